@@ -63,6 +63,8 @@ func main() {
 			go s.StartProcessSlackNotifications()
 			go s.StartProcessRequestLogs()
 			go s.StartProcessDeleteOldData()
+			go s.StartDeleteIntradayPrices()
+			go s.StartBackfillJobs()
 		}),
 	).Run()
 
@@ -68,6 +68,23 @@ func Models() []interface{} {
 		schema.AppToken{},
 		schema.Coins{},
 		schema.CoinHistoricalPrice{},
+		schema.RejectedPrice{},
+		schema.FxRate{},
+		schema.CexSymbol{},
+		schema.CoinCandle{},
+		schema.CoinMarketData{},
+		schema.CoinRequestCount{},
+		schema.BackfillJob{},
+	}
+}
+
+// list of statements run after migration, for indexes gorm tags cannot express
+func Statements() []string {
+	return []string{
+		// 代币搜索按 LOWER(symbol)、LOWER(name) 做 LIKE 匹配，三元组索引用于前缀匹配及包含关键字的查询
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_coins_symbol_trgm ON coins USING gin (LOWER(symbol) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_coins_name_trgm ON coins USING gin (LOWER(name) gin_trgm_ops)",
 	}
 }
 
@@ -78,6 +95,11 @@ func (_db *Database) MigrateModels() {
 	); err != nil {
 		_db.Log.Error().Err(err).Msg("An unknown error occurred when to migrate the database!")
 	}
+	for _, statement := range Statements() {
+		if err := _db.DB.Exec(statement).Error; err != nil {
+			_db.Log.Error().Err(err).Msgf("An unknown error occurred when to run %s!", statement)
+		}
+	}
 }
 
 // list of models for migration
@@ -0,0 +1,25 @@
+package schema
+
+import "time"
+
+type BackfillJob struct {
+	CoinIDs     JSONStrings `gorm:"type:json;notNull" json:"coin_ids"`                        // 需要回填的 coins ID，创建任务时确定
+	From        int64       `gorm:"column:from_time;type:bigint;notNull" json:"from"`         // 开始时间，unix
+	To          int64       `gorm:"column:to_time;type:bigint;notNull" json:"to"`             // 结束时间，unix
+	Granularity string      `gorm:"type:varchar(16);notNull;default:'1d'" json:"granularity"` // 1d / 1h / 5m
+	Status      string      `gorm:"type:varchar(32);notNull;index" json:"status"`             // pending / running / completed / cancelled
+	CoinIndex   int         `gorm:"type:int;notNull;default:0" json:"coin_index"`             // 检查点：正在回填的代币下标
+	Cursor      int64       `gorm:"type:bigint;notNull;default:0" json:"cursor"`              // 检查点：该代币下一段的开始时间，0 表示从 from 开始
+	Attempts    int         `gorm:"type:int;notNull;default:0" json:"attempts"`               // 当前段连续失败的次数
+	Filled      int64       `gorm:"type:bigint;notNull;default:0" json:"filled"`              // 已有价格的时间段数
+	Missing     int64       `gorm:"type:bigint;notNull;default:0" json:"missing"`             // 数据源都没有价格的时间段数
+	Skipped     int64       `gorm:"type:bigint;notNull;default:0" json:"skipped"`             // 多次失败后跳过的段数
+	LastError   string      `gorm:"type:text;notNull;default:''" json:"last_error"`           // 最近一次失败的原因
+	StartedAt   *time.Time  `json:"started_at"`
+	FinishedAt  *time.Time  `json:"finished_at"`
+	Base
+}
+
+func (BackfillJob) TableName() string {
+	return "backfill_jobs"
+}
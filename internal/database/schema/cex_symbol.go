@@ -0,0 +1,7 @@
+package schema
+
+type CexSymbol struct {
+	CoinID string `gorm:"type:varchar(255);notNull;uniqueIndex" json:"coin_id"` // coin id
+	Symbol string `gorm:"type:varchar(255);notNull" json:"symbol"`              // exchange pair, e.g. BTCUSDT
+	Base
+}
@@ -0,0 +1,14 @@
+package schema
+
+type CoinCandle struct {
+	CoinID    string `gorm:"type:varchar(255);notNull;uniqueIndex:unique_coin_candle" json:"coin_id"`  // coin id
+	Timeframe string `gorm:"type:varchar(16);notNull;uniqueIndex:unique_coin_candle" json:"timeframe"` // K 线周期 1d/1h
+	Timestamp int64  `gorm:"type:bigint;notNull;uniqueIndex:unique_coin_candle" json:"timestamp"`      // K 线开始时间，UTC 对齐
+	Open      string `gorm:"type:varchar(255);notNull" json:"open"`                                    // open
+	High      string `gorm:"type:varchar(255);notNull" json:"high"`                                    // high
+	Low       string `gorm:"type:varchar(255);notNull" json:"low"`                                     // low
+	Close     string `gorm:"type:varchar(255);notNull" json:"close"`                                   // close
+	Volume    string `gorm:"type:varchar(255);notNull;default:'0'" json:"volume"`                      // 成交额，USD
+	Source    string `gorm:"type:varchar(255);notNull;default:''" json:"source"`                       // data source
+	Base
+}
@@ -1,11 +1,12 @@
 package schema
 
 type CoinHistoricalPrice struct {
-	CoinID    string  `gorm:"type:varchar(255);notNull" json:"coin_id"`           // coin id
-	Date      int64   `gorm:"type:bigint;notNull" json:"date"`                    // unix date
-	DayDate   string  `gorm:"type:varchar(255);notNull" json:"day_date"`          // day date
-	Price     string  `gorm:"type:varchar(255);notNull" json:"price"`             // price
-	Source    string  `gorm:"type:varchar(255);notNull;default:''" json:"source"` // data source
-	QueryInfo *string `gorm:"type:json" json:"query_info"`                        // query info
+	CoinID      string  `gorm:"type:varchar(255);notNull" json:"coin_id"`                 // coin id
+	Date        int64   `gorm:"type:bigint;notNull" json:"date"`                          // unix date
+	DayDate     string  `gorm:"type:varchar(255);notNull" json:"day_date"`                // day date，小时及 5 分钟粒度为对应时间段
+	Granularity string  `gorm:"type:varchar(16);notNull;default:'1d'" json:"granularity"` // 粒度 1d/1h/5m
+	Price       string  `gorm:"type:varchar(255);notNull" json:"price"`                   // price
+	Source      string  `gorm:"type:varchar(255);notNull;default:''" json:"source"`       // data source
+	QueryInfo   *string `gorm:"type:json" json:"query_info"`                              // query info
 	Base
 }
@@ -0,0 +1,17 @@
+package schema
+
+type CoinMarketData struct {
+	CoinID                string  `gorm:"type:varchar(255);notNull;uniqueIndex:unique_coin_market_data" json:"coin_id"`  // coin id
+	Date                  int64   `gorm:"type:bigint;notNull" json:"date"`                                               // unix date，最后一次更新的时间
+	DayDate               string  `gorm:"type:varchar(255);notNull;uniqueIndex:unique_coin_market_data" json:"day_date"` // day date
+	MarketCap             *string `gorm:"type:varchar(255)" json:"market_cap"`                                           // 流通市值，USD
+	FullyDilutedValuation *string `gorm:"type:varchar(255)" json:"fully_diluted_valuation"`                              // 完全稀释估值，USD
+	Volume24h             *string `gorm:"type:varchar(255)" json:"volume_24h"`                                           // 24 小时成交额，USD
+	Liquidity             *string `gorm:"type:varchar(255)" json:"liquidity"`                                            // 池子流动性，USD
+	Source                string  `gorm:"type:varchar(255);notNull;default:''" json:"source"`                            // data source
+	Base
+}
+
+func (CoinMarketData) TableName() string {
+	return "coin_market_data"
+}
@@ -0,0 +1,12 @@
+package schema
+
+type CoinRequestCount struct {
+	CoinID string `gorm:"type:varchar(255);notNull;uniqueIndex:unique_coin_request_count" json:"coin_id"` // coin id
+	Date   int64  `gorm:"type:bigint;notNull;uniqueIndex:unique_coin_request_count;index" json:"date"`    // 当天 0 点的 unix 时间
+	Count  int64  `gorm:"type:bigint;notNull;default:0" json:"count"`                                     // 当天的请求次数
+	Base
+}
+
+func (CoinRequestCount) TableName() string {
+	return "coin_request_counts"
+}
@@ -23,5 +23,7 @@ type Coins struct {
 	LastPriceSource      *string    `gorm:"type:varchar(255)" json:"last_price_source"`              // 上次价格查询结果来源
 	PriceSource          *string    `gorm:"type:varchar(255)" json:"price_source"`                   // 价格查询来源
 	ReturnCoinsId        *string    `gorm:"type:varchar(255)" json:"return_coins_id"`                // 返回的coins ID
+	WrapperRule          *string    `gorm:"type:json" json:"wrapper_rule"`                           // 包装代币规则，按底层代币价格 × 汇率计算价格
+	Formula              *string    `gorm:"type:text" json:"formula"`                                // 合成价格公式，例如 0.5*price(1_0xa) + 0.5*price(1_0xb)
 	Base
 }
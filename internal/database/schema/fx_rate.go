@@ -0,0 +1,10 @@
+package schema
+
+type FxRate struct {
+	Currency string `gorm:"type:varchar(32);notNull;uniqueIndex:unique_fx_currency_day_date" json:"currency"`  // quote currency, lower case
+	Rate     string `gorm:"type:varchar(255);notNull" json:"rate"`                                             // units of currency per 1 USD
+	Date     int64  `gorm:"type:bigint;notNull" json:"date"`                                                   // unix date
+	DayDate  string `gorm:"type:varchar(255);notNull;uniqueIndex:unique_fx_currency_day_date" json:"day_date"` // day date
+	Source   string `gorm:"type:varchar(255);notNull;default:''" json:"source"`                                // data source
+	Base
+}
@@ -31,3 +31,32 @@ func (m *JSONMap) Scan(value interface{}) error {
 
 	return json.Unmarshal(bytes, m)
 }
+
+// JSONStrings is a custom type for handling []string JSON fields in GORM
+type JSONStrings []string
+
+// Value implements the driver.Valuer interface
+func (s JSONStrings) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal([]string(s))
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (s *JSONStrings) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = JSONStrings{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	}
+	return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type *JSONStrings", value)
+}
@@ -0,0 +1,13 @@
+package schema
+
+type RejectedPrice struct {
+	CoinID         string  `gorm:"type:varchar(255);notNull;index" json:"coin_id"`   // coin id
+	Source         string  `gorm:"type:varchar(255);notNull" json:"source"`          // data source
+	Price          string  `gorm:"type:varchar(255);notNull" json:"price"`           // rejected price
+	ReferencePrice string  `gorm:"type:varchar(255);notNull" json:"reference_price"` // last known price
+	Deviation      float64 `gorm:"type:double precision;notNull" json:"deviation"`   // deviation percent
+	Tier           string  `gorm:"type:varchar(255);notNull;default:''" json:"tier"` // token tier
+	Mode           string  `gorm:"type:varchar(255);notNull;default:''" json:"mode"` // reject / quarantine
+	Date           int64   `gorm:"type:bigint;notNull" json:"date"`                  // unix date
+	Base
+}
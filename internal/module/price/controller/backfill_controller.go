@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/price/service"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/valyala/fasthttp"
+)
+
+type BackfillController interface {
+	AddJob(ctx *fasthttp.RequestCtx)
+	GetJob(ctx *fasthttp.RequestCtx)
+	GetJobs(ctx *fasthttp.RequestCtx)
+	CancelJob(ctx *fasthttp.RequestCtx)
+}
+
+type backfillController struct {
+	backfillService service.BackfillService
+}
+
+func NewBackfillController(backfillService service.BackfillService) BackfillController {
+	return &backfillController{
+		backfillService: backfillService,
+	}
+}
+
+func (c *backfillController) respond(ctx *fasthttp.RequestCtx, code int, data interface{}, message string) {
+	response := map[string]interface{}{
+		"code":    code,
+		"data":    data,
+		"message": message,
+	}
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		ctx.Error("Failed to serialize response ", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	ctx.Response.SetBody(responseBody)
+	ctx.Response.SetStatusCode(fasthttp.StatusOK)
+}
+
+// respondError 参数错误返回 400，其他错误返回 500
+func (c *backfillController) respondError(ctx *fasthttp.RequestCtx, err error, message string) {
+	var backfillErr *service.BackfillError
+	if errors.As(err, &backfillErr) {
+		c.respond(ctx, 400, nil, err.Error())
+		return
+	}
+	c.respond(ctx, 500, nil, message)
+}
+
+// AddJob 创建历史价格回填任务，由定时任务在后台执行
+func (c *backfillController) AddJob(ctx *fasthttp.RequestCtx) {
+	var requestData struct {
+		CoinIds     []string    `json:"coinIds"`
+		ChainIds    []string    `json:"chainIds"`
+		Networks    []string    `json:"networks"`
+		From        interface{} `json:"from"`
+		To          interface{} `json:"to"`
+		Granularity string      `json:"granularity"`
+	}
+	if err := json.Unmarshal(ctx.PostBody(), &requestData); err != nil {
+		c.respond(ctx, 400, nil, "Failed to parse request body")
+		return
+	}
+	request := service.BackfillRequest{
+		CoinIDs:     requestData.CoinIds,
+		ChainIDs:    requestData.ChainIds,
+		Granularity: requestData.Granularity,
+	}
+	for _, network := range requestData.Networks {
+		chainID, err := shared.GetChainID(network)
+		if err != nil {
+			c.respond(ctx, 400, nil, fmt.Sprintf("%s Unsupported network", network))
+			return
+		}
+		request.ChainIDs = append(request.ChainIDs, chainID)
+	}
+	var err error
+	if request.From, err = parseDateValue(requestData.From); err != nil {
+		c.respond(ctx, 400, nil, "invalid from: "+err.Error())
+		return
+	}
+	if requestData.To != nil {
+		if request.To, err = parseDateValue(requestData.To); err != nil {
+			c.respond(ctx, 400, nil, "invalid to: "+err.Error())
+			return
+		}
+	}
+
+	job, err := c.backfillService.CreateJob(request)
+	if err != nil {
+		c.respondError(ctx, err, "Failed to create backfill job")
+		return
+	}
+	c.respond(ctx, 200, job, "Backfill job created successfully")
+}
+
+func (c *backfillController) GetJob(ctx *fasthttp.RequestCtx) {
+	id, err := strconv.ParseUint(ctx.UserValue("id").(string), 10, 64)
+	if err != nil {
+		c.respond(ctx, 400, nil, "invalid job id")
+		return
+	}
+	job, err := c.backfillService.GetJob(id)
+	if err != nil {
+		c.respondError(ctx, err, "Failed to retrieve backfill job")
+		return
+	}
+	c.respond(ctx, 200, job, "Backfill job retrieved successfully")
+}
+
+// GetJobs 返回最近创建的回填任务
+func (c *backfillController) GetJobs(ctx *fasthttp.RequestCtx) {
+	limit, _ := strconv.Atoi(string(ctx.QueryArgs().Peek("limit")))
+	jobs, err := c.backfillService.ListJobs(limit)
+	if err != nil {
+		c.respond(ctx, 500, nil, "Failed to retrieve backfill jobs")
+		return
+	}
+	c.respond(ctx, 200, jobs, "Backfill jobs retrieved successfully")
+}
+
+func (c *backfillController) CancelJob(ctx *fasthttp.RequestCtx) {
+	id, err := strconv.ParseUint(ctx.UserValue("id").(string), 10, 64)
+	if err != nil {
+		c.respond(ctx, 400, nil, "invalid job id")
+		return
+	}
+	job, err := c.backfillService.CancelJob(id)
+	if err != nil {
+		c.respondError(ctx, err, "Failed to cancel backfill job")
+		return
+	}
+	c.respond(ctx, 200, job, "Backfill job cancelled successfully")
+}
@@ -2,6 +2,9 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/DODOEX/token-price-proxy/internal/database/schema"
 	"github.com/DODOEX/token-price-proxy/internal/module/price/service"
@@ -17,6 +20,7 @@ type CoinsController interface {
 	DeleteRedisKey(ctx *fasthttp.RequestCtx)
 	RefreshAllCoinsCache(ctx *fasthttp.RequestCtx)
 	RefreshCoinListCache(ctx *fasthttp.RequestCtx)
+	SearchCoins(ctx *fasthttp.RequestCtx)
 }
 
 type coinsController struct {
@@ -57,6 +61,11 @@ func (c *coinsController) AddCoin(ctx *fasthttp.RequestCtx) {
 	}
 
 	if err := c.coinsService.AddCoin(coin); err != nil {
+		var formulaErr *service.FormulaError
+		if errors.As(err, &formulaErr) {
+			c.respond(ctx, 400, nil, err.Error())
+			return
+		}
 		c.respond(ctx, 500, nil, "Failed to add token")
 		return
 	}
@@ -74,6 +83,11 @@ func (c *coinsController) UpdateCoin(ctx *fasthttp.RequestCtx) {
 	}
 
 	if err := c.coinsService.UpdateCoin(id, coin); err != nil {
+		var formulaErr *service.FormulaError
+		if errors.As(err, &formulaErr) {
+			c.respond(ctx, 400, nil, err.Error())
+			return
+		}
 		c.respond(ctx, 500, nil, "Failed to update token")
 		return
 	}
@@ -140,3 +154,48 @@ func (c *coinsController) RefreshCoinListCache(ctx *fasthttp.RequestCtx) {
 	}
 	c.respond(ctx, 200, nil, "Cache refreshed successfully")
 }
+
+// SearchCoins 按 symbol 或 name 搜索代币，可按链及 label 过滤
+func (c *coinsController) SearchCoins(ctx *fasthttp.RequestCtx) {
+	args := ctx.QueryArgs()
+	params := service.CoinSearchParams{
+		Query:    string(args.Peek("q")),
+		Match:    string(args.Peek("match")),
+		ChainIDs: convertQueryArgsToStringSlice(args.PeekMulti("chainIds")),
+		Label:    string(args.Peek("label")),
+	}
+	for _, network := range convertQueryArgsToStringSlice(args.PeekMulti("networks")) {
+		chainID, err := shared.GetChainID(network)
+		if err != nil {
+			c.respond(ctx, 400, nil, fmt.Sprintf("%s Unsupported network", network))
+			return
+		}
+		params.ChainIDs = append(params.ChainIDs, chainID)
+	}
+	for _, arg := range []struct {
+		name   string
+		target *int
+	}{{"page", &params.Page}, {"pageSize", &params.PageSize}} {
+		if value := args.Peek(arg.name); len(value) > 0 {
+			parsed, err := strconv.Atoi(string(value))
+			if err != nil {
+				c.respond(ctx, 400, nil, "invalid "+arg.name)
+				return
+			}
+			*arg.target = parsed
+		}
+	}
+
+	page, err := c.coinsService.SearchCoins(params)
+	if err != nil {
+		var searchErr *service.CoinSearchError
+		if errors.As(err, &searchErr) {
+			c.respond(ctx, 400, nil, err.Error())
+			return
+		}
+		c.respond(ctx, 500, nil, "Failed to search tokens")
+		return
+	}
+
+	c.respond(ctx, 200, page, "Tokens retrieved successfully")
+}
@@ -8,22 +8,29 @@ import (
 )
 
 type Controller struct {
-	Price PriceController
-	Coins CoinsController
-	Token AppTokenController
+	Price    PriceController
+	Coins    CoinsController
+	Token    AppTokenController
+	Backfill BackfillController
 }
 
 func NewController(
 	priceService service.PriceService,
+	priceGuardService service.PriceGuardService,
+	fxService service.FxService,
+	dodoPoolService service.DodoPoolService,
 	coingeckoService service.CoinGeckoService,
+	tokenMetadataService service.TokenMetadataService,
 	coinsService service.CoinsService,
 	appTokenService service.AppTokenService,
+	backfillService service.BackfillService,
 	requestLogRepo repository.RequestLogRepository,
 	redisClient *shared.RedisClient,
 	logger zerolog.Logger) *Controller {
 	return &Controller{
-		Price: NewPriceController(priceService, coingeckoService, requestLogRepo, logger),
-		Coins: NewCoinsController(coinsService, redisClient),
-		Token: NewAppTokenController(appTokenService),
+		Price:    NewPriceController(priceService, priceGuardService, fxService, dodoPoolService, coingeckoService, tokenMetadataService, requestLogRepo, logger),
+		Coins:    NewCoinsController(coinsService, redisClient),
+		Token:    NewAppTokenController(appTokenService),
+		Backfill: NewBackfillController(backfillService),
 	}
 }
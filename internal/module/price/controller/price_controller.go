@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -16,27 +17,42 @@ import (
 )
 
 type priceController struct {
-	coinGeckoService service.CoinGeckoService
-	priceService     service.PriceService
-	requestLogRepo   repository.RequestLogRepository
-	logger           zerolog.Logger
+	coinGeckoService     service.CoinGeckoService
+	priceService         service.PriceService
+	priceGuardService    service.PriceGuardService
+	fxService            service.FxService
+	dodoPoolService      service.DodoPoolService
+	tokenMetadataService service.TokenMetadataService
+	requestLogRepo       repository.RequestLogRepository
+	logger               zerolog.Logger
 }
 
 type PriceController interface {
 	GetCoinList(ctx *fasthttp.RequestCtx)
 	SyncCoins(ctx *fasthttp.RequestCtx)
 	GetBatchPrice(ctx *fasthttp.RequestCtx)
+	GetBatchPriceChange(ctx *fasthttp.RequestCtx)
+	GetBatchMarketData(ctx *fasthttp.RequestCtx)
 	GetBatchHistoricalPrice(ctx *fasthttp.RequestCtx)
 	GetPrice(ctx *fasthttp.RequestCtx)
 	GetHistoricalPrice(ctx *fasthttp.RequestCtx)
+	GetHistoricalPriceRange(ctx *fasthttp.RequestCtx)
+	GetOhlcv(ctx *fasthttp.RequestCtx)
+	GetRejectedPrices(ctx *fasthttp.RequestCtx)
+	GetDodoPoolPrices(ctx *fasthttp.RequestCtx)
+	GetTokens(ctx *fasthttp.RequestCtx)
 }
 
-func NewPriceController(priceService service.PriceService, coinGeckoService service.CoinGeckoService, requestLogRepo repository.RequestLogRepository, logger zerolog.Logger) PriceController {
+func NewPriceController(priceService service.PriceService, priceGuardService service.PriceGuardService, fxService service.FxService, dodoPoolService service.DodoPoolService, coinGeckoService service.CoinGeckoService, tokenMetadataService service.TokenMetadataService, requestLogRepo repository.RequestLogRepository, logger zerolog.Logger) PriceController {
 	return &priceController{
-		coinGeckoService: coinGeckoService,
-		priceService:     priceService,
-		requestLogRepo:   requestLogRepo,
-		logger:           logger,
+		coinGeckoService:     coinGeckoService,
+		priceService:         priceService,
+		priceGuardService:    priceGuardService,
+		fxService:            fxService,
+		dodoPoolService:      dodoPoolService,
+		tokenMetadataService: tokenMetadataService,
+		requestLogRepo:       requestLogRepo,
+		logger:               logger,
 	}
 }
 
@@ -111,22 +127,48 @@ func (_i *priceController) SyncCoins(ctx *fasthttp.RequestCtx) {
 }
 
 func (_i *priceController) GetBatchPrice(ctx *fasthttp.RequestCtx) {
+	_i.batchPrice(ctx, "GetBatchPrice", false, false)
+}
+
+// GetBatchPriceChange 返回批量代币的当前价格及各时间窗口的涨跌幅
+func (_i *priceController) GetBatchPriceChange(ctx *fasthttp.RequestCtx) {
+	_i.batchPrice(ctx, "GetBatchPriceChange", true, false)
+}
+
+// GetBatchMarketData 返回批量代币的当前价格及市值、FDV、24 小时成交额和流动性
+func (_i *priceController) GetBatchMarketData(ctx *fasthttp.RequestCtx) {
+	_i.batchPrice(ctx, "GetBatchMarketData", false, true)
+}
+
+// batchPrice withChanges 为 true 时额外返回 windows 中各时间窗口的涨跌幅，
+// withMarketData 为 true 时总是返回市场数据，否则由请求中的 marketData 参数决定
+func (_i *priceController) batchPrice(ctx *fasthttp.RequestCtx, endpoint string, withChanges bool, withMarketData bool) {
 	_i.withTimeout(ctx, func(c context.Context) error {
 		startTime := time.Now()
-		var addresses, chainIds, symbols, networks []string
+		var addresses, chainIds, symbols, networks, assetIds, windows []string
 		var isCache bool = true // 默认值为 true
 		var excludeRoute bool = true
+		var provenance, caip bool
+		marketData := withMarketData
+		var currency string
 		defer func() {
-			_i.logger.Debug().Dur("execution_time", time.Since(startTime)).Msg("GetBatchPrice executed")
+			_i.logger.Debug().Dur("execution_time", time.Since(startTime)).Msg(endpoint + " executed")
 
 			// 创建请求参数的 map
 			requestParamsMap := map[string]interface{}{
 				"addresses":    addresses,
+				"assetIds":     assetIds,
 				"networks":     networks,
 				"chainIds":     chainIds,
 				"symbols":      symbols,
 				"isCache":      isCache,
 				"excludeRoute": excludeRoute,
+				"provenance":   provenance,
+				"marketData":   marketData,
+				"currency":     currency,
+			}
+			if withChanges {
+				requestParamsMap["windows"] = windows
 			}
 
 			// 将请求参数 map 转换为 JSON
@@ -135,7 +177,7 @@ func (_i *priceController) GetBatchPrice(ctx *fasthttp.RequestCtx) {
 				_i.logger.Error().Err(err).Msg("JSON marshaling of requestParams failed")
 			} else {
 				requestParams := string(requestParamsJSON)
-				_i.logRequest(ctx, "GetBatchPrice", requestParams, string(ctx.Response.Body()), time.Since(startTime).Milliseconds())
+				_i.logRequest(ctx, endpoint, requestParams, string(ctx.Response.Body()), time.Since(startTime).Milliseconds())
 			}
 		}()
 
@@ -144,20 +186,32 @@ func (_i *priceController) GetBatchPrice(ctx *fasthttp.RequestCtx) {
 			networks = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("networks"))
 			symbols = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("symbols"))
 			chainIds = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("chainIds"))
+			assetIds = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("assetIds"))
+			caip = string(ctx.QueryArgs().Peek("caip")) == "true"
 			if ctx.QueryArgs().Has("isCache") {
 				isCache = string(ctx.QueryArgs().Peek("isCache")) != "false"
 			}
 			if ctx.QueryArgs().Has("excludeRoute") {
 				excludeRoute = string(ctx.QueryArgs().Peek("excludeRoute")) != "false"
 			}
+			provenance = string(ctx.QueryArgs().Peek("provenance")) == "true"
+			marketData = marketData || string(ctx.QueryArgs().Peek("marketData")) == "true"
+			currency = string(ctx.QueryArgs().Peek("currency"))
+			windows = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("windows"))
 		} else if string(ctx.Method()) == fasthttp.MethodPost {
 			var requestData struct {
 				Addresses    []string `json:"addresses"`
 				Networks     []string `json:"networks"`
 				Symbols      []string `json:"symbols"`
 				ChainIds     []string `json:"chainIds"`
+				AssetIds     []string `json:"assetIds"`
+				Caip         bool     `json:"caip"`
 				IsCache      *bool    `json:"isCache"`
 				ExcludeRoute *bool    `json:"excludeRoute"`
+				Provenance   bool     `json:"provenance"`
+				MarketData   bool     `json:"marketData"`
+				Currency     string   `json:"currency"`
+				Windows      []string `json:"windows"`
 			}
 			if err := json.Unmarshal(ctx.PostBody(), &requestData); err != nil {
 				return err
@@ -166,52 +220,69 @@ func (_i *priceController) GetBatchPrice(ctx *fasthttp.RequestCtx) {
 			networks = requestData.Networks
 			symbols = requestData.Symbols
 			chainIds = requestData.ChainIds
+			assetIds = requestData.AssetIds
+			caip = requestData.Caip
 			if requestData.IsCache != nil {
 				isCache = *requestData.IsCache
 			}
 			if requestData.ExcludeRoute != nil {
 				excludeRoute = *requestData.ExcludeRoute
 			}
+			provenance = requestData.Provenance
+			marketData = marketData || requestData.MarketData
+			currency = requestData.Currency
+			windows = requestData.Windows
 		} else {
 			return fmt.Errorf("Method not supported" + string(ctx.Method()))
 		}
-
-		if len(chainIds) == 0 && len(networks) > 0 {
-			chainIds = make([]string, len(networks))
-			for i, network := range networks {
-				chainId, err := shared.GetChainID(network)
-				if err != nil {
-					return fmt.Errorf("%s Unsupported network", network)
-				}
-				chainIds[i] = chainId
-			}
-		} else if len(networks) == 0 && len(chainIds) > 0 {
-			networks = make([]string, len(chainIds))
-			for i, chainId := range chainIds {
-				network, err := shared.GetChainName(chainId)
-				if err != nil {
-					return fmt.Errorf("%s Unsupported network", chainId)
-				}
-				networks[i] = network
+		currency, err := _i.fxService.NormalizeCurrency(currency)
+		if err != nil {
+			return err
+		}
+		if withChanges {
+			if windows, err = service.ParsePriceChangeWindows(windows); err != nil {
+				_i.respond(ctx, 400, nil, err.Error())
+				return nil
 			}
 		}
+		// 按 CAIP-19 资产 ID 请求时忽略 addresses / networks / chainIds
+		var assetInvalid map[int]error
+		if len(assetIds) > 0 {
+			addresses, networks, assetInvalid = parseAssetIds(assetIds)
+			chainIds = nil
+		}
 
-		if len(addresses) != len(networks) {
-			return fmt.Errorf("the lengths of the addresses and networks arrays must be the same")
+		chainIds, networks, err = resolveChains(addresses, chainIds, networks)
+		if err != nil {
+			return err
 		}
 
-		chainIds = make([]string, len(networks))
-		for i, network := range networks {
-			chainId, err := shared.GetChainID(network)
+		// 无效地址单独返回错误，不再查询价格
+		canonical, valid, invalid := canonicalizeAddresses(chainIds, networks, addresses, assetInvalid)
+		var prices []service.PriceResult
+		if len(valid) > 0 {
+			prices, err = _i.priceService.GetBatchPrice(c, shared.Pick(chainIds, valid), shared.Pick(canonical, valid), shared.Pick(symbols, valid), shared.Pick(networks, valid), isCache, excludeRoute)
 			if err != nil {
-				return fmt.Errorf("%s Unsupported network", network)
+				return err
 			}
-			chainIds[i] = chainId
+			if withChanges {
+				// 涨跌幅按 USD 价格计算，不受计价货币影响
+				_i.priceService.FillPriceChanges(prices, windows)
+			}
+			if marketData {
+				_i.priceService.FillMarketData(c, prices, nil)
+			}
+			prices = _i.fxService.ConvertResults(currency, prices, nil)
 		}
-
-		prices, err := _i.priceService.GetBatchPrice(c, chainIds, addresses, symbols, networks, isCache, excludeRoute)
-		if err != nil {
-			return err
+		prices = mergeResults(addresses, chainIds, symbols, networks, valid, prices, invalid)
+		if caip || len(assetIds) > 0 {
+			withAssetIds(prices, assetIds, canonical)
+		}
+		if !provenance {
+			stripProvenance(prices)
+		}
+		if !marketData {
+			stripMarketData(prices)
 		}
 		_i.respond(ctx, 0, prices, "Request successful")
 		return nil
@@ -221,19 +292,26 @@ func (_i *priceController) GetBatchPrice(ctx *fasthttp.RequestCtx) {
 func (_i *priceController) GetBatchHistoricalPrice(ctx *fasthttp.RequestCtx) {
 	_i.withTimeout(ctx, func(c context.Context) error {
 		startTime := time.Now()
-		var addresses, chainIds, symbols, networks, datesStr []string
+		var addresses, chainIds, symbols, networks, datesStr, assetIds []string
 		var dates []int64
+		var provenance, caip, marketData bool
+		var currency, granularity string
 
 		defer func() {
 			_i.logger.Debug().Dur("execution_time", time.Since(startTime)).Msg("GetBatchHistoricalPrice executed")
 
 			// 创建请求参数的 map
 			requestParamsMap := map[string]interface{}{
-				"addresses": addresses,
-				"chainIds":  chainIds,
-				"networks":  networks,
-				"symbols":   symbols,
-				"dates":     dates,
+				"addresses":   addresses,
+				"assetIds":    assetIds,
+				"chainIds":    chainIds,
+				"networks":    networks,
+				"symbols":     symbols,
+				"dates":       dates,
+				"provenance":  provenance,
+				"marketData":  marketData,
+				"currency":    currency,
+				"granularity": granularity,
 			}
 
 			// 将请求参数 map 转换为 JSON
@@ -251,7 +329,9 @@ func (_i *priceController) GetBatchHistoricalPrice(ctx *fasthttp.RequestCtx) {
 			networks = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("networks"))
 			symbols = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("symbols"))
 			chainIds = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("chainIds"))
-			datesStr := convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("dates"))
+			assetIds = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("assetIds"))
+			caip = string(ctx.QueryArgs().Peek("caip")) == "true"
+			datesStr = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("dates"))
 			dates = make([]int64, len(datesStr))
 			for i, ds := range datesStr {
 				if len(ds) == 10 && ds[4] == '-' && ds[7] == '-' {
@@ -268,13 +348,23 @@ func (_i *priceController) GetBatchHistoricalPrice(ctx *fasthttp.RequestCtx) {
 					dates[i] = date
 				}
 			}
+			provenance = string(ctx.QueryArgs().Peek("provenance")) == "true"
+			marketData = string(ctx.QueryArgs().Peek("marketData")) == "true"
+			currency = string(ctx.QueryArgs().Peek("currency"))
+			granularity = string(ctx.QueryArgs().Peek("granularity"))
 		} else if string(ctx.Method()) == fasthttp.MethodPost {
 			var requestData struct {
-				Addresses []string      `json:"addresses"`
-				Networks  []string      `json:"networks"`
-				ChainIds  []string      `json:"chainIds"`
-				Symbols   []string      `json:"symbols"`
-				Dates     []interface{} `json:"dates"`
+				Addresses   []string      `json:"addresses"`
+				Networks    []string      `json:"networks"`
+				ChainIds    []string      `json:"chainIds"`
+				AssetIds    []string      `json:"assetIds"`
+				Caip        bool          `json:"caip"`
+				Symbols     []string      `json:"symbols"`
+				Dates       []interface{} `json:"dates"`
+				Provenance  bool          `json:"provenance"`
+				MarketData  bool          `json:"marketData"`
+				Currency    string        `json:"currency"`
+				Granularity string        `json:"granularity"`
 			}
 			if err := json.Unmarshal(ctx.PostBody(), &requestData); err != nil {
 				return err
@@ -282,7 +372,13 @@ func (_i *priceController) GetBatchHistoricalPrice(ctx *fasthttp.RequestCtx) {
 			addresses = requestData.Addresses
 			networks = requestData.Networks
 			chainIds = requestData.ChainIds
+			assetIds = requestData.AssetIds
+			caip = requestData.Caip
 			symbols = requestData.Symbols
+			provenance = requestData.Provenance
+			marketData = requestData.MarketData
+			currency = requestData.Currency
+			granularity = requestData.Granularity
 			datesStr = make([]string, len(requestData.Dates))
 			dates = make([]int64, len(requestData.Dates))
 			for i, d := range requestData.Dates {
@@ -312,42 +408,49 @@ func (_i *priceController) GetBatchHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		} else {
 			return fmt.Errorf("Method not supported" + string(ctx.Method()))
 		}
-		if len(chainIds) == 0 && len(networks) > 0 {
-			chainIds = make([]string, len(networks))
-			for i, network := range networks {
-				chainId, err := shared.GetChainID(network)
-				if err != nil {
-					return fmt.Errorf("%s Unsupported network", network)
-				}
-				chainIds[i] = chainId
-			}
-		} else if len(networks) == 0 && len(chainIds) > 0 {
-			networks = make([]string, len(chainIds))
-			for i, chainId := range chainIds {
-				network, err := shared.GetChainName(chainId)
-				if err != nil {
-					return fmt.Errorf("%s Unsupported network", chainId)
-				}
-				networks[i] = network
-			}
+		currency, err := _i.fxService.NormalizeCurrency(currency)
+		if err != nil {
+			return err
 		}
-
-		if len(addresses) != len(networks) || len(networks) != len(dates) {
-			return fmt.Errorf("the lengths of the addresses and networks arrays must be the same")
+		granularity, err = shared.ParseGranularity(granularity)
+		if err != nil {
+			return err
+		}
+		var assetInvalid map[int]error
+		if len(assetIds) > 0 {
+			addresses, networks, assetInvalid = parseAssetIds(assetIds)
+			chainIds = nil
+		}
+		chainIds, networks, err = resolveChains(addresses, chainIds, networks)
+		if err != nil {
+			return err
+		}
+		if len(networks) != len(dates) {
+			return fmt.Errorf("the lengths of the addresses and dates arrays must be the same")
 		}
 
-		chainIds = make([]string, len(networks))
-		for i, network := range networks {
-			chainId, err := shared.GetChainID(network)
+		canonical, valid, invalid := canonicalizeAddresses(chainIds, networks, addresses, assetInvalid)
+		var results []service.PriceResult
+		if len(valid) > 0 {
+			validDates := shared.Pick(dates, valid)
+			results, err = _i.priceService.GetBatchHistoricalPrice(shared.Pick(chainIds, valid), shared.Pick(canonical, valid), shared.Pick(symbols, valid), shared.Pick(networks, valid), validDates, shared.Pick(datesStr, valid), granularity)
 			if err != nil {
 				return err
 			}
-			chainIds[i] = chainId
+			if marketData {
+				_i.priceService.FillMarketData(c, results, validDates)
+			}
+			results = _i.fxService.ConvertResults(currency, results, validDates)
 		}
-
-		results, err := _i.priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, dates, datesStr)
-		if err != nil {
-			return err
+		results = mergeResults(addresses, chainIds, symbols, networks, valid, results, invalid)
+		if caip || len(assetIds) > 0 {
+			withAssetIds(results, assetIds, canonical)
+		}
+		if !provenance {
+			stripProvenance(results)
+		}
+		if !marketData {
+			stripMarketData(results)
 		}
 		_i.respond(ctx, 0, results, "Request successful")
 		return nil
@@ -359,6 +462,7 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 	var chainID, address, symbol, network string
 	var isCache bool = true // 默认值为 true
 	var excludeRoute bool = true
+	var currency string
 	defer func() {
 		_i.logger.Debug().Dur("execution_time", time.Since(startTime)).Msg("GetPrice executed")
 		// 创建请求参数的 map
@@ -369,6 +473,7 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 			"isCache":      isCache,
 			"chainId":      chainID,
 			"excludeRoute": excludeRoute,
+			"currency":     currency,
 		}
 
 		// 将请求参数 map 转换为 JSON
@@ -392,6 +497,7 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 		if ctx.QueryArgs().Has("excludeRoute") {
 			excludeRoute = string(ctx.QueryArgs().Peek("excludeRoute")) != "false"
 		}
+		currency = string(ctx.QueryArgs().Peek("currency"))
 	} else if string(ctx.Method()) == fasthttp.MethodPost {
 		var requestData struct {
 			Network      string `json:"network"`
@@ -400,6 +506,7 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 			Symbol       string `json:"symbol"`
 			IsCache      *bool  `json:"isCache"`
 			ExcludeRoute *bool  `json:"excludeRoute"`
+			Currency     string `json:"currency"`
 		}
 		if err := json.Unmarshal(ctx.PostBody(), &requestData); err != nil {
 			_i.respond(ctx, 500, nil, "failed to parse request body")
@@ -415,11 +522,17 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 		if requestData.ExcludeRoute != nil {
 			excludeRoute = *requestData.ExcludeRoute
 		}
+		currency = requestData.Currency
 	} else {
 		_i.respond(ctx, 500, nil, "Method not supported"+string(ctx.Method()))
 		return
 	}
-	if chainID == "" {
+	currency, err := _i.fxService.NormalizeCurrency(currency)
+	if err != nil {
+		_i.respond(ctx, 400, nil, err.Error())
+		return
+	}
+	if chainID == "" && network != "" {
 		chainIDNew, err := shared.GetChainID(network)
 		if err != nil {
 			_i.respond(ctx, 500, nil, network+" Unsupported network")
@@ -427,6 +540,11 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 		}
 		chainID = chainIDNew
 	}
+	chainID, canonical, err := shared.CanonicalAddress(chainID, address)
+	if err != nil {
+		_i.respond(ctx, 400, nil, err.Error())
+		return
+	}
 	if network == "" {
 		networkNew, err := shared.GetChainName(chainID)
 		if err != nil {
@@ -436,30 +554,42 @@ func (_i *priceController) GetPrice(ctx *fasthttp.RequestCtx) {
 		network = networkNew
 	}
 
-	price, err := _i.priceService.GetPrice(chainID, address, symbol, network, isCache, excludeRoute)
+	price, err := _i.priceService.GetPrice(chainID, canonical, symbol, network, isCache, excludeRoute)
 	if err != nil {
 		_i.logger.Err(err).Msg("GetPrice Failed to retrieve single price")
 		_i.respond(ctx, 500, nil, "Failed to retrieve single price")
 		return
 	}
+	price, err = _i.fxService.ConvertPrice(currency, price, 0)
+	if err != nil {
+		_i.logger.Err(err).Msg("GetPrice Failed to convert price")
+		if errors.Is(err, service.ErrUnsupportedCurrency) {
+			_i.respond(ctx, 400, nil, err.Error())
+			return
+		}
+		_i.respond(ctx, 500, nil, "Failed to convert price to "+currency)
+		return
+	}
 
 	_i.respond(ctx, 0, price, "Request successful")
 }
 
 func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 	startTime := time.Now()
-	var chainID, address, symbol, dateStr, network string
+	var chainID, address, symbol, dateStr, network, currency, granularity string
 	var date int64
 	defer func() {
 		_i.logger.Debug().Dur("execution_time", time.Since(startTime)).Msg("GetHistoricalPrice executed")
 
 		// 创建请求参数的 map
 		requestParamsMap := map[string]interface{}{
-			"network": network,
-			"chainId": chainID,
-			"address": address,
-			"symbol":  symbol,
-			"date":    date,
+			"network":     network,
+			"chainId":     chainID,
+			"address":     address,
+			"symbol":      symbol,
+			"date":        date,
+			"currency":    currency,
+			"granularity": granularity,
 		}
 		// 将请求参数 map 转换为 JSON
 		requestParamsJSON, err := json.Marshal(requestParamsMap)
@@ -478,6 +608,8 @@ func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		address = string(ctx.QueryArgs().Peek("address"))
 		symbol = string(ctx.QueryArgs().Peek("symbol"))
 		dateStr = string(ctx.QueryArgs().Peek("date"))
+		currency = string(ctx.QueryArgs().Peek("currency"))
+		granularity = string(ctx.QueryArgs().Peek("granularity"))
 		if len(dateStr) == 10 && dateStr[4] == '-' && dateStr[7] == '-' {
 			parsedDate, err := time.Parse("2006-01-02", dateStr)
 			if err != nil {
@@ -494,11 +626,13 @@ func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		}
 	} else if string(ctx.Method()) == fasthttp.MethodPost {
 		var requestData struct {
-			Network string      `json:"network"`
-			ChainID string      `json:"chainId"`
-			Address string      `json:"address"`
-			Symbol  string      `json:"symbol"`
-			Date    interface{} `json:"date"`
+			Network     string      `json:"network"`
+			ChainID     string      `json:"chainId"`
+			Address     string      `json:"address"`
+			Symbol      string      `json:"symbol"`
+			Date        interface{} `json:"date"`
+			Currency    string      `json:"currency"`
+			Granularity string      `json:"granularity"`
 		}
 		if err := json.Unmarshal(ctx.PostBody(), &requestData); err != nil {
 			_i.respond(ctx, 500, nil, "failed to parse request body")
@@ -508,6 +642,8 @@ func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		chainID = requestData.ChainID
 		address = requestData.Address
 		symbol = requestData.Symbol
+		currency = requestData.Currency
+		granularity = requestData.Granularity
 		switch v := requestData.Date.(type) {
 		case string:
 			if len(v) == 10 && v[4] == '-' && v[7] == '-' {
@@ -534,8 +670,18 @@ func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		_i.respond(ctx, 500, nil, "Method not supported"+string(ctx.Method()))
 		return
 	}
+	currency, err = _i.fxService.NormalizeCurrency(currency)
+	if err != nil {
+		_i.respond(ctx, 400, nil, err.Error())
+		return
+	}
+	granularity, err = shared.ParseGranularity(granularity)
+	if err != nil {
+		_i.respond(ctx, 400, nil, err.Error())
+		return
+	}
 
-	if chainID == "" {
+	if chainID == "" && network != "" {
 		chainIDNew, err := shared.GetChainID(network)
 		if err != nil {
 			_i.respond(ctx, 500, nil, network+" Unsupported network")
@@ -543,6 +689,11 @@ func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		}
 		chainID = chainIDNew
 	}
+	chainID, canonical, err := shared.CanonicalAddress(chainID, address)
+	if err != nil {
+		_i.respond(ctx, 400, nil, err.Error())
+		return
+	}
 	if network == "" {
 		networkNew, err := shared.GetChainName(chainID)
 		if err != nil {
@@ -552,16 +703,345 @@ func (_i *priceController) GetHistoricalPrice(ctx *fasthttp.RequestCtx) {
 		network = networkNew
 	}
 
-	price, err := _i.priceService.GetHistoricalPrice(chainID, address, symbol, network, date)
+	price, err := _i.priceService.GetHistoricalPrice(chainID, canonical, symbol, network, date, granularity)
 	if err != nil {
 		_i.logger.Err(err).Msg("GetHistoricalPrice Failed to retrieve historical price")
 		_i.respond(ctx, 500, nil, "Failed to retrieve historical price")
 		return
 	}
+	price, err = _i.fxService.ConvertPrice(currency, price, date)
+	if err != nil {
+		_i.logger.Err(err).Msg("GetHistoricalPrice Failed to convert price")
+		if errors.Is(err, service.ErrUnsupportedCurrency) {
+			_i.respond(ctx, 400, nil, err.Error())
+			return
+		}
+		_i.respond(ctx, 500, nil, "Failed to convert price to "+currency)
+		return
+	}
 
 	_i.respond(ctx, 0, price, "Request successful")
 }
 
+// rangeRequest 区间查询接口的请求参数，GET 使用查询参数，POST 使用 JSON
+type rangeRequest struct {
+	Network  string      `json:"network"`
+	ChainID  string      `json:"chainId"`
+	Address  string      `json:"address"`
+	From     interface{} `json:"from"`
+	To       interface{} `json:"to"`
+	Interval string      `json:"interval"`
+	Currency string      `json:"currency,omitempty"`
+}
+
+func readRangeRequest(ctx *fasthttp.RequestCtx) (*rangeRequest, error) {
+	request := &rangeRequest{}
+	if string(ctx.Method()) == fasthttp.MethodGet {
+		request.Network = string(ctx.QueryArgs().Peek("network"))
+		request.ChainID = string(ctx.QueryArgs().Peek("chainId"))
+		request.Address = string(ctx.QueryArgs().Peek("address"))
+		request.Interval = string(ctx.QueryArgs().Peek("interval"))
+		request.Currency = string(ctx.QueryArgs().Peek("currency"))
+		request.From = string(ctx.QueryArgs().Peek("from"))
+		if ctx.QueryArgs().Has("to") {
+			request.To = string(ctx.QueryArgs().Peek("to"))
+		}
+	} else if string(ctx.Method()) == fasthttp.MethodPost {
+		if err := json.Unmarshal(ctx.PostBody(), request); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("Method not supported" + string(ctx.Method()))
+	}
+	return request, nil
+}
+
+// resolve 解析日期及粒度并校验地址，返回实际使用的链 ID、规范化后的地址及时间范围
+func (r *rangeRequest) resolve(parseInterval func(string) (string, error)) (chainID, address string, from, to int64, err error) {
+	if from, err = parseDateValue(r.From); err == nil && r.To != nil {
+		to, err = parseDateValue(r.To)
+	}
+	if err != nil {
+		return
+	}
+	if r.Interval, err = parseInterval(r.Interval); err != nil {
+		return
+	}
+	chainID = r.ChainID
+	if chainID == "" && r.Network != "" {
+		if chainID, err = shared.GetChainID(r.Network); err != nil {
+			err = fmt.Errorf("%s Unsupported network", r.Network)
+			return
+		}
+	}
+	chainID, address, err = shared.CanonicalAddress(chainID, r.Address)
+	return
+}
+
+// logRangeRequest 记录区间查询接口的请求日志
+func (_i *priceController) logRangeRequest(ctx *fasthttp.RequestCtx, endpoint string, request *rangeRequest, startTime time.Time) {
+	_i.logger.Debug().Dur("execution_time", time.Since(startTime)).Msg(endpoint + " executed")
+	if request == nil {
+		return
+	}
+	requestParamsJSON, err := json.Marshal(request)
+	if err != nil {
+		_i.logger.Error().Err(err).Msg("JSON marshaling of requestParams failed")
+		return
+	}
+	_i.logRequest(ctx, endpoint, string(requestParamsJSON), string(ctx.Response.Body()), time.Since(startTime).Milliseconds())
+}
+
+// GetHistoricalPriceRange 返回代币在 from 到 to 之间按 interval 排列的历史价格
+func (_i *priceController) GetHistoricalPriceRange(ctx *fasthttp.RequestCtx) {
+	_i.withTimeout(ctx, func(c context.Context) error {
+		startTime := time.Now()
+		request, err := readRangeRequest(ctx)
+		defer func() { _i.logRangeRequest(ctx, "GetHistoricalPriceRange", request, startTime) }()
+		if err != nil {
+			return err
+		}
+
+		chainID, address, from, to, err := request.resolve(shared.ParseGranularity)
+		if err == nil {
+			request.Currency, err = _i.fxService.NormalizeCurrency(request.Currency)
+		}
+		if err != nil {
+			_i.respond(ctx, 400, nil, err.Error())
+			return nil
+		}
+
+		series, err := _i.priceService.GetHistoricalPriceRange(chainID, address, from, to, request.Interval)
+		if err != nil {
+			return err
+		}
+		if request.Currency != service.CurrencyUSD {
+			for i := range series.Prices {
+				price, err := _i.fxService.ConvertPrice(request.Currency, &series.Prices[i].Price, series.Prices[i].TimeStamp)
+				if err != nil {
+					return err
+				}
+				if price != nil {
+					series.Prices[i].Price = *price
+				}
+			}
+			series.Currency = request.Currency
+		}
+		_i.respond(ctx, 0, series, "Request successful")
+		return nil
+	})
+}
+
+// GetOhlcv 返回代币在 from 到 to 之间按天或按小时的 OHLCV K 线
+func (_i *priceController) GetOhlcv(ctx *fasthttp.RequestCtx) {
+	_i.withTimeout(ctx, func(c context.Context) error {
+		startTime := time.Now()
+		request, err := readRangeRequest(ctx)
+		defer func() { _i.logRangeRequest(ctx, "GetOhlcv", request, startTime) }()
+		if err != nil {
+			return err
+		}
+
+		chainID, address, from, to, err := request.resolve(shared.ParseCandleTimeframe)
+		if err != nil {
+			_i.respond(ctx, 400, nil, err.Error())
+			return nil
+		}
+
+		series, err := _i.priceService.GetOhlcv(chainID, address, from, to, request.Interval)
+		if err != nil {
+			return err
+		}
+		_i.respond(ctx, 0, series, "Request successful")
+		return nil
+	})
+}
+
+// GetTokens 返回批量代币的 symbol、name、decimals 及总供应量
+func (_i *priceController) GetTokens(ctx *fasthttp.RequestCtx) {
+	_i.withTimeout(ctx, func(c context.Context) error {
+		startTime := time.Now()
+		var addresses, chainIds, networks, assetIds []string
+		var caip bool
+		defer func() {
+			requestParamsJSON, err := json.Marshal(map[string]interface{}{
+				"addresses": addresses,
+				"assetIds":  assetIds,
+				"networks":  networks,
+				"chainIds":  chainIds,
+			})
+			if err != nil {
+				_i.logger.Error().Err(err).Msg("JSON marshaling of requestParams failed")
+				return
+			}
+			_i.logRequest(ctx, "GetTokens", string(requestParamsJSON), string(ctx.Response.Body()), time.Since(startTime).Milliseconds())
+		}()
+
+		if string(ctx.Method()) == fasthttp.MethodGet {
+			addresses = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("addresses"))
+			networks = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("networks"))
+			chainIds = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("chainIds"))
+			assetIds = convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("assetIds"))
+			caip = string(ctx.QueryArgs().Peek("caip")) == "true"
+		} else if string(ctx.Method()) == fasthttp.MethodPost {
+			var requestData struct {
+				Addresses []string `json:"addresses"`
+				Networks  []string `json:"networks"`
+				ChainIds  []string `json:"chainIds"`
+				AssetIds  []string `json:"assetIds"`
+				Caip      bool     `json:"caip"`
+			}
+			if err := json.Unmarshal(ctx.PostBody(), &requestData); err != nil {
+				return err
+			}
+			addresses = requestData.Addresses
+			networks = requestData.Networks
+			chainIds = requestData.ChainIds
+			assetIds = requestData.AssetIds
+			caip = requestData.Caip
+		} else {
+			return fmt.Errorf("Method not supported" + string(ctx.Method()))
+		}
+		var assetInvalid map[int]error
+		if len(assetIds) > 0 {
+			addresses, networks, assetInvalid = parseAssetIds(assetIds)
+			chainIds = nil
+		}
+		chainIds, networks, err := resolveChains(addresses, chainIds, networks)
+		if err != nil {
+			return err
+		}
+
+		canonical, valid, invalid := canonicalizeAddresses(chainIds, networks, addresses, assetInvalid)
+		tokens := make([]service.TokenMetadata, len(addresses))
+		for i, address := range addresses {
+			tokens[i] = service.TokenMetadata{ChainID: chainIds[i], Address: address, Serial: i}
+			if err, ok := invalid[i]; ok {
+				tokens[i].Error = err.Error()
+			}
+		}
+		if len(valid) > 0 {
+			results, err := _i.tokenMetadataService.GetTokens(shared.Pick(chainIds, valid), shared.Pick(canonical, valid))
+			if err != nil {
+				return err
+			}
+			for k, index := range valid {
+				results[k].Address = addresses[index]
+				results[k].Serial = index
+				tokens[index] = results[k]
+			}
+		}
+		for i := range tokens {
+			if i < len(assetIds) {
+				tokens[i].AssetID = assetIds[i]
+			} else if caip && tokens[i].Error == "" {
+				if assetId, err := shared.AssetID(tokens[i].ChainID, canonical[i]); err == nil {
+					tokens[i].AssetID = assetId
+				}
+			}
+		}
+		_i.respond(ctx, 0, tokens, "Request successful")
+		return nil
+	})
+}
+
+// parseDateValue 解析 YYYY-MM-DD 格式的日期或 UNIX 时间戳
+func parseDateValue(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case string:
+		if len(v) == 10 && v[4] == '-' && v[7] == '-' {
+			date, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse date: %s", v)
+			}
+			return date.Unix(), nil
+		}
+		date, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse date: %s", v)
+		}
+		return date, nil
+	case float64:
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf("invalid date format: %v", value)
+}
+
+// GetRejectedPrices 查询被价格校验拒绝的报价，供人工复核
+func (_i *priceController) GetRejectedPrices(ctx *fasthttp.RequestCtx) {
+	chainID := string(ctx.QueryArgs().Peek("chainId"))
+	address := string(ctx.QueryArgs().Peek("address"))
+	limit, _ := strconv.Atoi(string(ctx.QueryArgs().Peek("limit")))
+	if chainID == "" && ctx.QueryArgs().Has("network") {
+		chainIDNew, err := shared.GetChainID(string(ctx.QueryArgs().Peek("network")))
+		if err != nil {
+			_i.respond(ctx, 500, nil, string(ctx.QueryArgs().Peek("network"))+" Unsupported network")
+			return
+		}
+		chainID = chainIDNew
+	}
+	coinID := ""
+	if chainID != "" && address != "" {
+		coinID = shared.CoinID(chainID, address)
+	}
+
+	prices, err := _i.priceGuardService.RejectedPrices(coinID, limit)
+	if err != nil {
+		_i.logger.Err(err).Msg("GetRejectedPrices Failed to retrieve rejected prices")
+		_i.respond(ctx, 500, nil, "Failed to retrieve rejected prices")
+		return
+	}
+	_i.respond(ctx, 0, prices, "Request successful")
+}
+
+// GetDodoPoolPrices 按 DODO V2 池子的中间价查询价格，指定 blockNumber 时读取该区块的池子状态
+func (_i *priceController) GetDodoPoolPrices(ctx *fasthttp.RequestCtx) {
+	chainID := string(ctx.QueryArgs().Peek("chainId"))
+	if chainID == "" && ctx.QueryArgs().Has("network") {
+		chainIDNew, err := shared.GetChainID(string(ctx.QueryArgs().Peek("network")))
+		if err != nil {
+			_i.respond(ctx, 500, nil, string(ctx.QueryArgs().Peek("network"))+" Unsupported network")
+			return
+		}
+		chainID = chainIDNew
+	}
+	addresses := convertQueryArgsToStringSlice(ctx.QueryArgs().PeekMulti("addresses"))
+	if chainID == "" || len(addresses) == 0 {
+		_i.respond(ctx, 500, nil, "chainId and addresses are required")
+		return
+	}
+	var blockNumber uint64
+	if ctx.QueryArgs().Has("blockNumber") {
+		var err error
+		if blockNumber, err = strconv.ParseUint(string(ctx.QueryArgs().Peek("blockNumber")), 10, 64); err != nil {
+			_i.respond(ctx, 500, nil, "invalid blockNumber")
+			return
+		}
+	}
+
+	prices, err := _i.dodoPoolService.GetPricesAtBlock(chainID, addresses, blockNumber)
+	if err != nil {
+		_i.logger.Err(err).Msg("GetDodoPoolPrices Failed to retrieve prices")
+		_i.respond(ctx, 500, nil, err.Error())
+		return
+	}
+	_i.respond(ctx, 0, prices, "Request successful")
+}
+
+// stripProvenance 未请求 provenance 时去掉来源信息，保持原有的响应格式
+func stripProvenance(results []service.PriceResult) {
+	for i := range results {
+		results[i].PriceProvenance = service.PriceProvenance{}
+	}
+}
+
+// stripMarketData 未请求市场数据时不返回数据源随价格带回的市场数据
+func stripMarketData(results []service.PriceResult) {
+	for i := range results {
+		results[i].MarketData = nil
+	}
+}
+
 func convertQueryArgsToStringSlice(args [][]byte) []string {
 	result := make([]string, len(args))
 	for i, arg := range args {
@@ -569,3 +1049,146 @@ func convertQueryArgsToStringSlice(args [][]byte) []string {
 	}
 	return result
 }
+
+// parseAssetIds 将 CAIP-19 资产 ID 解析为地址及 network，无效的资产 ID 返回错误
+func parseAssetIds(assetIds []string) ([]string, []string, map[int]error) {
+	addresses := make([]string, len(assetIds))
+	networks := make([]string, len(assetIds))
+	invalid := make(map[int]error)
+	for i, assetId := range assetIds {
+		chainId, address, err := shared.ParseAssetID(assetId)
+		if err != nil {
+			invalid[i] = err
+			continue
+		}
+		network, err := shared.GetChainName(chainId)
+		if err != nil {
+			invalid[i] = fmt.Errorf("%s Unsupported network", chainId)
+			continue
+		}
+		addresses[i] = address
+		networks[i] = network
+	}
+	return addresses, networks, invalid
+}
+
+// resolveChains 根据 chainIds 或 networks 补全另一方，地址带有 EIP-3770 前缀的项均为空
+func resolveChains(addresses, chainIds, networks []string) ([]string, []string, error) {
+	if len(chainIds) == 0 && len(networks) > 0 {
+		chainIds = make([]string, len(networks))
+		for i, network := range networks {
+			if network == "" {
+				continue
+			}
+			chainId, err := shared.GetChainID(network)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s Unsupported network", network)
+			}
+			chainIds[i] = chainId
+		}
+	} else if len(networks) == 0 && len(chainIds) > 0 {
+		networks = make([]string, len(chainIds))
+		for i, chainId := range chainIds {
+			network, err := shared.GetChainName(chainId)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s Unsupported network", chainId)
+			}
+			networks[i] = network
+		}
+	} else if len(networks) == 0 {
+		// 全部使用 EIP-3770 前缀指定链
+		networks = make([]string, len(addresses))
+	}
+
+	if len(addresses) != len(networks) {
+		return nil, nil, fmt.Errorf("the lengths of the addresses and networks arrays must be the same")
+	}
+
+	chainIds = make([]string, len(networks))
+	for i, network := range networks {
+		if network == "" {
+			continue
+		}
+		chainId, err := shared.GetChainID(network)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s Unsupported network", network)
+		}
+		chainIds[i] = chainId
+	}
+	return chainIds, networks, nil
+}
+
+// canonicalizeAddresses 校验并规范化批量请求中的地址，返回有效地址的下标及无效地址的错误，invalid 为已知无效的项。
+// chainIds 中为空的链取自地址的 EIP-3770 前缀，并补充对应的 network
+func canonicalizeAddresses(chainIds, networks, addresses []string, invalid map[int]error) ([]string, []int, map[int]error) {
+	canonical := make([]string, len(addresses))
+	var valid []int
+	if invalid == nil {
+		invalid = make(map[int]error)
+	}
+	for i, address := range addresses {
+		if _, ok := invalid[i]; ok {
+			continue
+		}
+		chainId, normalized, err := shared.CanonicalAddress(chainIds[i], address)
+		if err != nil {
+			invalid[i] = err
+			continue
+		}
+		if networks[i] == "" {
+			network, err := shared.GetChainName(chainId)
+			if err != nil {
+				invalid[i] = fmt.Errorf("%s Unsupported network", chainId)
+				continue
+			}
+			networks[i] = network
+		}
+		chainIds[i] = chainId
+		canonical[i] = normalized
+		valid = append(valid, i)
+	}
+	return canonical, valid, invalid
+}
+
+// mergeResults 按请求顺序合并有效地址的结果和无效地址的错误，地址返回调用方传入的原始形式
+func mergeResults(addresses, chainIds, symbols, networks []string, valid []int, results []service.PriceResult, invalid map[int]error) []service.PriceResult {
+	merged := make([]service.PriceResult, len(addresses))
+	for i, address := range addresses {
+		merged[i] = service.PriceResult{
+			ChainID:   chainIds[i],
+			Address:   address,
+			Symbol:    service.GetOrNil(symbols, i),
+			Network:   service.GetOrNil(networks, i),
+			TimeStamp: "0",
+			Serial:    i,
+		}
+		if err, ok := invalid[i]; ok {
+			merged[i].Error = err.Error()
+		}
+	}
+	for k, index := range valid {
+		if k >= len(results) {
+			break
+		}
+		result := results[k]
+		result.Address = addresses[index]
+		result.Serial = index
+		merged[index] = result
+	}
+	return merged
+}
+
+// withAssetIds 为结果补充 CAIP-19 资产 ID，按资产 ID 请求时原样返回调用方传入的资产 ID
+func withAssetIds(results []service.PriceResult, assetIds, canonical []string) {
+	for i := range results {
+		if i < len(assetIds) {
+			results[i].AssetID = assetIds[i]
+			continue
+		}
+		if i < len(canonical) && canonical[i] != "" {
+			if assetId, err := shared.AssetID(results[i].ChainID, canonical[i]); err == nil {
+				results[i].AssetID = assetId
+			}
+		}
+	}
+}
@@ -27,13 +27,44 @@ var NewPriceModule = fx.Options(
 	fx.Provide(repository.NewAppTokenRepository),
 	fx.Provide(repository.NewRequestLogRepository),
 	fx.Provide(repository.NewSlackNotificationRepository),
+	fx.Provide(repository.NewRejectedPriceRepository),
+	fx.Provide(repository.NewFxRateRepository),
+	fx.Provide(repository.NewCexSymbolRepository),
+	fx.Provide(repository.NewCoinCandleRepository),
+	fx.Provide(repository.NewCoinMarketDataRepository),
+	fx.Provide(repository.NewCoinSearchRepository),
+	fx.Provide(repository.NewBackfillJobRepository),
 
 	fx.Provide(service.NewCoinGeckoService),
 	fx.Provide(service.NewGeckoTerminalService),
 	fx.Provide(service.NewDefiLlamaService),
 	fx.Provide(service.NewDodoexRouteService),
+	fx.Provide(service.NewCexTickerService),
+	fx.Provide(service.NewChainlinkService),
+	fx.Provide(service.NewAmmPoolService),
+	fx.Provide(service.NewDodoPoolService),
+	// 价格数据源，新增数据源在这里注册即可
+	fx.Provide(
+		fx.Annotate(service.NewCoinGeckoProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewGeckoTerminalProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewDefiLlamaProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewCoinGeckoOnChainProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewDodoexRouteProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewCexTickerProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewChainlinkProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewAmmPoolProvider, fx.ResultTags(`group:"priceProviders"`)),
+		fx.Annotate(service.NewDodoPoolProvider, fx.ResultTags(`group:"priceProviders"`)),
+	),
+	fx.Provide(fx.Annotate(service.NewPriceProviderRegistry, fx.ParamTags(`group:"priceProviders"`))),
+	fx.Provide(service.NewPriceGuardService),
+	fx.Provide(service.NewPegService),
+	fx.Provide(service.NewLpTokenService),
+	fx.Provide(service.NewWrapperService),
+	fx.Provide(service.NewFxService),
 	fx.Provide(service.NewPriceService),
 	fx.Provide(service.NewCoinsService),
+	fx.Provide(service.NewTokenMetadataService),
+	fx.Provide(service.NewBackfillService),
 	fx.Provide(service.NewAppTokenService),
 	fx.Provide(service.NewCoinGeckoOnChainService),
 	fx.Provide(service.NewSlackNotificationService),
@@ -70,8 +101,15 @@ func (_i *PriceRouter) RegisterPriceRoutes() {
 	_i.App.Router.GET("/price", rateLimitMiddleware(priceController.GetPrice))
 	_i.App.Router.GET("/price/coins", rateLimitMiddleware(priceController.GetCoinList))
 	_i.App.Router.GET("/price/sync", rateLimitMiddleware(priceController.SyncCoins))
+	_i.App.Router.GET("/price/rejected", rateLimitMiddleware(priceController.GetRejectedPrices))
+	_i.App.Router.GET("/api/v1/price/dodo", rateLimitMiddleware(priceController.GetDodoPoolPrices))
 	_i.App.Router.ANY("/api/v1/price/current/batch", rateLimitMiddleware(priceController.GetBatchPrice))
+	_i.App.Router.ANY("/api/v1/price/change/batch", rateLimitMiddleware(priceController.GetBatchPriceChange))
+	_i.App.Router.ANY("/api/v1/market/batch", rateLimitMiddleware(priceController.GetBatchMarketData))
 	_i.App.Router.ANY("/api/v1/price/historical/batch", rateLimitMiddleware(priceController.GetBatchHistoricalPrice))
+	_i.App.Router.ANY("/api/v1/price/historical/range", rateLimitMiddleware(priceController.GetHistoricalPriceRange))
+	_i.App.Router.ANY("/api/v1/ohlcv", rateLimitMiddleware(priceController.GetOhlcv))
+	_i.App.Router.ANY("/api/v1/tokens/batch", rateLimitMiddleware(priceController.GetTokens))
 	_i.App.Router.ANY("/api/v1/price/current", rateLimitMiddleware(priceController.GetPrice))
 	_i.App.Router.ANY("/api/v1/price/historical", rateLimitMiddleware(priceController.GetHistoricalPrice))
 }
@@ -83,11 +121,21 @@ func (_i *PriceRouter) RegisterCoinsRoutes() {
 	_i.App.Router.POST("/coins/update/{id}", coinsController.UpdateCoin)
 	_i.App.Router.POST("/coins/delete/{id}", coinsController.DeleteCoin)
 	_i.App.Router.POST("/redis/delete/{key}", coinsController.DeleteRedisKey)
+	_i.App.Router.GET("/coins/search", coinsController.SearchCoins)
 	_i.App.Router.GET("/coins/{id}", coinsController.GetCoinByID)
 	_i.App.Router.GET("/coins/refresh", coinsController.RefreshAllCoinsCache)
 	_i.App.Router.POST("/coins/refreshList", coinsController.RefreshCoinListCache)
 }
 
+func (_i *PriceRouter) RegisterBackfillRoutes() {
+	backfillController := _i.Controller.Backfill
+
+	_i.App.Router.POST("/backfill/add", backfillController.AddJob)
+	_i.App.Router.POST("/backfill/cancel/{id}", backfillController.CancelJob)
+	_i.App.Router.GET("/backfill/{id}", backfillController.GetJob)
+	_i.App.Router.GET("/backfill", backfillController.GetJobs)
+}
+
 func (_i *PriceRouter) RegisterAppTokenRoutes() {
 	tokenController := _i.Controller.Token
 
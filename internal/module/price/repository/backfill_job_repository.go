@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// 回填任务状态
+const (
+	BackfillStatusPending   = "pending"
+	BackfillStatusRunning   = "running"
+	BackfillStatusCompleted = "completed"
+	BackfillStatusCancelled = "cancelled"
+)
+
+// 未结束的任务状态
+var backfillActiveStatuses = []string{BackfillStatusPending, BackfillStatusRunning}
+
+type BackfillJobRepository interface {
+	CreateJob(job *schema.BackfillJob) error
+	// GetJob 任务不存在时返回 nil
+	GetJob(id uint64) (*schema.BackfillJob, error)
+	// ListJobs 按创建时间倒序返回最近的任务
+	ListJobs(limit int) ([]schema.BackfillJob, error)
+	// NextJob 返回最早创建的未结束任务，没有时返回 nil
+	NextJob() (*schema.BackfillJob, error)
+	// SaveProgress 保存任务状态、检查点及计数，任务已被取消时不保存并返回 false
+	SaveProgress(job *schema.BackfillJob) (bool, error)
+	// CancelJob 取消未结束的任务，返回是否取消成功
+	CancelJob(id uint64) (bool, error)
+	// CoinIDsByChain 返回 coins 表中这些链上的代币 ID
+	CoinIDsByChain(chainIDs []string) ([]string, error)
+}
+
+type backfillJobRepository struct {
+	db     *database.Database
+	logger zerolog.Logger
+}
+
+func NewBackfillJobRepository(db *database.Database, logger zerolog.Logger) BackfillJobRepository {
+	return &backfillJobRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *backfillJobRepository) CreateJob(job *schema.BackfillJob) error {
+	if err := r.db.DB.Create(job).Error; err != nil {
+		r.logger.Error().Err(err).Msg("创建回填任务失败")
+		return err
+	}
+	return nil
+}
+
+func (r *backfillJobRepository) GetJob(id uint64) (*schema.BackfillJob, error) {
+	var job schema.BackfillJob
+	if err := r.db.DB.Where("id = ?", id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Error().Err(err).Msgf("查询回填任务失败 %d", id)
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *backfillJobRepository) ListJobs(limit int) ([]schema.BackfillJob, error) {
+	var jobs []schema.BackfillJob
+	if err := r.db.DB.Order("id DESC").Limit(limit).Find(&jobs).Error; err != nil {
+		r.logger.Error().Err(err).Msg("查询回填任务列表失败")
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *backfillJobRepository) NextJob() (*schema.BackfillJob, error) {
+	var jobs []schema.BackfillJob
+	if err := r.db.DB.Where("status IN ?", backfillActiveStatuses).Order("id").Limit(1).Find(&jobs).Error; err != nil {
+		r.logger.Error().Err(err).Msg("查询待执行的回填任务失败")
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+func (r *backfillJobRepository) SaveProgress(job *schema.BackfillJob) (bool, error) {
+	result := r.db.DB.Model(&schema.BackfillJob{}).
+		Where("id = ? AND status IN ?", job.ID, backfillActiveStatuses).
+		Updates(map[string]interface{}{
+			"status":      job.Status,
+			"coin_index":  job.CoinIndex,
+			"cursor":      job.Cursor,
+			"attempts":    job.Attempts,
+			"filled":      job.Filled,
+			"missing":     job.Missing,
+			"skipped":     job.Skipped,
+			"last_error":  job.LastError,
+			"started_at":  job.StartedAt,
+			"finished_at": job.FinishedAt,
+		})
+	if result.Error != nil {
+		r.logger.Error().Err(result.Error).Msgf("保存回填任务进度失败 %d", job.ID)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *backfillJobRepository) CancelJob(id uint64) (bool, error) {
+	result := r.db.DB.Model(&schema.BackfillJob{}).
+		Where("id = ? AND status IN ?", id, backfillActiveStatuses).
+		Updates(map[string]interface{}{"status": BackfillStatusCancelled, "finished_at": gorm.Expr("NOW()")})
+	if result.Error != nil {
+		r.logger.Error().Err(result.Error).Msgf("取消回填任务失败 %d", id)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *backfillJobRepository) CoinIDsByChain(chainIDs []string) ([]string, error) {
+	var ids []string
+	if err := r.db.DB.Model(&schema.Coins{}).Where("chain_id IN ?", chainIDs).Order("id").Pluck("id", &ids).Error; err != nil {
+		r.logger.Error().Err(err).Msg("查询链上的代币失败")
+		return nil, err
+	}
+	return ids, nil
+}
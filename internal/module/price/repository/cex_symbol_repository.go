@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/rs/zerolog"
+)
+
+type CexSymbolRepository interface {
+	// GetSymbols 返回 coinID 对应的交易所交易对，没有映射的币种不返回
+	GetSymbols(coinIDs []string) (map[string]string, error)
+}
+
+type cexSymbolRepository struct {
+	db     *database.Database
+	logger zerolog.Logger
+}
+
+func NewCexSymbolRepository(db *database.Database, logger zerolog.Logger) CexSymbolRepository {
+	return &cexSymbolRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *cexSymbolRepository) GetSymbols(coinIDs []string) (map[string]string, error) {
+	symbols := make(map[string]string)
+	if len(coinIDs) == 0 {
+		return symbols, nil
+	}
+	var rows []schema.CexSymbol
+	if err := r.db.DB.Where("coin_id IN ?", coinIDs).Find(&rows).Error; err != nil {
+		r.logger.Error().Err(err).Msg("查询交易所交易对映射失败")
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Symbol != "" {
+			symbols[row.CoinID] = row.Symbol
+		}
+	}
+	return symbols, nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm/clause"
+)
+
+type CoinCandleRepository interface {
+	// SaveCandles 保存 K 线，已存在的 K 线按最新数据更新
+	SaveCandles(candles []schema.CoinCandle) error
+	// GetCandles 返回开始时间在 [from, to] 内的 K 线，按时间升序
+	GetCandles(coinID, timeframe string, from, to int64) ([]schema.CoinCandle, error)
+}
+
+type coinCandleRepository struct {
+	db     *database.Database
+	logger zerolog.Logger
+}
+
+func NewCoinCandleRepository(db *database.Database, logger zerolog.Logger) CoinCandleRepository {
+	return &coinCandleRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *coinCandleRepository) SaveCandles(candles []schema.CoinCandle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+	err := r.db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "coin_id"}, {Name: "timeframe"}, {Name: "timestamp"}},
+		DoUpdates: clause.AssignmentColumns([]string{"open", "high", "low", "close", "volume", "source", "updated_at"}),
+	}).CreateInBatches(&candles, 500).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("保存 K 线失败")
+		return err
+	}
+	return nil
+}
+
+func (r *coinCandleRepository) GetCandles(coinID, timeframe string, from, to int64) ([]schema.CoinCandle, error) {
+	var candles []schema.CoinCandle
+	err := r.db.DB.Where("coin_id = ? AND timeframe = ? AND timestamp BETWEEN ? AND ?", coinID, timeframe, from, to).
+		Order("timestamp").Find(&candles).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询 K 线失败")
+		return nil, err
+	}
+	return candles, nil
+}
@@ -17,17 +17,28 @@ import (
 const (
 	historicalQueueKey     = "historical_prices:queue"
 	historicalSetKeyPrefix = "historical_prices:set:"
+	historicalIntradayKey  = "historical_prices:intraday"
 	historicalQueueRunSize = 1000
 	maxRetries             = 3
 	retryDelay             = 2 * time.Second
 	lockTTL                = 15 * time.Second
 	lockRetryInterval      = 1 * time.Second
 	lockRetryCount         = 3
+	intradayDeleteBatch    = 10000
 )
 
 type CoinHistoricalPriceRepository interface {
 	SaveHistoricalPrices(prices []schema.CoinHistoricalPrice) error
+	// SaveIntradaySnapshots 将当前价格保存为观测时间所在小时及 5 分钟时间段的快照
+	SaveIntradaySnapshots(prices []schema.CoinHistoricalPrice) error
 	GetHistoricalPrices(coinIDs []string, dates []int64) (map[string]string, error)
+	// GetHistoricalPricesByGranularity 按粒度查询历史价格，返回 key 为 coinID_时间段
+	GetHistoricalPricesByGranularity(coinIDs []string, dates []int64, granularity string) (map[string]string, error)
+	GetLatestPrices(coinIDs []string) (map[string]string, error)
+	// GetPriceRange 返回币种在 [from, to] 时间内指定粒度的历史价格，按时间升序
+	GetPriceRange(coinID, granularity string, from, to int64) ([]schema.CoinHistoricalPrice, error)
+	// DeleteIntradayPrices 物理删除指定日内粒度中 date 早于 before 的价格，返回删除的行数
+	DeleteIntradayPrices(granularity string, before int64) (int64, error)
 	ProcessQueue() error
 }
 
@@ -53,6 +64,12 @@ func (r *coinHistoricalPriceRepository) SaveHistoricalPrices(prices []schema.Coi
 		return nil
 	}
 
+	for i := range prices {
+		if prices[i].Granularity == "" {
+			prices[i].Granularity = shared.GranularityDay
+		}
+	}
+
 	// 使用map进行去重
 	uniquePrices := make(map[string]schema.CoinHistoricalPrice)
 	for _, price := range prices {
@@ -152,7 +169,10 @@ func (r *coinHistoricalPriceRepository) ProcessQueue() error {
 		ok := r.redisClient.AcquireLock(lockKey, lockTTL)
 		if ok {
 			defer r.redisClient.ReleaseLock(lockKey)
-			return r.processQueueWithTransaction()
+			if err := r.processQueueWithTransaction(); err != nil {
+				return err
+			}
+			return r.processIntradaySnapshots()
 		}
 		time.Sleep(lockRetryInterval)
 	}
@@ -256,11 +276,81 @@ func (r *coinHistoricalPriceRepository) processQueueTransaction(historicalPrices
 	r.logger.Debug().Msg("coinHistoricalPriceRepository 处理队列成功")
 	return nil
 }
+
+// SaveIntradaySnapshots 按观测时间 date 将价格保存为所在小时及 5 分钟时间段的快照，观测时间早于当前时间段的价格不保存。
+// 快照不经过历史价格队列，按 coin_id 及时间段写入 Redis 哈希，同一时间段只保留最新的价格，由 ProcessQueue 批量写入数据库
+func (r *coinHistoricalPriceRepository) SaveIntradaySnapshots(prices []schema.CoinHistoricalPrice) error {
+	now := time.Now().Unix()
+	ctx := context.Background()
+	pipe := r.redisClient.Client.Pipeline()
+	queued := 0
+	for _, price := range prices {
+		for _, granularity := range []string{shared.GranularityHour, shared.GranularityFiveMinute} {
+			bucket := shared.BucketStart(granularity, price.Date)
+			if bucket < shared.BucketStart(granularity, now) {
+				continue
+			}
+			snapshot := price
+			snapshot.Granularity = granularity
+			snapshot.Date = bucket
+			snapshot.DayDate = shared.BucketDate(granularity, bucket)
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				return err
+			}
+			r.redisClient.SetHistoricalPriceCache(snapshot.CoinID, snapshot.DayDate, snapshot.Price)
+			pipe.HSet(ctx, historicalIntradayKey, snapshot.CoinID+"_"+snapshot.DayDate, data)
+			queued++
+		}
+	}
+	if queued == 0 {
+		return nil
+	}
+	queueLen := pipe.HLen(ctx, historicalIntradayKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if queueLen.Val() >= int64(historicalQueueRunSize) {
+		return r.ProcessQueue()
+	}
+	return nil
+}
+
+// processIntradaySnapshots 取出并清空 Redis 中的日内快照，写入数据库
+func (r *coinHistoricalPriceRepository) processIntradaySnapshots() error {
+	ctx := context.Background()
+	var snapshotsCmd *redis.MapStringStringCmd
+	_, err := r.redisClient.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		snapshotsCmd = pipe.HGetAll(ctx, historicalIntradayKey)
+		pipe.Del(ctx, historicalIntradayKey)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	snapshots := make([]schema.CoinHistoricalPrice, 0, len(snapshotsCmd.Val()))
+	for _, data := range snapshotsCmd.Val() {
+		var snapshot schema.CoinHistoricalPrice
+		if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+			return err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return r.processQueueTransaction(snapshots)
+}
+
 func (r *coinHistoricalPriceRepository) GetHistoricalPrices(coinIDs []string, dates []int64) (map[string]string, error) {
+	return r.GetHistoricalPricesByGranularity(coinIDs, dates, shared.GranularityDay)
+}
+
+func (r *coinHistoricalPriceRepository) GetHistoricalPricesByGranularity(coinIDs []string, dates []int64, granularity string) (map[string]string, error) {
 	dayDates := make([]string, len(dates))
-	currentDay := time.Now().Format("02-01-2006")
+	currentDay := shared.BucketDate(granularity, time.Now().Unix())
 	for i, date := range dates {
-		dayDates[i] = time.Unix(date, 0).Format("02-01-2006")
+		dayDates[i] = shared.BucketDate(granularity, date)
 	}
 
 	priceMap := make(map[string]string)
@@ -271,7 +361,7 @@ func (r *coinHistoricalPriceRepository) GetHistoricalPrices(coinIDs []string, da
 		if err == nil && price != "" {
 			priceMap[coinID+"_"+dayDates[i]] = price
 		} else {
-			if dayDates[i] != currentDay { // 跳过当天日期的数据库查询
+			if dayDates[i] != currentDay { // 跳过当前时间段的数据库查询
 				missingPrices[coinID] = append(missingPrices[coinID], dayDates[i])
 			}
 		}
@@ -298,3 +388,51 @@ func (r *coinHistoricalPriceRepository) GetHistoricalPrices(coinIDs []string, da
 	}
 	return priceMap, nil
 }
+
+// GetLatestPrices 返回每个币种最新一条历史价格
+func (r *coinHistoricalPriceRepository) GetLatestPrices(coinIDs []string) (map[string]string, error) {
+	priceMap := make(map[string]string)
+	if len(coinIDs) == 0 {
+		return priceMap, nil
+	}
+	var latestPrices []schema.CoinHistoricalPrice
+	err := r.db.DB.Raw(`SELECT DISTINCT ON (coin_id) coin_id, price FROM coin_historical_prices
+		WHERE coin_id IN ? AND deleted_at IS NULL ORDER BY coin_id, date DESC`, coinIDs).Scan(&latestPrices).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询最新历史价格失败: %v", err)
+	}
+	for _, price := range latestPrices {
+		priceMap[price.CoinID] = price.Price
+	}
+	return priceMap, nil
+}
+
+func (r *coinHistoricalPriceRepository) GetPriceRange(coinID, granularity string, from, to int64) ([]schema.CoinHistoricalPrice, error) {
+	var prices []schema.CoinHistoricalPrice
+	err := r.db.DB.Where("coin_id = ? AND granularity = ? AND date BETWEEN ? AND ?", coinID, granularity, from, to).
+		Order("date").Find(&prices).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询历史价格区间失败: %v", err)
+	}
+	return prices, nil
+}
+
+func (r *coinHistoricalPriceRepository) DeleteIntradayPrices(granularity string, before int64) (int64, error) {
+	if !shared.IsIntraday(granularity) {
+		return 0, fmt.Errorf("只能删除日内价格: %s", granularity)
+	}
+	// 分批删除，避免长时间锁表
+	var total int64
+	for {
+		batch := r.db.DB.Model(&schema.CoinHistoricalPrice{}).Unscoped().Select("id").
+			Where("granularity = ? AND date < ?", granularity, before).Limit(intradayDeleteBatch)
+		result := r.db.DB.Unscoped().Where("id IN (?)", batch).Delete(&schema.CoinHistoricalPrice{})
+		if result.Error != nil {
+			return total, fmt.Errorf("删除 %s 日内价格失败: %v", granularity, result.Error)
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < intradayDeleteBatch {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CoinMarketDataRepository interface {
+	// SaveMarketData 按 coin_id 和 day_date 保存市场数据，新数据中为空的字段保留已有的值
+	SaveMarketData(data []schema.CoinMarketData) error
+	// GetMarketData 返回各代币在 dayDate 当天的市场数据，key 为 coin_id
+	GetMarketData(coinIDs []string, dayDate string) (map[string]schema.CoinMarketData, error)
+	// GetLatestMarketData 返回各代币最近一天的市场数据，key 为 coin_id
+	GetLatestMarketData(coinIDs []string) (map[string]schema.CoinMarketData, error)
+}
+
+type coinMarketDataRepository struct {
+	db     *database.Database
+	logger zerolog.Logger
+}
+
+func NewCoinMarketDataRepository(db *database.Database, logger zerolog.Logger) CoinMarketDataRepository {
+	return &coinMarketDataRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *coinMarketDataRepository) SaveMarketData(data []schema.CoinMarketData) error {
+	if len(data) == 0 {
+		return nil
+	}
+	// 同一天的数据可能来自不同数据源，各字段分别合并
+	assignments := map[string]interface{}{
+		"date":       gorm.Expr("EXCLUDED.date"),
+		"source":     gorm.Expr("EXCLUDED.source"),
+		"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+	}
+	for _, column := range []string{"market_cap", "fully_diluted_valuation", "volume_24h", "liquidity"} {
+		assignments[column] = gorm.Expr("COALESCE(EXCLUDED." + column + ", coin_market_data." + column + ")")
+	}
+	err := r.db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "coin_id"}, {Name: "day_date"}},
+		DoUpdates: clause.Assignments(assignments),
+	}).CreateInBatches(&data, 500).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("保存市场数据失败")
+		return err
+	}
+	return nil
+}
+
+func (r *coinMarketDataRepository) GetMarketData(coinIDs []string, dayDate string) (map[string]schema.CoinMarketData, error) {
+	var rows []schema.CoinMarketData
+	if len(coinIDs) == 0 {
+		return map[string]schema.CoinMarketData{}, nil
+	}
+	if err := r.db.DB.Where("coin_id IN ? AND day_date = ?", coinIDs, dayDate).Find(&rows).Error; err != nil {
+		r.logger.Error().Err(err).Msg("查询市场数据失败")
+		return nil, err
+	}
+	return marketDataByCoin(rows), nil
+}
+
+func (r *coinMarketDataRepository) GetLatestMarketData(coinIDs []string) (map[string]schema.CoinMarketData, error) {
+	var rows []schema.CoinMarketData
+	if len(coinIDs) == 0 {
+		return map[string]schema.CoinMarketData{}, nil
+	}
+	err := r.db.DB.Raw("SELECT DISTINCT ON (coin_id) * FROM coin_market_data WHERE coin_id IN ? AND deleted_at IS NULL ORDER BY coin_id, date DESC", coinIDs).
+		Scan(&rows).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询最新市场数据失败")
+		return nil, err
+	}
+	return marketDataByCoin(rows), nil
+}
+
+func marketDataByCoin(rows []schema.CoinMarketData) map[string]schema.CoinMarketData {
+	data := make(map[string]schema.CoinMarketData, len(rows))
+	for _, row := range rows {
+		data[row.CoinID] = row
+	}
+	return data
+}
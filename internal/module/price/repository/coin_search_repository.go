@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CoinSearchMatchPrefix = "prefix" // symbol 或 name 以关键字开头
+	CoinSearchMatchFuzzy  = "fuzzy"  // symbol 或 name 按顺序包含关键字的每个字符
+)
+
+// CoinSearchQuery 代币搜索条件，ChainIDs 和 Label 为空时不过滤
+type CoinSearchQuery struct {
+	Query    string
+	Match    string
+	ChainIDs []string
+	Label    string
+	Since    int64 // 统计请求次数的开始时间
+	Offset   int
+	Limit    int
+}
+
+// CoinSearchResult 搜索到的代币及 Since 之后的请求次数
+type CoinSearchResult struct {
+	schema.Coins
+	Requests int64 `json:"requests"`
+}
+
+type CoinSearchRepository interface {
+	// SaveRequestCounts 按 coin_id 和 date 累加请求次数
+	SaveRequestCounts(counts []schema.CoinRequestCount) error
+	// SearchCoins 按匹配程度及请求次数排序返回一页代币，同时返回满足条件的总数
+	SearchCoins(query CoinSearchQuery) ([]CoinSearchResult, int64, error)
+}
+
+type coinSearchRepository struct {
+	db     *database.Database
+	logger zerolog.Logger
+}
+
+func NewCoinSearchRepository(db *database.Database, logger zerolog.Logger) CoinSearchRepository {
+	return &coinSearchRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *coinSearchRepository) SaveRequestCounts(counts []schema.CoinRequestCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	err := r.db.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "coin_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":      gorm.Expr("coin_request_counts.count + EXCLUDED.count"),
+			"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).CreateInBatches(&counts, 500).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("保存代币请求次数失败")
+		return err
+	}
+	return nil
+}
+
+func (r *coinSearchRepository) SearchCoins(query CoinSearchQuery) ([]CoinSearchResult, int64, error) {
+	keyword := strings.ToLower(query.Query)
+	prefix := escapeLike(keyword) + "%"
+	pattern := prefix
+	if query.Match != CoinSearchMatchPrefix {
+		// 关键字的字符之间允许出现其他字符，例如 wbtc 可以匹配 Wrapped BTC
+		chars := strings.Split(keyword, "")
+		for i, char := range chars {
+			chars[i] = escapeLike(char)
+		}
+		pattern = "%" + strings.Join(chars, "%") + "%"
+	}
+	where := func() *gorm.DB {
+		tx := r.db.DB.Table("coins").
+			Where("coins.deleted_at IS NULL").
+			Where("(LOWER(coins.symbol) LIKE ? OR LOWER(coins.name) LIKE ?)", pattern, pattern)
+		if len(query.ChainIDs) > 0 {
+			tx = tx.Where("coins.chain_id IN ?", query.ChainIDs)
+		}
+		if query.Label != "" {
+			tx = tx.Where("coins.label = ?", query.Label)
+		}
+		return tx
+	}
+
+	var total int64
+	if err := where().Count(&total).Error; err != nil {
+		r.logger.Error().Err(err).Msg("统计代币搜索结果失败")
+		return nil, 0, err
+	}
+	if total == 0 {
+		return []CoinSearchResult{}, 0, nil
+	}
+
+	// 依次按 symbol 完全匹配、symbol 前缀、name 前缀、symbol 包含、其他排序，同一档内请求次数多的在前
+	orderBy := clause.Expr{
+		SQL: `CASE WHEN LOWER(coins.symbol) = ? THEN 0
+			WHEN LOWER(coins.symbol) LIKE ? THEN 1
+			WHEN LOWER(coins.name) LIKE ? THEN 2
+			WHEN LOWER(coins.symbol) LIKE ? THEN 3
+			ELSE 4 END, requests DESC, coins.symbol, coins.id`,
+		Vars:               []interface{}{keyword, prefix, prefix, "%" + prefix},
+		WithoutParentheses: true,
+	}
+	var results []CoinSearchResult
+	err := where().
+		Select("coins.*, COALESCE(request_counts.total, 0) AS requests").
+		Joins("LEFT JOIN (SELECT coin_id, SUM(count) AS total FROM coin_request_counts WHERE date >= ? AND deleted_at IS NULL GROUP BY coin_id) request_counts ON request_counts.coin_id = coins.id", query.Since).
+		Clauses(clause.OrderBy{Expression: orderBy}).
+		Offset(query.Offset).
+		Limit(query.Limit).
+		Scan(&results).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("搜索代币失败")
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// requestCounts 从请求日志中统计各代币每天的请求次数
+func requestCounts(logs []schema.RequestLog) []schema.CoinRequestCount {
+	indexes := make(map[string]int)
+	var counts []schema.CoinRequestCount
+	for _, log := range logs {
+		createdAt := log.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		date := shared.BucketStart(shared.GranularityDay, createdAt.Unix())
+		for _, coinID := range requestedCoinIDs(log.RequestParams) {
+			key := coinID + "_" + strconv.FormatInt(date, 10)
+			if index, ok := indexes[key]; ok {
+				counts[index].Count++
+				continue
+			}
+			indexes[key] = len(counts)
+			counts = append(counts, schema.CoinRequestCount{CoinID: coinID, Date: date, Count: 1})
+		}
+	}
+	return counts
+}
+
+// requestedCoinIDs 从请求参数中解析请求的代币，支持单个代币的 address、批量的 addresses 及 CAIP-19 的 assetIds，
+// 与接口一致，传入 assetIds 时忽略 addresses，无法解析的地址忽略
+func requestedCoinIDs(requestParams string) []string {
+	var params struct {
+		Address   string   `json:"address"`
+		Network   string   `json:"network"`
+		ChainID   string   `json:"chainId"`
+		Addresses []string `json:"addresses"`
+		Networks  []string `json:"networks"`
+		ChainIDs  []string `json:"chainIds"`
+		AssetIDs  []string `json:"assetIds"`
+	}
+	if err := json.Unmarshal([]byte(requestParams), &params); err != nil {
+		return nil
+	}
+	if params.Address != "" {
+		params.Addresses = []string{params.Address}
+		params.Networks = []string{params.Network}
+		params.ChainIDs = []string{params.ChainID}
+	}
+	if len(params.AssetIDs) > 0 {
+		params.Addresses = make([]string, len(params.AssetIDs))
+		params.Networks = nil
+		params.ChainIDs = make([]string, len(params.AssetIDs))
+		for i, assetID := range params.AssetIDs {
+			params.ChainIDs[i], params.Addresses[i], _ = shared.ParseAssetID(assetID)
+		}
+	}
+	var coinIDs []string
+	seen := make(map[string]bool)
+	for i, address := range params.Addresses {
+		chainID := ""
+		if i < len(params.ChainIDs) {
+			chainID = params.ChainIDs[i]
+		}
+		if chainID == "" && i < len(params.Networks) && params.Networks[i] != "" {
+			chainID, _ = shared.GetChainID(params.Networks[i])
+		}
+		chainID, address, err := shared.CanonicalAddress(chainID, address)
+		if err != nil {
+			continue
+		}
+		coinID := shared.CoinID(chainID, address)
+		if !seen[coinID] {
+			seen[coinID] = true
+			coinIDs = append(coinIDs, coinID)
+		}
+	}
+	return coinIDs
+}
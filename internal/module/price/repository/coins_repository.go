@@ -138,9 +138,33 @@ func (r *coinRepository) upsertCoins(tx *gorm.DB, coins []schema.Coins) error {
 	return nil
 }
 
+// normalizeCoins 按链的地址格式规范化 ID 及地址，EVM 链转为小写，base58 等区分大小写的地址保持原样
+func normalizeCoins(coins []schema.Coins) []schema.Coins {
+	normalized := make([]schema.Coins, len(coins))
+	for i, coin := range coins {
+		coin.ID = shared.NormalizeCoinID(coin.ID)
+		coin.Address = shared.NormalizeAddress(coin.ChainID, coin.Address)
+		if coin.ReturnCoinsId != nil && *coin.ReturnCoinsId != "" {
+			returnCoinsId := shared.NormalizeCoinID(*coin.ReturnCoinsId)
+			coin.ReturnCoinsId = &returnCoinsId
+		}
+		normalized[i] = coin
+	}
+	return normalized
+}
+
+func normalizeCoinIDs(ids []string) []string {
+	normalized := make([]string, len(ids))
+	for i, id := range ids {
+		normalized[i] = shared.NormalizeCoinID(id)
+	}
+	return normalized
+}
+
 // 批量插入和更新币种，记录执行耗时
 func (r *coinRepository) UpsertCoins(coins []schema.Coins) error {
 	startTime := time.Now() // 记录开始时间
+	coins = normalizeCoins(coins)
 
 	batchSize := 1000 // 增加批次大小
 
@@ -178,6 +202,7 @@ func (r *coinRepository) UpsertCoins(coins []schema.Coins) error {
 	return nil
 }
 func (r *coinRepository) GetCoinsByID(ids []string) ([]schema.Coins, error) {
+	ids = normalizeCoinIDs(ids)
 	var coins []schema.Coins
 	var missingIDs []string
 	cachedCoins := make(map[string]schema.Coins)
@@ -235,6 +260,7 @@ func (r *coinRepository) GetCoinsByID(ids []string) ([]schema.Coins, error) {
 }
 
 func (r *coinRepository) GetCoinsByOneID(id string) (*schema.Coins, error) {
+	id = shared.NormalizeCoinID(id)
 	var coin schema.Coins
 	cacheKey := fmt.Sprintf("%s%s", cacheKeyPrefix, id)
 
@@ -341,7 +367,7 @@ func (r *coinRepository) RefreshCoinListCache(ids []string) error {
 
 	var coins []schema.Coins
 	// 从数据库中批量获取数据
-	if err := r.db.DB.Where("id IN ? AND deleted_at IS NULL", ids).Find(&coins).Error; err != nil {
+	if err := r.db.DB.Where("id IN ? AND deleted_at IS NULL", normalizeCoinIDs(ids)).Find(&coins).Error; err != nil {
 		return err
 	}
 
@@ -370,6 +396,7 @@ func (r *coinRepository) RefreshAllCoinsCache() error {
 
 // 将 coin 添加到队列
 func (r *coinRepository) AddToQueue(coins []schema.Coins) error {
+	coins = normalizeCoins(coins)
 	pipe := r.redisClient.Client.Pipeline()
 
 	for _, coin := range coins {
@@ -508,6 +535,7 @@ func (r *coinRepository) upsertCoinsTransaction(coins []schema.Coins) error {
 	return nil
 }
 func (r *coinRepository) DeleteCoinByID(id string) error {
+	id = shared.NormalizeCoinID(id)
 	tx := r.db.DB.Begin()
 
 	// 删除数据库记录
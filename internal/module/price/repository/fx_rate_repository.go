@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm/clause"
+)
+
+type FxRateRepository interface {
+	SaveRates(rates []schema.FxRate) error
+	// GetRate 返回指定日期的汇率，优先读取 Redis 缓存，没有记录时返回空字符串
+	GetRate(currency string, dayDate string) (string, error)
+}
+
+type fxRateRepository struct {
+	db          *database.Database
+	redisClient *shared.RedisClient
+	logger      zerolog.Logger
+}
+
+func NewFxRateRepository(db *database.Database, redisClient *shared.RedisClient, logger zerolog.Logger) FxRateRepository {
+	return &fxRateRepository{
+		db:          db,
+		redisClient: redisClient,
+		logger:      logger,
+	}
+}
+
+func (r *fxRateRepository) SaveRates(rates []schema.FxRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	err := r.db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}, {Name: "day_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "date", "source", "updated_at"}),
+	}).Create(&rates).Error
+	if err != nil {
+		r.logger.Error().Err(err).Msg("保存汇率失败")
+		return err
+	}
+	for _, rate := range rates {
+		r.redisClient.SetFxRateCache(rate.Currency, rate.DayDate, rate.Rate)
+	}
+	return nil
+}
+
+func (r *fxRateRepository) GetRate(currency string, dayDate string) (string, error) {
+	if rate, err := r.redisClient.GetFxRateCache(currency, dayDate); err == nil && rate != "" {
+		return rate, nil
+	}
+	var rates []schema.FxRate
+	if err := r.db.DB.Where("currency = ? AND day_date = ?", currency, dayDate).Limit(1).Find(&rates).Error; err != nil {
+		return "", err
+	}
+	if len(rates) == 0 {
+		return "", nil
+	}
+	r.redisClient.SetFxRateCache(currency, dayDate, rates[0].Rate)
+	return rates[0].Rate, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"github.com/DODOEX/token-price-proxy/internal/database"
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/rs/zerolog"
+)
+
+type RejectedPriceRepository interface {
+	SaveRejectedPrice(price schema.RejectedPrice) error
+	GetRejectedPrices(coinID string, limit int) ([]schema.RejectedPrice, error)
+}
+
+type rejectedPriceRepository struct {
+	db     *database.Database
+	logger zerolog.Logger
+}
+
+func NewRejectedPriceRepository(db *database.Database, logger zerolog.Logger) RejectedPriceRepository {
+	return &rejectedPriceRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *rejectedPriceRepository) SaveRejectedPrice(price schema.RejectedPrice) error {
+	if err := r.db.DB.Create(&price).Error; err != nil {
+		r.logger.Error().Err(err).Msgf("保存被拒绝的报价失败: %s", price.CoinID)
+		return err
+	}
+	return nil
+}
+
+// GetRejectedPrices 按时间倒序返回被拒绝的报价，coinID 为空时返回所有币种
+func (r *rejectedPriceRepository) GetRejectedPrices(coinID string, limit int) ([]schema.RejectedPrice, error) {
+	var prices []schema.RejectedPrice
+	query := r.db.DB.Order("date DESC").Limit(limit)
+	if coinID != "" {
+		query = query.Where("coin_id = ?", coinID)
+	}
+	if err := query.Find(&prices).Error; err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
@@ -32,20 +32,22 @@ type RequestLogRepository interface {
 }
 
 type requestLogRepository struct {
-	db          *database.Database
-	redisClient *shared.RedisClient
-	logger      zerolog.Logger
-	taskQueue   chan func() error
-	quit        chan bool
+	db             *database.Database
+	coinSearchRepo CoinSearchRepository
+	redisClient    *shared.RedisClient
+	logger         zerolog.Logger
+	taskQueue      chan func() error
+	quit           chan bool
 }
 
-func NewRequestLogRepository(lc fx.Lifecycle, db *database.Database, redisClient *shared.RedisClient, logger zerolog.Logger) RequestLogRepository {
+func NewRequestLogRepository(lc fx.Lifecycle, db *database.Database, coinSearchRepo CoinSearchRepository, redisClient *shared.RedisClient, logger zerolog.Logger) RequestLogRepository {
 	repo := &requestLogRepository{
-		db:          db,
-		redisClient: redisClient,
-		logger:      logger,
-		taskQueue:   make(chan func() error, 1000), // 任务队列
-		quit:        make(chan bool),
+		db:             db,
+		coinSearchRepo: coinSearchRepo,
+		redisClient:    redisClient,
+		logger:         logger,
+		taskQueue:      make(chan func() error, 1000), // 任务队列
+		quit:           make(chan bool),
 	}
 	workerCount := 8
 	lc.Append(fx.Hook{
@@ -191,6 +193,8 @@ func (r *requestLogRepository) insertLogsTransaction(logs []schema.RequestLog) e
 			r.logger.Error().Err(err).Msg("Failed to commit transaction")
 			return err
 		}
+		// 请求次数只用于搜索排序，保存失败不影响日志写入
+		r.coinSearchRepo.SaveRequestCounts(requestCounts(batch))
 	}
 	return nil
 }
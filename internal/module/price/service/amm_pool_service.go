@@ -0,0 +1,359 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// 池子类型
+const (
+	AmmPoolUniswapV2 = "uniswapV2"
+	AmmPoolUniswapV3 = "uniswapV3"
+)
+
+// Uniswap 池子方法选择器
+const (
+	ammGetReserves = "0x0902f1ac"
+	ammSlot0       = "0x3850c7bd"
+	ammToken0      = "0x0dfe1681"
+	ammToken1      = "0xd21220a7"
+	erc20BalanceOf = "0x70a08231"
+)
+
+// 池子报价侧流动性低于该值（USD）时不使用池子价格
+const defaultAmmMinLiquidityUsd = 10000
+
+// ammPoolAttributes coins.pool_attributes 中的池子配置
+type ammPoolAttributes struct {
+	Pool            string  `json:"pool"`            // 池子地址
+	Type            string  `json:"type"`            // uniswapV2 | uniswapV3，为空时自动识别
+	MinLiquidityUsd float64 `json:"minLiquidityUsd"` // 覆盖默认的最低流动性
+}
+
+// ammPool 代币在 coins 表中配置的定价池子
+type ammPool struct {
+	ammPoolAttributes
+	Token string // 需要定价的代币
+	Quote string // 已知 USD 价格的报价代币
+}
+
+// AmmPoolService 通过 eth_call 读取 coins 表中配置的 Uniswap V2/V3 池子，按报价代币的 USD 价格换算代币价格
+type AmmPoolService interface {
+	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
+}
+
+type ammPoolService struct {
+	minLiquidityUsd         float64
+	rpcClient               *shared.RpcClient
+	coinRepository          repository.CoinRepository
+	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	redisClient             *shared.RedisClient
+	logger                  zerolog.Logger
+}
+
+func NewAmmPoolService(cfg *koanf.Koanf, rpcClient *shared.RpcClient, coinRepository repository.CoinRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, redisClient *shared.RedisClient, logger zerolog.Logger) AmmPoolService {
+	minLiquidityUsd := cfg.Float64("ammPool.minLiquidityUsd")
+	if !cfg.Exists("ammPool.minLiquidityUsd") {
+		minLiquidityUsd = defaultAmmMinLiquidityUsd
+	}
+	return &ammPoolService{
+		minLiquidityUsd:         minLiquidityUsd,
+		rpcClient:               rpcClient,
+		coinRepository:          coinRepository,
+		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		redisClient:             redisClient,
+		logger:                  logger,
+	}
+}
+
+// poolOf 解析币种的池子配置，没有配置池子或报价代币时返回 false，LP 代币的 pool 表示储备所在的合约，不用于定价
+func poolOf(coin schema.Coins) (ammPool, bool) {
+	if coin.PoolAttributes == nil || coin.QuoteTokenAddress == nil || *coin.QuoteTokenAddress == "" {
+		return ammPool{}, false
+	}
+	if _, ok := lpTokenAttributesOf(coin); ok {
+		return ammPool{}, false
+	}
+	var pool ammPool
+	if err := json.Unmarshal([]byte(*coin.PoolAttributes), &pool.ammPoolAttributes); err != nil || pool.Pool == "" {
+		return ammPool{}, false
+	}
+	pool.Pool = strings.ToLower(pool.Pool)
+	pool.Token = shared.NormalizeAddress(coin.ChainID, coin.Address)
+	if coin.BaseTokenAddress != nil && *coin.BaseTokenAddress != "" {
+		pool.Token = shared.NormalizeAddress(coin.ChainID, *coin.BaseTokenAddress)
+	}
+	pool.Quote = shared.NormalizeAddress(coin.ChainID, *coin.QuoteTokenAddress)
+	return pool, true
+}
+
+func (s *ammPoolService) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	if len(chainIds) != len(addresses) {
+		return nil, fmt.Errorf("chainIds and addresses must have the same length")
+	}
+	coinIDs := make([]string, len(addresses))
+	for i, address := range addresses {
+		coinIDs[i] = chainIds[i] + "_" + address
+	}
+	coins, err := s.coinRepository.GetCoinsByID(coinIDs)
+	if err != nil {
+		return nil, err
+	}
+	pools := make(map[string]ammPool)
+	for _, coin := range coins {
+		if pool, ok := poolOf(coin); ok && s.rpcClient.HasChain(coin.ChainID) {
+			pools[coin.ID] = pool
+		}
+	}
+
+	var cachedPrices map[string]string
+	if isCache {
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
+	now := time.Now()
+	results := make([]PriceResult, len(addresses))
+	var pricesToSave []schema.CoinHistoricalPrice
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, coinID := range coinIDs {
+		results[i] = PriceResult{
+			ChainID:   chainIds[i],
+			Address:   addresses[i],
+			Symbol:    GetOrNil(symbols, i),
+			Network:   GetOrNil(networks, i),
+			TimeStamp: strconv.FormatInt(now.Unix(), 10),
+		}
+		pool, ok := pools[coinID]
+		if !ok {
+			continue
+		}
+		if cachedPrice, exists := cachedPrices[coinID]; exists {
+			results[i].Price = &cachedPrice
+			results[i].PriceProvenance = cachedProvenance(-1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, pool ammPool) {
+			defer wg.Done()
+			price, err := s.poolPrice(chainIds[i], pool)
+			if err != nil {
+				s.logger.Err(err).Msgf("AmmPoolService 获取 %s 池子价格失败, pool: %s", coinIDs[i], pool.Pool)
+				return
+			}
+			if price == nil {
+				return
+			}
+
+			priceStr := strconv.FormatFloat(*price, 'f', -1, 64)
+			s.redisClient.SetCurrentPriceCache(coinIDs[i], priceStr)
+			mu.Lock()
+			defer mu.Unlock()
+			results[i].Price = &priceStr
+			results[i].PriceProvenance = upstreamProvenance(now.Unix())
+			pricesToSave = append(pricesToSave, schema.CoinHistoricalPrice{
+				CoinID:  coinIDs[i],
+				Date:    now.Unix(),
+				DayDate: now.Format("02-01-2006"),
+				Price:   priceStr,
+				Source:  SourceAmmPool,
+			})
+		}(i, pool)
+	}
+	wg.Wait()
+
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(pricesToSave); err != nil {
+		s.logger.Err(err).Msg("AmmPoolService 保存价格失败")
+	}
+	return results, nil
+}
+
+// knownUsdPrice 已知的代币 USD 价格，unixTimeStamp 为 0 时优先取当前价格缓存，其次取最近保存的价格，否则取当天保存的价格
+func knownUsdPrice(redisClient *shared.RedisClient, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, coinID string, unixTimeStamp int64) (float64, error) {
+	var price string
+	if unixTimeStamp > 0 && time.Unix(unixTimeStamp, 0).Format("02-01-2006") != time.Now().Format("02-01-2006") {
+		prices, err := coinHistoricalPriceRepo.GetHistoricalPrices([]string{coinID}, []int64{unixTimeStamp})
+		if err != nil {
+			return 0, err
+		}
+		price = prices[coinID+"_"+time.Unix(unixTimeStamp, 0).Format("02-01-2006")]
+	} else {
+		cached, err := redisClient.GetCurrentPriceCache(coinID)
+		if err == nil && cached != "" {
+			price = cached
+		} else {
+			latest, err := coinHistoricalPriceRepo.GetLatestPrices([]string{coinID})
+			if err != nil {
+				return 0, err
+			}
+			price = latest[coinID]
+		}
+	}
+	if price == "" {
+		return 0, fmt.Errorf("no usd price for %s", coinID)
+	}
+	return strconv.ParseFloat(price, 64)
+}
+
+// poolPrice 计算代币的 USD 价格，流动性不足时返回 nil
+func (s *ammPoolService) poolPrice(chainId string, pool ammPool) (*float64, error) {
+	quoteUsd, err := knownUsdPrice(s.redisClient, s.coinHistoricalPriceRepo, chainId+"_"+pool.Quote, 0)
+	if err != nil {
+		return nil, err
+	}
+	tokenDecimals, err := s.rpcClient.Decimals(chainId, pool.Token)
+	if err != nil {
+		return nil, err
+	}
+	quoteDecimals, err := s.rpcClient.Decimals(chainId, pool.Quote)
+	if err != nil {
+		return nil, err
+	}
+	token0, err := s.poolToken(chainId, pool.Pool, ammToken0)
+	if err != nil {
+		return nil, err
+	}
+	token1, err := s.poolToken(chainId, pool.Pool, ammToken1)
+	if err != nil {
+		return nil, err
+	}
+	tokenIsToken0 := token0 == pool.Token && token1 == pool.Quote
+	if !tokenIsToken0 && !(token1 == pool.Token && token0 == pool.Quote) {
+		return nil, fmt.Errorf("pool %s does not pair %s with %s", pool.Pool, pool.Token, pool.Quote)
+	}
+
+	poolType := pool.Type
+	var slot0 []*big.Int
+	if poolType == "" || poolType == AmmPoolUniswapV3 {
+		slot0, err = s.call(chainId, pool.Pool, ammSlot0)
+		var rpcErr *shared.RpcError
+		if poolType == "" && errors.As(err, &rpcErr) {
+			poolType, err = AmmPoolUniswapV2, nil
+		} else if err == nil {
+			poolType = AmmPoolUniswapV3
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// priceInQuote 为 1 个代币可兑换的报价代币数量，quoteLiquidity 为池子中报价代币的数量
+	var priceInQuote, quoteLiquidity *big.Float
+	scale := new(big.Float).Quo(pow10(tokenDecimals), pow10(quoteDecimals))
+	switch poolType {
+	case AmmPoolUniswapV2:
+		reserves, err := s.call(chainId, pool.Pool, ammGetReserves)
+		if err != nil {
+			return nil, err
+		}
+		if len(reserves) < 2 {
+			return nil, fmt.Errorf("invalid getReserves response from %s", pool.Pool)
+		}
+		tokenReserve, quoteReserve := reserves[0], reserves[1]
+		if !tokenIsToken0 {
+			tokenReserve, quoteReserve = reserves[1], reserves[0]
+		}
+		if tokenReserve.Sign() == 0 {
+			return nil, nil
+		}
+		priceInQuote = new(big.Float).Quo(new(big.Float).SetInt(quoteReserve), new(big.Float).SetInt(tokenReserve))
+		quoteLiquidity = new(big.Float).SetInt(quoteReserve)
+	case AmmPoolUniswapV3:
+		if len(slot0) == 0 || slot0[0].Sign() == 0 {
+			return nil, fmt.Errorf("invalid slot0 response from %s", pool.Pool)
+		}
+		// sqrtPriceX96^2 / 2^192 为 1 个 token0 可兑换的 token1 数量（最小单位）
+		sqrtPrice := new(big.Float).SetInt(slot0[0])
+		priceInQuote = new(big.Float).Quo(new(big.Float).Mul(sqrtPrice, sqrtPrice), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 192)))
+		if !tokenIsToken0 {
+			priceInQuote = new(big.Float).Quo(big.NewFloat(1), priceInQuote)
+		}
+		balance, err := s.call(chainId, pool.Quote, erc20BalanceOf+shared.AbiEncodeAddress(pool.Pool))
+		if err != nil {
+			return nil, err
+		}
+		if len(balance) == 0 {
+			return nil, fmt.Errorf("invalid balanceOf response from %s", pool.Quote)
+		}
+		quoteLiquidity = new(big.Float).SetInt(balance[0])
+	default:
+		return nil, fmt.Errorf("unsupported pool type: %s", poolType)
+	}
+
+	minLiquidityUsd := s.minLiquidityUsd
+	if pool.MinLiquidityUsd > 0 {
+		minLiquidityUsd = pool.MinLiquidityUsd
+	}
+	// 按报价侧流动性的两倍估算池子的总流动性
+	liquidityUsd, _ := new(big.Float).Quo(quoteLiquidity, pow10(quoteDecimals)).Float64()
+	liquidityUsd *= 2 * quoteUsd
+	if liquidityUsd < minLiquidityUsd {
+		s.logger.Debug().Msgf("AmmPoolService 池子 %s 流动性 %f 低于 %f", pool.Pool, liquidityUsd, minLiquidityUsd)
+		return nil, nil
+	}
+
+	value, _ := new(big.Float).Mul(priceInQuote, scale).Float64()
+	value *= quoteUsd
+	if value <= 0 {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+func (s *ammPoolService) call(chainId, to, data string) ([]*big.Int, error) {
+	result, err := s.rpcClient.EthCall(chainId, to, data, 0)
+	if err != nil {
+		return nil, err
+	}
+	return shared.AbiWords(result)
+}
+
+func (s *ammPoolService) poolToken(chainId, pool, selector string) (string, error) {
+	words, err := s.call(chainId, pool, selector)
+	if err != nil {
+		return "", err
+	}
+	if len(words) == 0 {
+		return "", fmt.Errorf("invalid token response from %s", pool)
+	}
+	return shared.AbiAddress(words[0]), nil
+}
+
+func pow10(n int) *big.Float {
+	return new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
+
+// ammPoolProvider 将 AmmPoolService 适配为 PriceProvider，只支持当前价格
+type ammPoolProvider struct {
+	service AmmPoolService
+}
+
+func NewAmmPoolProvider(service AmmPoolService) PriceProvider {
+	return &ammPoolProvider{service: service}
+}
+
+func (p *ammPoolProvider) Name() string             { return SourceAmmPool }
+func (p *ammPoolProvider) SupportsCurrent() bool    { return true }
+func (p *ammPoolProvider) SupportsHistorical() bool { return false }
+func (p *ammPoolProvider) ListedCoinsOnly() bool    { return true }
+
+func (p *ammPoolProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *ammPoolProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return nil, fmt.Errorf("%s does not support historical prices", SourceAmmPool)
+}
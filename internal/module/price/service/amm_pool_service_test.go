@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStubContractServer 模拟 JSON-RPC 节点，calls 以 "合约地址:calldata" 为键，指定区块的调用以 "合约地址:calldata@区块号" 为键，
+// 未配置的调用返回 revert。节点共有 latestBlock 个区块，区块 n 的时间为 n*10
+func newStubContractServer(calls map[string]string, latestBlock uint64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64             `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var block string
+		json.Unmarshal(req.Params[len(req.Params)-1], &block)
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+
+		if req.Method == "eth_getBlockByNumber" {
+			json.Unmarshal(req.Params[0], &block)
+			number := latestBlock
+			if block != "latest" {
+				number, _ = strconv.ParseUint(strings.TrimPrefix(block, "0x"), 16, 64)
+			}
+			resp["result"] = nil
+			if number <= latestBlock {
+				resp["result"] = map[string]string{"number": fmt.Sprintf("0x%x", number), "timestamp": fmt.Sprintf("0x%x", number*10)}
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		var call struct {
+			To   string `json:"to"`
+			Data string `json:"data"`
+		}
+		json.Unmarshal(req.Params[0], &call)
+		key := call.To + ":" + call.Data
+		if block != "latest" {
+			number, _ := strconv.ParseUint(strings.TrimPrefix(block, "0x"), 16, 64)
+			if result, ok := calls[fmt.Sprintf("%s@%d", key, number)]; ok {
+				resp["result"] = result
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+		}
+		if result, ok := calls[key]; ok {
+			resp["result"] = result
+		} else {
+			resp["error"] = map[string]any{"code": 3, "message": "execution reverted"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func abiResult(values ...*big.Int) string {
+	result := "0x"
+	for _, value := range values {
+		result += shared.AbiEncodeUint(value)
+	}
+	return result
+}
+
+func abiAddressResult(address string) string {
+	return "0x" + shared.AbiEncodeAddress(address)
+}
+
+func newTestRpcClient(rpcURL string) *shared.RpcClient {
+	cfg := koanf.New(".")
+	cfg.Set("loadbalances", []map[string]any{{"id": 1, "endpoints": []map[string]any{{"url": rpcURL}}}})
+	return shared.NewRpcClient(cfg, zerolog.Nop())
+}
+
+func TestAmmPoolService_GetBatchCurrentPrices(t *testing.T) {
+	const (
+		usdc      = "0x00000000000000000000000000000000000000a0"
+		tokenV2   = "0x00000000000000000000000000000000000000b1"
+		tokenV3   = "0x00000000000000000000000000000000000000b2"
+		tokenThin = "0x00000000000000000000000000000000000000b3"
+		poolV2    = "0x00000000000000000000000000000000000000c1"
+		poolV3    = "0x00000000000000000000000000000000000000c2"
+		poolThin  = "0x00000000000000000000000000000000000000c3"
+	)
+	e := func(n int64) *big.Int { return new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil) }
+	mul := func(a int64, b *big.Int) *big.Int { return new(big.Int).Mul(big.NewInt(a), b) }
+
+	// V3 池子中 token0 为 USDC，1 个 tokenV3 价值 2000 USDC，即 1 USDC 最小单位可兑换 5e8 个 tokenV3 最小单位
+	sqrtPrice, _ := new(big.Float).Mul(new(big.Float).Sqrt(big.NewFloat(5e8)), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))).Int(nil)
+
+	server := newStubContractServer(map[string]string{
+		usdc + ":0x313ce567":      abiResult(big.NewInt(6)),
+		tokenV2 + ":0x313ce567":   abiResult(big.NewInt(18)),
+		tokenV3 + ":0x313ce567":   abiResult(big.NewInt(18)),
+		tokenThin + ":0x313ce567": abiResult(big.NewInt(18)),
+
+		poolV2 + ":" + ammToken0:      abiAddressResult(tokenV2),
+		poolV2 + ":" + ammToken1:      abiAddressResult(usdc),
+		poolV2 + ":" + ammGetReserves: abiResult(mul(1000, e(18)), mul(2000000, e(6)), big.NewInt(0)),
+
+		poolV3 + ":" + ammToken0: abiAddressResult(usdc),
+		poolV3 + ":" + ammToken1: abiAddressResult(tokenV3),
+		poolV3 + ":" + ammSlot0:  abiResult(sqrtPrice, big.NewInt(0)),
+		usdc + ":" + erc20BalanceOf + shared.AbiEncodeAddress(poolV3): abiResult(mul(1000000, e(6))),
+
+		poolThin + ":" + ammToken0:      abiAddressResult(tokenThin),
+		poolThin + ":" + ammToken1:      abiAddressResult(usdc),
+		poolThin + ":" + ammGetReserves: abiResult(mul(1, e(18)), mul(2000, e(6)), big.NewInt(0)),
+	}, 100)
+	defer server.Close()
+
+	poolCoin := func(token, pool, poolType string) schema.Coins {
+		attributes := `{"pool":"` + pool + `","type":"` + poolType + `"}`
+		quote := usdc
+		return schema.Coins{ID: "1_" + token, ChainID: "1", Address: token, QuoteTokenAddress: &quote, PoolAttributes: &attributes}
+	}
+	coins := stubCoinRepo{}
+	coins.UpsertCoins([]schema.Coins{
+		poolCoin(tokenV2, poolV2, ""),
+		poolCoin(tokenV3, poolV3, AmmPoolUniswapV3),
+		poolCoin(tokenThin, poolThin, AmmPoolUniswapV2),
+	})
+	historicalRepo := &stubHistoricalPriceRepo{latest: map[string]string{"1_" + usdc: "1"}}
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	s := NewAmmPoolService(koanf.New("."), newTestRpcClient(server.URL), coins, historicalRepo, redisClient, zerolog.Nop())
+
+	addresses := []string{tokenV2, tokenV3, tokenThin, "0x00000000000000000000000000000000000000ff"}
+	results, err := NewAmmPoolProvider(s).GetBatchCurrentPrices(addresses, []string{"1", "1", "1", "1"}, nil, nil, false)
+	assert.NoError(t, err)
+	if assert.NotNil(t, results[0].Price) {
+		assert.Equal(t, "2000", *results[0].Price)
+	}
+	if assert.NotNil(t, results[1].Price) {
+		price, _ := new(big.Float).SetString(*results[1].Price)
+		value, _ := price.Float64()
+		assert.InDelta(t, 2000, value, 1e-6)
+	}
+	// 流动性 4000 USD 低于默认的 10000 USD
+	assert.Nil(t, results[2].Price)
+	assert.Nil(t, results[3].Price)
+	assert.Len(t, historicalRepo.saved, 2)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// 未配置 backfill.requestsPerMinute 时每分钟的区间请求数
+	defaultBackfillRequestsPerMinute = 30
+	// 同一段连续失败达到该次数后跳过
+	backfillMaxAttempts = 3
+	// 一个任务最多包含的代币数
+	backfillMaxCoins = 10000
+)
+
+// BackfillRequest 创建回填任务的参数，CoinIDs 和 ChainIDs 至少指定一个，ChainIDs 表示 coins 表中这些链上的所有代币
+type BackfillRequest struct {
+	CoinIDs     []string
+	ChainIDs    []string
+	From        int64
+	To          int64
+	Granularity string
+}
+
+// BackfillError 回填任务参数无效或任务不存在
+type BackfillError struct {
+	Message string
+}
+
+func (e *BackfillError) Error() string {
+	return "invalid backfill: " + e.Message
+}
+
+// BackfillService 在后台按代币逐段回填历史价格，进度保存在 backfill_jobs 中，重启后从检查点继续
+type BackfillService interface {
+	CreateJob(request BackfillRequest) (*schema.BackfillJob, error)
+	GetJob(id uint64) (*schema.BackfillJob, error)
+	ListJobs(limit int) ([]schema.BackfillJob, error)
+	CancelJob(id uint64) (*schema.BackfillJob, error)
+	// RunPending 由定时任务调用，在 budget 内继续执行最早的未结束任务
+	RunPending(budget time.Duration) error
+}
+
+type backfillService struct {
+	priceService PriceService
+	jobRepo      repository.BackfillJobRepository
+	interval     time.Duration // 两次区间请求之间的最短间隔
+	logger       zerolog.Logger
+}
+
+func NewBackfillService(cfg *koanf.Koanf, priceService PriceService, jobRepo repository.BackfillJobRepository, logger zerolog.Logger) BackfillService {
+	requestsPerMinute := cfg.Int("backfill.requestsPerMinute")
+	if requestsPerMinute <= 0 {
+		requestsPerMinute = defaultBackfillRequestsPerMinute
+	}
+	return &backfillService{
+		priceService: priceService,
+		jobRepo:      jobRepo,
+		interval:     time.Minute / time.Duration(requestsPerMinute),
+		logger:       logger,
+	}
+}
+
+func (s *backfillService) CreateJob(request BackfillRequest) (*schema.BackfillJob, error) {
+	granularity, err := shared.ParseGranularity(request.Granularity)
+	if err != nil {
+		return nil, &BackfillError{Message: err.Error()}
+	}
+	if now := time.Now().Unix(); request.To <= 0 || request.To > now {
+		request.To = now
+	}
+	if request.From <= 0 || request.From > request.To {
+		return nil, &BackfillError{Message: "from is required and must not be after to"}
+	}
+
+	var coinIDs []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if id = shared.NormalizeCoinID(strings.TrimSpace(id)); id != "" && !seen[id] {
+			seen[id] = true
+			coinIDs = append(coinIDs, id)
+		}
+	}
+	for _, id := range request.CoinIDs {
+		if chainID, address, ok := strings.Cut(strings.TrimSpace(id), "_"); !ok || chainID == "" || address == "" {
+			return nil, &BackfillError{Message: "invalid coin id: " + id}
+		}
+		add(id)
+	}
+	if len(request.ChainIDs) > 0 {
+		ids, err := s.jobRepo.CoinIDsByChain(request.ChainIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			add(id)
+		}
+	}
+	if len(coinIDs) == 0 {
+		return nil, &BackfillError{Message: "no coins to backfill"}
+	}
+	if len(coinIDs) > backfillMaxCoins {
+		return nil, &BackfillError{Message: fmt.Sprintf("a job may contain at most %d coins", backfillMaxCoins)}
+	}
+
+	job := &schema.BackfillJob{
+		CoinIDs:     coinIDs,
+		From:        shared.BucketStart(granularity, request.From),
+		To:          request.To,
+		Granularity: granularity,
+		Status:      repository.BackfillStatusPending,
+	}
+	if err := s.jobRepo.CreateJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *backfillService) GetJob(id uint64) (*schema.BackfillJob, error) {
+	job, err := s.jobRepo.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, &BackfillError{Message: fmt.Sprintf("job %d not found", id)}
+	}
+	return job, nil
+}
+
+func (s *backfillService) ListJobs(limit int) ([]schema.BackfillJob, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return s.jobRepo.ListJobs(limit)
+}
+
+func (s *backfillService) CancelJob(id uint64) (*schema.BackfillJob, error) {
+	job, err := s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	cancelled, err := s.jobRepo.CancelJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, &BackfillError{Message: fmt.Sprintf("job %d is already %s", id, job.Status)}
+	}
+	return s.GetJob(id)
+}
+
+func (s *backfillService) RunPending(budget time.Duration) error {
+	job, err := s.jobRepo.NextJob()
+	if err != nil || job == nil {
+		return err
+	}
+	deadline := time.Now().Add(budget)
+	if job.Status == repository.BackfillStatusPending {
+		now := time.Now()
+		job.Status = repository.BackfillStatusRunning
+		job.StartedAt = &now
+	}
+	for {
+		finished, throttled := s.step(job)
+		if finished {
+			now := time.Now()
+			job.Status = repository.BackfillStatusCompleted
+			job.FinishedAt = &now
+		}
+		saved, err := s.jobRepo.SaveProgress(job)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			s.logger.Info().Msgf("回填任务 %d 已取消", job.ID)
+			return nil
+		}
+		// 请求失败或被节流时等到下一次定时任务再重试，避免持续触发上游限流
+		if finished || throttled || job.Attempts > 0 || time.Now().Add(s.interval).After(deadline) {
+			return nil
+		}
+		time.Sleep(s.interval)
+	}
+}
+
+// step 回填当前代币的下一段并推进检查点，返回任务是否已完成，代币被节流时不请求也不推进检查点
+func (s *backfillService) step(job *schema.BackfillJob) (bool, bool) {
+	if job.CoinIndex >= len(job.CoinIDs) {
+		return true, false
+	}
+	coinID := job.CoinIDs[job.CoinIndex]
+	from := job.Cursor
+	if from == 0 {
+		from = job.From
+	}
+	to, next, intervals := backfillChunk(job.Granularity, from, job.To)
+
+	chainID, address, _ := strings.Cut(coinID, "_")
+	if s.priceService.RangeThrottled(chainID, address, job.Granularity) {
+		s.logger.Info().Msgf("回填任务 %d 的代币 %s 被节流，等待下一次执行", job.ID, coinID)
+		return false, true
+	}
+	series, err := s.priceService.GetHistoricalPriceRange(chainID, address, from, to, job.Granularity)
+	if err != nil {
+		job.Attempts++
+		job.LastError = fmt.Sprintf("%s: %v", coinID, err)
+		s.logger.Err(err).Msgf("回填任务 %d 获取 %s 历史价格失败", job.ID, coinID)
+		if job.Attempts < backfillMaxAttempts {
+			return false, false
+		}
+		job.Skipped++
+	} else {
+		job.Filled += int64(len(series.Prices))
+		job.Missing += int64(intervals - len(series.Prices))
+	}
+	job.Attempts = 0
+
+	if next == 0 {
+		job.CoinIndex++
+		job.Cursor = 0
+	} else {
+		job.Cursor = next
+	}
+	return job.CoinIndex >= len(job.CoinIDs), false
+}
+
+// backfillChunk 返回从 from 开始、不超过 until 的一段的结束时间、下一段的开始时间及其包含的时间段数，
+// 每段最多 maxRangePoints 个时间段，没有下一段时 next 为 0
+func backfillChunk(granularity string, from, until int64) (int64, int64, int) {
+	step := int64(shared.GranularityDuration(granularity).Seconds())
+	seen := make(map[string]bool)
+	for ts := shared.BucketStart(granularity, from); ts <= until; ts += step {
+		// 与 rangeBuckets 一致，按 day_date 去重处理夏令时
+		dayDate := shared.BucketDate(granularity, ts)
+		if seen[dayDate] {
+			continue
+		}
+		if len(seen) == maxRangePoints {
+			next := shared.BucketStart(granularity, ts)
+			return next - 1, next, len(seen)
+		}
+		seen[dayDate] = true
+	}
+	return until, 0, len(seen)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubBackfillJobRepo 在内存中保存回填任务
+type stubBackfillJobRepo struct {
+	jobs  []schema.BackfillJob
+	coins map[string][]string
+}
+
+func (r *stubBackfillJobRepo) CreateJob(job *schema.BackfillJob) error {
+	job.ID = uint64(len(r.jobs) + 1)
+	r.jobs = append(r.jobs, *job)
+	return nil
+}
+
+func (r *stubBackfillJobRepo) GetJob(id uint64) (*schema.BackfillJob, error) {
+	if id == 0 || int(id) > len(r.jobs) {
+		return nil, nil
+	}
+	job := r.jobs[id-1]
+	return &job, nil
+}
+
+func (r *stubBackfillJobRepo) ListJobs(limit int) ([]schema.BackfillJob, error) {
+	return r.jobs, nil
+}
+
+func (r *stubBackfillJobRepo) active(id uint64) bool {
+	status := r.jobs[id-1].Status
+	return status == repository.BackfillStatusPending || status == repository.BackfillStatusRunning
+}
+
+func (r *stubBackfillJobRepo) NextJob() (*schema.BackfillJob, error) {
+	for i := range r.jobs {
+		if r.active(r.jobs[i].ID) {
+			job := r.jobs[i]
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *stubBackfillJobRepo) SaveProgress(job *schema.BackfillJob) (bool, error) {
+	if !r.active(job.ID) {
+		return false, nil
+	}
+	r.jobs[job.ID-1] = *job
+	return true, nil
+}
+
+func (r *stubBackfillJobRepo) CancelJob(id uint64) (bool, error) {
+	if !r.active(id) {
+		return false, nil
+	}
+	r.jobs[id-1].Status = repository.BackfillStatusCancelled
+	return true, nil
+}
+
+func (r *stubBackfillJobRepo) CoinIDsByChain(chainIDs []string) ([]string, error) {
+	var ids []string
+	for _, chainID := range chainIDs {
+		ids = append(ids, r.coins[chainID]...)
+	}
+	return ids, nil
+}
+
+// stubRangePriceService 每个时间段隔一个返回价格，failures 中的代币返回错误，throttled 中的代币被节流
+type stubRangePriceService struct {
+	PriceService
+	failures  map[string]bool
+	throttled map[string]bool
+	calls     []string
+}
+
+func (s *stubRangePriceService) RangeThrottled(chainId, address, granularity string) bool {
+	return s.throttled[chainId+"_"+address]
+}
+
+func (s *stubRangePriceService) GetHistoricalPriceRange(chainId, address string, from, to int64, granularity string) (*PriceSeries, error) {
+	s.calls = append(s.calls, fmt.Sprintf("%s_%s:%d-%d", chainId, address, from, to))
+	if s.failures[chainId+"_"+address] {
+		return nil, fmt.Errorf("429 Too Many Requests")
+	}
+	series := &PriceSeries{ChainID: chainId, Address: address, Interval: granularity, From: from, To: to}
+	dayDates, starts := rangeBuckets(granularity, from, to)
+	for i, dayDate := range dayDates {
+		if i%2 == 0 {
+			series.Prices = append(series.Prices, PricePoint{TimeStamp: starts[dayDate], Price: "1"})
+		}
+	}
+	return series, nil
+}
+
+func TestBackfillService_Run(t *testing.T) {
+	repo := &stubBackfillJobRepo{coins: map[string][]string{"56": {"56_0xb", "1_0xa"}}}
+	prices := &stubRangePriceService{failures: map[string]bool{"56_0xb": true}}
+	s := &backfillService{priceService: prices, jobRepo: repo, logger: zerolog.Nop()}
+
+	_, err := s.CreateJob(BackfillRequest{CoinIDs: []string{"0xa"}, From: 1})
+	assert.IsType(t, &BackfillError{}, err)
+	_, err = s.CreateJob(BackfillRequest{CoinIDs: []string{"1_0xa"}, From: 1, Granularity: "1w"})
+	assert.IsType(t, &BackfillError{}, err)
+
+	// 链上的代币与指定的代币合并去重，1h 粒度 1500 个时间段分为两段
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	to := from + 1499*3600
+	job, err := s.CreateJob(BackfillRequest{CoinIDs: []string{"1_0xA"}, ChainIDs: []string{"56"}, From: from, To: to, Granularity: "1h"})
+	assert.NoError(t, err)
+	assert.Equal(t, schema.JSONStrings{"1_0xa", "56_0xb"}, job.CoinIDs)
+	assert.Equal(t, repository.BackfillStatusPending, job.Status)
+
+	// 每段完成后保存检查点，预算用完时停止
+	assert.NoError(t, s.RunPending(0))
+	job, _ = s.GetJob(job.ID)
+	assert.Equal(t, repository.BackfillStatusRunning, job.Status)
+	assert.NotNil(t, job.StartedAt)
+	assert.Equal(t, 0, job.CoinIndex)
+	assert.Equal(t, from+1000*3600, job.Cursor)
+	assert.Equal(t, int64(500), job.Filled)
+	assert.Equal(t, int64(500), job.Missing)
+
+	// 失败时不推进检查点并等待下一次执行，连续失败达到上限后跳过该段
+	assert.NoError(t, s.RunPending(time.Minute))
+	job, _ = s.GetJob(job.ID)
+	assert.Equal(t, 1, job.CoinIndex)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Contains(t, job.LastError, "56_0xb")
+	assert.Equal(t, int64(750), job.Filled)
+	for i := 0; i < backfillMaxAttempts-1; i++ {
+		assert.NoError(t, s.RunPending(time.Minute))
+	}
+	job, _ = s.GetJob(job.ID)
+	assert.Equal(t, int64(1), job.Skipped)
+	assert.Equal(t, from+1000*3600, job.Cursor)
+	assert.Equal(t, 1, job.Attempts)
+
+	// 代币被节流时不请求也不推进检查点
+	prices.throttled = map[string]bool{"56_0xb": true}
+	calls := len(prices.calls)
+	assert.NoError(t, s.RunPending(time.Minute))
+	assert.Len(t, prices.calls, calls)
+	job, _ = s.GetJob(job.ID)
+	assert.Equal(t, 1, job.CoinIndex)
+	assert.Equal(t, 1, job.Attempts)
+	prices.throttled = nil
+
+	// 取消后不再执行
+	_, err = s.CancelJob(job.ID)
+	assert.NoError(t, err)
+	calls = len(prices.calls)
+	assert.NoError(t, s.RunPending(time.Minute))
+	assert.Len(t, prices.calls, calls)
+	_, err = s.CancelJob(job.ID)
+	assert.IsType(t, &BackfillError{}, err)
+
+	// 每次执行至少完成一段，直到所有代币完成
+	prices.failures = nil
+	job, err = s.CreateJob(BackfillRequest{CoinIDs: []string{"1_0xa"}, From: from, To: to, Granularity: "1h"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.RunPending(0))
+	assert.NoError(t, s.RunPending(0))
+	job, _ = s.GetJob(job.ID)
+	assert.Equal(t, repository.BackfillStatusCompleted, job.Status)
+	assert.NotNil(t, job.FinishedAt)
+	assert.Equal(t, int64(1500), job.Filled+job.Missing)
+
+	_, err = s.GetJob(99)
+	assert.IsType(t, &BackfillError{}, err)
+}
+
+func TestBackfillChunk(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 30, 0, 0, time.Local).Unix()
+	until := from + 2500*86400
+	to, next, intervals := backfillChunk(shared.GranularityDay, from, until)
+	assert.Equal(t, maxRangePoints, intervals)
+	assert.Equal(t, next-1, to)
+	assert.Equal(t, shared.BucketStart(shared.GranularityDay, next), next)
+	dayDates, _ := rangeBuckets(shared.GranularityDay, from, to)
+	assert.Len(t, dayDates, maxRangePoints)
+
+	to, next, intervals = backfillChunk(shared.GranularityDay, from, from+86400)
+	assert.Equal(t, from+86400, to)
+	assert.Equal(t, int64(0), next)
+	assert.Equal(t, 2, intervals)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// 每次请求的交易对数量
+const cexTickerBatchSize = 100
+
+// CexTickerService 从兼容 Binance 接口的中心化交易所获取盘口中间价，交易对需配置在 cex_symbols 表中
+type CexTickerService interface {
+	Enabled() bool
+	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
+}
+
+type cexTickerService struct {
+	baseURL                 string
+	timeout                 int
+	cexSymbolRepo           repository.CexSymbolRepository
+	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	redisClient             *shared.RedisClient
+	logger                  zerolog.Logger
+}
+
+func NewCexTickerService(cfg *koanf.Koanf, cexSymbolRepo repository.CexSymbolRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, redisClient *shared.RedisClient, logger zerolog.Logger) CexTickerService {
+	return &cexTickerService{
+		baseURL:                 strings.TrimRight(cfg.String("cex.baseUrl"), "/"),
+		timeout:                 cfg.Int("cex.timeout"),
+		cexSymbolRepo:           cexSymbolRepo,
+		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		redisClient:             redisClient,
+		logger:                  logger,
+	}
+}
+
+// Enabled 未配置 cex.baseUrl 时不参与查询
+func (s *cexTickerService) Enabled() bool {
+	return s.baseURL != ""
+}
+
+func (s *cexTickerService) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	if len(chainIds) != len(addresses) {
+		return nil, fmt.Errorf("chainIds and addresses must have the same length")
+	}
+	coinIDs := make([]string, len(addresses))
+	for i, address := range addresses {
+		coinIDs[i] = chainIds[i] + "_" + address
+	}
+	pairs, err := s.cexSymbolRepo.GetSymbols(coinIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var cachedPrices map[string]string
+	if isCache {
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
+	results := make([]PriceResult, len(addresses))
+	var toFetch []string
+	for i, coinID := range coinIDs {
+		results[i] = PriceResult{
+			ChainID:   chainIds[i],
+			Address:   addresses[i],
+			Symbol:    GetOrNil(symbols, i),
+			Network:   GetOrNil(networks, i),
+			TimeStamp: strconv.FormatInt(time.Now().Unix(), 10),
+		}
+		pair, ok := pairs[coinID]
+		if !ok {
+			continue
+		}
+		if cachedPrice, exists := cachedPrices[coinID]; exists {
+			results[i].Price = &cachedPrice
+			results[i].PriceProvenance = cachedProvenance(-1)
+			continue
+		}
+		toFetch = append(toFetch, pair)
+	}
+	if len(toFetch) == 0 {
+		return results, nil
+	}
+
+	midPrices, err := s.fetchMidPrices(toFetch)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var pricesToSave []schema.CoinHistoricalPrice
+	for i, coinID := range coinIDs {
+		if results[i].Price != nil {
+			continue
+		}
+		midPrice, ok := midPrices[pairs[coinID]]
+		if !ok {
+			continue
+		}
+		priceStr := strconv.FormatFloat(midPrice, 'f', -1, 64)
+		results[i].Price = &priceStr
+		results[i].PriceProvenance = upstreamProvenance(now.Unix())
+
+		s.redisClient.SetCurrentPriceCache(coinID, priceStr)
+		pricesToSave = append(pricesToSave, schema.CoinHistoricalPrice{
+			CoinID:  coinID,
+			Date:    now.Unix(),
+			DayDate: now.Format("02-01-2006"),
+			Price:   priceStr,
+			Source:  SourceCex,
+		})
+	}
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(pricesToSave); err != nil {
+		s.logger.Err(err).Msg("CexTickerService 保存价格失败")
+	}
+	return results, nil
+}
+
+// cexBookTicker bookTicker 接口返回的盘口数据
+type cexBookTicker struct {
+	Symbol   string `json:"symbol"`
+	BidPrice string `json:"bidPrice"`
+	AskPrice string `json:"askPrice"`
+}
+
+// fetchMidPrices 批量获取交易对的盘口中间价，批量请求中包含无效交易对时逐个重试
+func (s *cexTickerService) fetchMidPrices(pairs []string) (map[string]float64, error) {
+	midPrices := make(map[string]float64)
+	for start := 0; start < len(pairs); start += cexTickerBatchSize {
+		end := start + cexTickerBatchSize
+		if end > len(pairs) {
+			end = len(pairs)
+		}
+		batch := pairs[start:end]
+		symbolsJSON, _ := json.Marshal(batch)
+		tickers, statusCode, err := s.bookTickers(fmt.Sprintf("%s/api/v3/ticker/bookTicker?symbols=%s", s.baseURL, url.QueryEscape(string(symbolsJSON))), true)
+		if err != nil && statusCode == http.StatusBadRequest && len(batch) > 1 {
+			tickers = nil
+			for _, pair := range batch {
+				ticker, _, err := s.bookTickers(fmt.Sprintf("%s/api/v3/ticker/bookTicker?symbol=%s", s.baseURL, url.QueryEscape(pair)), false)
+				if err != nil {
+					s.logger.Debug().Err(err).Msgf("CexTickerService 获取 %s 盘口失败", pair)
+					continue
+				}
+				tickers = append(tickers, ticker...)
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, ticker := range tickers {
+			bid, bidErr := strconv.ParseFloat(ticker.BidPrice, 64)
+			ask, askErr := strconv.ParseFloat(ticker.AskPrice, 64)
+			if bidErr != nil || askErr != nil || bid <= 0 || ask <= 0 {
+				continue
+			}
+			midPrices[ticker.Symbol] = (bid + ask) / 2
+		}
+	}
+	return midPrices, nil
+}
+
+// bookTickers 请求 bookTicker 接口，batch 为 true 时响应为数组
+func (s *cexTickerService) bookTickers(requestURL string, batch bool) ([]cexBookTicker, int, error) {
+	headers := map[string]string{
+		"accept": "application/json",
+	}
+	body, statusCode, err := shared.DoRequest(http.DefaultClient, requestURL, headers, s.timeout)
+	if err != nil {
+		if statusCode != http.StatusBadRequest && statusCode != http.StatusTooManyRequests {
+			shared.HandleErrorWithThrottling(s.redisClient, s.logger, "CexTickerService-bookTickers", fmt.Sprintf("url: %s, status code: %d, response: %s", requestURL, statusCode, string(body)))
+		}
+		return nil, statusCode, err
+	}
+	if !batch {
+		var ticker cexBookTicker
+		if err := shared.ParseJSONResponse(body, &ticker); err != nil {
+			return nil, statusCode, err
+		}
+		return []cexBookTicker{ticker}, statusCode, nil
+	}
+	var tickers []cexBookTicker
+	if err := shared.ParseJSONResponse(body, &tickers); err != nil {
+		return nil, statusCode, err
+	}
+	return tickers, statusCode, nil
+}
+
+// cexTickerProvider 将 CexTickerService 适配为 PriceProvider，只支持当前价格
+type cexTickerProvider struct {
+	service CexTickerService
+}
+
+func NewCexTickerProvider(service CexTickerService) PriceProvider {
+	return &cexTickerProvider{service: service}
+}
+
+func (p *cexTickerProvider) Name() string             { return SourceCex }
+func (p *cexTickerProvider) SupportsCurrent() bool    { return p.service.Enabled() }
+func (p *cexTickerProvider) SupportsHistorical() bool { return false }
+func (p *cexTickerProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *cexTickerProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *cexTickerProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return nil, fmt.Errorf("%s does not support historical prices", SourceCex)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCexSymbolRepo map[string]string
+
+func (r stubCexSymbolRepo) GetSymbols(coinIDs []string) (map[string]string, error) {
+	symbols := make(map[string]string)
+	for _, coinID := range coinIDs {
+		if symbol, ok := r[coinID]; ok {
+			symbols[coinID] = symbol
+		}
+	}
+	return symbols, nil
+}
+
+// newStubCexServer 模拟 Binance bookTicker 接口，批量请求中包含未知交易对时返回 400
+func newStubCexServer(tickers map[string]cexBookTicker) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/ticker/bookTicker" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if symbol := r.URL.Query().Get("symbol"); symbol != "" {
+			ticker, ok := tickers[symbol]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+				return
+			}
+			json.NewEncoder(w).Encode(ticker)
+			return
+		}
+		var symbols []string
+		json.Unmarshal([]byte(r.URL.Query().Get("symbols")), &symbols)
+		var result []cexBookTicker
+		for _, symbol := range symbols {
+			ticker, ok := tickers[symbol]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+				return
+			}
+			result = append(result, ticker)
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+}
+
+func newTestCexTickerService(baseURL string, symbols stubCexSymbolRepo, historicalRepo *stubHistoricalPriceRepo) *cexTickerService {
+	// 不可用的 Redis 地址，写缓存失败会被忽略
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	return &cexTickerService{
+		baseURL:                 strings.TrimRight(baseURL, "/"),
+		cexSymbolRepo:           symbols,
+		coinHistoricalPriceRepo: historicalRepo,
+		redisClient:             redisClient,
+		logger:                  zerolog.Nop(),
+	}
+}
+
+func TestCexTickerService_FetchMidPrices(t *testing.T) {
+	server := newStubCexServer(map[string]cexBookTicker{
+		"BTCUSDT": {Symbol: "BTCUSDT", BidPrice: "60000", AskPrice: "60002"},
+		"ETHUSDT": {Symbol: "ETHUSDT", BidPrice: "3000.5", AskPrice: "3001.5"},
+		"BADUSDT": {Symbol: "BADUSDT", BidPrice: "0", AskPrice: "1"},
+	})
+	defer server.Close()
+	s := newTestCexTickerService(server.URL, nil, &stubHistoricalPriceRepo{})
+
+	midPrices, err := s.fetchMidPrices([]string{"BTCUSDT", "ETHUSDT", "BADUSDT"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"BTCUSDT": 60001, "ETHUSDT": 3001}, midPrices)
+
+	// 包含无效交易对时逐个重试，其他交易对不受影响
+	midPrices, err = s.fetchMidPrices([]string{"BTCUSDT", "UNKNOWN"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"BTCUSDT": 60001}, midPrices)
+}
+
+func TestCexTickerProvider_GetBatchCurrentPrices(t *testing.T) {
+	server := newStubCexServer(map[string]cexBookTicker{
+		"ETHUSDT": {Symbol: "ETHUSDT", BidPrice: "3000", AskPrice: "3002"},
+	})
+	defer server.Close()
+	historicalRepo := &stubHistoricalPriceRepo{}
+	weth := "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+	s := newTestCexTickerService(server.URL, stubCexSymbolRepo{"1_" + weth: "ETHUSDT"}, historicalRepo)
+	provider := NewCexTickerProvider(s)
+
+	assert.Equal(t, SourceCex, provider.Name())
+	assert.True(t, provider.SupportsCurrent())
+	assert.False(t, provider.SupportsHistorical())
+
+	results, err := provider.GetBatchCurrentPrices([]string{weth, "0xunmapped"}, []string{"1", "1"}, []string{"WETH", ""}, []string{"ethereum", "ethereum"}, false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "3001", *results[0].Price)
+	assert.False(t, *results[0].FromCache)
+	assert.Nil(t, results[1].Price)
+
+	assert.Len(t, historicalRepo.saved, 1)
+	assert.Equal(t, "1_"+weth, historicalRepo.saved[0].CoinID)
+	assert.Equal(t, SourceCex, historicalRepo.saved[0].Source)
+
+	assert.False(t, NewCexTickerProvider(newTestCexTickerService("", nil, historicalRepo)).SupportsCurrent())
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// Chainlink 聚合器方法选择器
+const (
+	chainlinkLatestRoundData = "0xfeaf968c"
+	chainlinkGetRoundData    = "0x9a6fc8f5"
+)
+
+const (
+	chainlinkRoundKeyPrefix = "chainlink:round:"
+	chainlinkRoundCacheTTL  = 7 * 24 * time.Hour
+)
+
+var errChainlinkRoundNotFound = errors.New("chainlink round not found")
+
+// ChainlinkService 通过 eth_call 读取 Chainlink 聚合器的报价，喂价地址按链配置在 chainlink.feeds 中
+type ChainlinkService interface {
+	Enabled() bool
+	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
+	GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error)
+}
+
+type chainlinkService struct {
+	feeds                   map[string]string // chainId_token -> 聚合器地址
+	maxAge                  int64
+	rpcClient               *shared.RpcClient
+	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	redisClient             *shared.RedisClient
+	logger                  zerolog.Logger
+}
+
+// chainlinkRound 聚合器的一轮报价
+type chainlinkRound struct {
+	RoundID   *big.Int `json:"-"`
+	Answer    string   `json:"answer"`
+	UpdatedAt int64    `json:"updatedAt"`
+}
+
+func NewChainlinkService(cfg *koanf.Koanf, rpcClient *shared.RpcClient, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, redisClient *shared.RedisClient, logger zerolog.Logger) ChainlinkService {
+	return &chainlinkService{
+		feeds:                   chainlinkFeeds(cfg),
+		maxAge:                  cfg.Int64("chainlink.maxAge"),
+		rpcClient:               rpcClient,
+		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		redisClient:             redisClient,
+		logger:                  logger,
+	}
+}
+
+// chainlinkFeeds 读取 chainlink.feeds.<chainId>.<token> 配置的聚合器地址
+func chainlinkFeeds(cfg *koanf.Koanf) map[string]string {
+	feeds := make(map[string]string)
+	for _, chainId := range cfg.MapKeys("chainlink.feeds") {
+		for token, aggregator := range cfg.StringMap("chainlink.feeds." + chainId) {
+			feeds[shared.CoinID(chainId, token)] = strings.ToLower(aggregator)
+		}
+	}
+	return feeds
+}
+
+func (s *chainlinkService) Enabled() bool {
+	return len(s.feeds) > 0
+}
+
+// feed 返回代币的聚合器地址，链没有配置 RPC 节点时视为没有喂价
+func (s *chainlinkService) feed(chainId, address string) (string, bool) {
+	aggregator, ok := s.feeds[shared.CoinID(chainId, address)]
+	if !ok || !s.rpcClient.HasChain(chainId) {
+		return "", false
+	}
+	return aggregator, true
+}
+
+func (s *chainlinkService) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	if len(chainIds) != len(addresses) {
+		return nil, fmt.Errorf("chainIds and addresses must have the same length")
+	}
+	coinIDs := make([]string, len(addresses))
+	for i, address := range addresses {
+		coinIDs[i] = chainIds[i] + "_" + address
+	}
+	var cachedPrices map[string]string
+	if isCache {
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
+	now := time.Now()
+	results := make([]PriceResult, len(addresses))
+	var pricesToSave []schema.CoinHistoricalPrice
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := range addresses {
+		results[i] = PriceResult{
+			ChainID:   chainIds[i],
+			Address:   addresses[i],
+			Symbol:    GetOrNil(symbols, i),
+			Network:   GetOrNil(networks, i),
+			TimeStamp: strconv.FormatInt(now.Unix(), 10),
+		}
+		aggregator, ok := s.feed(chainIds[i], addresses[i])
+		if !ok {
+			continue
+		}
+		if cachedPrice, exists := cachedPrices[coinIDs[i]]; exists {
+			results[i].Price = &cachedPrice
+			results[i].PriceProvenance = cachedProvenance(-1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, aggregator string) {
+			defer wg.Done()
+			round, err := s.latestRound(chainIds[i], aggregator)
+			if err != nil {
+				s.logger.Err(err).Msgf("ChainlinkService 获取 %s 最新报价失败", coinIDs[i])
+				return
+			}
+			if s.maxAge > 0 && now.Unix()-round.UpdatedAt > s.maxAge {
+				s.logger.Warn().Msgf("ChainlinkService %s 报价已过期, updatedAt: %d", coinIDs[i], round.UpdatedAt)
+				return
+			}
+
+			s.redisClient.SetCurrentPriceCache(coinIDs[i], round.Answer)
+			mu.Lock()
+			defer mu.Unlock()
+			answer := round.Answer
+			results[i].Price = &answer
+			results[i].PriceProvenance = upstreamProvenance(round.UpdatedAt)
+			pricesToSave = append(pricesToSave, schema.CoinHistoricalPrice{
+				CoinID:  coinIDs[i],
+				Date:    now.Unix(),
+				DayDate: now.Format("02-01-2006"),
+				Price:   round.Answer,
+				Source:  SourceChainlink,
+			})
+		}(i, aggregator)
+	}
+	wg.Wait()
+
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(pricesToSave); err != nil {
+		s.logger.Err(err).Msg("ChainlinkService 保存价格失败")
+	}
+	return results, nil
+}
+
+func (s *chainlinkService) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	if len(chainIds) != len(addresses) || len(addresses) != len(unixTimeStamps) {
+		return nil, fmt.Errorf("chainIds, addresses and unixTimeStamps must have the same length")
+	}
+
+	results := make([]PriceResult, len(addresses))
+	var pricesToSave []schema.CoinHistoricalPrice
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := range addresses {
+		results[i] = PriceResult{
+			ChainID:   chainIds[i],
+			Address:   addresses[i],
+			Symbol:    GetOrNil(symbols, i),
+			Network:   GetOrNil(networks, i),
+			TimeStamp: strconv.FormatInt(unixTimeStamps[i], 10),
+		}
+		aggregator, ok := s.feed(chainIds[i], addresses[i])
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, aggregator string) {
+			defer wg.Done()
+			coinID := chainIds[i] + "_" + addresses[i]
+			round, err := s.roundAt(chainIds[i], aggregator, unixTimeStamps[i])
+			if err != nil {
+				s.logger.Err(err).Msgf("ChainlinkService 获取 %s 在 %d 的报价失败", coinID, unixTimeStamps[i])
+				return
+			}
+			if round == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			answer := round.Answer
+			results[i].Price = &answer
+			results[i].PriceProvenance = upstreamProvenance(round.UpdatedAt)
+			pricesToSave = append(pricesToSave, schema.CoinHistoricalPrice{
+				CoinID:  coinID,
+				Date:    unixTimeStamps[i],
+				DayDate: time.Unix(unixTimeStamps[i], 0).Format("02-01-2006"),
+				Price:   round.Answer,
+				Source:  SourceChainlink,
+			})
+		}(i, aggregator)
+	}
+	wg.Wait()
+
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(pricesToSave); err != nil {
+		s.logger.Err(err).Msg("ChainlinkService 保存历史价格失败")
+	}
+	return results, nil
+}
+
+// roundAt 返回 unixTimeStamp 时生效的轮次，即 updatedAt 不晚于 unixTimeStamp 的最后一轮，没有时返回 nil
+// roundId 的高位为 phaseId，低 64 位为该 phase 内从 1 开始递增的轮次，聚合器升级后 phaseId 加一
+func (s *chainlinkService) roundAt(chainId, aggregator string, unixTimeStamp int64) (*chainlinkRound, error) {
+	latest, err := s.latestRound(chainId, aggregator)
+	if err != nil {
+		return nil, err
+	}
+	if latest.UpdatedAt <= unixTimeStamp {
+		return latest, nil
+	}
+
+	phase := new(big.Int).Rsh(latest.RoundID, 64).Uint64()
+	last := new(big.Int).And(latest.RoundID, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	for ; phase > 0; phase, last = phase-1, 0 {
+		if last == 0 {
+			if last, err = s.lastRoundInPhase(chainId, aggregator, phase); err != nil {
+				return nil, err
+			}
+			if last == 0 {
+				continue
+			}
+			round, err := s.round(chainId, aggregator, phase, last)
+			if err != nil {
+				return nil, err
+			}
+			if round.UpdatedAt <= unixTimeStamp {
+				return round, nil
+			}
+		}
+
+		first, err := s.round(chainId, aggregator, phase, 1)
+		if errors.Is(err, errChainlinkRoundNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first.UpdatedAt > unixTimeStamp {
+			continue
+		}
+
+		// lo 轮次不晚于 unixTimeStamp，last 轮次晚于 unixTimeStamp
+		lo, hi, found := uint64(1), last, first
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			round, err := s.round(chainId, aggregator, phase, mid)
+			if errors.Is(err, errChainlinkRoundNotFound) {
+				hi = mid
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if round.UpdatedAt <= unixTimeStamp {
+				lo, found = mid, round
+			} else {
+				hi = mid
+			}
+		}
+		return found, nil
+	}
+	return nil, nil
+}
+
+// lastRoundInPhase 查找已结束 phase 的最后一轮，phase 不存在时返回 0
+func (s *chainlinkService) lastRoundInPhase(chainId, aggregator string, phase uint64) (uint64, error) {
+	exists := func(n uint64) (bool, error) {
+		_, err := s.round(chainId, aggregator, phase, n)
+		if errors.Is(err, errChainlinkRoundNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	ok, err := exists(1)
+	if err != nil || !ok {
+		return 0, err
+	}
+	lo, hi := uint64(1), uint64(2)
+	for {
+		ok, err := exists(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi, hi*2
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+func (s *chainlinkService) latestRound(chainId, aggregator string) (*chainlinkRound, error) {
+	data, err := s.rpcClient.EthCall(chainId, aggregator, chainlinkLatestRoundData, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.parseRound(chainId, aggregator, data)
+}
+
+// round 读取指定轮次的报价，已完成的轮次不会再变化，结果缓存在 Redis 中
+func (s *chainlinkService) round(chainId, aggregator string, phase, aggregatorRound uint64) (*chainlinkRound, error) {
+	roundID := new(big.Int).Or(new(big.Int).Lsh(new(big.Int).SetUint64(phase), 64), new(big.Int).SetUint64(aggregatorRound))
+	cacheKey := fmt.Sprintf("%s%s_%s_%s", chainlinkRoundKeyPrefix, chainId, aggregator, roundID)
+	if cached, err := s.redisClient.Client.Get(context.Background(), cacheKey).Result(); err == nil && cached != "" {
+		var round chainlinkRound
+		if err := json.Unmarshal([]byte(cached), &round); err == nil {
+			round.RoundID = roundID
+			return &round, nil
+		}
+	}
+
+	data, err := s.rpcClient.EthCall(chainId, aggregator, chainlinkGetRoundData+shared.AbiEncodeUint(roundID), 0)
+	var rpcErr *shared.RpcError
+	if errors.As(err, &rpcErr) {
+		return nil, errChainlinkRoundNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	round, err := s.parseRound(chainId, aggregator, data)
+	if err != nil {
+		return nil, err
+	}
+	if cached, err := json.Marshal(round); err == nil {
+		s.redisClient.Client.Set(context.Background(), cacheKey, cached, chainlinkRoundCacheTTL)
+	}
+	return round, nil
+}
+
+// parseRound 解析 (roundId, answer, startedAt, updatedAt, answeredInRound)，updatedAt 为 0 表示轮次不存在
+func (s *chainlinkService) parseRound(chainId, aggregator, data string) (*chainlinkRound, error) {
+	words, err := shared.AbiWords(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) < 5 {
+		return nil, errChainlinkRoundNotFound
+	}
+	answer := shared.AbiInt(words[1])
+	if words[3].Sign() == 0 {
+		return nil, errChainlinkRoundNotFound
+	}
+	if answer.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid chainlink answer %s from %s", answer, aggregator)
+	}
+	decimals, err := s.rpcClient.Decimals(chainId, aggregator)
+	if err != nil {
+		return nil, err
+	}
+	return &chainlinkRound{
+		RoundID:   words[0],
+		Answer:    shared.FormatUnits(answer, decimals),
+		UpdatedAt: words[3].Int64(),
+	}, nil
+}
+
+// chainlinkProvider 将 ChainlinkService 适配为 PriceProvider
+type chainlinkProvider struct {
+	service ChainlinkService
+}
+
+func NewChainlinkProvider(service ChainlinkService) PriceProvider {
+	return &chainlinkProvider{service: service}
+}
+
+func (p *chainlinkProvider) Name() string             { return SourceChainlink }
+func (p *chainlinkProvider) SupportsCurrent() bool    { return p.service.Enabled() }
+func (p *chainlinkProvider) SupportsHistorical() bool { return p.service.Enabled() }
+func (p *chainlinkProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *chainlinkProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *chainlinkProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.service.GetBatchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps)
+}
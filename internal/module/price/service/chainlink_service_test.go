@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubAggregatorRound 模拟聚合器中的一轮报价，answer 为 8 位精度
+type stubAggregatorRound struct {
+	phase, round uint64
+	answer       int64
+	updatedAt    int64
+}
+
+// newStubAggregatorServer 模拟 Chainlink 聚合器的 JSON-RPC 节点，不存在的轮次返回 revert
+func newStubAggregatorServer(rounds []stubAggregatorRound) *httptest.Server {
+	roundID := func(phase, round uint64) *big.Int {
+		return new(big.Int).Or(new(big.Int).Lsh(new(big.Int).SetUint64(phase), 64), new(big.Int).SetUint64(round))
+	}
+	encode := func(r stubAggregatorRound) string {
+		id := roundID(r.phase, r.round)
+		return "0x" + shared.AbiEncodeUint(id) + shared.AbiEncodeUint(big.NewInt(r.answer)) +
+			shared.AbiEncodeUint(big.NewInt(r.updatedAt)) + shared.AbiEncodeUint(big.NewInt(r.updatedAt)) + shared.AbiEncodeUint(id)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64             `json:"id"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var call struct {
+			Data string `json:"data"`
+		}
+		json.Unmarshal(req.Params[0], &call)
+
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch {
+		case call.Data == "0x313ce567":
+			resp["result"] = "0x" + shared.AbiEncodeUint(big.NewInt(8))
+		case call.Data == chainlinkLatestRoundData:
+			resp["result"] = encode(rounds[len(rounds)-1])
+		case strings.HasPrefix(call.Data, chainlinkGetRoundData):
+			id, _ := new(big.Int).SetString(strings.TrimPrefix(call.Data, chainlinkGetRoundData), 16)
+			resp["error"] = map[string]any{"code": 3, "message": "execution reverted: No data present"}
+			for _, round := range rounds {
+				if roundID(round.phase, round.round).Cmp(id) == 0 {
+					delete(resp, "error")
+					resp["result"] = encode(round)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func newTestChainlinkService(rpcURL string, historicalRepo *stubHistoricalPriceRepo) ChainlinkService {
+	cfg := koanf.New(".")
+	cfg.Set("loadbalances", []map[string]any{{"id": 1, "endpoints": []map[string]any{{"url": rpcURL}}}})
+	cfg.Set("chainlink.feeds.1.0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", "0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419")
+	// 不可用的 Redis 地址，轮次缓存读写失败会被忽略
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	return NewChainlinkService(cfg, shared.NewRpcClient(cfg, zerolog.Nop()), historicalRepo, redisClient, zerolog.Nop())
+}
+
+func TestChainlinkService_GetBatchPrices(t *testing.T) {
+	// phase 1 有 5 轮，升级后 phase 2 有 3 轮
+	var rounds []stubAggregatorRound
+	for i := uint64(1); i <= 5; i++ {
+		rounds = append(rounds, stubAggregatorRound{phase: 1, round: i, answer: int64(10+i) * 1e8, updatedAt: int64(i) * 1000})
+	}
+	for i := uint64(1); i <= 3; i++ {
+		rounds = append(rounds, stubAggregatorRound{phase: 2, round: i, answer: int64(20+i)*1e8 + 5e7, updatedAt: int64(5+i) * 1000})
+	}
+	server := newStubAggregatorServer(rounds)
+	defer server.Close()
+
+	historicalRepo := &stubHistoricalPriceRepo{}
+	provider := NewChainlinkProvider(newTestChainlinkService(server.URL, historicalRepo))
+	assert.Equal(t, SourceChainlink, provider.Name())
+	assert.True(t, provider.SupportsCurrent())
+	assert.True(t, provider.SupportsHistorical())
+
+	weth := "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"
+	results, err := provider.GetBatchCurrentPrices([]string{weth, "0xnofeed"}, []string{"1", "1"}, nil, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "23.5", *results[0].Price)
+	assert.Equal(t, int64(8000), *results[0].ObservedAt)
+	assert.Nil(t, results[1].Price)
+
+	timestamps := []int64{8500, 6500, 5999, 2500, 1000, 500}
+	expected := []string{"23.5", "21.5", "15", "12", "11", ""}
+	addresses := make([]string, len(timestamps))
+	chainIds := make([]string, len(timestamps))
+	for i := range timestamps {
+		addresses[i] = weth
+		chainIds[i] = "1"
+	}
+	results, err = provider.GetBatchHistoricalPrices(addresses, chainIds, nil, nil, timestamps)
+	assert.NoError(t, err)
+	for i, want := range expected {
+		if want == "" {
+			assert.Nil(t, results[i].Price, "timestamp %d", timestamps[i])
+			continue
+		}
+		if assert.NotNil(t, results[i].Price, "timestamp %d", timestamps[i]) {
+			assert.Equal(t, want, *results[i].Price, "timestamp %d", timestamps[i])
+		}
+	}
+	// 1 条当前价格和 5 条历史价格
+	assert.Len(t, historicalRepo.saved, 6)
+}
+
+func TestChainlinkService_Disabled(t *testing.T) {
+	cfg := koanf.New(".")
+	provider := NewChainlinkProvider(NewChainlinkService(cfg, shared.NewRpcClient(cfg, zerolog.Nop()), &stubHistoricalPriceRepo{}, nil, zerolog.Nop()))
+	assert.False(t, provider.SupportsCurrent())
+	assert.False(t, provider.SupportsHistorical())
+}
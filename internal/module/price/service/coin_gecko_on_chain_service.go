@@ -25,6 +25,9 @@ type CoinGeckoOnChainService interface {
 	GetHistoricalPriceOnChain(chainId, address string, unixTimeStamp int64) (*string, error)
 	GetBatchCurrentPricesOnChain(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
 	GetBatchHistoricalPricesOnChain(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error)
+	GetBatchIntradayPricesOnChain(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error)
+	GetCandlesOnChain(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error)
+	GetTokenInfoOnChain(chainId, address string) (*schema.Coins, error)
 }
 
 type coinGeckoOnChainService struct {
@@ -33,6 +36,7 @@ type coinGeckoOnChainService struct {
 	logger                  zerolog.Logger
 	coinRepository          repository.CoinRepository
 	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	coinCandleRepo          repository.CoinCandleRepository
 	coinGeckoService        CoinGeckoService
 	apiKey                  string
 }
@@ -41,15 +45,17 @@ const coingeckoV3baseURL = "https://pro-api.coingecko.com/api/v3/"
 
 var coinGeckoOnChainRedisPrefix = map[string]string{
 	"tokenPools": "coinGeckoOnChain:tokenPools:",
+	"token":      "coinGeckoOnChain:token:",
 }
 
-func NewCoinGeckoOnChainService(cfg *koanf.Koanf, redisClient *shared.RedisClient, logger zerolog.Logger, coinRepository repository.CoinRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, coinGeckoService CoinGeckoService) CoinGeckoOnChainService {
+func NewCoinGeckoOnChainService(cfg *koanf.Koanf, redisClient *shared.RedisClient, logger zerolog.Logger, coinRepository repository.CoinRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, coinCandleRepo repository.CoinCandleRepository, coinGeckoService CoinGeckoService) CoinGeckoOnChainService {
 	return &coinGeckoOnChainService{
 		config:                  cfg,
 		redisClient:             redisClient,
 		logger:                  logger,
 		coinRepository:          coinRepository,
 		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		coinCandleRepo:          coinCandleRepo,
 		coinGeckoService:        coinGeckoService,
 		apiKey:                  cfg.String("apiKey.coingeckoOnChain"),
 	}
@@ -190,6 +196,11 @@ func (s *coinGeckoOnChainService) GetCurrentPriceOnChain(chainId, address string
 }
 
 func (s *coinGeckoOnChainService) GetHistoricalPriceOnChain(chainId, address string, unixTimeStamp int64) (*string, error) {
+	return s.historicalPriceOnChain(chainId, address, unixTimeStamp, shared.GranularityDay)
+}
+
+// historicalPriceOnChain 按粒度查询历史价格，使用代币第一个池子的 OHLCV 收盘价
+func (s *coinGeckoOnChainService) historicalPriceOnChain(chainId, address string, unixTimeStamp int64, granularity string) (*string, error) {
 	assetPlatformId, err := s.coinGeckoService.GetAssetPlatformIdByChainId(chainId)
 	if err != nil {
 		return nil, err
@@ -198,21 +209,60 @@ func (s *coinGeckoOnChainService) GetHistoricalPriceOnChain(chainId, address str
 	if err != nil {
 		return nil, err
 	}
-	coinId := chainId + "_" + strings.ToLower(address)
+	coinId := shared.CoinID(chainId, address)
 	tokenInfo := getTokenInfo(network, address)
 	splitTokenInfo := strings.Split(tokenInfo, ":")
 	network = splitTokenInfo[0]
 	address = splitTokenInfo[1]
 
-	date := time.Unix(unixTimeStamp, 0).Format("02-01-2006")
+	date := shared.BucketDate(granularity, unixTimeStamp)
 	// 检查是否存在历史记录
-	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPrices([]string{coinId}, []int64{unixTimeStamp})
+	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPricesByGranularity([]string{coinId}, []int64{unixTimeStamp}, granularity)
 	if err == nil {
 		if price, exists := historicalPrices[coinId+"_"+date]; exists {
 			return &price, nil
 		}
 	}
 
+	poolAddress, token, err := s.topPoolOnChain(network, address, "CoinGeckoOnChainService-GetHistoricalPriceOnChain")
+	if err != nil || poolAddress == "" {
+		return nil, err
+	}
+
+	ohlcvs, err := s.getOhlcvsOnChain(network, poolAddress, token, granularity, ohlcvBefore(granularity, unixTimeStamp))
+	if err != nil || len(ohlcvs) == 0 {
+		return nil, err
+	}
+	s.saveCandles(candlesFromOhlcvs(coinId, SourceCoinGeckoOnChain, granularity, ohlcvs))
+
+	var prices []schema.CoinHistoricalPrice
+	priceMap := make(map[string]string)
+	for _, item := range ohlcvs {
+		itemDate := shared.BucketDate(granularity, int64(item[0].(float64)))
+		prices = append(prices, schema.CoinHistoricalPrice{
+			CoinID:      coinId,
+			Date:        int64(item[0].(float64)),
+			DayDate:     itemDate,
+			Granularity: granularity,
+			Price:       fmt.Sprintf("%f", item[4].(float64)),
+			Source:      "coinGeckoOnChain",
+		})
+		priceMap[coinId+"_"+itemDate] = fmt.Sprintf("%f", item[4].(float64))
+	}
+
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(prices); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save historical prices")
+	}
+
+	if price, exists := priceMap[coinId+"_"+date]; exists {
+		return &price, nil
+	}
+	return nil, nil
+}
+
+// topPoolOnChain 返回代币第一个池子的地址及代币在池子中是 base 还是 quote，没有池子时返回空
+func (s *coinGeckoOnChainService) topPoolOnChain(network, address, errorKey string) (string, string, error) {
+	tokenInfo := getTokenInfo(network, address)
 	tokenPoolsKey := coinGeckoOnChainRedisPrefix["tokenPools"] + tokenInfo
 	tokenPools, err := s.redisClient.Client.Get(context.Background(), tokenPoolsKey).Result()
 	if err != nil {
@@ -225,9 +275,9 @@ func (s *coinGeckoOnChainService) GetHistoricalPriceOnChain(chainId, address str
 		body, statusCode, err := shared.DoRequest(http.DefaultClient, url, headers, 0) // 传递 0 表示使用默认超时
 		if err != nil {
 			if statusCode != http.StatusTooManyRequests {
-				shared.HandleErrorWithThrottling(s.redisClient, s.logger, "CoinGeckoOnChainService-GetHistoricalPriceOnChain", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+				shared.HandleErrorWithThrottling(s.redisClient, s.logger, errorKey, fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
 			}
-			return nil, err
+			return "", "", err
 		}
 		var result struct {
 			Data []struct {
@@ -247,7 +297,7 @@ func (s *coinGeckoOnChainService) GetHistoricalPriceOnChain(chainId, address str
 		}
 
 		if err := shared.ParseJSONResponse(body, &result); err != nil {
-			return nil, fmt.Errorf("failed to decode response: %v", err)
+			return "", "", fmt.Errorf("failed to decode response: %v", err)
 		}
 
 		tokenPoolsBytes, _ := json.Marshal(result.Data)
@@ -257,7 +307,7 @@ func (s *coinGeckoOnChainService) GetHistoricalPriceOnChain(chainId, address str
 
 	var pools []map[string]interface{}
 	if err := json.Unmarshal([]byte(tokenPools), &pools); err != nil || len(pools) == 0 {
-		return nil, nil
+		return "", "", nil
 	}
 
 	poolAddress := pools[0]["attributes"].(map[string]interface{})["address"].(string)
@@ -268,38 +318,83 @@ func (s *coinGeckoOnChainService) GetHistoricalPriceOnChain(chainId, address str
 	if address == poolQuoteToken {
 		token = "quote"
 	}
+	return poolAddress, token, nil
+}
 
-	ohlcvs, err := s.getOhlcvsOnChain(network, poolAddress, token)
-	if err != nil || len(ohlcvs) == 0 {
+// GetTokenInfoOnChain 从 token 接口读取代币的 symbol、name、decimals 及总供应量，响应缓存 24 小时
+func (s *coinGeckoOnChainService) GetTokenInfoOnChain(chainId, address string) (*schema.Coins, error) {
+	assetPlatformId, err := s.coinGeckoService.GetAssetPlatformIdByChainId(chainId)
+	if err != nil {
+		return nil, err
+	}
+	network, err := s.GetCoinGeckoOnChainNetwork(assetPlatformId, true)
+	if err != nil {
 		return nil, err
 	}
+	tokenKey := coinGeckoOnChainRedisPrefix["token"] + getTokenInfo(network, address)
+	tokenData, err := s.redisClient.Client.Get(context.Background(), tokenKey).Bytes()
+	if err != nil {
+		url := fmt.Sprintf("%sonchain/networks/%s/tokens/%s", coingeckoV3baseURL, network, address)
+		headers := map[string]string{
+			"accept":           "application/json",
+			"x-cg-pro-api-key": s.apiKey,
+		}
+		body, statusCode, err := shared.DoRequest(http.DefaultClient, url, headers, 0) // 传递 0 表示使用默认超时
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != http.StatusOK && statusCode != http.StatusNotFound {
+			if statusCode != http.StatusTooManyRequests {
+				shared.HandleErrorWithThrottling(s.redisClient, s.logger, "CoinGeckoOnChainService-GetTokenInfoOnChain", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+			}
+			return nil, fmt.Errorf("failed to get token info, status code: %d, response: %s", statusCode, string(body))
+		}
+		s.redisClient.Client.Set(context.Background(), tokenKey, body, 24*time.Hour)
+		tokenData = body
+	}
 
-	var prices []schema.CoinHistoricalPrice
-	priceMap := make(map[string]string)
-	for _, item := range ohlcvs {
-		itemDate := time.Unix(int64(item[0].(float64)), 0).Format("02-01-2006")
-		prices = append(prices, schema.CoinHistoricalPrice{
-			CoinID:  coinId,
-			Date:    int64(item[0].(float64)),
-			DayDate: itemDate,
-			Price:   fmt.Sprintf("%f", item[4].(float64)),
-			Source:  "coinGeckoOnChain",
-		})
-		priceMap[coinId+"_"+itemDate] = fmt.Sprintf("%f", item[4].(float64))
+	var result map[string]interface{}
+	if err := shared.ParseJSONResponse(tokenData, &result); err != nil {
+		return nil, err
 	}
+	return tokenInfoFromResponse(chainId, address, result), nil
+}
 
-	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(prices); err != nil {
-		s.logger.Error().Err(err).Msg("Failed to save historical prices")
+// GetCandlesOnChain 通过代币第一个池子的 OHLCV 接口获取 from 与 to 之间的 K 线并保存
+func (s *coinGeckoOnChainService) GetCandlesOnChain(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error) {
+	assetPlatformId, err := s.coinGeckoService.GetAssetPlatformIdByChainId(chainId)
+	if err != nil {
+		return nil, err
 	}
+	network, err := s.GetCoinGeckoOnChainNetwork(assetPlatformId, true)
+	if err != nil {
+		return nil, err
+	}
+	coinId := shared.CoinID(chainId, address)
+	poolAddress, token, err := s.topPoolOnChain(network, address, "CoinGeckoOnChainService-GetCandlesOnChain")
+	if err != nil || poolAddress == "" {
+		return nil, err
+	}
+	ohlcvs, err := pagedOhlcvs(from, to, func(before int64) ([][]interface{}, error) {
+		return s.getOhlcvsOnChain(network, poolAddress, token, timeframe, before)
+	})
+	if err != nil {
+		return nil, err
+	}
+	candles := candlesFromOhlcvs(coinId, SourceCoinGeckoOnChain, timeframe, ohlcvs)
+	s.saveCandles(candles)
+	return candles, nil
+}
 
-	if price, exists := priceMap[coinId+"_"+date]; exists {
-		return &price, nil
+// saveCandles 保存下载的 K 线，失败只记录日志
+func (s *coinGeckoOnChainService) saveCandles(candles []schema.CoinCandle) {
+	if err := s.coinCandleRepo.SaveCandles(candles); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save candles")
 	}
-	return nil, nil
 }
 
-func (s *coinGeckoOnChainService) getOhlcvsOnChain(network, poolAddress, token string) ([][]interface{}, error) {
-	url := fmt.Sprintf("%sonchain/networks/%s/pools/%s/ohlcv/day?limit=1000&token=%s", coingeckoV3baseURL, network, poolAddress, token)
+func (s *coinGeckoOnChainService) getOhlcvsOnChain(network, poolAddress, token, granularity string, before int64) ([][]interface{}, error) {
+	url := fmt.Sprintf("%sonchain/networks/%s/pools/%s/ohlcv/%s", coingeckoV3baseURL, network, poolAddress, ohlcvQuery(granularity, token, before))
 	headers := map[string]string{
 		"accept":           "application/json",
 		"x-cg-pro-api-key": s.apiKey,
@@ -338,22 +433,45 @@ func (s *coinGeckoOnChainService) GetBatchCurrentPricesOnChain(addresses []strin
 	errCh := make(chan error, len(addresses))
 	var wg sync.WaitGroup
 
+	// 先批量读取缓存，区分缓存命中和实时请求的结果
+	var cachedPrices map[string]string
+	if isCache {
+		coinIDs := make([]string, len(addresses))
+		for i := range addresses {
+			coinIDs[i] = chainIds[i] + "_" + addresses[i]
+		}
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
 	for i := range chainIds {
+		if cachedPrice, exists := cachedPrices[chainIds[i]+"_"+addresses[i]]; exists {
+			results[i] = PriceResult{
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           &cachedPrice,
+				Symbol:          GetOrNil(symbols, i),
+				Network:         GetOrNil(networks, i),
+				TimeStamp:       strconv.FormatInt(time.Now().Unix(), 10),
+				PriceProvenance: cachedProvenance(-1),
+			}
+			continue
+		}
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			price, err := s.GetCurrentPriceOnChain(chainIds[i], addresses[i], GetOrDefault(symbols, i, ""), isCache)
+			price, err := s.GetCurrentPriceOnChain(chainIds[i], addresses[i], GetOrDefault(symbols, i, ""), false)
 			if err != nil {
 				s.logger.Err(err).Msg("Failed to btch get current price on chain")
 			}
 
 			priceResult := PriceResult{
-				ChainID:   chainIds[i],
-				Address:   addresses[i],
-				Price:     price,
-				Symbol:    GetOrNil(symbols, i),
-				Network:   GetOrNil(networks, i),
-				TimeStamp: strconv.FormatInt(time.Now().Unix(), 10),
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           price,
+				Symbol:          GetOrNil(symbols, i),
+				Network:         GetOrNil(networks, i),
+				TimeStamp:       strconv.FormatInt(time.Now().Unix(), 10),
+				PriceProvenance: upstreamProvenance(0),
 			}
 			results[i] = priceResult
 		}(i)
@@ -365,6 +483,15 @@ func (s *coinGeckoOnChainService) GetBatchCurrentPricesOnChain(addresses []strin
 }
 
 func (s *coinGeckoOnChainService) GetBatchHistoricalPricesOnChain(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return s.batchHistoricalPricesOnChain(addresses, chainIds, symbols, networks, unixTimeStamps, shared.GranularityDay)
+}
+
+// GetBatchIntradayPricesOnChain 批量查询小时或 5 分钟粒度的历史价格
+func (s *coinGeckoOnChainService) GetBatchIntradayPricesOnChain(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
+	return s.batchHistoricalPricesOnChain(addresses, chainIds, symbols, networks, unixTimeStamps, granularity)
+}
+
+func (s *coinGeckoOnChainService) batchHistoricalPricesOnChain(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
 	if len(networks) != len(addresses) || len(addresses) != len(unixTimeStamps) {
 		return nil, fmt.Errorf("chainIds, addresses and unixTimeStamps must have the same length")
 	}
@@ -381,7 +508,7 @@ func (s *coinGeckoOnChainService) GetBatchHistoricalPricesOnChain(addresses []st
 		dates[i] = unixTimeStamps[i]
 	}
 
-	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPrices(coinIds, dates)
+	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPricesByGranularity(coinIds, dates, granularity)
 	if err != nil {
 		return nil, fmt.Errorf("批量查询历史价格失败: %v", err)
 	}
@@ -391,7 +518,7 @@ func (s *coinGeckoOnChainService) GetBatchHistoricalPricesOnChain(addresses []st
 		go func(i int) {
 			defer wg.Done()
 			coinId := chainIds[i] + "_" + addresses[i]
-			date := time.Unix(unixTimeStamps[i], 0).Format("02-01-2006")
+			date := shared.BucketDate(granularity, unixTimeStamps[i])
 			historicalPrice, exists := historicalPrices[coinId+"_"+date]
 			if exists {
 				priceResult := PriceResult{
@@ -404,7 +531,7 @@ func (s *coinGeckoOnChainService) GetBatchHistoricalPricesOnChain(addresses []st
 				}
 				results[i] = priceResult
 			} else {
-				price, err := s.GetHistoricalPriceOnChain(chainIds[i], addresses[i], unixTimeStamps[i])
+				price, err := s.historicalPriceOnChain(chainIds[i], addresses[i], unixTimeStamps[i], granularity)
 				if err != nil {
 					errCh <- err
 					return
@@ -447,3 +574,37 @@ func isSymbolAllowed(symbol string) bool {
 	}
 	return false
 }
+
+// coinGeckoOnChainProvider 将 CoinGeckoOnChainService 适配为 PriceProvider
+type coinGeckoOnChainProvider struct {
+	service CoinGeckoOnChainService
+}
+
+func NewCoinGeckoOnChainProvider(service CoinGeckoOnChainService) PriceProvider {
+	return &coinGeckoOnChainProvider{service: service}
+}
+
+func (p *coinGeckoOnChainProvider) Name() string             { return SourceCoinGeckoOnChain }
+func (p *coinGeckoOnChainProvider) SupportsCurrent() bool    { return true }
+func (p *coinGeckoOnChainProvider) SupportsHistorical() bool { return true }
+func (p *coinGeckoOnChainProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *coinGeckoOnChainProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPricesOnChain(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *coinGeckoOnChainProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.service.GetBatchHistoricalPricesOnChain(addresses, chainIds, symbols, networks, unixTimeStamps)
+}
+
+func (p *coinGeckoOnChainProvider) GetBatchIntradayPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
+	return p.service.GetBatchIntradayPricesOnChain(addresses, chainIds, symbols, networks, unixTimeStamps, granularity)
+}
+
+func (p *coinGeckoOnChainProvider) GetCandles(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error) {
+	return p.service.GetCandlesOnChain(chainId, address, from, to, timeframe)
+}
+
+func (p *coinGeckoOnChainProvider) GetTokenInfo(chainId, address string) (*schema.Coins, error) {
+	return p.service.GetTokenInfoOnChain(chainId, address)
+}
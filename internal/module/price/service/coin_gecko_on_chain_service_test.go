@@ -19,8 +19,9 @@ func TestGetCoinGeckoOnChainNetwork(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	network, err := coinGeckoOnChainService.GetCoinGeckoOnChainNetwork("ethereum", false)
 	assert.NoError(t, err)
@@ -41,8 +42,9 @@ func TestGetCurrentPriceOnChain(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	price, err := coinGeckoOnChainService.GetCurrentPriceOnChain("1", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", "ETH", false)
 	assert.NoError(t, err)
@@ -55,8 +57,9 @@ func TestGetHistoricalPriceOnChain(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	price, err := coinGeckoOnChainService.GetHistoricalPriceOnChain("1", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", 1704959441)
 	assert.NoError(t, err)
@@ -69,8 +72,9 @@ func TestGetBatchCurrentPricesOnChain(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	addresses := []string{"0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"}
 	chainIds := []string{"1"}
@@ -87,8 +91,9 @@ func TestGetBatchHistoricalPricesOnChain(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	addresses := []string{"0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"}
 	chainIds := []string{"1"}
@@ -106,8 +111,9 @@ func TestGetCurrentPriceOnChainIsNil(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	price, err := coinGeckoOnChainService.GetCurrentPriceOnChain("1", "0x1", "ETH", false)
 	assert.NoError(t, err)
@@ -120,8 +126,9 @@ func TestGetHistoricalPriceOnChainIsNil(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	timestamp := time.Now().Add(-24 * time.Hour).Unix()
 	price, err := coinGeckoOnChainService.GetHistoricalPriceOnChain("1", "0x1", timestamp)
@@ -135,8 +142,9 @@ func TestGetBatchCurrentPricesOnChainIsNil(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	addresses := []string{"0x1"}
 	chainIds := []string{"1"}
@@ -153,8 +161,9 @@ func TestGetBatchHistoricalPricesOnChainIsNil(t *testing.T) {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 
 	addresses := []string{"0x2"}
 	chainIds := []string{"1"}
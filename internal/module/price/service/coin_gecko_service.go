@@ -38,6 +38,7 @@ type CoinGeckoService interface {
 	GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, dates []int64) ([]PriceResult, error)
 	GetSinglePrice(chainID string, address string, symbol string, network string, isCache bool) (*string, error)
 	GetSingleHistoricalPrice(date int64, chainID string, address string, symbol string, network string) (*string, error)
+	GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error)
 }
 
 type coinGeckoService struct {
@@ -47,6 +48,7 @@ type coinGeckoService struct {
 	redisClient             *shared.RedisClient
 	logger                  zerolog.Logger
 	apiKey                  string
+	nativeCurrencies        []string // 除 USD 外同时请求的计价货币
 }
 
 func NewCoinGeckoService(cfg *koanf.Koanf, coinRepository repository.CoinRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, redisClient *shared.RedisClient, logger zerolog.Logger) CoinGeckoService {
@@ -57,6 +59,7 @@ func NewCoinGeckoService(cfg *koanf.Koanf, coinRepository repository.CoinReposit
 		redisClient:             redisClient,
 		logger:                  logger,
 		apiKey:                  cfg.String("apiKey.coingecko"),
+		nativeCurrencies:        nativeCurrencies(cfg),
 	}
 }
 
@@ -69,14 +72,23 @@ type CoinGeckoCoin struct {
 
 // 定义价格结果结构体
 type PriceResult struct {
-	ChainID       string  `json:"chainId"`
-	Address       string  `json:"address"`
-	Price         *string `json:"price"`
-	Symbol        *string `json:"symbol"`
-	Network       *string `json:"network"`
-	TimeStamp     string  `json:"date"`
-	RequestStatus *string `json:"-"`
-	Serial        int     `json:"serial"`
+	ChainID       string             `json:"chainId"`
+	Address       string             `json:"address"`
+	AssetID       string             `json:"assetId,omitempty"` // CAIP-19 资产 ID
+	Price         *string            `json:"price"`
+	Symbol        *string            `json:"symbol"`
+	Network       *string            `json:"network"`
+	TimeStamp     string             `json:"date"`
+	Currency      string             `json:"currency,omitempty"` // 非 USD 计价时返回
+	RequestStatus *string            `json:"-"`
+	Serial        int                `json:"serial"`
+	Divergent     bool               `json:"divergent,omitempty"`     // 共识模式下各数据源报价偏差超过阈值
+	OffPeg        bool               `json:"offPeg,omitempty"`        // 锚定资产价格超出容忍范围
+	ObservedPrice *string            `json:"observedPrice,omitempty"` // clamp 模式下截断前的报价
+	Error         string             `json:"error,omitempty"`         // 请求中的地址无效或没有计价货币的汇率
+	Changes       map[string]*string `json:"changes,omitempty"`       // 各时间窗口的涨跌幅百分比，没有参考价格时为 null
+	MarketData    *MarketData        `json:"marketData,omitempty"`    // 市值、FDV、成交额及流动性
+	PriceProvenance
 }
 
 func (s *coinGeckoService) getAssetPlatforms(isCache bool) (map[string]string, error) {
@@ -267,6 +279,7 @@ func (s *coinGeckoService) CoinsList(useCache bool) ([]schema.Coins, error) {
 			if !ok {
 				continue
 			}
+			address = shared.NormalizeAddress(chainID, address)
 			id := chainID + "_" + address
 
 			// 检查是否已经处理过这个 id
@@ -353,7 +366,7 @@ func (s *coinGeckoService) GetBatchPrice(addresses []string, chainIds []string,
 	}
 	var priceMap map[string]map[string]float64
 	if len(coingeckoIDs) > 0 {
-		url := fmt.Sprintf("https://pro-api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=usd", strings.Join(coingeckoIDs, "%2C"))
+		url := fmt.Sprintf("https://pro-api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=%s&include_market_cap=true&include_24hr_vol=true&include_last_updated_at=true", strings.Join(coingeckoIDs, "%2C"), strings.Join(append([]string{CurrencyUSD}, s.nativeCurrencies...), "%2C"))
 		headers := map[string]string{
 			"accept":           "application/json",
 			"x-cg-pro-api-key": s.apiKey,
@@ -383,11 +396,14 @@ func (s *coinGeckoService) GetBatchPrice(addresses []string, chainIds []string,
 	for i := range addresses {
 		coinID := chainIds[i] + "_" + addresses[i]
 		var price *string
+		var provenance PriceProvenance
+		var marketData *MarketData
 
 		// 优先使用缓存中的历史价格
 		historicalPrice, exists := existingPrices[coinID]
 		if exists {
 			price = &historicalPrice
+			provenance = cachedProvenance(-1)
 		} else {
 			// 从 coingeckoIDMap 中获取 coingeckoCoinID 并请求 API 获取最新价格
 			if coingeckoCoinID, exists := coingeckoIDMap[coinID]; exists {
@@ -396,9 +412,12 @@ func (s *coinGeckoService) GetBatchPrice(addresses []string, chainIds []string,
 						// priceStr := fmt.Sprintf("%g", usdPrice)
 						priceStr := strconv.FormatFloat(usdPrice, 'f', -1, 64)
 						price = &priceStr
+						provenance = upstreamProvenance(int64(coinPrice["last_updated_at"]))
+						marketData = newMarketData(marketValue(coinPrice["usd_market_cap"]), nil, marketValue(coinPrice["usd_24h_vol"]), nil)
 
 						// 保存到 redis
 						s.redisClient.SetCurrentPriceCache(coinID, priceStr)
+						s.cacheNativePrices(coinID, "", coinPrice)
 
 						// 保存到 coinHistoricalPriceRepository
 						coin, coinsExists := coinsMap[coinID]
@@ -419,12 +438,14 @@ func (s *coinGeckoService) GetBatchPrice(addresses []string, chainIds []string,
 		}
 
 		results = append(results, PriceResult{
-			ChainID:   chainIds[i],
-			Address:   addresses[i],
-			Price:     price,
-			Symbol:    GetOrNil(symbols, i),
-			Network:   GetOrNil(networks, i),
-			TimeStamp: strconv.FormatInt(nowTime, 10),
+			ChainID:         chainIds[i],
+			Address:         addresses[i],
+			Price:           price,
+			Symbol:          GetOrNil(symbols, i),
+			Network:         GetOrNil(networks, i),
+			TimeStamp:       strconv.FormatInt(nowTime, 10),
+			PriceProvenance: provenance,
+			MarketData:      marketData,
 		})
 	}
 
@@ -464,14 +485,19 @@ func (s *coinGeckoService) GetBatchHistoricalPrices(addresses []string, chainIds
 	for i, id := range ids {
 		historicalPrice, exists := existingPrices[id+"_"+time.Unix(dates[i], 0).Format("02-01-2006")]
 		var price *string
+		var provenance PriceProvenance
+		var marketData *MarketData
 		if exists {
 			price = &historicalPrice
+			provenance = cachedProvenance(-1)
 		} else if coin, ok := coinMap[id]; ok && coin.CoingeckoCoinID != nil {
 			date := time.Unix(dates[i], 0).Format("02-01-2006")
 			if date == time.Now().Format("02-01-2006") {
 				re, err := s.GetBatchPrice([]string{addresses[i]}, []string{chainIds[i]}, []string{symbols[i]}, []string{networks[i]}, true)
 				if err == nil {
 					price = re[0].Price
+					provenance = re[0].PriceProvenance
+					marketData = re[0].MarketData
 				}
 			} else {
 				url := fmt.Sprintf("https://pro-api.coingecko.com/api/v3/coins/%s/history?date=%s", *coin.CoingeckoCoinID, date)
@@ -496,16 +522,21 @@ func (s *coinGeckoService) GetBatchHistoricalPrices(addresses []string, chainIds
 					ID         string `json:"id"`
 					MarketData struct {
 						CurrentPrice map[string]float64 `json:"current_price"`
+						MarketCap    map[string]float64 `json:"market_cap"`
+						TotalVolume  map[string]float64 `json:"total_volume"`
 					} `json:"market_data"`
 				}
 				if err := shared.ParseJSONResponse(body, &priceData); err != nil {
 					return nil, fmt.Errorf("解析响应失败: %v", err)
 				}
 
+				s.cacheNativePrices(id, date, priceData.MarketData.CurrentPrice)
 				priceFloat, ok := priceData.MarketData.CurrentPrice["usd"]
 				if ok {
 					priceStr := strconv.FormatFloat(priceFloat, 'f', -1, 64)
 					price = &priceStr
+					provenance = upstreamProvenance(0)
+					marketData = newMarketData(marketValue(priceData.MarketData.MarketCap["usd"]), nil, marketValue(priceData.MarketData.TotalVolume["usd"]), nil)
 
 					// 保存到 coinHistoricalPriceRepository
 					coinID := coin.ChainID + "_" + coin.Address
@@ -522,12 +553,14 @@ func (s *coinGeckoService) GetBatchHistoricalPrices(addresses []string, chainIds
 		}
 
 		results = append(results, PriceResult{
-			ChainID:   chainIds[i],
-			Address:   addresses[i],
-			Price:     price,
-			Symbol:    GetOrNil(symbols, i),
-			Network:   GetOrNil(networks, i),
-			TimeStamp: strconv.FormatInt(dates[i], 10),
+			ChainID:         chainIds[i],
+			Address:         addresses[i],
+			Price:           price,
+			Symbol:          GetOrNil(symbols, i),
+			Network:         GetOrNil(networks, i),
+			TimeStamp:       strconv.FormatInt(dates[i], 10),
+			PriceProvenance: provenance,
+			MarketData:      marketData,
 		})
 	}
 
@@ -538,6 +571,56 @@ func (s *coinGeckoService) GetBatchHistoricalPrices(addresses []string, chainIds
 	return results, nil
 }
 
+// GetPriceRange 通过 market_chart/range 一次获取区间内的价格，CoinGecko 根据区间长度自动选择 5 分钟、小时或天的数据
+func (s *coinGeckoService) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	coin, err := s.coinRepository.GetCoinsByOneID(chainId + "_" + address)
+	if err != nil || coin == nil || coin.CoingeckoCoinID == nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://pro-api.coingecko.com/api/v3/coins/%s/market_chart/range?vs_currency=usd&from=%d&to=%d", *coin.CoingeckoCoinID, from, to)
+	headers := map[string]string{
+		"accept":           "application/json",
+		"x-cg-pro-api-key": s.apiKey,
+	}
+	body, statusCode, err := shared.DoRequest(http.DefaultClient, url, headers, 0) // 传递 0 表示使用默认超时
+	if err != nil {
+		return nil, fmt.Errorf("执行请求失败: %v", err)
+	}
+	if statusCode != http.StatusOK {
+		if statusCode != http.StatusTooManyRequests {
+			shared.HandleErrorWithThrottling(s.redisClient, s.logger, "CoinGeckoService-GetPriceRange", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+		}
+		return nil, fmt.Errorf("获取历史价格区间失败，状态码: %d，响应: %s", statusCode, string(body))
+	}
+
+	var chart struct {
+		Prices [][2]float64 `json:"prices"`
+	}
+	if err := shared.ParseJSONResponse(body, &chart); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	points := make([]rangePoint, len(chart.Prices))
+	for i, item := range chart.Prices {
+		points[i] = rangePoint{timestamp: int64(item[0]) / 1000, price: item[1]}
+	}
+
+	prices := closesByBucket(chainId+"_"+address, SourceCoinGecko, granularity, points, from, to)
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(prices); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save historical prices")
+	}
+	return prices, nil
+}
+
+// cacheNativePrices 缓存 CoinGecko 返回的非 USD 报价，dayDate 为空时表示当前价格
+func (s *coinGeckoService) cacheNativePrices(coinID, dayDate string, prices map[string]float64) {
+	for _, currency := range s.nativeCurrencies {
+		if price, ok := prices[currency]; ok {
+			s.redisClient.SetCurrencyPriceCache(currency, coinID, dayDate, strconv.FormatFloat(price, 'f', -1, 64))
+		}
+	}
+}
+
 func (s *coinGeckoService) GetSinglePrice(chainID, address, symbol, network string, isCache bool) (*string, error) {
 	prices, err := s.GetBatchPrice([]string{address}, []string{chainID}, []string{symbol}, []string{network}, isCache)
 	if err != nil || len(prices) == 0 {
@@ -597,3 +680,29 @@ func generateRequestID(parts ...string) string {
 	hash := md5.Sum([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
+
+// coinGeckoProvider 将 CoinGeckoService 适配为 PriceProvider
+type coinGeckoProvider struct {
+	service CoinGeckoService
+}
+
+func NewCoinGeckoProvider(service CoinGeckoService) PriceProvider {
+	return &coinGeckoProvider{service: service}
+}
+
+func (p *coinGeckoProvider) Name() string             { return SourceCoinGecko }
+func (p *coinGeckoProvider) SupportsCurrent() bool    { return true }
+func (p *coinGeckoProvider) SupportsHistorical() bool { return true }
+func (p *coinGeckoProvider) ListedCoinsOnly() bool    { return true }
+
+func (p *coinGeckoProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchPrice(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *coinGeckoProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.service.GetBatchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps)
+}
+
+func (p *coinGeckoProvider) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	return p.service.GetPriceRange(chainId, address, from, to, granularity)
+}
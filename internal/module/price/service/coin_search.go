@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+)
+
+const (
+	// 排序使用的请求次数统计区间
+	coinSearchRequestWindow = 7 * 24 * time.Hour
+	coinSearchMaxQueryLen   = 64
+	coinSearchPageSize      = 20
+	coinSearchMaxPageSize   = 100
+)
+
+// CoinSearchParams 代币搜索参数，Page 从 1 开始，Page 和 PageSize 为 0 时使用默认值
+type CoinSearchParams struct {
+	Query    string
+	Match    string
+	ChainIDs []string
+	Label    string
+	Page     int
+	PageSize int
+}
+
+// CoinSearchPage 一页搜索结果，Total 为满足条件的代币总数
+type CoinSearchPage struct {
+	Items    []repository.CoinSearchResult `json:"items"`
+	Total    int64                         `json:"total"`
+	Page     int                           `json:"page"`
+	PageSize int                           `json:"pageSize"`
+}
+
+// CoinSearchError 搜索参数无效
+type CoinSearchError struct {
+	Message string
+}
+
+func (e *CoinSearchError) Error() string {
+	return "invalid search: " + e.Message
+}
+
+// normalize 校验搜索参数并补全默认值
+func (p CoinSearchParams) normalize() (CoinSearchParams, error) {
+	p.Query = strings.TrimSpace(p.Query)
+	if p.Query == "" {
+		return p, &CoinSearchError{Message: "q is required"}
+	}
+	if utf8.RuneCountInString(p.Query) > coinSearchMaxQueryLen {
+		return p, &CoinSearchError{Message: fmt.Sprintf("q must be at most %d characters", coinSearchMaxQueryLen)}
+	}
+	switch strings.ToLower(p.Match) {
+	case "", repository.CoinSearchMatchFuzzy:
+		p.Match = repository.CoinSearchMatchFuzzy
+	case repository.CoinSearchMatchPrefix:
+		p.Match = repository.CoinSearchMatchPrefix
+	default:
+		return p, &CoinSearchError{Message: "unsupported match: " + p.Match}
+	}
+	if p.Page < 0 || p.PageSize < 0 {
+		return p, &CoinSearchError{Message: "page and pageSize must be positive"}
+	}
+	if p.Page == 0 {
+		p.Page = 1
+	}
+	if p.PageSize == 0 {
+		p.PageSize = coinSearchPageSize
+	}
+	if p.PageSize > coinSearchMaxPageSize {
+		p.PageSize = coinSearchMaxPageSize
+	}
+	return p, nil
+}
+
+// SearchCoins 按 symbol 或 name 搜索代币，匹配程度相同时按最近 7 天的请求次数排序
+func (s *coinsService) SearchCoins(params CoinSearchParams) (*CoinSearchPage, error) {
+	params, err := params.normalize()
+	if err != nil {
+		return nil, err
+	}
+	items, total, err := s.coinSearchRepo.SearchCoins(repository.CoinSearchQuery{
+		Query:    params.Query,
+		Match:    params.Match,
+		ChainIDs: params.ChainIDs,
+		Label:    params.Label,
+		Since:    time.Now().Add(-coinSearchRequestWindow).Unix(),
+		Offset:   (params.Page - 1) * params.PageSize,
+		Limit:    params.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CoinSearchPage{Items: items, Total: total, Page: params.Page, PageSize: params.PageSize}, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCoinSearchRepo 记录最后一次搜索条件
+type stubCoinSearchRepo struct {
+	query   repository.CoinSearchQuery
+	results []repository.CoinSearchResult
+}
+
+func (r *stubCoinSearchRepo) SaveRequestCounts(counts []schema.CoinRequestCount) error {
+	return nil
+}
+
+func (r *stubCoinSearchRepo) SearchCoins(query repository.CoinSearchQuery) ([]repository.CoinSearchResult, int64, error) {
+	r.query = query
+	return r.results, int64(len(r.results)) + 40, nil
+}
+
+func TestCoinsService_SearchCoins(t *testing.T) {
+	repo := &stubCoinSearchRepo{results: []repository.CoinSearchResult{{Coins: schema.Coins{ID: "1_0xa"}, Requests: 12}}}
+	s := &coinsService{coinSearchRepo: repo}
+
+	// 未指定时使用默认的匹配方式及分页
+	page, err := s.SearchCoins(CoinSearchParams{Query: "  usdc "})
+	assert.NoError(t, err)
+	assert.Equal(t, "usdc", repo.query.Query)
+	assert.Equal(t, repository.CoinSearchMatchFuzzy, repo.query.Match)
+	assert.Equal(t, 0, repo.query.Offset)
+	assert.Equal(t, coinSearchPageSize, repo.query.Limit)
+	assert.InDelta(t, time.Now().Add(-coinSearchRequestWindow).Unix(), repo.query.Since, 5)
+	assert.Equal(t, int64(41), page.Total)
+	assert.Equal(t, 1, page.Page)
+	assert.Equal(t, int64(12), page.Items[0].Requests)
+
+	// pageSize 超过上限时按上限返回
+	page, err = s.SearchCoins(CoinSearchParams{Query: "eth", Match: "PREFIX", ChainIDs: []string{"1"}, Label: "stable", Page: 3, PageSize: 500})
+	assert.NoError(t, err)
+	assert.Equal(t, repository.CoinSearchMatchPrefix, repo.query.Match)
+	assert.Equal(t, coinSearchMaxPageSize, page.PageSize)
+	assert.Equal(t, 2*coinSearchMaxPageSize, repo.query.Offset)
+	assert.Equal(t, []string{"1"}, repo.query.ChainIDs)
+	assert.Equal(t, "stable", repo.query.Label)
+
+	for _, params := range []CoinSearchParams{
+		{Query: " "},
+		{Query: "eth", Match: "regex"},
+		{Query: "eth", Page: -1},
+		{Query: strings.Repeat("a", coinSearchMaxQueryLen+1)},
+	} {
+		_, err := s.SearchCoins(params)
+		var searchErr *CoinSearchError
+		assert.ErrorAs(t, err, &searchErr)
+	}
+}
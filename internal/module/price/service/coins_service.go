@@ -12,24 +12,33 @@ type CoinsService interface {
 	GetCoinByID(id string) (*schema.Coins, error)
 	RefreshAllCoinsCache() error
 	RefreshCoinListCache(ids []string) error
+	SearchCoins(params CoinSearchParams) (*CoinSearchPage, error)
 }
 
 type coinsService struct {
-	coinsRepo repository.CoinRepository
+	coinsRepo      repository.CoinRepository
+	coinSearchRepo repository.CoinSearchRepository
 }
 
-func NewCoinsService(coinsRepo repository.CoinRepository) CoinsService {
+func NewCoinsService(coinsRepo repository.CoinRepository, coinSearchRepo repository.CoinSearchRepository) CoinsService {
 	return &coinsService{
-		coinsRepo: coinsRepo,
+		coinsRepo:      coinsRepo,
+		coinSearchRepo: coinSearchRepo,
 	}
 }
 
 func (s *coinsService) AddCoin(coin schema.Coins) error {
+	if err := ValidateFormula(coin, s.coinsRepo.GetCoinsByID); err != nil {
+		return err
+	}
 	return s.coinsRepo.UpsertCoins([]schema.Coins{coin})
 }
 
 func (s *coinsService) UpdateCoin(id string, updatedCoin schema.Coins) error {
 	updatedCoin.ID = id
+	if err := ValidateFormula(updatedCoin, s.coinsRepo.GetCoinsByID); err != nil {
+		return err
+	}
 	return s.coinsRepo.UpsertCoins([]schema.Coins{updatedCoin})
 }
 
@@ -16,7 +16,8 @@ func setupCoinsService() service.CoinsService {
 	db := shared.SetupRealDB()
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
-	return service.NewCoinsService(coinRepo)
+	coinSearchRepo := repository.NewCoinSearchRepository(db, zerolog.New(nil))
+	return service.NewCoinsService(coinRepo, coinSearchRepo)
 }
 
 func TestAddCoin(t *testing.T) {
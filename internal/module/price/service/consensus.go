@@ -0,0 +1,105 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// 共识价格计算方式
+const (
+	ConsensusMethodMedian   = "median"
+	ConsensusMethodWeighted = "weighted"
+)
+
+// consensusConfig 多数据源共识配置，enabled 为 false 时保持按顺序取第一个价格的行为
+type consensusConfig struct {
+	enabled      bool
+	method       string
+	minSources   int                // 至少多少个数据源有报价才计算共识，否则直接使用优先级最高的报价
+	maxDeviation float64            // 报价最大偏差百分比，超过则标记为分歧
+	sources      []string           // 参与共识的数据源，为空时使用当前价格数据源顺序
+	weights      map[string]float64 // weighted 模式下各数据源的权重，未配置的数据源权重为 1
+}
+
+func newConsensusConfig(cfg *koanf.Koanf) consensusConfig {
+	c := consensusConfig{
+		enabled:      cfg.Bool("consensus.enabled"),
+		method:       cfg.String("consensus.method"),
+		minSources:   cfg.Int("consensus.minSources"),
+		maxDeviation: cfg.Float64("consensus.maxDeviation"),
+		sources:      configStrings(cfg, "consensus.sources"),
+		weights:      make(map[string]float64),
+	}
+	if c.method != ConsensusMethodWeighted {
+		c.method = ConsensusMethodMedian
+	}
+	if c.minSources <= 0 {
+		c.minSources = 2
+	}
+	if c.maxDeviation <= 0 {
+		c.maxDeviation = 5
+	}
+	for _, source := range cfg.MapKeys("consensus.weights") {
+		if weight := cfg.Float64("consensus.weights." + source); weight > 0 {
+			c.weights[source] = weight
+		}
+	}
+	return c
+}
+
+// sourceQuote 单个数据源的报价
+type sourceQuote struct {
+	source string
+	price  float64
+}
+
+// aggregate 计算共识价格，返回价格以及报价之间的最大偏差百分比
+func (c consensusConfig) aggregate(quotes []sourceQuote) (float64, float64) {
+	if len(quotes) == 0 {
+		return 0, 0
+	}
+	sorted := make([]sourceQuote, len(quotes))
+	copy(sorted, quotes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].price < sorted[j].price
+	})
+
+	var price float64
+	if c.method == ConsensusMethodWeighted {
+		price = weightedMedian(sorted, c.weights)
+	} else {
+		mid := len(sorted) / 2
+		price = sorted[mid].price
+		if len(sorted)%2 == 0 {
+			price = (sorted[mid-1].price + sorted[mid].price) / 2
+		}
+	}
+	if price <= 0 {
+		return price, 0
+	}
+	deviation := (sorted[len(sorted)-1].price - sorted[0].price) / price * 100
+	return price, deviation
+}
+
+// weightedMedian 加权中位数，quotes 需按价格升序排列
+func weightedMedian(quotes []sourceQuote, weights map[string]float64) float64 {
+	weightOf := func(source string) float64 {
+		if weight, ok := weights[source]; ok {
+			return weight
+		}
+		return 1
+	}
+	var total float64
+	for _, quote := range quotes {
+		total += weightOf(quote.source)
+	}
+	var cumulative float64
+	for _, quote := range quotes {
+		cumulative += weightOf(quote.source)
+		if cumulative >= total/2 {
+			return quote.price
+		}
+	}
+	return quotes[len(quotes)-1].price
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConsensusConfig_Defaults(t *testing.T) {
+	c := newConsensusConfig(koanf.New("."))
+	assert.False(t, c.enabled)
+	assert.Equal(t, ConsensusMethodMedian, c.method)
+	assert.Equal(t, 2, c.minSources)
+	assert.Equal(t, float64(5), c.maxDeviation)
+}
+
+func TestConsensusAggregate_Median(t *testing.T) {
+	c := consensusConfig{method: ConsensusMethodMedian}
+
+	price, deviation := c.aggregate([]sourceQuote{{"a", 1.02}, {"b", 0.98}, {"c", 1.00}})
+	assert.Equal(t, 1.00, price)
+	assert.InDelta(t, 4, deviation, 1e-9)
+
+	price, _ = c.aggregate([]sourceQuote{{"a", 2}, {"b", 4}})
+	assert.Equal(t, float64(3), price)
+}
+
+func TestConsensusAggregate_Weighted(t *testing.T) {
+	cfg := koanf.New(".")
+	assert.NoError(t, cfg.Load(confmap.Provider(map[string]interface{}{
+		"consensus.method":            "weighted",
+		"consensus.weights.coingecko": 3,
+	}, "."), nil))
+	c := newConsensusConfig(cfg)
+
+	price, deviation := c.aggregate([]sourceQuote{{"coingecko", 10}, {"defillama", 20}, {"geckoterminal", 30}})
+	assert.Equal(t, float64(10), price)
+	assert.InDelta(t, 200, deviation, 1e-9)
+}
+
+func TestPriceService_Consensus(t *testing.T) {
+	cfg := newTestConfig(t, map[string]interface{}{
+		"consensus.enabled":      true,
+		"consensus.minSources":   2,
+		"consensus.maxDeviation": 5,
+	})
+	redisClient, _ := newStubRedisClient()
+	slack := &stubSlackService{}
+	guard := NewPriceGuardService(cfg, &stubHistoricalPriceRepo{}, &stubRejectedPriceRepo{}, redisClient, zerolog.Nop())
+	s := newTestBatchPriceService(cfg, redisClient, guard, slack,
+		&stubProvider{name: SourceCoinGecko, prices: map[string]string{"1_0xa": "1", "1_0xb": "10", "1_0xc": "5", "1_0xd": "20"}},
+		&stubProvider{name: SourceDefiLlama, prices: map[string]string{"1_0xa": "1.02", "1_0xb": "12", "1_0xd": "30"}},
+		&stubProvider{name: SourceGeckoTerminal, prices: map[string]string{"1_0xa": "0.98"}},
+	)
+
+	results, err := s.FetchAndProcessBatchPrices(context.Background(), []string{"1", "1", "1", "1"}, []string{"0xa", "0xb", "0xc", "0xd"}, nil, nil, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+
+	// 三个报价取中位数，偏差 4% 未超过阈值
+	assert.Equal(t, "1", *results[0].Price)
+	assert.Equal(t, SourceConsensus, *results[0].Source)
+	assert.True(t, *results[0].Consensus)
+	assert.False(t, results[0].Divergent)
+
+	// 两个报价偏差 18% 超过阈值，标记偏差并发送告警，同一批次的告警只调用一次
+	assert.Equal(t, "11", *results[1].Price)
+	assert.True(t, results[1].Divergent)
+	assert.True(t, results[3].Divergent)
+	assert.Eventually(t, func() bool {
+		slack.mu.Lock()
+		defer slack.mu.Unlock()
+		return len(slack.divergences) == 2
+	}, time.Second, 10*time.Millisecond)
+	slack.mu.Lock()
+	assert.Equal(t, 1, slack.divergenceCalls)
+	assert.ElementsMatch(t, []map[string]float64{{SourceCoinGecko: 10, SourceDefiLlama: 12}, {SourceCoinGecko: 20, SourceDefiLlama: 30}}, slack.divergences)
+	slack.mu.Unlock()
+
+	// 报价不足 minSources 时使用单个数据源的报价，并标记未达成共识
+	assert.Equal(t, "5", *results[2].Price)
+	assert.Equal(t, SourceCoinGecko, *results[2].Source)
+	assert.False(t, *results[2].Consensus)
+	assert.False(t, results[2].Divergent)
+}
+
+func TestPriceService_ConsensusSourcesFollowChainOrder(t *testing.T) {
+	cfg := newTestConfig(t, map[string]interface{}{
+		"consensus.enabled":    true,
+		"consensus.minSources": 2,
+		"consensus.sources":    []string{SourceCoinGecko, SourceDefiLlama},
+	})
+	redisClient, _ := newStubRedisClient()
+	slack := &stubSlackService{}
+	guard := NewPriceGuardService(cfg, &stubHistoricalPriceRepo{}, &stubRejectedPriceRepo{}, redisClient, zerolog.Nop())
+	s := newTestBatchPriceService(cfg, redisClient, guard, slack,
+		&stubProvider{name: SourceCoinGecko, prices: map[string]string{"1_0xa": "1", "56_0xa": "1"}},
+		&stubProvider{name: SourceDefiLlama, prices: map[string]string{"1_0xa": "1.02", "56_0xa": "3"}},
+	)
+	// 56 链的数据源顺序不包含 DefiLlama
+	s.currentSourceOrder.chains = map[string][]string{"56": {SourceCoinGecko}}
+
+	results, err := s.FetchAndProcessBatchPrices(context.Background(), []string{"1", "56"}, []string{"0xa", "0xa"}, nil, nil, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	assert.Equal(t, "1.01", *results[0].Price)
+	assert.True(t, *results[0].Consensus)
+
+	assert.Equal(t, "1", *results[1].Price)
+	assert.False(t, *results[1].Consensus)
+}
@@ -28,6 +28,7 @@ type DefiLlamaService interface {
 	GetHistoricalPrice(chainId, address string, unixTimeStamp int64) (*string, error)
 	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
 	GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error)
+	GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error)
 }
 
 type defiLlamaService struct {
@@ -297,6 +298,56 @@ func (s *defiLlamaService) GetHistoricalPrice(chainId, address string, unixTimeS
 	return &priceStr, nil
 }
 
+// GetPriceRange 通过 chart 接口一次获取区间内按粒度间隔的价格
+func (s *defiLlamaService) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	chainName, err := s.getChainNameById(chainId)
+	if err != nil || chainName == "" {
+		return nil, err
+	}
+
+	step := int64(shared.GranularityDuration(granularity).Seconds())
+	span := (to-from)/step + 1
+	coinKey := fmt.Sprintf("%s:%s", chainName, address)
+	url := fmt.Sprintf("%s/chart/%s?start=%d&span=%d&period=%s", defiLlamaBaseURL, coinKey, from, span, granularity)
+	headers := map[string]string{
+		"accept": "application/json",
+	}
+
+	body, statusCode, err := shared.DoRequest(http.DefaultClient, url, headers, 10) // 指定 10 秒超时
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		if statusCode != http.StatusTooManyRequests {
+			shared.HandleErrorWithThrottling(s.redisClient, s.logger, "DefiLlamaService-GetPriceRange", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+		}
+		return nil, fmt.Errorf("failed to get price chart, status code: %d, response: %s", statusCode, string(body))
+	}
+
+	var result struct {
+		Coins map[string]struct {
+			Prices []struct {
+				Price     float64 `json:"price"`
+				Timestamp int64   `json:"timestamp"`
+			} `json:"prices"`
+		} `json:"coins"`
+	}
+	if err := shared.ParseJSONResponse(body, &result); err != nil {
+		return nil, err
+	}
+
+	chart := result.Coins[coinKey]
+	points := make([]rangePoint, len(chart.Prices))
+	for i, item := range chart.Prices {
+		points[i] = rangePoint{timestamp: item.Timestamp, price: item.Price}
+	}
+	prices := closesByBucket(chainId+"_"+address, SourceDefiLlama, granularity, points, from, to)
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(prices); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save historical prices")
+	}
+	return prices, nil
+}
+
 func (s *defiLlamaService) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
 	if len(chainIds) != len(addresses) {
 		return nil, fmt.Errorf("chainIds 和 addresses 的长度必须相同")
@@ -328,12 +379,13 @@ func (s *defiLlamaService) GetBatchCurrentPrices(addresses []string, chainIds []
 	for i, coinID := range coinIDs {
 		if cachedPrice, exists := cachedPrices[coinID]; exists && isCache {
 			results[i] = PriceResult{
-				ChainID:   chainIds[i],
-				Address:   addresses[i],
-				Price:     &cachedPrice,
-				Symbol:    GetOrNil(symbols, i),
-				Network:   GetOrNil(networks, i),
-				TimeStamp: strconv.FormatInt(time.Now().Unix(), 10),
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           &cachedPrice,
+				Symbol:          GetOrNil(symbols, i),
+				Network:         GetOrNil(networks, i),
+				TimeStamp:       strconv.FormatInt(time.Now().Unix(), 10),
+				PriceProvenance: cachedProvenance(-1),
 			}
 		} else {
 			chainName, _ := s.getChainNameById(chainIds[i])
@@ -380,8 +432,9 @@ func (s *defiLlamaService) GetBatchCurrentPrices(addresses []string, chainIds []
 
 				var apiResult struct {
 					Coins map[string]struct {
-						Price  float64 `json:"price"`
-						Symbol string  `json:"symbol"`
+						Price     float64 `json:"price"`
+						Symbol    string  `json:"symbol"`
+						Timestamp int64   `json:"timestamp"`
 					} `json:"coins"`
 				}
 
@@ -396,12 +449,13 @@ func (s *defiLlamaService) GetBatchCurrentPrices(addresses []string, chainIds []
 					i := coinsToFetchMap[coinKey]
 					priceStr := strconv.FormatFloat(data.Price, 'f', -1, 64)
 					results[i] = PriceResult{
-						ChainID:   chainIds[i],
-						Address:   addresses[i],
-						Price:     &priceStr,
-						Symbol:    GetOrNil(symbols, i),
-						Network:   GetOrNil(networks, i),
-						TimeStamp: strconv.FormatInt(time.Now().Unix(), 10),
+						ChainID:         chainIds[i],
+						Address:         addresses[i],
+						Price:           &priceStr,
+						Symbol:          GetOrNil(symbols, i),
+						Network:         GetOrNil(networks, i),
+						TimeStamp:       strconv.FormatInt(time.Now().Unix(), 10),
+						PriceProvenance: upstreamProvenance(data.Timestamp),
 					}
 
 					// 确保 coinID 存在
@@ -470,3 +524,29 @@ func (s *defiLlamaService) GetBatchHistoricalPrices(addresses []string, chainIds
 
 	return results, nil
 }
+
+// defiLlamaProvider 将 DefiLlamaService 适配为 PriceProvider
+type defiLlamaProvider struct {
+	service DefiLlamaService
+}
+
+func NewDefiLlamaProvider(service DefiLlamaService) PriceProvider {
+	return &defiLlamaProvider{service: service}
+}
+
+func (p *defiLlamaProvider) Name() string             { return SourceDefiLlama }
+func (p *defiLlamaProvider) SupportsCurrent() bool    { return true }
+func (p *defiLlamaProvider) SupportsHistorical() bool { return true }
+func (p *defiLlamaProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *defiLlamaProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *defiLlamaProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.service.GetBatchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps)
+}
+
+func (p *defiLlamaProvider) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	return p.service.GetPriceRange(chainId, address, from, to, granularity)
+}
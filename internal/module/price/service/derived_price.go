@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+)
+
+// 底层代币本身也可以是 LP 代币、包装代币或合成价格，估值时最多递归的层数
+const maxDerivedPriceDepth = 3
+
+// derivedPriceDepthKey 记录当前价格估值的递归层数
+type derivedPriceDepthKey struct{}
+
+// derivedRequest 需要按底层代币估值的币种及时间点，unixTimeStamp 为 0 表示当前价格
+type derivedRequest struct {
+	coin          schema.Coins
+	unixTimeStamp int64
+}
+
+// derivedValuation 币种依赖的底层代币（coins ID）及根据底层代币价格计算价格的方法
+type derivedValuation struct {
+	source     string
+	underlying []string
+	value      func(prices map[string]float64) *string
+}
+
+// isDerived 币种是否按底层代币估值，而不是查询数据源
+func (s *priceService) isDerived(coin schema.Coins) bool {
+	return (coin.Formula != nil && *coin.Formula != "") || s.lpTokens.IsLpToken(coin) || s.wrappers.IsWrapped(coin)
+}
+
+// valuationOf 解析币种的公式，或读取储备、汇率，返回估值方法
+func (s *priceService) valuationOf(request derivedRequest) (*derivedValuation, error) {
+	coin := request.coin
+	if coin.Formula != nil && *coin.Formula != "" {
+		f, err := parseFormula(*coin.Formula)
+		if err != nil {
+			return nil, err
+		}
+		if err := formulaCycle(coin.ID, f, s.coinRepository.GetCoinsByID); err != nil {
+			return nil, err
+		}
+		return &derivedValuation{source: SourceFormula, underlying: f.refs, value: f.evaluate}, nil
+	}
+	if s.lpTokens.IsLpToken(coin) {
+		reserves, err := s.lpTokens.Reserves(coin, request.unixTimeStamp)
+		if err != nil {
+			return nil, err
+		}
+		base, quote := coin.ChainID+"_"+reserves.Base, coin.ChainID+"_"+reserves.Quote
+		return &derivedValuation{
+			source:     SourceLpToken,
+			underlying: []string{base, quote},
+			value: func(prices map[string]float64) *string {
+				tokenPrices := make(map[string]float64)
+				if price, ok := prices[base]; ok {
+					tokenPrices[reserves.Base] = price
+				}
+				if price, ok := prices[quote]; ok {
+					tokenPrices[reserves.Quote] = price
+				}
+				return lpTokenValue(reserves, tokenPrices)
+			},
+		}, nil
+	}
+
+	chainId, address, err := s.wrappers.Underlying(coin)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := s.wrappers.Rate(coin, request.unixTimeStamp)
+	if err != nil {
+		return nil, err
+	}
+	underlying := chainId + "_" + address
+	return &derivedValuation{
+		source:     SourceWrapper,
+		underlying: []string{underlying},
+		value: func(prices map[string]float64) *string {
+			price, ok := prices[underlying]
+			if !ok {
+				return nil
+			}
+			value := strconv.FormatFloat(price*rate, 'f', -1, 64)
+			return &value
+		},
+	}, nil
+}
+
+// derivedPrices 估值 requests 中的币种，underlyingPrices 批量查询同一时间点的底层代币价格
+func (s *priceService) derivedPrices(requests map[string]derivedRequest, underlyingPrices func(chainIds, addresses []string, unixTimeStamps []int64) ([]PriceResult, error)) map[string]PriceResult {
+	valuations := make(map[string]*derivedValuation)
+	var uChainIds, uAddresses []string
+	var uTimeStamps []int64
+	seen := make(map[string]bool)
+	for id, request := range requests {
+		valuation, err := s.valuationOf(request)
+		if err != nil {
+			s.logger.Err(err).Msgf("priceService 估值 %s 失败", id)
+			continue
+		}
+		valuations[id] = valuation
+		for _, underlying := range valuation.underlying {
+			key := fmt.Sprintf("%s_%d", underlying, request.unixTimeStamp)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			chainId, address, _ := strings.Cut(underlying, "_")
+			uChainIds = append(uChainIds, chainId)
+			uAddresses = append(uAddresses, address)
+			uTimeStamps = append(uTimeStamps, request.unixTimeStamp)
+		}
+	}
+	if len(uAddresses) == 0 {
+		return nil
+	}
+	underlying, err := underlyingPrices(uChainIds, uAddresses, uTimeStamps)
+	if err != nil {
+		s.logger.Err(err).Msg("priceService 获取底层代币价格失败")
+		return nil
+	}
+	// 按时间点分组底层代币价格
+	prices := make(map[int64]map[string]float64)
+	for i, result := range underlying {
+		if i >= len(uAddresses) || result.Price == nil {
+			continue
+		}
+		price, err := strconv.ParseFloat(*result.Price, 64)
+		if err != nil {
+			continue
+		}
+		if prices[uTimeStamps[i]] == nil {
+			prices[uTimeStamps[i]] = make(map[string]float64)
+		}
+		prices[uTimeStamps[i]][uChainIds[i]+"_"+uAddresses[i]] = price
+	}
+
+	now := time.Now().Unix()
+	results := make(map[string]PriceResult)
+	for id, valuation := range valuations {
+		request := requests[id]
+		price := valuation.value(prices[request.unixTimeStamp])
+		if price == nil {
+			continue
+		}
+		observedAt := request.unixTimeStamp
+		if observedAt == 0 {
+			observedAt = now
+		}
+		results[id] = PriceResult{
+			ChainID:         request.coin.ChainID,
+			Address:         request.coin.Address,
+			Price:           price,
+			TimeStamp:       strconv.FormatInt(observedAt, 10),
+			PriceProvenance: upstreamProvenance(observedAt).complete(valuation.source, observedAt),
+		}
+	}
+	return results
+}
+
+// derivedCurrentPrices 按当前储备、汇率或公式估值，底层代币价格通过 FetchAndProcessBatchPrices 查询
+func (s *priceService) derivedCurrentPrices(ctx context.Context, requests map[string]derivedRequest, isCache bool, excludeRoute bool) map[string]PriceResult {
+	depth, _ := ctx.Value(derivedPriceDepthKey{}).(int)
+	if len(requests) == 0 || depth >= maxDerivedPriceDepth {
+		return nil
+	}
+	return s.derivedPrices(requests, func(chainIds, addresses []string, _ []int64) ([]PriceResult, error) {
+		return s.FetchAndProcessBatchPrices(context.WithValue(ctx, derivedPriceDepthKey{}, depth+1), chainIds, addresses, nil, nil, isCache, excludeRoute)
+	})
+}
+
+// derivedHistoricalPrices 按对应区块的储备、汇率或公式估值，底层代币价格通过 batchHistoricalPrice 按相同粒度查询
+func (s *priceService) derivedHistoricalPrices(depth int, granularity string, requests map[string]derivedRequest) map[string]PriceResult {
+	if len(requests) == 0 || depth >= maxDerivedPriceDepth {
+		return nil
+	}
+	return s.derivedPrices(requests, func(chainIds, addresses []string, unixTimeStamps []int64) ([]PriceResult, error) {
+		datesStr := make([]string, len(unixTimeStamps))
+		for i, unixTimeStamp := range unixTimeStamps {
+			datesStr[i] = strconv.FormatInt(unixTimeStamp, 10)
+		}
+		return s.batchHistoricalPrice(depth+1, granularity, chainIds, addresses, nil, nil, unixTimeStamps, datesStr)
+	})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceService_DerivedPrices(t *testing.T) {
+	rpcClient := newStubWrapperServer(t)
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	s := &priceService{
+		lpTokens:       NewLpTokenService(rpcClient, zerolog.Nop()),
+		wrappers:       NewWrapperService(koanf.New("."), rpcClient, redisClient, zerolog.Nop()),
+		coinRepository: stubCoinRepo{},
+		logger:         zerolog.Nop(),
+	}
+
+	attributes := `{"lpToken":true,"baseReserve":"2","quoteReserve":"3"}`
+	base, quote, totalSupply := testStEth, testUsdc, "1"
+	lpCoin := schema.Coins{ID: "1_0xlp", ChainID: "1", Address: "0xlp", BaseTokenAddress: &base, QuoteTokenAddress: &quote, PoolAttributes: &attributes, TotalSupply: &totalSupply}
+	vault := wrappedCoin(testVault, `{"type":"erc4626"}`)
+	wstEth := wrappedCoin(testWstEth, `{"type":"wstETH","underlying":"1_`+testStEth+`"}`)
+	assert.True(t, s.isDerived(lpCoin))
+	assert.True(t, s.isDerived(vault))
+	formula := "price(1_" + testStEth + ") / price(1_" + testUsdc + ")"
+	synthetic := schema.Coins{ID: "1_0xsynthetic", ChainID: "1", Address: "0xsynthetic", Formula: &formula}
+	assert.True(t, s.isDerived(synthetic))
+	assert.False(t, s.isDerived(schema.Coins{ID: "1_" + testUsdc}))
+
+	var requested []string
+	underlyingPrices := func(chainIds, addresses []string, unixTimeStamps []int64) ([]PriceResult, error) {
+		results := make([]PriceResult, len(addresses))
+		for i, address := range addresses {
+			requested = append(requested, chainIds[i]+"_"+address)
+			price := map[string]string{testStEth: "2000", testUsdc: "1"}[address]
+			results[i] = PriceResult{ChainID: chainIds[i], Address: address, Price: &price}
+		}
+		return results, nil
+	}
+	results := s.derivedPrices(map[string]derivedRequest{
+		lpCoin.ID:    {coin: lpCoin},
+		vault.ID:     {coin: vault},
+		wstEth.ID:    {coin: wstEth},
+		synthetic.ID: {coin: synthetic},
+	}, underlyingPrices)
+	assert.ElementsMatch(t, []string{"1_" + testStEth, "1_" + testUsdc}, requested)
+	if assert.NotNil(t, results[lpCoin.ID].Price) {
+		assert.Equal(t, "4003", *results[lpCoin.ID].Price)
+		assert.Equal(t, SourceLpToken, *results[lpCoin.ID].Source)
+	}
+	if assert.NotNil(t, results[vault.ID].Price) {
+		assert.Equal(t, "1.05", *results[vault.ID].Price)
+		assert.Equal(t, SourceWrapper, *results[vault.ID].Source)
+	}
+	if assert.NotNil(t, results[wstEth.ID].Price) {
+		assert.Equal(t, "2300", *results[wstEth.ID].Price)
+	}
+	if assert.NotNil(t, results[synthetic.ID].Price) {
+		assert.Equal(t, "2000", *results[synthetic.ID].Price)
+		assert.Equal(t, SourceFormula, *results[synthetic.ID].Source)
+	}
+
+	// 历史价格按请求时间点查询底层代币，没有底层代币价格时不返回结果
+	requested = nil
+	results = s.derivedPrices(map[string]derivedRequest{vault.ID: {coin: vault, unixTimeStamp: 505}}, func(chainIds, addresses []string, unixTimeStamps []int64) ([]PriceResult, error) {
+		assert.Equal(t, []int64{505}, unixTimeStamps)
+		return make([]PriceResult, len(addresses)), nil
+	})
+	assert.Empty(t, results)
+}
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// DODO V2 池子及工厂合约方法选择器
+const (
+	dodoGetMidPrice            = "0xee27c689"
+	dodoGetPMMStateForCall     = "0xfd1ed7e9"
+	dodoBaseToken              = "0x4a248d2a"
+	dodoQuoteToken             = "0xd4b97046"
+	dodoGetDODOPoolBidirection = "0x794e5538"
+)
+
+const (
+	dodoPoolKeyPrefix = "dodoPool:pool:"
+	dodoPoolCacheTTL  = 6 * time.Hour
+)
+
+// dodoPoolChain 单条链的池子配置
+type dodoPoolChain struct {
+	pools       map[string]string // 代币 -> 指定的池子
+	factories   []string          // 用于发现池子的 DVM/DSP/DPP 工厂合约
+	quoteTokens []string          // 发现池子时与代币配对的报价代币
+}
+
+// DodoPoolService 通过 eth_call 读取 DODO V2 PMM 池子的中间价，池子来自配置或工厂合约
+type DodoPoolService interface {
+	Enabled() bool
+	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
+	GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error)
+	// GetPricesAtBlock 按指定区块的池子状态计算价格
+	GetPricesAtBlock(chainId string, addresses []string, blockNumber uint64) ([]PriceResult, error)
+}
+
+type dodoPoolService struct {
+	chains                  map[string]dodoPoolChain
+	minLiquidityUsd         float64
+	rpcClient               *shared.RpcClient
+	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	redisClient             *shared.RedisClient
+	logger                  zerolog.Logger
+	poolTokens              sync.Map // 池子 -> [base, quote]
+}
+
+func NewDodoPoolService(cfg *koanf.Koanf, rpcClient *shared.RpcClient, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, redisClient *shared.RedisClient, logger zerolog.Logger) DodoPoolService {
+	minLiquidityUsd := cfg.Float64("dodoPool.minLiquidityUsd")
+	if !cfg.Exists("dodoPool.minLiquidityUsd") {
+		minLiquidityUsd = defaultAmmMinLiquidityUsd
+	}
+	return &dodoPoolService{
+		chains:                  dodoPoolChains(cfg),
+		minLiquidityUsd:         minLiquidityUsd,
+		rpcClient:               rpcClient,
+		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		redisClient:             redisClient,
+		logger:                  logger,
+	}
+}
+
+// dodoPoolChains 读取 dodoPool.chains.<chainId> 下的 pools、factories 和 quoteTokens 配置
+func dodoPoolChains(cfg *koanf.Koanf) map[string]dodoPoolChain {
+	lower := func(values []string) []string {
+		for i, value := range values {
+			values[i] = strings.ToLower(value)
+		}
+		return values
+	}
+	chains := make(map[string]dodoPoolChain)
+	for _, chainId := range cfg.MapKeys("dodoPool.chains") {
+		path := "dodoPool.chains." + chainId
+		chain := dodoPoolChain{
+			pools:       make(map[string]string),
+			factories:   lower(configStrings(cfg, path+".factories")),
+			quoteTokens: lower(configStrings(cfg, path+".quoteTokens")),
+		}
+		for token, pool := range cfg.StringMap(path + ".pools") {
+			chain.pools[shared.NormalizeAddress(chainId, token)] = strings.ToLower(pool)
+		}
+		chains[chainId] = chain
+	}
+	return chains
+}
+
+func (s *dodoPoolService) Enabled() bool {
+	return len(s.chains) > 0
+}
+
+func (s *dodoPoolService) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	if len(chainIds) != len(addresses) {
+		return nil, fmt.Errorf("chainIds and addresses must have the same length")
+	}
+	coinIDs := make([]string, len(addresses))
+	for i, address := range addresses {
+		coinIDs[i] = chainIds[i] + "_" + address
+	}
+	var cachedPrices map[string]string
+	if isCache {
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
+	now := time.Now()
+	results := make([]PriceResult, len(addresses))
+	var pricesToSave []schema.CoinHistoricalPrice
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, coinID := range coinIDs {
+		results[i] = PriceResult{
+			ChainID:   chainIds[i],
+			Address:   addresses[i],
+			Symbol:    GetOrNil(symbols, i),
+			Network:   GetOrNil(networks, i),
+			TimeStamp: strconv.FormatInt(now.Unix(), 10),
+		}
+		if _, ok := s.chains[chainIds[i]]; !ok || !s.rpcClient.HasChain(chainIds[i]) {
+			continue
+		}
+		if cachedPrice, exists := cachedPrices[coinID]; exists {
+			results[i].Price = &cachedPrice
+			results[i].PriceProvenance = cachedProvenance(-1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			price, err := s.tokenPrice(chainIds[i], addresses[i], 0, 0)
+			if err != nil {
+				s.logger.Err(err).Msgf("DodoPoolService 获取 %s 价格失败", coinIDs[i])
+				return
+			}
+			if price == nil {
+				return
+			}
+
+			s.redisClient.SetCurrentPriceCache(coinIDs[i], *price)
+			mu.Lock()
+			defer mu.Unlock()
+			results[i].Price = price
+			results[i].PriceProvenance = upstreamProvenance(now.Unix())
+			pricesToSave = append(pricesToSave, schema.CoinHistoricalPrice{
+				CoinID:  coinIDs[i],
+				Date:    now.Unix(),
+				DayDate: now.Format("02-01-2006"),
+				Price:   *price,
+				Source:  SourceDodoPool,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(pricesToSave); err != nil {
+		s.logger.Err(err).Msg("DodoPoolService 保存价格失败")
+	}
+	return results, nil
+}
+
+func (s *dodoPoolService) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	if len(chainIds) != len(addresses) || len(addresses) != len(unixTimeStamps) {
+		return nil, fmt.Errorf("chainIds, addresses and unixTimeStamps must have the same length")
+	}
+
+	// 同一链同一时间点只查找一次区块
+	blocks := make(map[string]uint64)
+	results := make([]PriceResult, len(addresses))
+	var pricesToSave []schema.CoinHistoricalPrice
+	for i := range addresses {
+		results[i] = PriceResult{
+			ChainID:   chainIds[i],
+			Address:   addresses[i],
+			Symbol:    GetOrNil(symbols, i),
+			Network:   GetOrNil(networks, i),
+			TimeStamp: strconv.FormatInt(unixTimeStamps[i], 10),
+		}
+		if _, ok := s.chains[chainIds[i]]; !ok || !s.rpcClient.HasChain(chainIds[i]) {
+			continue
+		}
+		blockKey := chainIds[i] + "_" + strconv.FormatInt(unixTimeStamps[i], 10)
+		blockNumber, ok := blocks[blockKey]
+		if !ok {
+			var err error
+			if blockNumber, err = s.rpcClient.BlockNumberAt(chainIds[i], unixTimeStamps[i]); err != nil {
+				s.logger.Err(err).Msgf("DodoPoolService 查找链 %s 在 %d 的区块失败", chainIds[i], unixTimeStamps[i])
+				continue
+			}
+			blocks[blockKey] = blockNumber
+		}
+
+		coinID := chainIds[i] + "_" + addresses[i]
+		price, err := s.tokenPrice(chainIds[i], addresses[i], blockNumber, unixTimeStamps[i])
+		if err != nil {
+			s.logger.Err(err).Msgf("DodoPoolService 获取 %s 在区块 %d 的价格失败", coinID, blockNumber)
+			continue
+		}
+		if price == nil {
+			continue
+		}
+		results[i].Price = price
+		results[i].PriceProvenance = upstreamProvenance(unixTimeStamps[i])
+		pricesToSave = append(pricesToSave, schema.CoinHistoricalPrice{
+			CoinID:  coinID,
+			Date:    unixTimeStamps[i],
+			DayDate: time.Unix(unixTimeStamps[i], 0).Format("02-01-2006"),
+			Price:   *price,
+			Source:  SourceDodoPool,
+		})
+	}
+
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(pricesToSave); err != nil {
+		s.logger.Err(err).Msg("DodoPoolService 保存历史价格失败")
+	}
+	return results, nil
+}
+
+func (s *dodoPoolService) GetPricesAtBlock(chainId string, addresses []string, blockNumber uint64) ([]PriceResult, error) {
+	if _, ok := s.chains[chainId]; !ok || !s.rpcClient.HasChain(chainId) {
+		return nil, fmt.Errorf("dodo pool pricing is not configured for chain %s", chainId)
+	}
+	blockTime, err := s.rpcClient.BlockTimestamp(chainId, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]PriceResult, len(addresses))
+	for i, address := range addresses {
+		results[i] = PriceResult{
+			ChainID:   chainId,
+			Address:   address,
+			TimeStamp: strconv.FormatInt(blockTime, 10),
+		}
+		price, err := s.tokenPrice(chainId, shared.NormalizeAddress(chainId, address), blockNumber, blockTime)
+		if err != nil {
+			s.logger.Err(err).Msgf("DodoPoolService 获取 %s_%s 在区块 %d 的价格失败", chainId, address, blockNumber)
+			continue
+		}
+		results[i].Price = price
+		if price != nil {
+			results[i].PriceProvenance = upstreamProvenance(blockTime)
+		}
+	}
+	return results, nil
+}
+
+// tokenPrice 计算代币在指定区块的 USD 价格，blockNumber 为 0 时使用最新区块，unixTimeStamp 用于取配对代币的历史价格
+func (s *dodoPoolService) tokenPrice(chainId, token string, blockNumber uint64, unixTimeStamp int64) (*string, error) {
+	pool, err := s.selectPool(chainId, token)
+	if err != nil || pool == "" {
+		return nil, err
+	}
+	price, _, err := s.poolPrice(chainId, pool, token, blockNumber, unixTimeStamp)
+	if err != nil || price == nil {
+		return nil, err
+	}
+	priceStr := strconv.FormatFloat(*price, 'f', -1, 64)
+	return &priceStr, nil
+}
+
+// selectPool 返回代币的定价池子，优先使用配置的池子，否则通过工厂合约发现流动性最高的池子，结果缓存在 Redis 中
+func (s *dodoPoolService) selectPool(chainId, token string) (string, error) {
+	chain := s.chains[chainId]
+	if pool, ok := chain.pools[token]; ok {
+		return pool, nil
+	}
+	if len(chain.factories) == 0 || len(chain.quoteTokens) == 0 {
+		return "", nil
+	}
+
+	cacheKey := dodoPoolKeyPrefix + chainId + "_" + token
+	if pool, err := s.redisClient.Client.Get(context.Background(), cacheKey).Result(); err == nil {
+		return pool, nil
+	}
+
+	var best string
+	var bestLiquidity float64
+	for _, factory := range chain.factories {
+		for _, quote := range chain.quoteTokens {
+			if quote == token {
+				continue
+			}
+			pools, err := s.discoverPools(chainId, factory, token, quote)
+			if err != nil {
+				s.logger.Debug().Err(err).Msgf("DodoPoolService 查询工厂 %s 的池子失败", factory)
+				continue
+			}
+			for _, pool := range pools {
+				price, liquidity, err := s.poolPrice(chainId, pool, token, 0, 0)
+				if err != nil || price == nil {
+					continue
+				}
+				if liquidity > bestLiquidity {
+					best, bestLiquidity = pool, liquidity
+				}
+			}
+		}
+	}
+	// 没有可用池子时同样缓存，避免重复查询工厂合约
+	s.redisClient.Client.Set(context.Background(), cacheKey, best, dodoPoolCacheTTL)
+	return best, nil
+}
+
+// discoverPools 通过 getDODOPoolBidirection 查询两个代币之间的所有池子
+func (s *dodoPoolService) discoverPools(chainId, factory, token, quote string) ([]string, error) {
+	data, err := s.rpcClient.EthCall(chainId, factory, dodoGetDODOPoolBidirection+shared.AbiEncodeAddress(token)+shared.AbiEncodeAddress(quote), 0)
+	if err != nil {
+		return nil, err
+	}
+	words, err := shared.AbiWords(data)
+	if err != nil {
+		return nil, err
+	}
+	baseTokenPools, err := shared.AbiAddressArray(words, 0)
+	if err != nil {
+		return nil, err
+	}
+	quoteTokenPools, err := shared.AbiAddressArray(words, 1)
+	if err != nil {
+		return nil, err
+	}
+	return append(baseTokenPools, quoteTokenPools...), nil
+}
+
+// poolTokensOf 读取池子的 base 和 quote 代币，池子创建后不会变化
+func (s *dodoPoolService) poolTokensOf(chainId, pool string) (string, string, error) {
+	key := chainId + "_" + pool
+	if tokens, ok := s.poolTokens.Load(key); ok {
+		return tokens.([2]string)[0], tokens.([2]string)[1], nil
+	}
+	var tokens [2]string
+	for i, selector := range []string{dodoBaseToken, dodoQuoteToken} {
+		words, err := s.call(chainId, pool, selector, 0)
+		if err != nil {
+			return "", "", err
+		}
+		if len(words) == 0 {
+			return "", "", fmt.Errorf("invalid token response from %s", pool)
+		}
+		tokens[i] = shared.AbiAddress(words[0])
+	}
+	s.poolTokens.Store(key, tokens)
+	return tokens[0], tokens[1], nil
+}
+
+// poolPrice 按池子中间价计算代币的 USD 价格，同时返回池子中配对代币一侧的流动性（USD），流动性不足时价格为 nil
+func (s *dodoPoolService) poolPrice(chainId, pool, token string, blockNumber uint64, unixTimeStamp int64) (*float64, float64, error) {
+	base, quote, err := s.poolTokensOf(chainId, pool)
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != base && token != quote {
+		return nil, 0, fmt.Errorf("pool %s does not contain %s", pool, token)
+	}
+	baseDecimals, err := s.rpcClient.Decimals(chainId, base)
+	if err != nil {
+		return nil, 0, err
+	}
+	quoteDecimals, err := s.rpcClient.Decimals(chainId, quote)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// getMidPrice 为 1e18 精度下每最小单位 base 可兑换的 quote 最小单位数量
+	mid, err := s.call(chainId, pool, dodoGetMidPrice, blockNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(mid) == 0 || mid[0].Sign() == 0 {
+		return nil, 0, fmt.Errorf("invalid getMidPrice response from %s", pool)
+	}
+	// getPMMStateForCall 返回 (i, K, B, Q, B0, Q0, R)
+	state, err := s.call(chainId, pool, dodoGetPMMStateForCall, blockNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(state) < 4 {
+		return nil, 0, fmt.Errorf("invalid getPMMStateForCall response from %s", pool)
+	}
+
+	midPrice, _ := new(big.Float).Quo(new(big.Float).Mul(new(big.Float).SetInt(mid[0]), pow10(baseDecimals)), pow10(18+quoteDecimals)).Float64()
+
+	pair, pairDecimals, pairReserve, priceInPair := quote, quoteDecimals, state[3], midPrice
+	if token == quote {
+		pair, pairDecimals, pairReserve, priceInPair = base, baseDecimals, state[2], 1/midPrice
+	}
+	pairUsd, err := knownUsdPrice(s.redisClient, s.coinHistoricalPriceRepo, chainId+"_"+pair, unixTimeStamp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	liquidity, _ := new(big.Float).Quo(new(big.Float).SetInt(pairReserve), pow10(pairDecimals)).Float64()
+	liquidity *= 2 * pairUsd
+	if liquidity < s.minLiquidityUsd {
+		return nil, liquidity, nil
+	}
+	price := priceInPair * pairUsd
+	if price <= 0 {
+		return nil, liquidity, nil
+	}
+	return &price, liquidity, nil
+}
+
+func (s *dodoPoolService) call(chainId, to, data string, blockNumber uint64) ([]*big.Int, error) {
+	result, err := s.rpcClient.EthCall(chainId, to, data, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return shared.AbiWords(result)
+}
+
+// dodoPoolProvider 将 DodoPoolService 适配为 PriceProvider
+type dodoPoolProvider struct {
+	service DodoPoolService
+}
+
+func NewDodoPoolProvider(service DodoPoolService) PriceProvider {
+	return &dodoPoolProvider{service: service}
+}
+
+func (p *dodoPoolProvider) Name() string             { return SourceDodoPool }
+func (p *dodoPoolProvider) SupportsCurrent() bool    { return p.service.Enabled() }
+func (p *dodoPoolProvider) SupportsHistorical() bool { return p.service.Enabled() }
+func (p *dodoPoolProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *dodoPoolProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *dodoPoolProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.service.GetBatchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps)
+}
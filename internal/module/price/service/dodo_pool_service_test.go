@@ -0,0 +1,98 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDodoPoolService_Prices(t *testing.T) {
+	const (
+		usdc       = "0x00000000000000000000000000000000000000a0"
+		tokenPool  = "0x00000000000000000000000000000000000000b1"
+		tokenFound = "0x00000000000000000000000000000000000000b2"
+		pool       = "0x00000000000000000000000000000000000000c1"
+		poolThin   = "0x00000000000000000000000000000000000000c2"
+		poolDeep   = "0x00000000000000000000000000000000000000c3"
+		factory    = "0x00000000000000000000000000000000000000d1"
+	)
+	e := func(n int64) *big.Int { return new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil) }
+	mul := func(a int64, b *big.Int) *big.Int { return new(big.Int).Mul(big.NewInt(a), b) }
+	state := func(b, q *big.Int) string {
+		return abiResult(e(18), big.NewInt(0), b, q, b, q, big.NewInt(0))
+	}
+
+	server := newStubContractServer(map[string]string{
+		usdc + ":0x313ce567":       abiResult(big.NewInt(6)),
+		tokenPool + ":0x313ce567":  abiResult(big.NewInt(18)),
+		tokenFound + ":0x313ce567": abiResult(big.NewInt(18)),
+
+		// 配置的池子：1 tokenPool = 2000 USDC，区块 50 时为 1000 USDC
+		pool + ":" + dodoBaseToken:                  abiAddressResult(tokenPool),
+		pool + ":" + dodoQuoteToken:                 abiAddressResult(usdc),
+		pool + ":" + dodoGetMidPrice:                abiResult(mul(2000, e(6))),
+		pool + ":" + dodoGetMidPrice + "@50":        abiResult(mul(1000, e(6))),
+		pool + ":" + dodoGetPMMStateForCall:         state(mul(1000, e(18)), mul(2000000, e(6))),
+		pool + ":" + dodoGetPMMStateForCall + "@50": state(mul(1000, e(18)), mul(1000000, e(6))),
+
+		// 发现的池子：流动性不足的 tokenFound/USDC 池子报价 5 USDC，USDC/tokenFound 池子 1 USDC 可兑换 0.25 tokenFound
+		factory + ":" + dodoGetDODOPoolBidirection + shared.AbiEncodeAddress(tokenFound) + shared.AbiEncodeAddress(usdc): abiResult(
+			big.NewInt(64), big.NewInt(128), big.NewInt(1), new(big.Int).SetBytes([]byte{0xc2}), big.NewInt(1), new(big.Int).SetBytes([]byte{0xc3}),
+		),
+		poolThin + ":" + dodoBaseToken:          abiAddressResult(tokenFound),
+		poolThin + ":" + dodoQuoteToken:         abiAddressResult(usdc),
+		poolThin + ":" + dodoGetMidPrice:        abiResult(mul(5, e(6))),
+		poolThin + ":" + dodoGetPMMStateForCall: state(mul(20, e(18)), mul(100, e(6))),
+		poolDeep + ":" + dodoBaseToken:          abiAddressResult(usdc),
+		poolDeep + ":" + dodoQuoteToken:         abiAddressResult(tokenFound),
+		poolDeep + ":" + dodoGetMidPrice:        abiResult(new(big.Int).Div(e(30), big.NewInt(4))),
+		poolDeep + ":" + dodoGetPMMStateForCall: state(mul(1000000, e(6)), mul(250000, e(18))),
+	}, 100)
+	defer server.Close()
+
+	cfg := koanf.New(".")
+	cfg.Set("dodoPool.chains.1.pools", map[string]any{tokenPool: pool})
+	cfg.Set("dodoPool.chains.1.factories", []string{factory})
+	cfg.Set("dodoPool.chains.1.quoteTokens", []string{usdc})
+	historicalRepo := &stubHistoricalPriceRepo{latest: map[string]string{"1_" + usdc: "1"}}
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	s := NewDodoPoolService(cfg, newTestRpcClient(server.URL), historicalRepo, redisClient, zerolog.Nop())
+	provider := NewDodoPoolProvider(s)
+	assert.True(t, provider.SupportsCurrent())
+	assert.True(t, provider.SupportsHistorical())
+
+	unknown := "0x00000000000000000000000000000000000000ff"
+	results, err := provider.GetBatchCurrentPrices([]string{tokenPool, tokenFound, unknown, tokenPool}, []string{"1", "1", "1", "56"}, nil, nil, false)
+	assert.NoError(t, err)
+	if assert.NotNil(t, results[0].Price) {
+		assert.Equal(t, "2000", *results[0].Price)
+	}
+	if assert.NotNil(t, results[1].Price) {
+		assert.Equal(t, "4", *results[1].Price)
+	}
+	assert.Nil(t, results[2].Price)
+	assert.Nil(t, results[3].Price)
+	assert.Len(t, historicalRepo.saved, 2)
+
+	// 区块 50 的时间为 500，区块 51 为 510
+	results, err = s.GetPricesAtBlock("1", []string{tokenPool}, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, "500", results[0].TimeStamp)
+	if assert.NotNil(t, results[0].Price) {
+		assert.Equal(t, "1000", *results[0].Price)
+	}
+	results, err = provider.GetBatchHistoricalPrices([]string{tokenPool}, []string{"1"}, nil, nil, []int64{505})
+	assert.NoError(t, err)
+	if assert.NotNil(t, results[0].Price) {
+		assert.Equal(t, "1000", *results[0].Price)
+	}
+
+	_, err = s.GetPricesAtBlock("56", []string{tokenPool}, 50)
+	assert.Error(t, err)
+	assert.False(t, NewDodoPoolProvider(NewDodoPoolService(koanf.New("."), newTestRpcClient(server.URL), historicalRepo, redisClient, zerolog.Nop())).SupportsCurrent())
+}
@@ -165,11 +165,34 @@ func (s *dodoexRouteService) GetBatchCurrentPrices(addresses []string, chainIds
 	var wg sync.WaitGroup
 	errCh := make(chan error, len(addresses))
 
+	// 先批量读取缓存，区分缓存命中和实时请求的结果
+	var cachedPrices map[string]string
+	if isCache {
+		coinIDs := make([]string, len(addresses))
+		for i := range addresses {
+			coinIDs[i] = chainIds[i] + "_" + addresses[i]
+		}
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
 	for i := range chainIds {
+		if cachedPrice, exists := cachedPrices[chainIds[i]+"_"+addresses[i]]; exists {
+			results[i] = PriceResult{
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           &cachedPrice,
+				Symbol:          &symbols[i],
+				Network:         &networks[i],
+				TimeStamp:       fmt.Sprintf("%d", time.Now().Unix()),
+				Serial:          i,
+				PriceProvenance: cachedProvenance(-1),
+			}
+			continue
+		}
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			price, err := s.GetCurrentPrice(addresses[i], chainIds[i], isCache)
+			price, err := s.GetCurrentPrice(addresses[i], chainIds[i], false)
 			requestStatus := "200"
 			if err != nil {
 				if strings.Contains(err.Error(), "429") {
@@ -177,14 +200,15 @@ func (s *dodoexRouteService) GetBatchCurrentPrices(addresses []string, chainIds
 				}
 			}
 			priceResult := PriceResult{
-				ChainID:       chainIds[i],
-				Address:       addresses[i],
-				Price:         price,
-				Symbol:        &symbols[i],
-				Network:       &networks[i],
-				TimeStamp:     fmt.Sprintf("%d", time.Now().Unix()),
-				RequestStatus: &requestStatus,
-				Serial:        i,
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           price,
+				Symbol:          &symbols[i],
+				Network:         &networks[i],
+				TimeStamp:       fmt.Sprintf("%d", time.Now().Unix()),
+				RequestStatus:   &requestStatus,
+				Serial:          i,
+				PriceProvenance: upstreamProvenance(0),
 			}
 			results[i] = priceResult
 		}(i)
@@ -195,3 +219,25 @@ func (s *dodoexRouteService) GetBatchCurrentPrices(addresses []string, chainIds
 
 	return results, nil
 }
+
+// dodoexRouteProvider 将 DodoexRouteService 适配为 PriceProvider，只支持当前价格
+type dodoexRouteProvider struct {
+	service DodoexRouteService
+}
+
+func NewDodoexRouteProvider(service DodoexRouteService) PriceProvider {
+	return &dodoexRouteProvider{service: service}
+}
+
+func (p *dodoexRouteProvider) Name() string             { return SourceDodoexRoute }
+func (p *dodoexRouteProvider) SupportsCurrent() bool    { return true }
+func (p *dodoexRouteProvider) SupportsHistorical() bool { return false }
+func (p *dodoexRouteProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *dodoexRouteProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *dodoexRouteProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return nil, fmt.Errorf("%s does not support historical prices", SourceDodoexRoute)
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+)
+
+// SourceFormula 由 coins.formula 表达式计算得到的合成价格
+const SourceFormula = "formula"
+
+// FormulaError 公式语法错误或存在循环引用
+type FormulaError struct {
+	Message string
+}
+
+func (e *FormulaError) Error() string {
+	return "invalid formula: " + e.Message
+}
+
+// formula 解析后的价格表达式，例如 0.5*price(1_0xa) + 0.5*price(1_0xb)
+type formula struct {
+	root formulaNode
+	refs []string // 引用的 coins ID，按出现顺序去重
+}
+
+type formulaNode interface {
+	// eval 计算表达式的值，缺少引用的价格或结果无效时返回 false
+	eval(prices map[string]float64) (float64, bool)
+}
+
+type formulaNumber float64
+
+type formulaPrice string
+
+type formulaNegate struct {
+	operand formulaNode
+}
+
+type formulaBinary struct {
+	op          byte
+	left, right formulaNode
+}
+
+func (n formulaNumber) eval(map[string]float64) (float64, bool) {
+	return float64(n), true
+}
+
+func (n formulaPrice) eval(prices map[string]float64) (float64, bool) {
+	price, ok := prices[string(n)]
+	return price, ok
+}
+
+func (n formulaNegate) eval(prices map[string]float64) (float64, bool) {
+	value, ok := n.operand.eval(prices)
+	return -value, ok
+}
+
+func (n formulaBinary) eval(prices map[string]float64) (float64, bool) {
+	left, ok := n.left.eval(prices)
+	if !ok {
+		return 0, false
+	}
+	right, ok := n.right.eval(prices)
+	if !ok {
+		return 0, false
+	}
+	var value float64
+	switch n.op {
+	case '+':
+		value = left + right
+	case '-':
+		value = left - right
+	case '*':
+		value = left * right
+	case '/':
+		if right == 0 {
+			return 0, false
+		}
+		value = left / right
+	}
+	return value, !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// evaluate 计算公式的价格，结果不为正数时返回 nil
+func (f *formula) evaluate(prices map[string]float64) *string {
+	value, ok := f.root.eval(prices)
+	if !ok || value <= 0 {
+		return nil
+	}
+	price := strconv.FormatFloat(value, 'f', -1, 64)
+	return &price
+}
+
+// parseFormula 解析由数字、+ - * /、括号和 price(<coins ID>) 组成的表达式
+func parseFormula(input string) (*formula, error) {
+	p := &formulaParser{input: input}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	if len(p.refs) == 0 {
+		return nil, &FormulaError{Message: "formula must reference at least one price()"}
+	}
+	return &formula{root: root, refs: p.refs}, nil
+}
+
+type formulaParser struct {
+	input string
+	pos   int
+	refs  []string
+}
+
+func (p *formulaParser) errorf(format string, args ...any) error {
+	return &FormulaError{Message: fmt.Sprintf("%s at position %d", fmt.Sprintf(format, args...), p.pos)}
+}
+
+func (p *formulaParser) skipSpaces() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t' || p.input[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *formulaParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// expr := term { ('+' | '-') term }
+func (p *formulaParser) parseExpr() (formulaNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term := unary { ('*' | '/') unary }
+func (p *formulaParser) parseTerm() (formulaNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *formulaParser) parseUnary() (formulaNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return formulaNegate{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// primary := number | 'price' '(' coins ID ')' | '(' expr ')'
+func (p *formulaParser) parsePrimary() (formulaNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end of formula")
+	case c == '(':
+		p.pos++
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.input[start:p.pos])
+		}
+		return formulaNumber(value), nil
+	case strings.HasPrefix(p.input[p.pos:], "price"):
+		p.pos += len("price")
+		if p.peek() != '(' {
+			return nil, p.errorf("expected ( after price")
+		}
+		p.pos++
+		end := strings.IndexByte(p.input[p.pos:], ')')
+		if end < 0 {
+			return nil, p.errorf("missing )")
+		}
+		id := shared.NormalizeCoinID(strings.Trim(strings.TrimSpace(p.input[p.pos:p.pos+end]), `"'`))
+		if chainId, address, ok := strings.Cut(id, "_"); !ok || chainId == "" || address == "" {
+			return nil, p.errorf("invalid coin id %q", id)
+		}
+		p.pos += end + 1
+		p.addRef(id)
+		return formulaPrice(id), nil
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *formulaParser) addRef(id string) {
+	for _, ref := range p.refs {
+		if ref == id {
+			return
+		}
+	}
+	p.refs = append(p.refs, id)
+}
+
+// formulaCycle 从 coinID 出发沿公式引用查找循环依赖，f 为 coinID 的公式，getCoins 读取被引用的币种
+func formulaCycle(coinID string, f *formula, getCoins func(ids []string) ([]schema.Coins, error)) error {
+	path := []string{coinID}
+	onPath := map[string]bool{coinID: true}
+	checked := make(map[string]bool)
+
+	var visit func(refs []string) error
+	visit = func(refs []string) error {
+		var next []string
+		for _, ref := range refs {
+			if onPath[ref] {
+				return &FormulaError{Message: "circular reference " + strings.Join(append(path, ref), " -> ")}
+			}
+			if !checked[ref] {
+				next = append(next, ref)
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		coins, err := getCoins(next)
+		if err != nil {
+			return err
+		}
+		for _, coin := range coins {
+			checked[coin.ID] = true
+			if coin.Formula == nil || *coin.Formula == "" {
+				continue
+			}
+			// 被引用币种的公式无效时在计算它的价格时报错，这里只检查循环引用
+			child, err := parseFormula(*coin.Formula)
+			if err != nil {
+				continue
+			}
+			path = append(path, coin.ID)
+			onPath[coin.ID] = true
+			if err := visit(child.refs); err != nil {
+				return err
+			}
+			path = path[:len(path)-1]
+			delete(onPath, coin.ID)
+		}
+		return nil
+	}
+	return visit(f.refs)
+}
+
+// ValidateFormula 检查币种公式的语法及循环引用，没有配置公式时返回 nil
+func ValidateFormula(coin schema.Coins, getCoins func(ids []string) ([]schema.Coins, error)) error {
+	if coin.Formula == nil || *coin.Formula == "" {
+		return nil
+	}
+	f, err := parseFormula(*coin.Formula)
+	if err != nil {
+		return err
+	}
+	return formulaCycle(coin.ID, f, getCoins)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormula(t *testing.T) {
+	prices := map[string]float64{"1_0xa": 2, "1_0xb": 4, "56_0xc": 0}
+	tests := []struct {
+		formula string
+		refs    []string
+		want    *string
+	}{
+		{"0.5*price(1_0xA) + 0.5*price(1_0xb)", []string{"1_0xa", "1_0xb"}, ptr("3")},
+		{"price(1_0xb) / price(1_0xa) - 1", []string{"1_0xb", "1_0xa"}, ptr("1")},
+		{"1 / price(1_0xa)", []string{"1_0xa"}, ptr("0.5")},
+		{"-(price(1_0xa) - 3) * 2", []string{"1_0xa"}, ptr("2")},
+		{"price( '1_0xa' ) * price(1_0xa)", []string{"1_0xa"}, ptr("4")},
+		{"price(1_0xa) / price(56_0xc)", []string{"1_0xa", "56_0xc"}, nil},
+		{"price(1_0xa) - price(1_0xb)", []string{"1_0xa", "1_0xb"}, nil},
+		{"price(1_0xd) + 1", []string{"1_0xd"}, nil},
+	}
+	for _, tt := range tests {
+		f, err := parseFormula(tt.formula)
+		if !assert.NoError(t, err, tt.formula) {
+			continue
+		}
+		assert.Equal(t, tt.refs, f.refs, tt.formula)
+		assert.Equal(t, tt.want, f.evaluate(prices), tt.formula)
+	}
+
+	for _, invalid := range []string{"", "1 + 2", "price(1_0xa) +", "price(1_0xa", "(price(1_0xa)", "price(0xa)", "price(1_0xa) price(1_0xb)", "abs(price(1_0xa))", "1..2 * price(1_0xa)"} {
+		_, err := parseFormula(invalid)
+		var formulaErr *FormulaError
+		assert.True(t, errors.As(err, &formulaErr), invalid)
+	}
+}
+
+func TestValidateFormula(t *testing.T) {
+	coins := stubCoinRepo{}
+	withFormula := func(id, formula string) schema.Coins {
+		return schema.Coins{ID: id, ChainID: "1", Address: id[2:], Formula: &formula}
+	}
+	coins.UpsertCoins([]schema.Coins{
+		withFormula("1_0xb", "price(1_0xc) * 2"),
+		withFormula("1_0xc", "price(1_0xd) + price(1_0xe)"),
+		withFormula("1_0xd", "price(1_0xa)"),
+		{ID: "1_0xe", ChainID: "1", Address: "0xe"},
+	})
+
+	assert.NoError(t, ValidateFormula(schema.Coins{ID: "1_0xa"}, coins.GetCoinsByID))
+	assert.NoError(t, ValidateFormula(withFormula("1_0xa", "price(1_0xe)"), coins.GetCoinsByID))
+	assert.NoError(t, ValidateFormula(withFormula("1_0xf", "price(1_0xb) + price(1_0xc)"), coins.GetCoinsByID))
+
+	err := ValidateFormula(withFormula("1_0xa", "price(1_0xa) * 2"), coins.GetCoinsByID)
+	assert.EqualError(t, err, "invalid formula: circular reference 1_0xa -> 1_0xa")
+	err = ValidateFormula(withFormula("1_0xa", "price(1_0xe) + price(1_0xb)"), coins.GetCoinsByID)
+	assert.EqualError(t, err, "invalid formula: circular reference 1_0xa -> 1_0xb -> 1_0xc -> 1_0xd -> 1_0xa")
+}
+
+func ptr(s string) *string {
+	return &s
+}
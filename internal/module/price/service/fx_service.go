@@ -0,0 +1,350 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// CurrencyUSD 数据源和存储使用的默认计价货币
+const CurrencyUSD = "usd"
+
+// 默认向数据源请求原生报价的计价货币
+var defaultNativeCurrencies = []string{"eur", "cny", "btc", "eth"}
+
+var currencyPattern = regexp.MustCompile(`^[a-z]{3,5}$`)
+
+// ErrUnsupportedCurrency 计价货币格式不正确或没有汇率
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// nativeCurrencySources 会缓存原生非 USD 报价的数据源
+var nativeCurrencySources = map[string]bool{
+	SourceCoinGecko: true,
+}
+
+// FxService 汇率服务，将 USD 价格转换为其他计价货币
+type FxService interface {
+	// NormalizeCurrency 校验并返回小写的计价货币，空值表示 USD
+	NormalizeCurrency(currency string) (string, error)
+	// Rate 返回 1 USD 可兑换的 currency 数量，unixTimeStamp 为 0 时返回当前汇率
+	Rate(currency string, unixTimeStamp int64) (float64, error)
+	// ConvertPrice 按汇率转换单个价格，unixTimeStamp 为 0 时按当前汇率转换
+	ConvertPrice(currency string, price *string, unixTimeStamp int64) (*string, error)
+	// ConvertResults 转换批量结果，来源支持原生报价且未超出锚定范围时优先使用原生报价，unixTimeStamps 为空时按当前汇率转换，
+	// 没有汇率的结果价格为空并返回 error
+	ConvertResults(currency string, results []PriceResult, unixTimeStamps []int64) []PriceResult
+}
+
+type fxService struct {
+	fxRateRepo     repository.FxRateRepository
+	coinRepository repository.CoinRepository
+	redisClient    *shared.RedisClient
+	logger         zerolog.Logger
+	apiKey         string
+}
+
+func NewFxService(cfg *koanf.Koanf, fxRateRepo repository.FxRateRepository, coinRepository repository.CoinRepository, redisClient *shared.RedisClient, logger zerolog.Logger) FxService {
+	return &fxService{
+		fxRateRepo:     fxRateRepo,
+		coinRepository: coinRepository,
+		redisClient:    redisClient,
+		logger:         logger,
+		apiKey:         cfg.String("apiKey.coingecko"),
+	}
+}
+
+// nativeCurrencies 读取需要向数据源请求原生报价的计价货币
+func nativeCurrencies(cfg *koanf.Koanf) []string {
+	currencies := configStrings(cfg, "currency.native")
+	if len(currencies) == 0 && !cfg.Exists("currency.native") {
+		return defaultNativeCurrencies
+	}
+	for i, currency := range currencies {
+		currencies[i] = strings.ToLower(currency)
+	}
+	return currencies
+}
+
+func (s *fxService) NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	if currency == "" {
+		return CurrencyUSD, nil
+	}
+	if !currencyPattern.MatchString(currency) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	return currency, nil
+}
+
+func (s *fxService) Rate(currency string, unixTimeStamp int64) (float64, error) {
+	if currency == CurrencyUSD {
+		return 1, nil
+	}
+	today := time.Now().Format("02-01-2006")
+	dayDate := today
+	if unixTimeStamp > 0 {
+		dayDate = time.Unix(unixTimeStamp, 0).Format("02-01-2006")
+	}
+
+	var rateStr string
+	var err error
+	if dayDate == today {
+		rateStr, err = s.redisClient.GetFxRateCache(currency, "")
+		if err != nil || rateStr == "" {
+			rateStr, err = s.fetchCurrentRates(currency)
+		}
+	} else {
+		rateStr, err = s.redisClient.GetFxRateCache(currency, dayDate)
+		if err != nil || rateStr == "" {
+			rateStr, err = s.fxRateRepo.GetRate(currency, dayDate)
+			if err == nil && rateStr == "" {
+				rateStr, err = s.fetchHistoricalRates(currency, dayDate, unixTimeStamp)
+			}
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	return rate, nil
+}
+
+// fetchCurrentRates 从 CoinGecko exchange_rates 获取所有计价货币的当前汇率，返回 currency 的汇率，
+// 没有 currency 的汇率时同样缓存 0，避免未知的计价货币每次请求都查询 CoinGecko
+func (s *fxService) fetchCurrentRates(currency string) (string, error) {
+	url := "https://pro-api.coingecko.com/api/v3/exchange_rates"
+	body, statusCode, err := shared.DoRequest(http.DefaultClient, url, s.headers(), 0)
+	if err != nil {
+		if statusCode != http.StatusTooManyRequests {
+			shared.HandleErrorWithThrottling(s.redisClient, s.logger, "FxService-fetchCurrentRates", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+		}
+		return "", err
+	}
+
+	var result struct {
+		Rates map[string]struct {
+			Value float64 `json:"value"`
+		} `json:"rates"`
+	}
+	if err := shared.ParseJSONResponse(body, &result); err != nil {
+		return "", err
+	}
+	// exchange_rates 以 BTC 为基准，换算为以 USD 为基准
+	values := make(map[string]float64, len(result.Rates))
+	for code, rate := range result.Rates {
+		values[code] = rate.Value
+	}
+	rates := usdRates(values)
+	now := time.Now()
+	toSave := make([]schema.FxRate, 0, len(rates))
+	for code, rate := range rates {
+		s.redisClient.SetFxRateCache(code, "", rate)
+		toSave = append(toSave, schema.FxRate{
+			Currency: code,
+			Rate:     rate,
+			Date:     now.Unix(),
+			DayDate:  now.Format("02-01-2006"),
+			Source:   SourceCoinGecko,
+		})
+	}
+	go s.fxRateRepo.SaveRates(toSave)
+	if _, ok := rates[currency]; !ok && len(rates) > 0 {
+		s.redisClient.SetFxRateCache(currency, "", "0")
+	}
+	return rates[currency], nil
+}
+
+// fetchHistoricalRates 通过 CoinGecko 比特币的历史多币种报价换算指定日期的汇率，返回 currency 的汇率，
+// 当天没有 currency 的报价时缓存 0，避免每次请求都查询 CoinGecko
+func (s *fxService) fetchHistoricalRates(currency, dayDate string, unixTimeStamp int64) (string, error) {
+	url := fmt.Sprintf("https://pro-api.coingecko.com/api/v3/coins/bitcoin/history?date=%s&localization=false", dayDate)
+	body, statusCode, err := shared.DoRequest(http.DefaultClient, url, s.headers(), 0)
+	if err != nil {
+		if statusCode != http.StatusTooManyRequests {
+			shared.HandleErrorWithThrottling(s.redisClient, s.logger, "FxService-fetchHistoricalRates", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+		}
+		return "", err
+	}
+
+	var result struct {
+		MarketData struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	if err := shared.ParseJSONResponse(body, &result); err != nil {
+		return "", err
+	}
+	// 比特币的多币种报价同样以 BTC 为基准，并补充 BTC 自身
+	values := result.MarketData.CurrentPrice
+	if len(values) > 0 {
+		values["btc"] = 1
+	}
+	rates := usdRates(values)
+	toSave := make([]schema.FxRate, 0, len(rates))
+	for code, rate := range rates {
+		s.redisClient.SetFxRateCache(code, dayDate, rate)
+		toSave = append(toSave, schema.FxRate{
+			Currency: code,
+			Rate:     rate,
+			Date:     unixTimeStamp,
+			DayDate:  dayDate,
+			Source:   SourceCoinGecko,
+		})
+	}
+	go s.fxRateRepo.SaveRates(toSave)
+	if _, ok := rates[currency]; !ok && len(rates) > 0 {
+		s.redisClient.SetFxRateCache(currency, dayDate, "0")
+	}
+	return rates[currency], nil
+}
+
+func (s *fxService) headers() map[string]string {
+	return map[string]string{
+		"accept":           "application/json",
+		"x-cg-pro-api-key": s.apiKey,
+	}
+}
+
+// usdRates 将同一基准下的报价换算为 1 USD 可兑换的数量
+func usdRates(values map[string]float64) map[string]string {
+	rates := make(map[string]string)
+	usd := values[CurrencyUSD]
+	if usd <= 0 {
+		return rates
+	}
+	for code, value := range values {
+		if value > 0 {
+			rates[strings.ToLower(code)] = strconv.FormatFloat(value/usd, 'f', -1, 64)
+		}
+	}
+	return rates
+}
+
+func (s *fxService) ConvertPrice(currency string, price *string, unixTimeStamp int64) (*string, error) {
+	if currency == CurrencyUSD || price == nil || *price == "" {
+		return price, nil
+	}
+	rate, err := s.Rate(currency, unixTimeStamp)
+	if err != nil {
+		return nil, err
+	}
+	return convertPrice(*price, rate), nil
+}
+
+func (s *fxService) ConvertResults(currency string, results []PriceResult, unixTimeStamps []int64) []PriceResult {
+	if currency == CurrencyUSD {
+		return results
+	}
+	aliases := s.nativeAliases(results)
+	// 同一天的汇率只查询一次
+	rates := make(map[string]float64)
+	rateErrors := make(map[string]error)
+	for i := range results {
+		results[i].Currency = currency
+		if results[i].Price == nil || *results[i].Price == "" {
+			continue
+		}
+		var unixTimeStamp int64
+		if i < len(unixTimeStamps) {
+			unixTimeStamp = unixTimeStamps[i]
+		}
+		// 超出锚定范围的结果按截断或标记后的 USD 价格转换，原生报价未经过锚定检查
+		if !results[i].OffPeg && results[i].Source != nil && nativeCurrencySources[*results[i].Source] {
+			coinID := shared.CoinID(results[i].ChainID, results[i].Address)
+			if alias, ok := aliases[coinID]; ok {
+				coinID = alias
+			}
+			if native := s.nativePrice(currency, coinID, unixTimeStamp); native != nil {
+				results[i].Price = native
+				continue
+			}
+		}
+		dayDate := ""
+		if unixTimeStamp > 0 {
+			dayDate = time.Unix(unixTimeStamp, 0).Format("02-01-2006")
+		}
+		rate, ok := rates[dayDate]
+		if !ok && rateErrors[dayDate] == nil {
+			var err error
+			if rate, err = s.Rate(currency, unixTimeStamp); err != nil {
+				s.logger.Err(err).Msgf("获取 %s 汇率失败 %s", currency, dayDate)
+				rateErrors[dayDate] = err
+			} else {
+				rates[dayDate] = rate
+			}
+		}
+		if err := rateErrors[dayDate]; err != nil {
+			results[i].Price = nil
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Price = convertPrice(*results[i].Price, rate)
+		if results[i].ObservedPrice != nil {
+			results[i].ObservedPrice = convertPrice(*results[i].ObservedPrice, rate)
+		}
+	}
+	return results
+}
+
+// nativeAliases 返回原生报价来源的结果中通过 return_coins_id 关联到其他代币的币种，数据源按关联代币缓存原生报价
+func (s *fxService) nativeAliases(results []PriceResult) map[string]string {
+	var coinIDs []string
+	for _, result := range results {
+		if result.Price != nil && result.Source != nil && nativeCurrencySources[*result.Source] {
+			coinIDs = append(coinIDs, shared.CoinID(result.ChainID, result.Address))
+		}
+	}
+	aliases := make(map[string]string)
+	if len(coinIDs) == 0 {
+		return aliases
+	}
+	coins, err := s.coinRepository.GetCoinsByID(coinIDs)
+	if err != nil {
+		s.logger.Err(err).Msg("查询原生报价的关联代币失败")
+		return aliases
+	}
+	for _, coin := range coins {
+		if coin.ChainID == "" || coin.Address == "" {
+			continue
+		}
+		if returnCoinId := coin.ChainID + "_" + coin.Address; returnCoinId != coin.ID {
+			aliases[coin.ID] = returnCoinId
+		}
+	}
+	return aliases
+}
+
+// nativePrice 返回数据源缓存的原生报价
+func (s *fxService) nativePrice(currency, coinID string, unixTimeStamp int64) *string {
+	dayDate := ""
+	if unixTimeStamp > 0 && time.Unix(unixTimeStamp, 0).Format("02-01-2006") != time.Now().Format("02-01-2006") {
+		dayDate = time.Unix(unixTimeStamp, 0).Format("02-01-2006")
+	}
+	price, err := s.redisClient.GetCurrencyPriceCache(currency, coinID, dayDate)
+	if err != nil || price == "" {
+		return nil
+	}
+	return &price
+}
+
+func convertPrice(price string, rate float64) *string {
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return nil
+	}
+	converted := strconv.FormatFloat(value*rate, 'f', -1, 64)
+	return &converted
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubFxRateRepo 按 货币_日期 返回已保存的汇率，没有记录的日期返回 err
+type stubFxRateRepo struct {
+	rates map[string]string
+	err   error
+	calls int
+}
+
+func (r *stubFxRateRepo) SaveRates(rates []schema.FxRate) error { return nil }
+func (r *stubFxRateRepo) GetRate(currency string, dayDate string) (string, error) {
+	r.calls++
+	if rate, ok := r.rates[currency+"_"+dayDate]; ok {
+		return rate, nil
+	}
+	return "", r.err
+}
+
+func TestUsdRates(t *testing.T) {
+	// 以 BTC 为基准：1 BTC = 60000 USD = 54000 EUR
+	rates := usdRates(map[string]float64{"btc": 1, "usd": 60000, "eur": 54000, "bad": 0})
+	assert.Equal(t, "1", rates["usd"])
+	assert.Equal(t, "0.9", rates["eur"])
+	assert.Equal(t, "0.000016666666666666667", rates["btc"])
+	assert.NotContains(t, rates, "bad")
+
+	assert.Empty(t, usdRates(map[string]float64{"eur": 1}))
+}
+
+func TestFxService_NormalizeCurrency(t *testing.T) {
+	s := &fxService{}
+	for input, expected := range map[string]string{"": CurrencyUSD, "EUR": "eur", " cny ": "cny", "usdt": "usdt"} {
+		currency, err := s.NormalizeCurrency(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, currency)
+	}
+	for _, input := range []string{"e", "eu-r", "toolongcurrency"} {
+		_, err := s.NormalizeCurrency(input)
+		assert.Error(t, err)
+	}
+}
+
+func TestFxService_ConvertUSD(t *testing.T) {
+	s := &fxService{}
+	price := "1.5"
+	converted, err := s.ConvertPrice(CurrencyUSD, &price, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &price, converted)
+
+	results := s.ConvertResults(CurrencyUSD, []PriceResult{{Price: &price}}, nil)
+	assert.Equal(t, "1.5", *results[0].Price)
+	assert.Empty(t, results[0].Currency)
+}
+
+func TestNativeCurrencies(t *testing.T) {
+	assert.Equal(t, defaultNativeCurrencies, nativeCurrencies(koanf.New(".")))
+
+	cfg := koanf.New(".")
+	cfg.Set("currency.native", "EUR, jpy")
+	assert.Equal(t, []string{"eur", "jpy"}, nativeCurrencies(cfg))
+
+	cfg = koanf.New(".")
+	cfg.Set("currency.native", "")
+	assert.Empty(t, nativeCurrencies(cfg))
+}
+
+func TestConvertPriceRate(t *testing.T) {
+	assert.Equal(t, "0.9", *convertPrice("1", 0.9))
+	assert.Nil(t, convertPrice("abc", 0.9))
+}
+
+func TestFxService_ConvertResults(t *testing.T) {
+	redisClient, _ := newStubRedisClient()
+	repo := &stubFxRateRepo{err: errors.New("db unavailable")}
+	s := &fxService{
+		fxRateRepo: repo,
+		coinRepository: stubCoinRepo{
+			"1_0xalias": {ID: "1_0xalias", ChainID: "1", Address: "0xreal"},
+		},
+		redisClient: redisClient,
+		logger:      zerolog.Nop(),
+	}
+	cached, missing := int64(1700000000), int64(1690000000)
+	redisClient.SetFxRateCache("eur", "", "0.9")
+	redisClient.SetFxRateCache("eur", time.Unix(cached, 0).Format("02-01-2006"), "0.8")
+	redisClient.SetCurrencyPriceCache("eur", "1_0xreal", "", "7")
+
+	price := func(value string) *string { return &value }
+	source := SourceCoinGecko
+	results := s.ConvertResults("eur", []PriceResult{
+		{ChainID: "1", Address: "0xa", Price: price("10")},
+		{ChainID: "1", Address: "0xalias", Price: price("10"), PriceProvenance: PriceProvenance{Source: &source}},
+	}, nil)
+	assert.Equal(t, "9", *results[0].Price)
+	assert.Equal(t, "eur", results[0].Currency)
+	// 关联代币使用数据源按关联代币缓存的原生报价
+	assert.Equal(t, "7", *results[1].Price)
+
+	// 超出锚定范围的结果不使用原生报价，截断后的价格及截断前的报价都按汇率转换
+	redisClient.SetCurrencyPriceCache("eur", "1_0xpeg", "", "0.5")
+	results = s.ConvertResults("eur", []PriceResult{
+		{ChainID: "1", Address: "0xpeg", Price: price("2"), OffPeg: true, ObservedPrice: price("0.5"), PriceProvenance: PriceProvenance{Source: &source}},
+	}, nil)
+	assert.Equal(t, "1.8", *results[0].Price)
+	assert.Equal(t, "0.45", *results[0].ObservedPrice)
+
+	// 已缓存的历史汇率不查询数据库，没有汇率的结果单独返回错误，不影响其他结果
+	results = s.ConvertResults("eur", []PriceResult{
+		{ChainID: "1", Address: "0xa", Price: price("10")},
+		{ChainID: "1", Address: "0xb", Price: price("10")},
+		{ChainID: "1", Address: "0xc", Price: price("20")},
+	}, []int64{cached, missing, missing})
+	assert.Equal(t, "8", *results[0].Price)
+	assert.Empty(t, results[0].Error)
+	for _, result := range results[1:] {
+		assert.Nil(t, result.Price)
+		assert.Equal(t, "db unavailable", result.Error)
+	}
+	assert.Equal(t, 1, repo.calls)
+
+	// 缓存为 0 的计价货币直接返回不支持，不再查询 CoinGecko
+	redisClient.SetFxRateCache("zzz", "", "0")
+	_, err := s.Rate("zzz", 0)
+	assert.EqualError(t, err, "unsupported currency: zzz")
+}
@@ -22,6 +22,10 @@ type GeckoTerminalService interface {
 	GetHistoricalPrice(chainId, address string, unixTimeStamp int64) (*string, error)
 	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
 	GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error)
+	GetBatchIntradayPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error)
+	GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error)
+	GetCandles(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error)
+	GetTokenInfo(chainId, address string) (*schema.Coins, error)
 }
 
 type geckoTerminalService struct {
@@ -30,6 +34,7 @@ type geckoTerminalService struct {
 	logger                  zerolog.Logger
 	coinRepository          repository.CoinRepository
 	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	coinCandleRepo          repository.CoinCandleRepository
 	totalReserveThreshold   float64
 	priceUsdThreshold       float64
 	apiKey                  string
@@ -95,7 +100,7 @@ var redisPrefix = map[string]string{
 	"limit":           "geckoterminal:limit:",
 }
 
-func NewGeckoTerminalService(cfg *koanf.Koanf, redisClient *shared.RedisClient, logger zerolog.Logger, coinRepository repository.CoinRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository) GeckoTerminalService {
+func NewGeckoTerminalService(cfg *koanf.Koanf, redisClient *shared.RedisClient, logger zerolog.Logger, coinRepository repository.CoinRepository, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, coinCandleRepo repository.CoinCandleRepository) GeckoTerminalService {
 	totalReserveThreshold := cfg.Float64("token.totalReserveThreshold")
 	if totalReserveThreshold == 0 {
 		totalReserveThreshold = 1000 // 默认值
@@ -111,6 +116,7 @@ func NewGeckoTerminalService(cfg *koanf.Koanf, redisClient *shared.RedisClient,
 		logger:                  logger,
 		coinRepository:          coinRepository,
 		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		coinCandleRepo:          coinCandleRepo,
 		totalReserveThreshold:   totalReserveThreshold,
 		priceUsdThreshold:       priceUsdThreshold,
 		apiKey:                  cfg.String("apiKey.geckoterminal"),
@@ -122,9 +128,15 @@ func getTokenInfo(network, address string) string {
 }
 
 func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache bool) (*string, error) {
+	price, _, err := s.currentPrice(chainId, address, isCache)
+	return price, err
+}
+
+// currentPrice 返回代币当前价格及 token 接口中的市场数据，命中缓存时没有市场数据
+func (s *geckoTerminalService) currentPrice(chainId, address string, isCache bool) (*string, *MarketData, error) {
 	network, err := chainIdToNetwork(chainId)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	tokenInfo := getTokenInfo(network, address)
@@ -133,7 +145,7 @@ func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache
 	historicalPrices, err := s.redisClient.GetCurrentPricesCache([]string{coinID})
 	if err == nil {
 		if price, exists := historicalPrices[coinID]; exists && isCache {
-			return &price, nil
+			return &price, nil, nil
 		}
 	}
 
@@ -144,7 +156,7 @@ func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache
 	limitKey := redisPrefix["limit"] + network
 	limit, err := s.redisClient.Client.Get(context.Background(), limitKey).Int()
 	if err == nil && limit > 30 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	s.redisClient.Client.Incr(context.Background(), limitKey)
@@ -157,19 +169,19 @@ func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache
 
 	body, statusCode, err := shared.DoRequest(http.DefaultClient, url, headers, 15) // 指定 15 秒超时
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if statusCode != http.StatusOK && statusCode != http.StatusNotFound {
 		if statusCode != http.StatusTooManyRequests {
 			shared.HandleErrorWithThrottling(s.redisClient, s.logger, "GeckoTerminalService-GetCurrentPrice", fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
 		}
-		return nil, fmt.Errorf("failed to get prices, status code: %d, response: %s", statusCode, string(body))
+		return nil, nil, fmt.Errorf("failed to get prices, status code: %d, response: %s", statusCode, string(body))
 	}
 
 	var result map[string]interface{}
 	if err := shared.ParseJSONResponse(body, &result); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if data, ok := result["data"].(map[string]interface{}); ok {
@@ -181,7 +193,7 @@ func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache
 					if err == nil && totalReserve < s.totalReserveThreshold {
 						price, err := strconv.ParseFloat(priceUsd, 64)
 						if err == nil && price > s.priceUsdThreshold {
-							return nil, nil
+							return nil, nil, nil
 						}
 					}
 				}
@@ -197,7 +209,7 @@ func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache
 				// 检查 coins 表中是否存在该 coin
 				existingCoin, err := s.coinRepository.GetCoinsByOneID(coinID)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				if existingCoin == nil || existingCoin.ID == "" {
 					// 插入新 coin 记录
@@ -214,39 +226,49 @@ func (s *geckoTerminalService) GetCurrentPrice(chainId, address string, isCache
 					}
 					err = s.coinRepository.UpsertCoins([]schema.Coins{newCoin})
 					if err != nil {
-						return nil, err
+						return nil, nil, err
 					}
 				}
 				s.coinHistoricalPriceRepo.SaveHistoricalPrices([]schema.CoinHistoricalPrice{priceToSave})
-				return &priceUsd, nil
+				var volume24h *string
+				if volumes, ok := attributes["volume_usd"].(map[string]interface{}); ok {
+					volume24h = marketValue(volumes["h24"])
+				}
+				marketData := newMarketData(marketValue(attributes["market_cap_usd"]), marketValue(attributes["fdv_usd"]), volume24h, marketValue(attributes["total_reserve_in_usd"]))
+				return &priceUsd, marketData, nil
 			}
 		}
 	}
-	return nil, nil
+	return nil, nil, nil
 }
 
 func (s *geckoTerminalService) GetHistoricalPrice(chainId, address string, unixTimeStamp int64) (*string, error) {
+	return s.historicalPrice(chainId, address, unixTimeStamp, shared.GranularityDay)
+}
+
+// historicalPrice 按粒度查询历史价格，当前时间段使用当前价格，其他时间段使用池子的 OHLCV 收盘价
+func (s *geckoTerminalService) historicalPrice(chainId, address string, unixTimeStamp int64, granularity string) (*string, error) {
 	network, err := chainIdToNetwork(chainId)
 	if err != nil {
 		return nil, err
 	}
 
-	coinId := chainId + "_" + strings.ToLower(address)
+	coinId := shared.CoinID(chainId, address)
 
 	tokenInfo := getTokenInfo(network, address)
 	splitTokenInfo := strings.Split(tokenInfo, ":")
 	network = splitTokenInfo[0]
 	address = splitTokenInfo[1]
 
-	date := time.Unix(unixTimeStamp, 0).Format("02-01-2006")
+	date := shared.BucketDate(granularity, unixTimeStamp)
 	// 检查是否存在历史记录
-	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPrices([]string{coinId}, []int64{unixTimeStamp})
+	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPricesByGranularity([]string{coinId}, []int64{unixTimeStamp}, granularity)
 	if err == nil {
 		if price, exists := historicalPrices[coinId+"_"+date]; exists {
 			return &price, nil
 		}
 	}
-	if date == time.Now().Format("02-01-2006") {
+	if shared.IsCurrentBucket(date) {
 		price, err := s.GetCurrentPrice(chainId, address, true)
 		if err != nil && price != nil && *price != "" {
 			s.redisClient.SetHistoricalPriceCache(coinId, date, *price)
@@ -260,7 +282,7 @@ func (s *geckoTerminalService) GetHistoricalPrice(chainId, address string, unixT
 	if err == nil {
 		var tokenResult map[string]interface{}
 		if err := json.Unmarshal([]byte(cachedTokenInfo), &tokenResult); err == nil {
-			if price, err := s.processTokenData(tokenResult, coinId, date, network, address, chainId); err == nil && price != nil {
+			if price, err := s.processTokenData(tokenResult, coinId, date, network, address, chainId, granularity, unixTimeStamp); err == nil && price != nil {
 				return price, nil
 			}
 		}
@@ -292,10 +314,10 @@ func (s *geckoTerminalService) GetHistoricalPrice(chainId, address string, unixT
 	tokenInfoBytes, _ := json.Marshal(result)
 	s.redisClient.Client.Set(context.Background(), tokenCacheKey, tokenInfoBytes, 24*time.Hour)
 
-	return s.processTokenData(result, coinId, date, network, address, chainId)
+	return s.processTokenData(result, coinId, date, network, address, chainId, granularity, unixTimeStamp)
 }
 
-func (s *geckoTerminalService) processTokenData(tokenData map[string]interface{}, coinId, date, network, address string, chainId string) (*string, error) {
+func (s *geckoTerminalService) processTokenData(tokenData map[string]interface{}, coinId, date, network, address string, chainId string, granularity string, unixTimeStamp int64) (*string, error) {
 	if data, ok := tokenData["data"].(map[string]interface{}); ok {
 		if attributes, ok := data["attributes"].(map[string]interface{}); ok {
 			if priceUsd, ok := attributes["price_usd"].(string); ok {
@@ -338,43 +360,11 @@ func (s *geckoTerminalService) processTokenData(tokenData map[string]interface{}
 					poolID := poolData[0].(map[string]interface{})["id"].(string)
 					poolAddress := extractPoolAddress(poolID)
 
-					// 检查Redis缓存中是否存在池子信息
-					poolCacheKey := fmt.Sprintf("%spoolInfo:%s", redisPrefix["tokenPools"], poolAddress)
-					cachedPoolInfo, err := s.redisClient.Client.Get(context.Background(), poolCacheKey).Result()
-					if err == nil {
-						var poolResult map[string]interface{}
-						if err := json.Unmarshal([]byte(cachedPoolInfo), &poolResult); err == nil {
-							return s.processPoolData(poolResult, coinId, date, network, address, poolAddress)
-						}
-					}
-
-					poolUrl := fmt.Sprintf("%snetworks/%s/pools/%s?partner_api_key=%s", baseURL, network, poolAddress, s.apiKey)
-					headers := map[string]string{
-						"accept": "application/json",
-					}
-
-					poolBody, statusCode, err := shared.DoRequest(http.DefaultClient, poolUrl, headers, 15) // 使用15秒超时
+					poolResult, err := s.poolInfo(network, poolAddress, "GeckoTerminalService-GetHistoricalPrice-Pool")
 					if err != nil {
 						return nil, err
 					}
-
-					if statusCode != http.StatusOK && statusCode != http.StatusNotFound {
-						if statusCode != http.StatusTooManyRequests {
-							shared.HandleErrorWithThrottling(s.redisClient, s.logger, "GeckoTerminalService-GetHistoricalPrice-Pool", fmt.Sprintf("url: %s, status code: %d, response: %s", poolUrl, statusCode, string(poolBody)))
-						}
-						return nil, fmt.Errorf("failed to get pool info, status code: %d, response: %s", statusCode, string(poolBody))
-					}
-
-					var poolResult map[string]interface{}
-					if err := shared.ParseJSONResponse(poolBody, &poolResult); err != nil {
-						return nil, err
-					}
-
-					// 缓存池子信息
-					poolInfoBytes, _ := json.Marshal(poolResult)
-					s.redisClient.Client.Set(context.Background(), poolCacheKey, poolInfoBytes, 24*time.Hour)
-
-					return s.processPoolData(poolResult, coinId, date, network, address, poolAddress)
+					return s.processPoolData(poolResult, coinId, date, network, address, poolAddress, granularity, unixTimeStamp)
 				}
 			}
 		}
@@ -382,32 +372,203 @@ func (s *geckoTerminalService) processTokenData(tokenData map[string]interface{}
 	return nil, nil
 }
 
-func (s *geckoTerminalService) processPoolData(poolData map[string]interface{}, coinId, date, network, address, poolAddress string) (*string, error) {
-	if data, ok := poolData["data"].(map[string]interface{}); ok {
-		baseTokenId := data["relationships"].(map[string]interface{})["base_token"].(map[string]interface{})["data"].(map[string]interface{})["id"].(string)
-		baseTokenAddress := extractTokenAddress(baseTokenId)
+// cachedResponse 读取 Redis 中缓存的接口响应，没有缓存时请求接口并缓存 24 小时，404 的响应同样缓存
+func (s *geckoTerminalService) cachedResponse(cacheKey, url, errorKey string) (map[string]interface{}, error) {
+	if cached, err := s.redisClient.Client.Get(context.Background(), cacheKey).Result(); err == nil {
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(cached), &result); err == nil {
+			return result, nil
+		}
+	}
+
+	headers := map[string]string{
+		"accept": "application/json",
+	}
+	body, statusCode, err := shared.DoRequest(http.DefaultClient, url, headers, 15) // 使用15秒超时
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK && statusCode != http.StatusNotFound {
+		if statusCode != http.StatusTooManyRequests {
+			shared.HandleErrorWithThrottling(s.redisClient, s.logger, errorKey, fmt.Sprintf("url: %s, status code: %d, response: %s", url, statusCode, string(body)))
+		}
+		return nil, fmt.Errorf("failed to get %s, status code: %d, response: %s", url, statusCode, string(body))
+	}
+
+	var result map[string]interface{}
+	if err := shared.ParseJSONResponse(body, &result); err != nil {
+		return nil, err
+	}
+	resultBytes, _ := json.Marshal(result)
+	s.redisClient.Client.Set(context.Background(), cacheKey, resultBytes, 24*time.Hour)
+	return result, nil
+}
+
+// GetTokenInfo 从 token 接口读取代币的 symbol、name、decimals 及总供应量，与历史价格共用 token 接口的缓存
+func (s *geckoTerminalService) GetTokenInfo(chainId, address string) (*schema.Coins, error) {
+	network, err := chainIdToNetwork(chainId)
+	if err != nil {
+		return nil, err
+	}
+	tokenCacheKey := fmt.Sprintf("%stokenInfo:%s", redisPrefix["token"], getTokenInfo(network, address))
+	tokenUrl := fmt.Sprintf("%snetworks/%s/tokens/%s?partner_api_key=%s", baseURL, network, address, s.apiKey)
+	tokenData, err := s.cachedResponse(tokenCacheKey, tokenUrl, "GeckoTerminalService-GetTokenInfo")
+	if err != nil {
+		return nil, err
+	}
+	coin := tokenInfoFromResponse(chainId, address, tokenData)
+	if coin != nil {
+		coin.GeckoterminalNetwork = &network
+	}
+	return coin, nil
+}
+
+// tokenInfoFromResponse 解析 GeckoTerminal 及 CoinGecko on-chain token 接口返回的代币信息，没有数据时返回 nil
+func tokenInfoFromResponse(chainId, address string, response map[string]interface{}) *schema.Coins {
+	data, _ := response["data"].(map[string]interface{})
+	attributes, ok := data["attributes"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return &schema.Coins{
+		ID:          chainId + "_" + address,
+		ChainID:     chainId,
+		Address:     address,
+		Symbol:      shared.GetStringPtr(attributes["symbol"]),
+		Name:        shared.GetStringPtr(attributes["name"]),
+		Decimals:    shared.GetIntPtr(attributes["decimals"]),
+		TotalSupply: shared.GetStringPtr(attributes["total_supply"]),
+	}
+}
+
+// poolInfo 返回池子信息
+func (s *geckoTerminalService) poolInfo(network, poolAddress, errorKey string) (map[string]interface{}, error) {
+	poolCacheKey := fmt.Sprintf("%spoolInfo:%s", redisPrefix["tokenPools"], poolAddress)
+	poolUrl := fmt.Sprintf("%snetworks/%s/pools/%s?partner_api_key=%s", baseURL, network, poolAddress, s.apiKey)
+	return s.cachedResponse(poolCacheKey, poolUrl, errorKey)
+}
+
+// topPoolAddress 返回代币信息中流动性最大的池子地址
+func topPoolAddress(tokenData map[string]interface{}) string {
+	data, _ := tokenData["data"].(map[string]interface{})
+	relationships, _ := data["relationships"].(map[string]interface{})
+	topPools, _ := relationships["top_pools"].(map[string]interface{})
+	pools, _ := topPools["data"].([]interface{})
+	if len(pools) == 0 {
+		return ""
+	}
+	pool, _ := pools[0].(map[string]interface{})
+	poolID, _ := pool["id"].(string)
+	return extractPoolAddress(poolID)
+}
+
+// poolTokenSide 返回代币在池子中是 base 还是 quote
+func poolTokenSide(poolData map[string]interface{}, address string) string {
+	data, _ := poolData["data"].(map[string]interface{})
+	relationships, _ := data["relationships"].(map[string]interface{})
+	baseToken, _ := relationships["base_token"].(map[string]interface{})
+	baseTokenData, _ := baseToken["data"].(map[string]interface{})
+	baseTokenId, _ := baseTokenData["id"].(string)
+	if address != extractTokenAddress(baseTokenId) {
+		return "quote"
+	}
+	return "base"
+}
+
+// rangeOhlcvs 获取代币最大池子在 from 与 to 之间的 OHLCV，没有池子时返回空
+func (s *geckoTerminalService) rangeOhlcvs(chainId, address string, from, to int64, granularity, errorKey string) ([][]interface{}, error) {
+	network, err := chainIdToNetwork(chainId)
+	if err != nil {
+		return nil, err
+	}
+	tokenInfo := getTokenInfo(network, address)
+	splitTokenInfo := strings.Split(tokenInfo, ":")
+	network = splitTokenInfo[0]
+	address = splitTokenInfo[1]
+
+	tokenCacheKey := fmt.Sprintf("%stokenInfo:%s", redisPrefix["token"], tokenInfo)
+	tokenUrl := fmt.Sprintf("%snetworks/%s/tokens/%s?partner_api_key=%s", baseURL, network, address, s.apiKey)
+	tokenData, err := s.cachedResponse(tokenCacheKey, tokenUrl, errorKey)
+	if err != nil {
+		return nil, err
+	}
+	poolAddress := topPoolAddress(tokenData)
+	if poolAddress == "" {
+		return nil, nil
+	}
+	poolData, err := s.poolInfo(network, poolAddress, errorKey+"-Pool")
+	if err != nil {
+		return nil, err
+	}
+
+	token := poolTokenSide(poolData, address)
+	return pagedOhlcvs(from, to, func(before int64) ([][]interface{}, error) {
+		return s.getOhlcvs(network, poolAddress, token, granularity, before)
+	})
+}
 
-		token := "base"
-		if address != baseTokenAddress {
-			token = "quote"
+// GetPriceRange 通过代币最大池子的 OHLCV 接口一次获取区间内的收盘价
+func (s *geckoTerminalService) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	ohlcvs, err := s.rangeOhlcvs(chainId, address, from, to, granularity, "GeckoTerminalService-GetPriceRange")
+	if err != nil {
+		return nil, err
+	}
+	coinId := shared.CoinID(chainId, address)
+	s.saveCandles(candlesFromOhlcvs(coinId, SourceGeckoTerminal, granularity, ohlcvs))
+	points := make([]rangePoint, 0, len(ohlcvs))
+	for _, item := range ohlcvs {
+		if len(item) < 5 {
+			continue
 		}
+		timestamp, _ := item[0].(float64)
+		closePrice, _ := item[4].(float64)
+		points = append(points, rangePoint{timestamp: int64(timestamp), price: closePrice})
+	}
+	prices := closesByBucket(coinId, SourceGeckoTerminal, granularity, points, from, to)
+	if err := s.coinHistoricalPriceRepo.SaveHistoricalPrices(prices); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save historical prices")
+	}
+	return prices, nil
+}
+
+// GetCandles 通过代币最大池子的 OHLCV 接口获取 from 与 to 之间的 K 线并保存
+func (s *geckoTerminalService) GetCandles(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error) {
+	ohlcvs, err := s.rangeOhlcvs(chainId, address, from, to, timeframe, "GeckoTerminalService-GetCandles")
+	if err != nil {
+		return nil, err
+	}
+	candles := candlesFromOhlcvs(shared.CoinID(chainId, address), SourceGeckoTerminal, timeframe, ohlcvs)
+	s.saveCandles(candles)
+	return candles, nil
+}
 
-		ohlcvs, err := s.getOhlcvs(network, poolAddress, token)
+// saveCandles 保存下载的 K 线，失败只记录日志
+func (s *geckoTerminalService) saveCandles(candles []schema.CoinCandle) {
+	if err := s.coinCandleRepo.SaveCandles(candles); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save candles")
+	}
+}
+
+func (s *geckoTerminalService) processPoolData(poolData map[string]interface{}, coinId, date, network, address, poolAddress string, granularity string, unixTimeStamp int64) (*string, error) {
+	if _, ok := poolData["data"].(map[string]interface{}); ok {
+		ohlcvs, err := s.getOhlcvs(network, poolAddress, poolTokenSide(poolData, address), granularity, ohlcvBefore(granularity, unixTimeStamp))
 		if err != nil || len(ohlcvs) == 0 {
 			return nil, err
 		}
+		s.saveCandles(candlesFromOhlcvs(coinId, SourceGeckoTerminal, granularity, ohlcvs))
 
 		var prices []schema.CoinHistoricalPrice
 		priceMap := make(map[string]string)
 		for _, item := range ohlcvs {
-			itemDate := time.Unix(int64(item[0].(float64)), 0).Format("02-01-2006")
+			itemDate := shared.BucketDate(granularity, int64(item[0].(float64)))
 			priceStr := strconv.FormatFloat(item[4].(float64), 'f', -1, 64)
 			prices = append(prices, schema.CoinHistoricalPrice{
-				CoinID:  coinId,
-				Date:    int64(item[0].(float64)),
-				DayDate: itemDate,
-				Price:   priceStr,
-				Source:  "geckoterminal",
+				CoinID:      coinId,
+				Date:        int64(item[0].(float64)),
+				DayDate:     itemDate,
+				Granularity: granularity,
+				Price:       priceStr,
+				Source:      "geckoterminal",
 			})
 			priceMap[coinId+"_"+itemDate] = priceStr
 		}
@@ -435,8 +596,41 @@ func extractTokenAddress(tokenID string) string {
 	return parts[len(parts)-1]
 }
 
-func (s *geckoTerminalService) getOhlcvs(network, poolAddress, token string) ([][]interface{}, error) {
-	url := fmt.Sprintf("%snetworks/%s/pools/%s/ohlcv/day?limit=1000&token=%s&partner_api_key=%s", baseURL, network, poolAddress, token, s.apiKey)
+// ohlcvTimeframe 返回粒度对应的 OHLCV 接口 timeframe 及 aggregate 参数
+func ohlcvTimeframe(granularity string) (string, int) {
+	switch granularity {
+	case shared.GranularityHour:
+		return "hour", 1
+	case shared.GranularityFiveMinute:
+		return "minute", 5
+	}
+	return "day", 1
+}
+
+// ohlcvQuery 返回 OHLCV 接口的查询参数，一次最多返回 ohlcvLimit 根 K 线，before 大于 0 时只返回该时间之前的 K 线
+func ohlcvQuery(granularity, token string, before int64) string {
+	timeframe, aggregate := ohlcvTimeframe(granularity)
+	query := fmt.Sprintf("%s?aggregate=%d&limit=%d&token=%s", timeframe, aggregate, ohlcvLimit, token)
+	if before > 0 {
+		query += fmt.Sprintf("&before_timestamp=%d", before)
+	}
+	return query
+}
+
+// ohlcvBefore 小时及 5 分钟粒度以请求的时间点为中心取 K 线，避免请求较早时间时取不到，按天时取最新的 K 线
+func ohlcvBefore(granularity string, unixTimeStamp int64) int64 {
+	if !shared.IsIntraday(granularity) {
+		return 0
+	}
+	before := unixTimeStamp + int64(shared.GranularityDuration(granularity).Seconds())*500
+	if now := time.Now().Unix(); before > now {
+		before = now
+	}
+	return before
+}
+
+func (s *geckoTerminalService) getOhlcvs(network, poolAddress, token, granularity string, before int64) ([][]interface{}, error) {
+	url := fmt.Sprintf("%snetworks/%s/pools/%s/ohlcv/%s&partner_api_key=%s", baseURL, network, poolAddress, ohlcvQuery(granularity, token, before), s.apiKey)
 	headers := map[string]string{
 		"accept": "application/json",
 	}
@@ -484,11 +678,33 @@ func (s *geckoTerminalService) GetBatchCurrentPrices(addresses []string, chainId
 	errCh := make(chan error, len(addresses))
 	var wg sync.WaitGroup
 
+	// 先批量读取缓存，区分缓存命中和实时请求的结果
+	var cachedPrices map[string]string
+	if isCache {
+		coinIDs := make([]string, len(addresses))
+		for i := range addresses {
+			coinIDs[i] = chainIds[i] + "_" + addresses[i]
+		}
+		cachedPrices, _ = s.redisClient.GetCurrentPricesCache(coinIDs)
+	}
+
 	for i := range chainIds {
+		if cachedPrice, exists := cachedPrices[chainIds[i]+"_"+addresses[i]]; exists {
+			results[i] = PriceResult{
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           &cachedPrice,
+				Symbol:          GetOrNil(symbols, i),
+				Network:         GetOrNil(networks, i),
+				TimeStamp:       strconv.FormatInt(time.Now().Unix(), 10),
+				PriceProvenance: cachedProvenance(-1),
+			}
+			continue
+		}
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			price, err := s.GetCurrentPrice(chainIds[i], addresses[i], isCache)
+			price, marketData, err := s.currentPrice(chainIds[i], addresses[i], false)
 			requestStatus := "200"
 			if err != nil {
 				if strings.Contains(err.Error(), "429") {
@@ -496,13 +712,15 @@ func (s *geckoTerminalService) GetBatchCurrentPrices(addresses []string, chainId
 				}
 			}
 			priceResult := PriceResult{
-				ChainID:       chainIds[i],
-				Address:       addresses[i],
-				Price:         price,
-				Symbol:        GetOrNil(symbols, i),
-				Network:       GetOrNil(networks, i),
-				TimeStamp:     strconv.FormatInt(time.Now().Unix(), 10),
-				RequestStatus: &requestStatus,
+				ChainID:         chainIds[i],
+				Address:         addresses[i],
+				Price:           price,
+				Symbol:          GetOrNil(symbols, i),
+				Network:         GetOrNil(networks, i),
+				TimeStamp:       strconv.FormatInt(time.Now().Unix(), 10),
+				RequestStatus:   &requestStatus,
+				PriceProvenance: upstreamProvenance(0),
+				MarketData:      marketData,
 			}
 			results[i] = priceResult
 		}(i)
@@ -515,6 +733,15 @@ func (s *geckoTerminalService) GetBatchCurrentPrices(addresses []string, chainId
 }
 
 func (s *geckoTerminalService) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return s.batchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps, shared.GranularityDay)
+}
+
+// GetBatchIntradayPrices 批量查询小时或 5 分钟粒度的历史价格
+func (s *geckoTerminalService) GetBatchIntradayPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
+	return s.batchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps, granularity)
+}
+
+func (s *geckoTerminalService) batchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
 	if len(chainIds) != len(addresses) || len(addresses) != len(unixTimeStamps) {
 		return nil, fmt.Errorf("chainIds, addresses and unixTimeStamps must have the same length")
 	}
@@ -531,7 +758,7 @@ func (s *geckoTerminalService) GetBatchHistoricalPrices(addresses []string, chai
 		dates[i] = unixTimeStamps[i]
 	}
 
-	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPrices(coinIds, dates)
+	historicalPrices, err := s.coinHistoricalPriceRepo.GetHistoricalPricesByGranularity(coinIds, dates, granularity)
 	if err != nil {
 		return nil, fmt.Errorf("批量查询历史价格失败: %v", err)
 	}
@@ -541,20 +768,21 @@ func (s *geckoTerminalService) GetBatchHistoricalPrices(addresses []string, chai
 		go func(i int) {
 			defer wg.Done()
 			coinId := chainIds[i] + "_" + addresses[i]
-			date := time.Unix(unixTimeStamps[i], 0).Format("02-01-2006")
+			date := shared.BucketDate(granularity, unixTimeStamps[i])
 			historicalPrice, exists := historicalPrices[coinId+"_"+date]
 			if exists {
 				priceResult := PriceResult{
-					ChainID:   chainIds[i],
-					Address:   addresses[i],
-					Price:     &historicalPrice,
-					Symbol:    GetOrNil(symbols, i),
-					Network:   GetOrNil(networks, i),
-					TimeStamp: strconv.FormatInt(unixTimeStamps[i], 10),
+					ChainID:         chainIds[i],
+					Address:         addresses[i],
+					Price:           &historicalPrice,
+					Symbol:          GetOrNil(symbols, i),
+					Network:         GetOrNil(networks, i),
+					TimeStamp:       strconv.FormatInt(unixTimeStamps[i], 10),
+					PriceProvenance: cachedProvenance(-1),
 				}
 				results[i] = priceResult
 			} else {
-				price, err := s.GetHistoricalPrice(chainIds[i], addresses[i], unixTimeStamps[i])
+				price, err := s.historicalPrice(chainIds[i], addresses[i], unixTimeStamps[i], granularity)
 				if err != nil {
 					errCh <- err
 					priceResult := PriceResult{
@@ -587,3 +815,41 @@ func (s *geckoTerminalService) GetBatchHistoricalPrices(addresses []string, chai
 
 	return results, nil
 }
+
+// geckoTerminalProvider 将 GeckoTerminalService 适配为 PriceProvider
+type geckoTerminalProvider struct {
+	service GeckoTerminalService
+}
+
+func NewGeckoTerminalProvider(service GeckoTerminalService) PriceProvider {
+	return &geckoTerminalProvider{service: service}
+}
+
+func (p *geckoTerminalProvider) Name() string             { return SourceGeckoTerminal }
+func (p *geckoTerminalProvider) SupportsCurrent() bool    { return true }
+func (p *geckoTerminalProvider) SupportsHistorical() bool { return true }
+func (p *geckoTerminalProvider) ListedCoinsOnly() bool    { return false }
+
+func (p *geckoTerminalProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	return p.service.GetBatchCurrentPrices(addresses, chainIds, symbols, networks, isCache)
+}
+
+func (p *geckoTerminalProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.service.GetBatchHistoricalPrices(addresses, chainIds, symbols, networks, unixTimeStamps)
+}
+
+func (p *geckoTerminalProvider) GetBatchIntradayPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
+	return p.service.GetBatchIntradayPrices(addresses, chainIds, symbols, networks, unixTimeStamps, granularity)
+}
+
+func (p *geckoTerminalProvider) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	return p.service.GetPriceRange(chainId, address, from, to, granularity)
+}
+
+func (p *geckoTerminalProvider) GetCandles(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error) {
+	return p.service.GetCandles(chainId, address, from, to, timeframe)
+}
+
+func (p *geckoTerminalProvider) GetTokenInfo(chainId, address string) (*schema.Coins, error) {
+	return p.service.GetTokenInfo(chainId, address)
+}
@@ -18,7 +18,8 @@ func setupGeckoTerminalService() service.GeckoTerminalService {
 	redis := shared.SetupRealRedis()
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
-	return service.NewGeckoTerminalService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
+	return service.NewGeckoTerminalService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo)
 }
 
 func TestGetCurrentPrice_Valid(t *testing.T) {
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRedis 在内存中执行测试用到的 Redis 命令，不建立连接，不处理过期
+type stubRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	hashes map[string]map[string]string
+	ttls   map[string]time.Duration
+}
+
+// newStubRedisClient 返回使用内存 stubRedis 的 RedisClient
+func newStubRedisClient() (*shared.RedisClient, *stubRedis) {
+	stub := &stubRedis{values: make(map[string]string), hashes: make(map[string]map[string]string), ttls: make(map[string]time.Duration)}
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	client.AddHook(stub)
+	return &shared.RedisClient{Client: client}, stub
+}
+
+func (r *stubRedis) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (r *stubRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		r.process(cmd)
+		return cmd.Err()
+	}
+}
+
+func (r *stubRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			r.process(cmd)
+		}
+		for _, cmd := range cmds {
+			if cmd.Err() != nil {
+				return cmd.Err()
+			}
+		}
+		return nil
+	}
+}
+
+func (r *stubRedis) get(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.values[key]
+	return value, ok
+}
+
+func (r *stubRedis) process(cmd redis.Cmder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	args := make([]string, len(cmd.Args()))
+	for i, arg := range cmd.Args() {
+		if data, ok := arg.([]byte); ok {
+			args[i] = string(data)
+		} else {
+			args[i] = fmt.Sprint(arg)
+		}
+	}
+	switch strings.ToLower(cmd.Name()) {
+	case "get":
+		value, ok := r.values[args[1]]
+		if !ok {
+			cmd.SetErr(redis.Nil)
+		}
+		cmd.(*redis.StringCmd).SetVal(value)
+	case "mget":
+		values := make([]interface{}, len(args)-1)
+		for i, key := range args[1:] {
+			if value, ok := r.values[key]; ok {
+				values[i] = value
+			}
+		}
+		cmd.(*redis.SliceCmd).SetVal(values)
+	case "set":
+		_, exists := r.values[args[1]]
+		for i := 3; i < len(args); i++ {
+			switch strings.ToLower(args[i]) {
+			case "nx":
+				if exists {
+					cmd.SetErr(redis.Nil)
+					return
+				}
+			case "ex":
+				seconds, _ := strconv.Atoi(args[i+1])
+				r.ttls[args[1]] = time.Duration(seconds) * time.Second
+			case "px":
+				ms, _ := strconv.Atoi(args[i+1])
+				r.ttls[args[1]] = time.Duration(ms) * time.Millisecond
+			}
+		}
+		r.values[args[1]] = args[2]
+		if c, ok := cmd.(*redis.StatusCmd); ok {
+			c.SetVal("OK")
+		} else if c, ok := cmd.(*redis.BoolCmd); ok {
+			c.SetVal(true)
+		}
+	case "del":
+		var deleted int64
+		for _, key := range args[1:] {
+			if _, ok := r.values[key]; ok {
+				deleted++
+			}
+			if _, ok := r.hashes[key]; ok {
+				deleted++
+			}
+			delete(r.values, key)
+			delete(r.hashes, key)
+			delete(r.ttls, key)
+		}
+		cmd.(*redis.IntCmd).SetVal(deleted)
+	case "exists":
+		var count int64
+		for _, key := range args[1:] {
+			if _, ok := r.values[key]; ok {
+				count++
+			} else if _, ok := r.hashes[key]; ok {
+				count++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(count)
+	case "incr":
+		value, _ := strconv.ParseInt(r.values[args[1]], 10, 64)
+		value++
+		r.values[args[1]] = strconv.FormatInt(value, 10)
+		cmd.(*redis.IntCmd).SetVal(value)
+	case "expire":
+		seconds, _ := strconv.Atoi(args[2])
+		r.ttls[args[1]] = time.Duration(seconds) * time.Second
+		cmd.(*redis.BoolCmd).SetVal(true)
+	case "ttl":
+		ttl, ok := r.ttls[args[1]]
+		if !ok {
+			ttl = -2 * time.Second
+			if _, exists := r.values[args[1]]; exists {
+				ttl = -time.Second
+			}
+		}
+		cmd.(*redis.DurationCmd).SetVal(ttl)
+	case "hset":
+		if r.hashes[args[1]] == nil {
+			r.hashes[args[1]] = make(map[string]string)
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			r.hashes[args[1]][args[i]] = args[i+1]
+		}
+		cmd.(*redis.IntCmd).SetVal(int64((len(args) - 2) / 2))
+	case "hdel":
+		for _, field := range args[2:] {
+			delete(r.hashes[args[1]], field)
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(len(args) - 2))
+	case "hgetall":
+		values := make(map[string]string)
+		for field, value := range r.hashes[args[1]] {
+			values[field] = value
+		}
+		cmd.(*redis.MapStringStringCmd).SetVal(values)
+	case "multi", "exec", "watch", "unwatch":
+	default:
+		cmd.SetErr(fmt.Errorf("stubRedis: unsupported command %s", cmd.Name()))
+	}
+}
+
+// stubRejectedPriceRepo 记录被拒绝的报价
+type stubRejectedPriceRepo struct {
+	mu     sync.Mutex
+	prices []schema.RejectedPrice
+}
+
+func (r *stubRejectedPriceRepo) SaveRejectedPrice(price schema.RejectedPrice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prices = append(r.prices, price)
+	return nil
+}
+
+func (r *stubRejectedPriceRepo) GetRejectedPrices(coinID string, limit int) ([]schema.RejectedPrice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]schema.RejectedPrice(nil), r.prices...), nil
+}
+
+// stubSlackService 记录发送的告警
+type stubSlackService struct {
+	mu              sync.Mutex
+	logs            []string
+	divergences     []map[string]float64
+	divergenceCalls int
+	depegs          []map[string]float64
+}
+
+func (s *stubSlackService) SaveLog(ctx context.Context, source, chainID, address, dateDay string, timestamp int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, chainID+"_"+address)
+	return nil
+}
+
+func (s *stubSlackService) SaveDivergences(ctx context.Context, divergences []PriceDivergence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.divergenceCalls++
+	for _, divergence := range divergences {
+		s.divergences = append(s.divergences, divergence.Prices)
+	}
+	return nil
+}
+
+func (s *stubSlackService) SaveDepeg(ctx context.Context, chainID, address string, target float64, prices map[string]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.depegs = append(s.depegs, prices)
+	return nil
+}
+
+// newTestConfig 返回按 values 加载的配置
+func newTestConfig(t *testing.T, values map[string]interface{}) *koanf.Koanf {
+	cfg := koanf.New(".")
+	assert.NoError(t, cfg.Load(confmap.Provider(values, "."), nil))
+	return cfg
+}
+
+// newTestBatchPriceService 返回按 providers 顺序查询当前价格的 priceService
+func newTestBatchPriceService(cfg *koanf.Koanf, redisClient *shared.RedisClient, guard PriceGuardService, slack SlackNotificationService, providers ...PriceProvider) *priceService {
+	var order []string
+	for _, provider := range providers {
+		order = append(order, provider.Name())
+	}
+	return &priceService{
+		providers:          NewPriceProviderRegistry(providers),
+		guard:              guard,
+		pegs:               NewPegService(cfg, slack, redisClient, zerolog.Nop()),
+		coinRepository:     stubCoinRepo{},
+		historicalRepo:     &stubHistoricalPriceRepo{},
+		throttler:          shared.NewCoinsThrottler(redisClient, zerolog.Nop(), stubCoinRepo{}),
+		slack:              slack,
+		redisClient:        redisClient,
+		logger:             zerolog.Nop(),
+		currentSourceOrder: newSourceOrder(koanf.New("."), "sourceOrder.current", order),
+		consensus:          newConsensusConfig(cfg),
+	}
+}
+
+// stubCoinRepo 内存中的 coins 表
+type stubCoinRepo map[string]schema.Coins
+
+func (r stubCoinRepo) UpsertCoins(coins []schema.Coins) error {
+	for _, coin := range coins {
+		r[coin.ID] = coin
+	}
+	return nil
+}
+func (r stubCoinRepo) GetCoinsByID(ids []string) ([]schema.Coins, error) {
+	var coins []schema.Coins
+	for _, id := range ids {
+		if coin, ok := r[id]; ok {
+			coins = append(coins, coin)
+		}
+	}
+	return coins, nil
+}
+func (r stubCoinRepo) GetCoinsByOneID(id string) (*schema.Coins, error) {
+	if coin, ok := r[id]; ok {
+		return &coin, nil
+	}
+	return nil, nil
+}
+func (r stubCoinRepo) DeleteCoinByID(id string) error          { delete(r, id); return nil }
+func (r stubCoinRepo) RefreshCoinListCache(ids []string) error { return nil }
+func (r stubCoinRepo) RefreshAllCoinsCache() error             { return nil }
+func (r stubCoinRepo) AddToQueue(coins []schema.Coins) error   { return r.UpsertCoins(coins) }
+func (r stubCoinRepo) ProcessQueue() error                     { return nil }
+func (r stubCoinRepo) CheckCoinExists(coinID string) (bool, error) {
+	_, ok := r[coinID]
+	return ok, nil
+}
+
+// stubHistoricalPriceRepo latest 中的价格同时作为任意日期的历史价格返回
+type stubHistoricalPriceRepo struct {
+	saved     []schema.CoinHistoricalPrice
+	snapshots []schema.CoinHistoricalPrice
+	latest    map[string]string
+}
+
+func (r *stubHistoricalPriceRepo) SaveHistoricalPrices(prices []schema.CoinHistoricalPrice) error {
+	r.saved = append(r.saved, prices...)
+	return nil
+}
+func (r *stubHistoricalPriceRepo) SaveIntradaySnapshots(prices []schema.CoinHistoricalPrice) error {
+	r.snapshots = append(r.snapshots, prices...)
+	return nil
+}
+func (r *stubHistoricalPriceRepo) GetHistoricalPrices(coinIDs []string, dates []int64) (map[string]string, error) {
+	return r.GetHistoricalPricesByGranularity(coinIDs, dates, shared.GranularityDay)
+}
+func (r *stubHistoricalPriceRepo) GetHistoricalPricesByGranularity(coinIDs []string, dates []int64, granularity string) (map[string]string, error) {
+	prices := make(map[string]string)
+	for i, coinID := range coinIDs {
+		if price, ok := r.latest[coinID]; ok {
+			prices[coinID+"_"+shared.BucketDate(granularity, dates[i])] = price
+		}
+	}
+	return prices, nil
+}
+func (r *stubHistoricalPriceRepo) GetLatestPrices(coinIDs []string) (map[string]string, error) {
+	prices := make(map[string]string)
+	for _, coinID := range coinIDs {
+		if price, ok := r.latest[coinID]; ok {
+			prices[coinID] = price
+		}
+	}
+	return prices, nil
+}
+func (r *stubHistoricalPriceRepo) GetPriceRange(coinID, granularity string, from, to int64) ([]schema.CoinHistoricalPrice, error) {
+	var prices []schema.CoinHistoricalPrice
+	for _, price := range r.saved {
+		if price.CoinID == coinID && price.Granularity == granularity && price.Date >= from && price.Date <= to {
+			prices = append(prices, price)
+		}
+	}
+	return prices, nil
+}
+func (r *stubHistoricalPriceRepo) DeleteIntradayPrices(granularity string, before int64) (int64, error) {
+	return 0, nil
+}
+func (r *stubHistoricalPriceRepo) ProcessQueue() error { return nil }
+
+// stubProvider 测试用的可配置数据源，默认支持当前及历史价格，所有请求计入 calls，err 不为空时请求失败。
+// prices 中当前价格的 key 为 coinID，历史价格的 key 为 粒度_coinID；requested 记录历史价格查询的粒度及时间戳，
+// from、to 为最近一次区间或 K 线请求的时间范围。可选接口由下方只嵌入 stubProvider 的类型提供
+type stubProvider struct {
+	name           string
+	listedOnly     bool
+	currentOnly    bool
+	historicalOnly bool
+	cached         bool
+	err            error
+	prices         map[string]string
+	points         []rangePoint
+	ohlcvs         [][]interface{}
+	infos          map[string]schema.Coins
+
+	calls     int
+	requested map[string][]int64
+	from, to  int64
+}
+
+func (p *stubProvider) Name() string             { return p.name }
+func (p *stubProvider) SupportsCurrent() bool    { return !p.historicalOnly }
+func (p *stubProvider) SupportsHistorical() bool { return !p.currentOnly }
+func (p *stubProvider) ListedCoinsOnly() bool    { return p.listedOnly }
+
+func (p *stubProvider) GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	var results []PriceResult
+	for i, address := range addresses {
+		price, ok := p.prices[chainIds[i]+"_"+address]
+		if !ok {
+			continue
+		}
+		provenance := upstreamProvenance(0)
+		if p.cached {
+			provenance = cachedProvenance(0)
+		}
+		results = append(results, PriceResult{ChainID: chainIds[i], Address: address, Price: &price, PriceProvenance: provenance})
+	}
+	return results, nil
+}
+
+func (p *stubProvider) GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	return p.historicalResults(shared.GranularityDay, addresses, chainIds, unixTimeStamps)
+}
+
+func (p *stubProvider) historicalResults(granularity string, addresses, chainIds []string, unixTimeStamps []int64) ([]PriceResult, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.requested == nil {
+		p.requested = make(map[string][]int64)
+	}
+	results := make([]PriceResult, 0, len(addresses))
+	for i, address := range addresses {
+		p.requested[granularity] = append(p.requested[granularity], unixTimeStamps[i])
+		result := PriceResult{ChainID: chainIds[i], Address: address, TimeStamp: strconv.FormatInt(unixTimeStamps[i], 10)}
+		if price, ok := p.prices[granularity+"_"+chainIds[i]+"_"+address]; ok {
+			result.Price = &price
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// stubIntradayProvider 支持小时及 5 分钟粒度的 stubProvider
+type stubIntradayProvider struct{ *stubProvider }
+
+func (p stubIntradayProvider) GetBatchIntradayPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error) {
+	return p.historicalResults(granularity, addresses, chainIds, unixTimeStamps)
+}
+
+// stubRangeProvider 将 points 按粒度归入时间段返回的 stubProvider
+type stubRangeProvider struct{ *stubProvider }
+
+func (p stubRangeProvider) GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error) {
+	p.calls++
+	p.from, p.to = from, to
+	if p.err != nil {
+		return nil, p.err
+	}
+	return closesByBucket(chainId+"_"+address, p.name, granularity, p.points, from, to), nil
+}
+
+// stubCandleProvider 将 ohlcvs 转为 K 线返回的 stubProvider
+type stubCandleProvider struct{ *stubProvider }
+
+func (p stubCandleProvider) GetCandles(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error) {
+	p.calls++
+	p.from, p.to = from, to
+	if p.err != nil {
+		return nil, p.err
+	}
+	return candlesFromOhlcvs(chainId+"_"+address, p.name, timeframe, p.ohlcvs), nil
+}
+
+// stubTokenInfoProvider 按 coinID 返回 infos 中代币信息的 stubProvider
+type stubTokenInfoProvider struct{ *stubProvider }
+
+func (p stubTokenInfoProvider) GetTokenInfo(chainId, address string) (*schema.Coins, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	if info, ok := p.infos[chainId+"_"+address]; ok {
+		return &info, nil
+	}
+	return nil, nil
+}
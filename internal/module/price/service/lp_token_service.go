@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/rs/zerolog"
+)
+
+// SourceLpToken 按底层代币价格估值得到的 LP 代币价格
+const SourceLpToken = "lpToken"
+
+const erc20TotalSupply = "0x18160ddd"
+
+// lpTokenAttributes coins.pool_attributes 中的 LP 代币配置，底层代币为 base_token_address 和 quote_token_address
+type lpTokenAttributes struct {
+	LpToken      bool   `json:"lpToken"`
+	Pool         string `json:"pool"`         // 持有储备的合约，默认为 LP 代币本身
+	BaseReserve  string `json:"baseReserve"`  // 与 coins.total_supply 一起配置时，当前价格直接使用配置的储备
+	QuoteReserve string `json:"quoteReserve"` // 代币单位
+}
+
+// LpTokenReserves LP 代币的底层代币、储备及总供应量，数量均为代币单位
+type LpTokenReserves struct {
+	Base         string
+	Quote        string
+	BaseReserve  float64
+	QuoteReserve float64
+	TotalSupply  float64
+}
+
+// LpTokenService 读取 LP 代币的储备和总供应量，由 PriceService 结合底层代币价格估值
+type LpTokenService interface {
+	IsLpToken(coin schema.Coins) bool
+	// Reserves 读取 unixTimeStamp 时的储备，unixTimeStamp 为 0 时读取最新数据
+	Reserves(coin schema.Coins, unixTimeStamp int64) (*LpTokenReserves, error)
+}
+
+type lpTokenService struct {
+	rpcClient *shared.RpcClient
+	logger    zerolog.Logger
+}
+
+func NewLpTokenService(rpcClient *shared.RpcClient, logger zerolog.Logger) LpTokenService {
+	return &lpTokenService{
+		rpcClient: rpcClient,
+		logger:    logger,
+	}
+}
+
+// lpTokenAttributesOf 解析币种的 LP 代币配置，没有配置 lpToken 或底层代币时返回 false
+func lpTokenAttributesOf(coin schema.Coins) (lpTokenAttributes, bool) {
+	if coin.PoolAttributes == nil || coin.BaseTokenAddress == nil || *coin.BaseTokenAddress == "" || coin.QuoteTokenAddress == nil || *coin.QuoteTokenAddress == "" {
+		return lpTokenAttributes{}, false
+	}
+	var attributes lpTokenAttributes
+	if err := json.Unmarshal([]byte(*coin.PoolAttributes), &attributes); err != nil || !attributes.LpToken {
+		return lpTokenAttributes{}, false
+	}
+	return attributes, true
+}
+
+func (s *lpTokenService) IsLpToken(coin schema.Coins) bool {
+	_, ok := lpTokenAttributesOf(coin)
+	return ok
+}
+
+func (s *lpTokenService) Reserves(coin schema.Coins, unixTimeStamp int64) (*LpTokenReserves, error) {
+	attributes, ok := lpTokenAttributesOf(coin)
+	if !ok {
+		return nil, fmt.Errorf("%s is not configured as an lp token", coin.ID)
+	}
+	reserves := &LpTokenReserves{
+		Base:  shared.NormalizeAddress(coin.ChainID, *coin.BaseTokenAddress),
+		Quote: shared.NormalizeAddress(coin.ChainID, *coin.QuoteTokenAddress),
+	}
+
+	// 历史价格总是读取链上数据，配置的储备只反映当前状态
+	if unixTimeStamp == 0 && attributes.BaseReserve != "" && attributes.QuoteReserve != "" && coin.TotalSupply != nil && *coin.TotalSupply != "" {
+		var err error
+		if reserves.BaseReserve, err = strconv.ParseFloat(attributes.BaseReserve, 64); err != nil {
+			return nil, err
+		}
+		if reserves.QuoteReserve, err = strconv.ParseFloat(attributes.QuoteReserve, 64); err != nil {
+			return nil, err
+		}
+		if reserves.TotalSupply, err = strconv.ParseFloat(*coin.TotalSupply, 64); err != nil {
+			return nil, err
+		}
+		return reserves, nil
+	}
+
+	if !s.rpcClient.HasChain(coin.ChainID) {
+		return nil, fmt.Errorf("no rpc endpoint configured for chain %s", coin.ChainID)
+	}
+	var blockNumber uint64
+	if unixTimeStamp > 0 {
+		var err error
+		if blockNumber, err = s.rpcClient.BlockNumberAt(coin.ChainID, unixTimeStamp); err != nil {
+			return nil, err
+		}
+	}
+	lpToken := strings.ToLower(coin.Address)
+	pool := lpToken
+	if attributes.Pool != "" {
+		pool = strings.ToLower(attributes.Pool)
+	}
+
+	var err error
+	if reserves.BaseReserve, err = s.amount(coin.ChainID, reserves.Base, erc20BalanceOf+shared.AbiEncodeAddress(pool), blockNumber); err != nil {
+		return nil, err
+	}
+	if reserves.QuoteReserve, err = s.amount(coin.ChainID, reserves.Quote, erc20BalanceOf+shared.AbiEncodeAddress(pool), blockNumber); err != nil {
+		return nil, err
+	}
+	if reserves.TotalSupply, err = s.amount(coin.ChainID, lpToken, erc20TotalSupply, blockNumber); err != nil {
+		return nil, err
+	}
+	return reserves, nil
+}
+
+// amount 调用 token 合约返回数量的方法，按 token 的精度转换为代币单位
+func (s *lpTokenService) amount(chainId, token, data string, blockNumber uint64) (float64, error) {
+	decimals, err := s.rpcClient.Decimals(chainId, token)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.rpcClient.EthCall(chainId, token, data, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	words, err := shared.AbiWords(result)
+	if err != nil || len(words) == 0 {
+		return 0, fmt.Errorf("invalid amount response from %s: %s", token, result)
+	}
+	value, _ := new(big.Float).Quo(new(big.Float).SetInt(words[0]), pow10(decimals)).Float64()
+	return value, nil
+}
+
+// lpTokenValue 按 (储备 × 底层代币价格) / 总供应量 计算 LP 代币价格，prices 以底层代币地址为键，缺少价格时返回 nil
+func lpTokenValue(reserves *LpTokenReserves, prices map[string]float64) *string {
+	basePrice, ok := prices[reserves.Base]
+	if !ok {
+		return nil
+	}
+	quotePrice, ok := prices[reserves.Quote]
+	if !ok || reserves.TotalSupply <= 0 {
+		return nil
+	}
+	value := (reserves.BaseReserve*basePrice + reserves.QuoteReserve*quotePrice) / reserves.TotalSupply
+	if value <= 0 {
+		return nil
+	}
+	price := strconv.FormatFloat(value, 'f', -1, 64)
+	return &price
+}
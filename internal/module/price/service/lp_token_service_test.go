@@ -0,0 +1,82 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLpTokenService_Reserves(t *testing.T) {
+	const (
+		usdc    = "0x00000000000000000000000000000000000000a0"
+		weth    = "0x00000000000000000000000000000000000000a1"
+		lpToken = "0x00000000000000000000000000000000000000c1"
+		vault   = "0x00000000000000000000000000000000000000c2"
+	)
+	e := func(n int64) *big.Int { return new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil) }
+	mul := func(a int64, b *big.Int) *big.Int { return new(big.Int).Mul(big.NewInt(a), b) }
+
+	server := newStubContractServer(map[string]string{
+		usdc + ":0x313ce567":    abiResult(big.NewInt(6)),
+		weth + ":0x313ce567":    abiResult(big.NewInt(18)),
+		lpToken + ":0x313ce567": abiResult(big.NewInt(18)),
+
+		weth + ":" + erc20BalanceOf + shared.AbiEncodeAddress(lpToken):         abiResult(mul(100, e(18))),
+		usdc + ":" + erc20BalanceOf + shared.AbiEncodeAddress(lpToken):         abiResult(mul(200000, e(6))),
+		lpToken + ":" + erc20TotalSupply:                                       abiResult(mul(50, e(18))),
+		weth + ":" + erc20BalanceOf + shared.AbiEncodeAddress(lpToken) + "@50": abiResult(mul(10, e(18))),
+		usdc + ":" + erc20BalanceOf + shared.AbiEncodeAddress(lpToken) + "@50": abiResult(mul(20000, e(6))),
+		lpToken + ":" + erc20TotalSupply + "@50":                               abiResult(mul(10, e(18))),
+
+		weth + ":" + erc20BalanceOf + shared.AbiEncodeAddress(vault): abiResult(mul(1, e(18))),
+		usdc + ":" + erc20BalanceOf + shared.AbiEncodeAddress(vault): abiResult(mul(2000, e(6))),
+	}, 100)
+	defer server.Close()
+
+	lpCoin := func(attributes string) schema.Coins {
+		base, quote := weth, usdc
+		return schema.Coins{ID: "1_" + lpToken, ChainID: "1", Address: lpToken, BaseTokenAddress: &base, QuoteTokenAddress: &quote, PoolAttributes: &attributes}
+	}
+	s := NewLpTokenService(newTestRpcClient(server.URL), zerolog.Nop())
+	assert.False(t, s.IsLpToken(lpCoin(`{"pool":"`+vault+`"}`)))
+	assert.True(t, s.IsLpToken(lpCoin(`{"lpToken":true}`)))
+
+	reserves, err := s.Reserves(lpCoin(`{"lpToken":true}`), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &LpTokenReserves{Base: weth, Quote: usdc, BaseReserve: 100, QuoteReserve: 200000, TotalSupply: 50}, reserves)
+
+	// 时间 505 对应区块 50
+	reserves, err = s.Reserves(lpCoin(`{"lpToken":true}`), 505)
+	assert.NoError(t, err)
+	assert.Equal(t, &LpTokenReserves{Base: weth, Quote: usdc, BaseReserve: 10, QuoteReserve: 20000, TotalSupply: 10}, reserves)
+
+	reserves, err = s.Reserves(lpCoin(`{"lpToken":true,"pool":"`+vault+`"}`), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, reserves.BaseReserve)
+	assert.Equal(t, 2000.0, reserves.QuoteReserve)
+
+	// 配置了储备和总供应量时，当前价格不读取链上数据
+	coin := lpCoin(`{"lpToken":true,"baseReserve":"3","quoteReserve":"6000"}`)
+	totalSupply := "4"
+	coin.TotalSupply = &totalSupply
+	reserves, err = s.Reserves(coin, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &LpTokenReserves{Base: weth, Quote: usdc, BaseReserve: 3, QuoteReserve: 6000, TotalSupply: 4}, reserves)
+	reserves, err = s.Reserves(coin, 505)
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, reserves.TotalSupply)
+}
+
+func TestLpTokenValue(t *testing.T) {
+	reserves := &LpTokenReserves{Base: "0xa1", Quote: "0xa0", BaseReserve: 100, QuoteReserve: 200000, TotalSupply: 50}
+	price := lpTokenValue(reserves, map[string]float64{"0xa1": 2000, "0xa0": 1})
+	if assert.NotNil(t, price) {
+		assert.Equal(t, "8000", *price)
+	}
+	assert.Nil(t, lpTokenValue(reserves, map[string]float64{"0xa1": 2000}))
+	assert.Nil(t, lpTokenValue(&LpTokenReserves{Base: "0xa1", Quote: "0xa0"}, map[string]float64{"0xa1": 2000, "0xa0": 1}))
+}
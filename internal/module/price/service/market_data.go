@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// 当天没有市场数据的代币，两次实时请求上游之间的最短间隔
+	marketDataRefreshInterval = 5 * time.Minute
+	// 同一代币同一天的市场数据两次写入数据库之间的最短间隔
+	marketDataSaveInterval = 5 * time.Minute
+)
+
+// MarketData 代币的市值、完全稀释估值、24 小时成交额及池子流动性，均以 USD 计价，上游没有返回的字段为 null
+type MarketData struct {
+	MarketCap             *string `json:"marketCap"`
+	FullyDilutedValuation *string `json:"fdv"`
+	Volume24h             *string `json:"volume24h"`
+	Liquidity             *string `json:"liquidity"`
+	UpdatedAt             int64   `json:"updatedAt,omitempty"` // 数据更新时间
+}
+
+func (m *MarketData) empty() bool {
+	return m == nil || (m.MarketCap == nil && m.FullyDilutedValuation == nil && m.Volume24h == nil && m.Liquidity == nil)
+}
+
+// newMarketData 字段都为空时返回 nil
+func newMarketData(marketCap, fdv, volume24h, liquidity *string) *MarketData {
+	data := &MarketData{MarketCap: marketCap, FullyDilutedValuation: fdv, Volume24h: volume24h, Liquidity: liquidity}
+	if data.empty() {
+		return nil
+	}
+	return data
+}
+
+// marketValue 将上游返回的数字或数字字符串转为字符串，无效或不大于 0 时返回 nil
+func marketValue(value interface{}) *string {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil
+		}
+		number = parsed
+	default:
+		return nil
+	}
+	if number <= 0 || math.IsInf(number, 0) || math.IsNaN(number) {
+		return nil
+	}
+	formatted := strconv.FormatFloat(number, 'f', -1, 64)
+	return &formatted
+}
+
+// fullyDilutedValuation 上游没有返回 FDV 时按价格与 coins 表中的总供应量计算，total_supply 为最小单位的数量
+func fullyDilutedValuation(price string, coin schema.Coins) *string {
+	if coin.TotalSupply == nil || coin.Decimals == nil {
+		return nil
+	}
+	supply, err := strconv.ParseFloat(strings.TrimSpace(*coin.TotalSupply), 64)
+	if err != nil {
+		return nil
+	}
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return nil
+	}
+	return marketValue(value * supply / math.Pow10(*coin.Decimals))
+}
+
+// marketDataRows 将结果中的市场数据转为按天保存的记录并补全 FDV，unixTimeStamps 为空时表示当前数据
+func marketDataRows(results []PriceResult, unixTimeStamps []int64, coinMap map[string]schema.Coins) []schema.CoinMarketData {
+	now := time.Now().Unix()
+	var rows []schema.CoinMarketData
+	seen := make(map[string]bool)
+	for i := range results {
+		result := &results[i]
+		if result.MarketData.empty() || result.Price == nil {
+			continue
+		}
+		coinID := shared.CoinID(result.ChainID, result.Address)
+		if result.MarketData.FullyDilutedValuation == nil {
+			result.MarketData.FullyDilutedValuation = fullyDilutedValuation(*result.Price, coinMap[coinID])
+		}
+		date := now
+		if unixTimeStamps != nil {
+			date = unixTimeStamps[i]
+		}
+		result.MarketData.UpdatedAt = date
+		dayDate := shared.BucketDate(shared.GranularityDay, date)
+		if seen[coinID+"_"+dayDate] {
+			continue
+		}
+		seen[coinID+"_"+dayDate] = true
+		row := schema.CoinMarketData{
+			CoinID:                coinID,
+			Date:                  date,
+			DayDate:               dayDate,
+			MarketCap:             result.MarketData.MarketCap,
+			FullyDilutedValuation: result.MarketData.FullyDilutedValuation,
+			Volume24h:             result.MarketData.Volume24h,
+			Liquidity:             result.MarketData.Liquidity,
+		}
+		if result.Source != nil {
+			row.Source = *result.Source
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// saveMarketData 异步保存数据源随价格返回的市场数据
+func (s *priceService) saveMarketData(results []PriceResult, unixTimeStamps []int64, coinMap map[string]schema.Coins) {
+	rows := marketDataRows(results, unixTimeStamps, coinMap)
+	if len(rows) == 0 {
+		return
+	}
+	go func() {
+		if rows := s.marketDataSaveAllowed(rows); len(rows) > 0 {
+			s.marketDataRepo.SaveMarketData(rows)
+		}
+	}()
+}
+
+// marketDataSaveAllowed 同一代币同一天的市场数据在 marketDataSaveInterval 内只写入一次，Redis 出错时全部写入
+func (s *priceService) marketDataSaveAllowed(rows []schema.CoinMarketData) []schema.CoinMarketData {
+	ctx := context.Background()
+	pipe := s.redisClient.Client.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(rows))
+	for i, row := range rows {
+		cmds[i] = pipe.SetNX(ctx, "price:marketData:save:"+row.CoinID+"_"+row.DayDate, 1, marketDataSaveInterval)
+	}
+	// 已存在的 key 返回 redis.Nil
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		s.logger.Err(err).Msg("saveMarketData 检查写入间隔失败")
+		return rows
+	}
+	var allowed []schema.CoinMarketData
+	for i, row := range rows {
+		if cmds[i].Val() {
+			allowed = append(allowed, row)
+		}
+	}
+	return allowed
+}
+
+func marketDataFromRow(row schema.CoinMarketData) *MarketData {
+	data := newMarketData(row.MarketCap, row.FullyDilutedValuation, row.Volume24h, row.Liquidity)
+	if data != nil {
+		data.UpdatedAt = row.Date
+	}
+	return data
+}
+
+// FillMarketData 为没有市场数据的结果补充已保存的市场数据，unixTimeStamps 为空时返回最新数据，
+// 其中当天还没有数据的代币不使用价格缓存重新请求一次数据源
+func (s *priceService) FillMarketData(ctx context.Context, results []PriceResult, unixTimeStamps []int64) {
+	byDay := make(map[string][]int)
+	for i, result := range results {
+		if result.Error != "" || !result.MarketData.empty() {
+			continue
+		}
+		dayDate := ""
+		if unixTimeStamps != nil {
+			dayDate = shared.BucketDate(shared.GranularityDay, unixTimeStamps[i])
+		}
+		byDay[dayDate] = append(byDay[dayDate], i)
+	}
+
+	for dayDate, indexes := range byDay {
+		coinIDs := make([]string, len(indexes))
+		for k, index := range indexes {
+			coinIDs[k] = shared.CoinID(results[index].ChainID, results[index].Address)
+		}
+		var stored map[string]schema.CoinMarketData
+		var err error
+		if dayDate == "" {
+			stored, err = s.marketDataRepo.GetLatestMarketData(coinIDs)
+		} else {
+			stored, err = s.marketDataRepo.GetMarketData(coinIDs, dayDate)
+		}
+		if err != nil {
+			s.logger.Err(err).Msg("FillMarketData 读取市场数据失败")
+			continue
+		}
+		today := shared.BucketDate(shared.GranularityDay, time.Now().Unix())
+		var stale []int
+		for k, index := range indexes {
+			row, ok := stored[coinIDs[k]]
+			if ok {
+				results[index].MarketData = marketDataFromRow(row)
+			}
+			if dayDate == "" && (!ok || row.DayDate != today) && s.marketDataRefreshAllowed(coinIDs[k]) {
+				stale = append(stale, index)
+			}
+		}
+		if len(stale) > 0 {
+			s.refreshMarketData(ctx, results, stale)
+		}
+	}
+}
+
+// marketDataRefreshAllowed 同一代币在 marketDataRefreshInterval 内只重新请求一次
+func (s *priceService) marketDataRefreshAllowed(coinID string) bool {
+	allowed, err := s.redisClient.Client.SetNX(context.Background(), "price:marketData:refresh:"+coinID, 1, marketDataRefreshInterval).Result()
+	return err == nil && allowed
+}
+
+// refreshMarketData 不使用缓存重新查询当前价格，数据源返回的市场数据随价格一起保存
+func (s *priceService) refreshMarketData(ctx context.Context, results []PriceResult, indexes []int) {
+	chainIds := make([]string, len(indexes))
+	addresses := make([]string, len(indexes))
+	for k, index := range indexes {
+		chainIds[k] = results[index].ChainID
+		addresses[k] = results[index].Address
+	}
+	refreshed, err := s.FetchAndProcessBatchPrices(ctx, chainIds, addresses, nil, nil, false, true)
+	if err != nil {
+		s.logger.Err(err).Msg("FillMarketData 重新获取市场数据失败")
+		return
+	}
+	for k, index := range indexes {
+		if k < len(refreshed) && !refreshed[k].MarketData.empty() {
+			results[index].MarketData = refreshed[k].MarketData
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubMarketDataRepo 按 coin_id 和 day_date 保存市场数据
+type stubMarketDataRepo map[string]schema.CoinMarketData
+
+func (r stubMarketDataRepo) SaveMarketData(data []schema.CoinMarketData) error {
+	for _, row := range data {
+		r[row.CoinID+"_"+row.DayDate] = row
+	}
+	return nil
+}
+
+func (r stubMarketDataRepo) GetMarketData(coinIDs []string, dayDate string) (map[string]schema.CoinMarketData, error) {
+	data := make(map[string]schema.CoinMarketData)
+	for _, coinID := range coinIDs {
+		if row, ok := r[coinID+"_"+dayDate]; ok {
+			data[coinID] = row
+		}
+	}
+	return data, nil
+}
+
+func (r stubMarketDataRepo) GetLatestMarketData(coinIDs []string) (map[string]schema.CoinMarketData, error) {
+	data := make(map[string]schema.CoinMarketData)
+	for _, coinID := range coinIDs {
+		for _, row := range r {
+			if latest, ok := data[coinID]; row.CoinID == coinID && (!ok || row.Date > latest.Date) {
+				data[coinID] = row
+			}
+		}
+	}
+	return data, nil
+}
+
+func TestPriceService_MarketData(t *testing.T) {
+	assert.Equal(t, "1500.5", *marketValue("1500.5"))
+	assert.Equal(t, "42", *marketValue(42.0))
+	assert.Nil(t, marketValue("0.0"))
+	assert.Nil(t, marketValue(nil))
+	assert.Nil(t, newMarketData(nil, nil, nil, nil))
+
+	// 上游没有返回 FDV 时按最小单位的总供应量计算，同一代币同一天只保存一条
+	supply, decimals := "2000000000000000000000.0", 18
+	coinMap := map[string]schema.Coins{"1_0xa": {ID: "1_0xa", TotalSupply: &supply, Decimals: &decimals}}
+	price, source := "1.5", SourceGeckoTerminal
+	liquidity := "800"
+	results := []PriceResult{
+		{ChainID: "1", Address: "0xA", Price: &price, MarketData: newMarketData(nil, nil, nil, &liquidity), PriceProvenance: PriceProvenance{Source: &source}},
+		{ChainID: "1", Address: "0xa", Price: &price, MarketData: newMarketData(nil, nil, nil, &liquidity)},
+		{ChainID: "1", Address: "0xb", Price: &price},
+	}
+	day := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local).Unix()
+	rows := marketDataRows(results, []int64{day, day, day}, coinMap)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "1_0xa", rows[0].CoinID)
+		assert.Equal(t, "02-01-2024", rows[0].DayDate)
+		assert.Equal(t, "3000", *rows[0].FullyDilutedValuation)
+		assert.Equal(t, "800", *rows[0].Liquidity)
+		assert.Nil(t, rows[0].MarketCap)
+		assert.Equal(t, SourceGeckoTerminal, rows[0].Source)
+	}
+	assert.Equal(t, "3000", *results[0].MarketData.FullyDilutedValuation)
+	assert.Equal(t, day, results[0].MarketData.UpdatedAt)
+
+	// 同一代币同一天的市场数据在写入间隔内只写入一次
+	stubClient, _ := newStubRedisClient()
+	throttled := &priceService{redisClient: stubClient, logger: zerolog.Nop()}
+	assert.Len(t, throttled.marketDataSaveAllowed(rows), 1)
+	assert.Empty(t, throttled.marketDataSaveAllowed(rows))
+
+	repo := stubMarketDataRepo{}
+	assert.NoError(t, repo.SaveMarketData(rows))
+	yesterday := time.Now().Add(-24 * time.Hour).Unix()
+	marketCap := "5000"
+	assert.NoError(t, repo.SaveMarketData([]schema.CoinMarketData{
+		{CoinID: "1_0xb", Date: yesterday, DayDate: shared.BucketDate(shared.GranularityDay, yesterday), MarketCap: &marketCap},
+	}))
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	s := &priceService{marketDataRepo: repo, redisClient: redisClient, logger: zerolog.Nop()}
+
+	// 历史数据读取当天的记录，没有记录的代币不返回
+	historical := []PriceResult{{ChainID: "1", Address: "0xa", Price: &price}, {ChainID: "1", Address: "0xb", Price: &price}}
+	s.FillMarketData(context.Background(), historical, []int64{day, day})
+	if assert.NotNil(t, historical[0].MarketData) {
+		assert.Equal(t, "3000", *historical[0].MarketData.FullyDilutedValuation)
+	}
+	assert.Nil(t, historical[1].MarketData)
+
+	// 当前数据返回最近一天的记录，不能重新请求数据源时仍返回已保存的数据
+	current := []PriceResult{{ChainID: "1", Address: "0xb", Price: &price}, {ChainID: "1", Address: "0xc", Error: "invalid address"}}
+	s.FillMarketData(context.Background(), current, nil)
+	if assert.NotNil(t, current[0].MarketData) {
+		assert.Equal(t, "5000", *current[0].MarketData.MarketCap)
+		assert.Equal(t, yesterday, current[0].MarketData.UpdatedAt)
+	}
+	assert.Nil(t, current[1].MarketData)
+}
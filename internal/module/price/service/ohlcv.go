@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+)
+
+const (
+	// 结束前或结束后 candleSettleDelay 内保存的 K 线可能不完整，保存后超过 candleRefreshInterval 重新向上游获取
+	candleRefreshInterval = 5 * time.Minute
+	candleSettleDelay     = 15 * time.Minute
+	// OHLCV 接口一次最多返回的 K 线数量
+	ohlcvLimit = 1000
+)
+
+// Candle 一根 OHLCV K 线，timestamp 为 K 线的开始时间
+type Candle struct {
+	TimeStamp int64  `json:"timestamp"`
+	Open      string `json:"open"`
+	High      string `json:"high"`
+	Low       string `json:"low"`
+	Close     string `json:"close"`
+	Volume    string `json:"volume"`
+	Source    string `json:"source,omitempty"`
+}
+
+// CandleSeries 代币在一段时间内的 K 线，中间没有成交的时间段以前一根 K 线的收盘价补齐，第一根之前及最后一根之后没有数据的时间段不返回
+type CandleSeries struct {
+	ChainID   string   `json:"chainId"`
+	Address   string   `json:"address"`
+	Timeframe string   `json:"timeframe"`
+	From      int64    `json:"from"`
+	To        int64    `json:"to"`
+	Candles   []Candle `json:"candles"`
+}
+
+// candlesFromOhlcvs 将 OHLCV 接口返回的 [timestamp, open, high, low, close, volume] 转为按时间排序的 K 线，
+// 开始时间与历史价格一致按 shared.BucketStart 对齐。只返回上游实际返回的 K 线，5 分钟 K 线不保存，返回空
+func candlesFromOhlcvs(coinID, source, timeframe string, ohlcvs [][]interface{}) []schema.CoinCandle {
+	if timeframe != shared.GranularityDay && timeframe != shared.GranularityHour {
+		return nil
+	}
+	byStart := make(map[int64]schema.CoinCandle, len(ohlcvs))
+	for _, item := range ohlcvs {
+		if len(item) < 5 {
+			continue
+		}
+		values := make([]float64, 6)
+		valid := true
+		for i := 0; i < len(item) && i < len(values); i++ {
+			value, ok := item[i].(float64)
+			if !ok {
+				valid = false
+				break
+			}
+			values[i] = value
+		}
+		if !valid || values[4] <= 0 {
+			continue
+		}
+		start := shared.BucketStart(timeframe, int64(values[0]))
+		byStart[start] = schema.CoinCandle{
+			CoinID:    coinID,
+			Timeframe: timeframe,
+			Timestamp: start,
+			Open:      strconv.FormatFloat(values[1], 'f', -1, 64),
+			High:      strconv.FormatFloat(values[2], 'f', -1, 64),
+			Low:       strconv.FormatFloat(values[3], 'f', -1, 64),
+			Close:     strconv.FormatFloat(values[4], 'f', -1, 64),
+			Volume:    strconv.FormatFloat(values[5], 'f', -1, 64),
+			Source:    source,
+		}
+	}
+	candles := make([]schema.CoinCandle, 0, len(byStart))
+	for _, candle := range byStart {
+		candles = append(candles, candle)
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Timestamp < candles[j].Timestamp })
+	return candles
+}
+
+// pagedOhlcvs 从 to 开始向前逐页获取 OHLCV，直到最早的 K 线不晚于 from，或上游返回不足一页、不再向前推进
+func pagedOhlcvs(from, to int64, fetch func(before int64) ([][]interface{}, error)) ([][]interface{}, error) {
+	before := to + 1
+	if now := time.Now().Unix(); before > now {
+		before = now
+	}
+	var ohlcvs [][]interface{}
+	for {
+		page, err := fetch(before)
+		if err != nil {
+			return nil, err
+		}
+		ohlcvs = append(ohlcvs, page...)
+		earliest := before
+		for _, item := range page {
+			if len(item) == 0 {
+				continue
+			}
+			if timestamp, ok := item[0].(float64); ok && int64(timestamp) < earliest {
+				earliest = int64(timestamp)
+			}
+		}
+		if len(page) < ohlcvLimit || earliest <= from || earliest >= before {
+			return ohlcvs, nil
+		}
+		before = earliest
+	}
+}
+
+// candleSettled 已保存的 K 线是否在结束 candleSettleDelay 之后保存，之前保存的 K 线可能缺少上游延迟到达的成交
+func candleSettled(row schema.CoinCandle, step int64) bool {
+	return row.UpdatedAt.Unix() >= row.Timestamp+step+int64(candleSettleDelay.Seconds())
+}
+
+// GetOhlcv 先读取已保存的 K 线，缺少的时间段按数据源顺序请求 OHLCV 接口补全，补全后不再请求后续数据源
+func (s *priceService) GetOhlcv(chainId, address string, from, to int64, timeframe string) (*CandleSeries, error) {
+	if timeframe == "" {
+		timeframe = shared.GranularityDay
+	}
+	now := time.Now()
+	if to <= 0 || to > now.Unix() {
+		to = now.Unix()
+	}
+	if from > to {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	step := int64(shared.GranularityDuration(timeframe).Seconds())
+	start, end := shared.BucketStart(timeframe, from), shared.BucketStart(timeframe, to)
+	count := int((end-start)/step + 1)
+	if count > maxRangePoints {
+		return nil, fmt.Errorf("range contains %d candles, at most %d are allowed", count, maxRangePoints)
+	}
+
+	address = shared.NormalizeAddress(chainId, address)
+	coin, err := s.coinRepository.GetCoinsByOneID(chainId + "_" + address)
+	if err != nil {
+		return nil, err
+	}
+	queryChainId, queryAddress := chainId, address
+	if coin != nil && coin.ChainID != "" && coin.Address != "" {
+		queryChainId, queryAddress = coin.ChainID, coin.Address
+	}
+
+	candles := make(map[int64]Candle, count)
+	// 已有的 K 线不被后续数据源覆盖
+	merge := func(rows []schema.CoinCandle) {
+		for _, row := range rows {
+			if _, exists := candles[row.Timestamp]; exists || row.Timestamp < start || row.Timestamp > end {
+				continue
+			}
+			candles[row.Timestamp] = Candle{TimeStamp: row.Timestamp, Open: row.Open, High: row.High, Low: row.Low, Close: row.Close, Volume: row.Volume, Source: row.Source}
+		}
+	}
+	stored, err := s.candleRepo.GetCandles(queryChainId+"_"+queryAddress, timeframe, start, end)
+	if err != nil {
+		s.logger.Err(err).Msgf("读取 K 线失败 %s_%s", queryChainId, queryAddress)
+	}
+	// 尚未结束及刚结束不久保存的 K 线过期后重新获取，上游请求失败时仍返回已保存的数据
+	var stale []schema.CoinCandle
+	for _, row := range stored {
+		if !candleSettled(row, step) && now.Sub(row.UpdatedAt) > candleRefreshInterval {
+			stale = append(stale, row)
+			continue
+		}
+		merge([]schema.CoinCandle{row})
+	}
+
+	// 上游不返回没有成交的时间段，已有的第一根和最后一根 K 线之间的时间段视为已获取，只请求之前或之后缺少的时间段，
+	// to 为最后一根缺少的 K 线的结束时间；请求失败或没有补全任何 K 线的数据源按币种和周期节流
+	missing := func() (int64, int64, bool) {
+		if len(candles) == 0 {
+			return start, end, true
+		}
+		first, last := end, start
+		for ts := range candles {
+			if ts < first {
+				first = ts
+			}
+			if ts > last {
+				last = ts
+			}
+		}
+		switch {
+		case first > start && last < end:
+			return start, end, true
+		case first > start:
+			return start, first - step, true
+		case last < end:
+			return last + step, end, true
+		}
+		return 0, 0, false
+	}
+	if coin == nil || !s.isDerived(*coin) {
+		for _, provider := range capableProviders[CandleProvider](s, queryChainId, coin) {
+			first, last, ok := missing()
+			if !ok {
+				break
+			}
+			throttleKey := fmt.Sprintf("%s_%s_ohlcv_%s_%s", queryChainId, queryAddress, timeframe, provider.Name())
+			if s.throttler.IsCoinsThrottled(throttleKey) {
+				continue
+			}
+			before := len(candles)
+			status := "200"
+			rows, err := provider.GetCandles(queryChainId, queryAddress, first, last+step-1, timeframe)
+			if err != nil {
+				if strings.Contains(err.Error(), "429") {
+					status = "429"
+				}
+				s.logger.Err(err).Msgf("GetOhlcv 获取%s K 线失败 %s_%s", provider.Name(), queryChainId, queryAddress)
+			}
+			merge(rows)
+			if len(candles) > before {
+				continue
+			}
+			if s.throttler.CoinsThrottle(throttleKey, status) {
+				s.slack.SaveLog(context.Background(), "priceService-GetOhlcv", queryChainId, queryAddress, time.Unix(first, 0).Format("2006-01-02"), now.Unix())
+			}
+		}
+	}
+	merge(stale)
+
+	// 没有成交的时间段只在返回结果中以前一根 K 线的收盘价补齐，不保存
+	series := &CandleSeries{ChainID: chainId, Address: address, Timeframe: timeframe, From: start, To: to, Candles: []Candle{}}
+	last := start - step
+	for ts := range candles {
+		if ts > last {
+			last = ts
+		}
+	}
+	var previous *Candle
+	for ts := start; ts <= last; ts += step {
+		if candle, ok := candles[ts]; ok {
+			series.Candles = append(series.Candles, candle)
+			previous = &candle
+			continue
+		}
+		if previous != nil {
+			series.Candles = append(series.Candles, Candle{TimeStamp: ts, Open: previous.Close, High: previous.Close, Low: previous.Close, Close: previous.Close, Volume: "0", Source: previous.Source})
+		}
+	}
+	return series, nil
+}
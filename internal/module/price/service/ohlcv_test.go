@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCandleRepo 按 coin_id、周期及开始时间保存 K 线
+type stubCandleRepo map[string]schema.CoinCandle
+
+func (r stubCandleRepo) SaveCandles(candles []schema.CoinCandle) error {
+	for _, candle := range candles {
+		r[fmt.Sprintf("%s_%s_%d", candle.CoinID, candle.Timeframe, candle.Timestamp)] = candle
+	}
+	return nil
+}
+
+func (r stubCandleRepo) GetCandles(coinID, timeframe string, from, to int64) ([]schema.CoinCandle, error) {
+	var candles []schema.CoinCandle
+	for _, candle := range r {
+		if candle.CoinID == coinID && candle.Timeframe == timeframe && candle.Timestamp >= from && candle.Timestamp <= to {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+func TestPriceService_Ohlcv(t *testing.T) {
+	// 只返回上游实际返回的 K 线，5 分钟 K 线不保存
+	candles := candlesFromOhlcvs("1_0xa", SourceGeckoTerminal, shared.GranularityHour, [][]interface{}{
+		{float64(10800), 3.0, 3.5, 2.5, 3.2, 10.0},
+		{float64(3600), 1.0, 2.0, 0.5, 1.5, 100.0},
+		{float64(7200), "bad", 1.0, 1.0, 1.0, 1.0},
+	})
+	if assert.Len(t, candles, 2) {
+		assert.Equal(t, schema.CoinCandle{CoinID: "1_0xa", Timeframe: shared.GranularityHour, Timestamp: 3600, Open: "1", High: "2", Low: "0.5", Close: "1.5", Volume: "100", Source: SourceGeckoTerminal}, candles[0])
+		assert.Equal(t, int64(10800), candles[1].Timestamp)
+		assert.Equal(t, "3.2", candles[1].Close)
+	}
+	assert.Nil(t, candlesFromOhlcvs("1_0xa", SourceGeckoTerminal, shared.GranularityFiveMinute, [][]interface{}{{float64(300), 1.0, 1.0, 1.0, 1.0, 1.0}}))
+
+	redisClient, _ := newStubRedisClient()
+	candleRepo := stubCandleRepo{}
+	assert.NoError(t, candleRepo.SaveCandles([]schema.CoinCandle{
+		{CoinID: "1_0xa", Timeframe: shared.GranularityHour, Timestamp: 3600, Open: "9", High: "9", Low: "9", Close: "9", Volume: "1", Source: SourceCoinGeckoOnChain, Base: schema.Base{UpdatedAt: time.Unix(9000, 0)}},
+	}))
+	listed := stubCandleProvider{&stubProvider{name: SourceCoinGeckoOnChain, listedOnly: true}}
+	terminal := stubCandleProvider{&stubProvider{name: SourceGeckoTerminal, ohlcvs: [][]interface{}{
+		{float64(3600), 1.0, 2.0, 0.5, 1.5, 100.0},
+		{float64(7200), 1.5, 1.6, 1.4, 1.55, 50.0},
+	}}}
+	s := &priceService{
+		providers:             NewPriceProviderRegistry([]PriceProvider{listed, terminal, &stubProvider{name: SourceDefiLlama}}),
+		historicalSourceOrder: newSourceOrder(koanf.New("."), "sourceOrder.historical", []string{SourceCoinGeckoOnChain, SourceDefiLlama, SourceGeckoTerminal}),
+		coinRepository:        stubCoinRepo{},
+		candleRepo:            candleRepo,
+		throttler:             shared.NewCoinsThrottler(redisClient, zerolog.Nop(), stubCoinRepo{}),
+		slack:                 &stubSlackService{},
+		logger:                zerolog.Nop(),
+	}
+
+	// 已保存的 K 线不覆盖，未收录的币种跳过只查询已收录币种的数据源，只请求缺少的 K 线
+	series, err := s.GetOhlcv("1", "0xA", 3700, 7300, shared.GranularityHour)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xa", series.Address)
+	assert.Equal(t, int64(3600), series.From)
+	assert.Equal(t, []Candle{
+		{TimeStamp: 3600, Open: "9", High: "9", Low: "9", Close: "9", Volume: "1", Source: SourceCoinGeckoOnChain},
+		{TimeStamp: 7200, Open: "1.5", High: "1.6", Low: "1.4", Close: "1.55", Volume: "50", Source: SourceGeckoTerminal},
+	}, series.Candles)
+	assert.Equal(t, 0, listed.calls)
+	assert.Equal(t, 1, terminal.calls)
+	assert.Equal(t, int64(7200), terminal.from)
+	assert.Equal(t, int64(10799), terminal.to)
+
+	// 请求失败或没有补全任何 K 线的数据源被节流，下一次请求不再查询
+	failing := stubCandleProvider{&stubProvider{name: SourceCoinGeckoOnChain, err: errors.New("status code: 500")}}
+	empty := stubCandleProvider{&stubProvider{name: SourceGeckoTerminal}}
+	s.providers = NewPriceProviderRegistry([]PriceProvider{failing, empty})
+	for i := 0; i < 2; i++ {
+		series, err = s.GetOhlcv("1", "0xb", 3600, 7200, shared.GranularityHour)
+		assert.NoError(t, err)
+		assert.Empty(t, series.Candles)
+	}
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 1, empty.calls)
+
+	// 结束后不久保存的 K 线重新获取，中间没有成交的小时只在返回结果中以前一根 K 线的收盘价补齐
+	assert.NoError(t, candleRepo.SaveCandles([]schema.CoinCandle{
+		{CoinID: "1_0xc", Timeframe: shared.GranularityHour, Timestamp: 3600, Open: "9", High: "9", Low: "9", Close: "9", Volume: "1", Source: SourceGeckoTerminal, Base: schema.Base{UpdatedAt: time.Unix(9000, 0)}},
+		{CoinID: "1_0xc", Timeframe: shared.GranularityHour, Timestamp: 10800, Open: "7", High: "7", Low: "7", Close: "7", Volume: "1", Source: SourceGeckoTerminal, Base: schema.Base{UpdatedAt: time.Unix(14400, 0)}},
+	}))
+	refresh := stubCandleProvider{&stubProvider{name: SourceGeckoTerminal, ohlcvs: [][]interface{}{
+		{float64(10800), 4.0, 4.0, 4.0, 4.0, 2.0},
+	}}}
+	s.providers = NewPriceProviderRegistry([]PriceProvider{refresh})
+	series, err = s.GetOhlcv("1", "0xc", 3600, 10800, shared.GranularityHour)
+	assert.NoError(t, err)
+	assert.Equal(t, []Candle{
+		{TimeStamp: 3600, Open: "9", High: "9", Low: "9", Close: "9", Volume: "1", Source: SourceGeckoTerminal},
+		{TimeStamp: 7200, Open: "9", High: "9", Low: "9", Close: "9", Volume: "0", Source: SourceGeckoTerminal},
+		{TimeStamp: 10800, Open: "4", High: "4", Low: "4", Close: "4", Volume: "2", Source: SourceGeckoTerminal},
+	}, series.Candles)
+	assert.Equal(t, int64(7200), refresh.from)
+	assert.NotContains(t, candleRepo, "1_0xc_1h_7200")
+
+	_, err = s.GetOhlcv("1", "0xa", 0, 3600*2000, shared.GranularityHour)
+	assert.Error(t, err)
+}
+
+func TestPagedOhlcvs(t *testing.T) {
+	// 整页返回且最早的 K 线晚于 from 时向前翻页，before 为上一页最早的 K 线
+	page := func(before int64) [][]interface{} {
+		ohlcvs := make([][]interface{}, 0, ohlcvLimit)
+		for i := int64(1); i <= ohlcvLimit; i++ {
+			ohlcvs = append(ohlcvs, []interface{}{float64(before - i*3600), 1.0, 1.0, 1.0, 1.0, 1.0})
+		}
+		return ohlcvs
+	}
+	to := int64(3600 * 5000)
+	var befores []int64
+	ohlcvs, err := pagedOhlcvs(to-3600*1500, to, func(before int64) ([][]interface{}, error) {
+		befores = append(befores, before)
+		return page(before), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{to + 1, to + 1 - 3600*ohlcvLimit}, befores)
+	assert.Len(t, ohlcvs, 2*ohlcvLimit)
+
+	// 不足一页时不再翻页
+	befores = nil
+	_, err = pagedOhlcvs(0, to, func(before int64) ([][]interface{}, error) {
+		befores = append(befores, before)
+		return page(before)[:10], nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, befores, 1)
+
+	_, err = pagedOhlcvs(0, to, func(before int64) ([][]interface{}, error) {
+		return nil, errors.New("status code: 500")
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// 锚定资产价格超出容忍范围时的处理方式
+const (
+	PegModeFlag  = "flag"  // 返回实际报价并标记 offPeg
+	PegModeClamp = "clamp" // 报价截断到容忍范围的边界，同时标记 offPeg
+)
+
+const (
+	pegOffPrefix      = "peg:off:"
+	pegOffCountPrefix = "peg:off:count:"
+)
+
+// PegTarget 锚定资产的目标价格（USD）及容忍范围（百分比）
+type PegTarget struct {
+	Target float64 `json:"target"`
+	Band   float64 `json:"band"`
+}
+
+// bounds 返回容忍范围的上下边界
+func (t PegTarget) bounds() (float64, float64) {
+	return t.Target * (1 - t.Band/100), t.Target * (1 + t.Band/100)
+}
+
+// PegService 维护稳定币等锚定资产的注册表，检查报价是否脱锚
+type PegService interface {
+	// Observe 记录数据源对锚定资产的报价，多个数据源报出超出范围的价格，或同一数据源多次重新获取的报价都超出范围时发送脱锚告警，
+	// cached 为数据源返回的缓存报价，不计入次数
+	Observe(coinID, source, price string, cached bool)
+	// Apply 按配置的模式截断或标记超出容忍范围的当前价格
+	Apply(coinID string, result *PriceResult)
+	// Flag 只标记超出容忍范围的历史价格，历史价格需要反映当时的实际报价，不截断
+	Flag(coinID string, result *PriceResult)
+}
+
+type pegService struct {
+	mode              string
+	targets           map[string]PegTarget // coinID => 锚定配置
+	alertSources      int                  // 至少多少个数据源报出脱锚价格时告警
+	alertObservations int                  // 按顺序查询只有一个数据源时，至少多少次脱锚报价时告警
+	alertWindow       time.Duration        // 脱锚报价及次数在该时间内有效
+	slack             SlackNotificationService
+	redisClient       *shared.RedisClient
+	logger            zerolog.Logger
+}
+
+func NewPegService(cfg *koanf.Koanf, slack SlackNotificationService, redisClient *shared.RedisClient, logger zerolog.Logger) PegService {
+	s := &pegService{
+		mode:              cfg.String("peg.mode"),
+		targets:           make(map[string]PegTarget),
+		alertSources:      cfg.Int("peg.alertSources"),
+		alertObservations: cfg.Int("peg.alertObservations"),
+		alertWindow:       cfg.Duration("peg.alertWindow"),
+		slack:             slack,
+		redisClient:       redisClient,
+		logger:            logger,
+	}
+	if s.mode != PegModeClamp {
+		s.mode = PegModeFlag
+	}
+	if s.alertSources <= 0 {
+		s.alertSources = 2
+	}
+	if s.alertObservations <= 0 {
+		s.alertObservations = 3
+	}
+	if s.alertWindow <= 0 {
+		s.alertWindow = 30 * time.Minute
+	}
+	defaultBand := cfg.Float64("peg.defaultBand")
+	if defaultBand <= 0 {
+		defaultBand = 2
+	}
+	for _, coinID := range cfg.MapKeys("peg.tokens") {
+		target := PegTarget{
+			Target: cfg.Float64("peg.tokens." + coinID + ".target"),
+			Band:   cfg.Float64("peg.tokens." + coinID + ".band"),
+		}
+		if target.Target <= 0 {
+			logger.Warn().Msgf("锚定资产 %s 没有配置目标价格，将被忽略", coinID)
+			continue
+		}
+		if target.Band <= 0 {
+			target.Band = defaultBand
+		}
+		s.targets[shared.NormalizeCoinID(coinID)] = target
+	}
+	return s
+}
+
+func (s *pegService) Observe(coinID, source, price string, cached bool) {
+	target, ok := s.targets[coinID]
+	if !ok {
+		return
+	}
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil || value <= 0 {
+		return
+	}
+	ctx := context.Background()
+	key := pegOffPrefix + coinID
+	countKey := pegOffCountPrefix + coinID
+	lower, upper := target.bounds()
+	if value >= lower && value <= upper {
+		if !cached {
+			s.redisClient.Client.HDel(ctx, key, source)
+			s.redisClient.Client.Del(ctx, countKey)
+		}
+		return
+	}
+	if cached {
+		return
+	}
+
+	// 每个数据源最近一次的脱锚报价及连续的脱锚次数，超过 alertWindow 没有新的脱锚报价时整体过期
+	pipe := s.redisClient.Client.TxPipeline()
+	pipe.HSet(ctx, key, source, price)
+	pipe.Expire(ctx, key, s.alertWindow)
+	all := pipe.HGetAll(ctx, key)
+	count := pipe.Incr(ctx, countKey)
+	pipe.Expire(ctx, countKey, s.alertWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Err(err).Msgf("Peg 记录 %s 的脱锚报价失败", coinID)
+		return
+	}
+	prices := make(map[string]float64)
+	for source, price := range all.Val() {
+		if value, err := strconv.ParseFloat(price, 64); err == nil {
+			prices[source] = value
+		}
+	}
+	s.logger.Warn().Msgf("Peg %s 报价 %s 超出锚定范围 [%v, %v]，脱锚数据源 %d 个，连续 %d 次", coinID, price, lower, upper, len(prices), count.Val())
+	if len(prices) < s.alertSources && count.Val() < int64(s.alertObservations) {
+		return
+	}
+	chainID, address, _ := strings.Cut(coinID, "_")
+	go s.slack.SaveDepeg(context.Background(), chainID, address, target.Target, prices)
+}
+
+func (s *pegService) Apply(coinID string, result *PriceResult) {
+	value, ok := s.offPeg(coinID, result)
+	if !ok {
+		return
+	}
+	result.OffPeg = true
+	if s.mode == PegModeClamp {
+		lower, upper := s.targets[coinID].bounds()
+		observed := *result.Price
+		// 边界按 12 位有效数字取整，避免 1.08*1.05 得到 1.1340000000000001
+		bound, _ := strconv.ParseFloat(strconv.FormatFloat(math.Min(math.Max(value, lower), upper), 'g', 12, 64), 64)
+		clamped := strconv.FormatFloat(bound, 'f', -1, 64)
+		result.ObservedPrice = &observed
+		result.Price = &clamped
+	}
+}
+
+func (s *pegService) Flag(coinID string, result *PriceResult) {
+	if _, ok := s.offPeg(coinID, result); ok {
+		result.OffPeg = true
+	}
+}
+
+// offPeg 返回已注册锚定资产超出容忍范围的报价
+func (s *pegService) offPeg(coinID string, result *PriceResult) (float64, bool) {
+	target, ok := s.targets[coinID]
+	if !ok || result.Price == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(*result.Price, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	lower, upper := target.bounds()
+	return value, value < lower || value > upper
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPegService(t *testing.T, mode string) PegService {
+	cfg := koanf.New(".")
+	assert.NoError(t, cfg.Load(confmap.Provider(map[string]interface{}{
+		"peg.mode":                   mode,
+		"peg.tokens.1_0xusdt.target": 1,
+		"peg.tokens.1_0xeurc.target": 1.08,
+		"peg.tokens.1_0xeurc.band":   5,
+		"peg.tokens.1_0xbroken.band": 1,
+	}, "."), nil))
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	return NewPegService(cfg, nil, redisClient, zerolog.Nop())
+}
+
+func TestPegService_Apply(t *testing.T) {
+	result := func(price string) PriceResult {
+		return PriceResult{Price: &price}
+	}
+
+	s := newTestPegService(t, PegModeFlag)
+	inBand := result("0.985")
+	s.Apply("1_0xusdt", &inBand)
+	assert.False(t, inBand.OffPeg)
+	assert.Equal(t, "0.985", *inBand.Price)
+
+	// 默认容忍范围 2%，flag 模式返回实际报价
+	depegged := result("0.95")
+	s.Apply("1_0xusdt", &depegged)
+	assert.True(t, depegged.OffPeg)
+	assert.Equal(t, "0.95", *depegged.Price)
+	assert.Nil(t, depegged.ObservedPrice)
+
+	eurc := result("1.12")
+	s.Apply("1_0xeurc", &eurc)
+	assert.False(t, eurc.OffPeg)
+
+	// 未注册或没有目标价格的币种不处理
+	unknown := result("0.5")
+	s.Apply("1_0xbroken", &unknown)
+	s.Apply("1_0xother", &unknown)
+	assert.False(t, unknown.OffPeg)
+	empty := PriceResult{}
+	s.Apply("1_0xusdt", &empty)
+	assert.False(t, empty.OffPeg)
+
+	s = newTestPegService(t, PegModeClamp)
+	low, high := result("0.95"), result("1.2")
+	s.Apply("1_0xusdt", &low)
+	s.Apply("1_0xeurc", &high)
+	assert.True(t, low.OffPeg)
+	assert.Equal(t, "0.98", *low.Price)
+	assert.Equal(t, "0.95", *low.ObservedPrice)
+	assert.True(t, high.OffPeg)
+	assert.Equal(t, "1.134", *high.Price)
+	assert.Equal(t, "1.2", *high.ObservedPrice)
+
+	// 历史价格只标记，不截断
+	historical := result("0.95")
+	s.Flag("1_0xusdt", &historical)
+	assert.True(t, historical.OffPeg)
+	assert.Equal(t, "0.95", *historical.Price)
+	assert.Nil(t, historical.ObservedPrice)
+
+	// Redis 不可用时记录脱锚报价失败，不影响请求
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.95", false)
+	s.Observe("1_0xusdt", SourceCoinGecko, "1", false)
+}
+
+func TestPegService_Observe(t *testing.T) {
+	redisClient, stub := newStubRedisClient()
+	slack := &stubSlackService{}
+	cfg := newTestConfig(t, map[string]interface{}{
+		"peg.tokens.1_0xusdt.target": 1,
+		"peg.tokens.1_0xdai.target":  1,
+	})
+	s := NewPegService(cfg, slack, redisClient, zerolog.Nop())
+	depegs := func() int {
+		slack.mu.Lock()
+		defer slack.mu.Unlock()
+		return len(slack.depegs)
+	}
+
+	// 按顺序查询时只有一个数据源，缓存的报价不计入次数，范围内的报价重新计数
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.95", false)
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.95", true)
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.95", true)
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.95", false)
+	s.Observe("1_0xusdt", SourceCoinGecko, "1", false)
+	_, counted := stub.get(pegOffCountPrefix + "1_0xusdt")
+	assert.False(t, counted)
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.95", false)
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.94", false)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, depegs())
+
+	// 同一数据源连续 3 次重新获取的报价都超出范围时告警
+	s.Observe("1_0xusdt", SourceCoinGecko, "0.93", false)
+	assert.Eventually(t, func() bool { return depegs() == 1 }, time.Second, 10*time.Millisecond)
+
+	// 多数据源同时查询时，2 个数据源报出脱锚价格即告警
+	s.Observe("1_0xdai", SourceCoinGecko, "1.1", false)
+	s.Observe("1_0xdai", SourceDefiLlama, "1.09", false)
+	assert.Eventually(t, func() bool { return depegs() == 2 }, time.Second, 10*time.Millisecond)
+	slack.mu.Lock()
+	defer slack.mu.Unlock()
+	assert.Equal(t, map[string]float64{SourceCoinGecko: 1.1, SourceDefiLlama: 1.09}, slack.depegs[1])
+}
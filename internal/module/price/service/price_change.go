@@ -0,0 +1,155 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+)
+
+// DefaultPriceChangeWindows 请求未指定时间窗口时返回的涨跌幅
+var DefaultPriceChangeWindows = []string{"1h", "24h", "7d", "30d"}
+
+// priceChangeWindow 时间窗口的长度及查询参考价格使用的粒度，前面的粒度没有已保存的价格时依次使用后面的粒度，
+// 数据源只查询最后一个粒度
+type priceChangeWindow struct {
+	duration      time.Duration
+	granularities []string
+}
+
+var priceChangeWindows = map[string]priceChangeWindow{
+	"1h":  {time.Hour, []string{shared.GranularityFiveMinute, shared.GranularityHour}},
+	"24h": {24 * time.Hour, []string{shared.GranularityHour, shared.GranularityDay}},
+	"7d":  {7 * 24 * time.Hour, []string{shared.GranularityHour, shared.GranularityDay}},
+	"30d": {30 * 24 * time.Hour, []string{shared.GranularityDay}},
+}
+
+// ParsePriceChangeWindows 解析请求中的时间窗口，为空时使用默认窗口，1d 等同于 24h
+func ParsePriceChangeWindows(windows []string) ([]string, error) {
+	if len(windows) == 0 {
+		return DefaultPriceChangeWindows, nil
+	}
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, window := range windows {
+		window = strings.ToLower(strings.TrimSpace(window))
+		if window == "1d" {
+			window = "24h"
+		}
+		if _, ok := priceChangeWindows[window]; !ok {
+			return nil, fmt.Errorf("unsupported window: %s", window)
+		}
+		if !seen[window] {
+			seen[window] = true
+			parsed = append(parsed, window)
+		}
+	}
+	return parsed, nil
+}
+
+// FillPriceChanges 根据当前价格计算各时间窗口的涨跌幅百分比，参考价格为窗口起点所在时间段的历史价格，没有参考价格的窗口返回 null
+func (s *priceService) FillPriceChanges(results []PriceResult, windows []string) {
+	now := time.Now().Unix()
+	current := make(map[int]float64)
+	var chainIds, addresses []string
+	var indexes []int
+	for i, result := range results {
+		if result.Price == nil || result.Error != "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(*result.Price, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		current[i] = price
+		chainIds = append(chainIds, result.ChainID)
+		addresses = append(addresses, result.Address)
+		indexes = append(indexes, i)
+		results[i].Changes = make(map[string]*string, len(windows))
+	}
+	if len(indexes) == 0 {
+		return
+	}
+
+	for _, window := range windows {
+		config := priceChangeWindows[window]
+		references := s.referencePrices(chainIds, addresses, now-int64(config.duration.Seconds()), config.granularities)
+		for k, index := range indexes {
+			var change *string
+			if reference, ok := references[k]; ok {
+				value := strconv.FormatFloat((current[index]-reference)/reference*100, 'f', 2, 64)
+				change = &value
+			}
+			results[index].Changes[window] = change
+		}
+	}
+}
+
+// referencePrices 返回各代币在 unixTimeStamp 所在时间段的价格，key 为请求中的下标
+// 时间戳按粒度对齐到时间段起始，先按粒度从细到粗读取已保存的历史价格，仍缺少的只按最粗的粒度查询一次数据源
+func (s *priceService) referencePrices(chainIds, addresses []string, unixTimeStamp int64, granularities []string) map[int]float64 {
+	references := make(map[int]float64)
+	coinIds := make([]string, len(addresses))
+	pending := make([]int, len(addresses))
+	for i := range pending {
+		coinIds[i] = shared.CoinID(chainIds[i], addresses[i])
+		pending[i] = i
+	}
+	resolve := func(price string, index int) bool {
+		value, err := strconv.ParseFloat(price, 64)
+		if err != nil || value <= 0 {
+			return false
+		}
+		references[index] = value
+		return true
+	}
+
+	for _, granularity := range granularities {
+		if len(pending) == 0 {
+			return references
+		}
+		bucket := shared.BucketStart(granularity, unixTimeStamp)
+		dates := make([]int64, len(pending))
+		for k := range pending {
+			dates[k] = bucket
+		}
+		stored, err := s.historicalRepo.GetHistoricalPricesByGranularity(shared.Pick(coinIds, pending), dates, granularity)
+		if err != nil {
+			s.logger.Err(err).Msgf("FillPriceChanges 读取 %s 参考价格失败", granularity)
+			continue
+		}
+		dayDate := shared.BucketDate(granularity, bucket)
+		var missing []int
+		for _, index := range pending {
+			if !resolve(stored[coinIds[index]+"_"+dayDate], index) {
+				missing = append(missing, index)
+			}
+		}
+		pending = missing
+	}
+	if len(pending) == 0 {
+		return references
+	}
+
+	granularity := granularities[len(granularities)-1]
+	bucket := shared.BucketStart(granularity, unixTimeStamp)
+	unixTimeStamps := make([]int64, len(pending))
+	datesStr := make([]string, len(pending))
+	for k := range pending {
+		unixTimeStamps[k] = bucket
+		datesStr[k] = strconv.FormatInt(bucket, 10)
+	}
+	results, err := s.batchHistoricalPrice(0, granularity, shared.Pick(chainIds, pending), shared.Pick(addresses, pending), nil, nil, unixTimeStamps, datesStr)
+	if err != nil {
+		s.logger.Err(err).Msgf("FillPriceChanges 获取 %s 参考价格失败", granularity)
+		return references
+	}
+	for k, index := range pending {
+		if k < len(results) && results[k].Price != nil {
+			resolve(*results[k].Price, index)
+		}
+	}
+	return references
+}
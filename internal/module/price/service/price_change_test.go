@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubChangeHistoryRepo 按粒度返回已保存的历史价格，prices 的 key 为 粒度_币种ID
+type stubChangeHistoryRepo struct {
+	stubHistoricalPriceRepo
+	prices map[string]string
+}
+
+func (r *stubChangeHistoryRepo) GetHistoricalPricesByGranularity(coinIDs []string, dates []int64, granularity string) (map[string]string, error) {
+	prices := make(map[string]string)
+	for i, coinID := range coinIDs {
+		if price, ok := r.prices[granularity+"_"+coinID]; ok {
+			prices[coinID+"_"+shared.BucketDate(granularity, dates[i])] = price
+		}
+	}
+	return prices, nil
+}
+
+func TestPriceService_PriceChanges(t *testing.T) {
+	windows, err := ParsePriceChangeWindows(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPriceChangeWindows, windows)
+	windows, err = ParsePriceChangeWindows([]string{"1D", "24h", "30d"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"24h", "30d"}, windows)
+	_, err = ParsePriceChangeWindows([]string{"1y"})
+	assert.Error(t, err)
+
+	// 不可用的 Redis 地址，节流检查视为未节流
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	provider := stubIntradayProvider{&stubProvider{
+		name: SourceGeckoTerminal,
+		prices: map[string]string{
+			shared.GranularityFiveMinute + "_1_0xa": "1",
+			shared.GranularityDay + "_1_0xa":        "4",
+		},
+	}}
+	s := &priceService{
+		providers:             NewPriceProviderRegistry([]PriceProvider{provider}),
+		historicalSourceOrder: newSourceOrder(koanf.New("."), "sourceOrder.historical", []string{SourceGeckoTerminal}),
+		coinRepository:        stubCoinRepo{},
+		historicalRepo: &stubChangeHistoryRepo{prices: map[string]string{
+			shared.GranularityFiveMinute + "_1_0xa": "2",
+			shared.GranularityHour + "_1_0xb":       "5",
+		}},
+		throttler:   shared.NewCoinsThrottler(redisClient, zerolog.Nop(), nil),
+		pegs:        NewPegService(koanf.New("."), nil, redisClient, zerolog.Nop()),
+		redisClient: redisClient,
+		logger:      zerolog.Nop(),
+	}
+
+	a, b := "3", "4"
+	results := []PriceResult{
+		{ChainID: "1", Address: "0xa", Price: &a},
+		{ChainID: "1", Address: "0xb", Price: &b},
+		{ChainID: "1", Address: "0xc"},
+	}
+	s.FillPriceChanges(results, []string{"1h", "24h"})
+
+	// 1h 使用已保存的 5 分钟价格，24h 没有已保存的小时价格时按天查询数据源
+	change := func(result PriceResult, window string) interface{} {
+		if value := result.Changes[window]; value != nil {
+			return *value
+		}
+		return nil
+	}
+	assert.Equal(t, "50.00", change(results[0], "1h"))
+	assert.Equal(t, "-25.00", change(results[0], "24h"))
+	assert.Equal(t, "-20.00", change(results[1], "1h"))
+	assert.Equal(t, "-20.00", change(results[1], "24h"))
+	assert.Nil(t, results[2].Changes)
+
+	// 数据源只按最粗的粒度查询，时间戳对齐到时间段起始
+	assert.NotContains(t, provider.requested, shared.GranularityFiveMinute)
+	assert.NotContains(t, provider.requested, shared.GranularityHour)
+	assert.Len(t, provider.requested[shared.GranularityDay], 1)
+	for granularity, unixTimeStamps := range provider.requested {
+		for _, unixTimeStamp := range unixTimeStamps {
+			assert.Equal(t, shared.BucketStart(granularity, unixTimeStamp), unixTimeStamp)
+		}
+	}
+}
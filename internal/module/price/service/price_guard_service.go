@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// 价格校验模式
+const (
+	PriceGuardModeReject     = "reject"     // 超出范围的报价丢弃，多次或多个数据源报出相近价格时确认价格变化
+	PriceGuardModeQuarantine = "quarantine" // 超出范围的报价先隔离，再次出现相近报价时确认价格变化
+)
+
+const (
+	priceQuarantinePrefix          = "price:quarantine:"
+	priceQuarantineTTL             = 30 * time.Minute
+	priceGuardAcceptedPrefix       = "price:guard:"
+	priceGuardAcceptedTTL          = 7 * 24 * time.Hour
+	defaultPriceGuardTier          = "default"
+	defaultPriceGuardConfirmations = 3
+	priceGuardConfirmRetries       = 3
+)
+
+// priceCandidate 超出范围的新价格水平，以及报出相近价格的次数和数据源
+type priceCandidate struct {
+	Price   float64         `json:"price"`
+	Checks  int             `json:"checks"`
+	Sources map[string]bool `json:"sources"`
+}
+
+// PriceGuardService 将新获取的报价与最近的已知价格比较，拦截异常跳变
+type PriceGuardService interface {
+	Enabled() bool
+	// LastKnownPrices 返回币种最近的已知价格，优先使用最近一次被接受的报价，其次是最新的历史价格
+	LastKnownPrices(coinIDs []string) map[string]float64
+	// Check 校验报价，返回 false 表示报价被拒绝，调用方应继续查询下一个数据源。
+	// cached 表示报价来自数据源的缓存，被拒绝时不计入确认次数也不重复记录
+	Check(coinID, label, source, price string, cached bool, reference float64) bool
+	// RejectedPrices 返回被拒绝的报价，coinID 为空时返回所有币种
+	RejectedPrices(coinID string, limit int) ([]schema.RejectedPrice, error)
+}
+
+type priceGuardService struct {
+	enabled                 bool
+	mode                    string
+	confirmations           int // reject 模式下确认价格变化需要的相近报价次数
+	defaultBand             float64
+	tierBands               map[string]float64 // tier => 允许的波动百分比
+	tokenTiers              map[string]string  // coinID => tier，优先于 coins.label
+	coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository
+	rejectedPriceRepo       repository.RejectedPriceRepository
+	redisClient             *shared.RedisClient
+	logger                  zerolog.Logger
+}
+
+func NewPriceGuardService(cfg *koanf.Koanf, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, rejectedPriceRepo repository.RejectedPriceRepository, redisClient *shared.RedisClient, logger zerolog.Logger) PriceGuardService {
+	s := &priceGuardService{
+		enabled:                 cfg.Bool("priceGuard.enabled"),
+		mode:                    cfg.String("priceGuard.mode"),
+		confirmations:           cfg.Int("priceGuard.confirmations"),
+		defaultBand:             cfg.Float64("priceGuard.defaultBand"),
+		tierBands:               make(map[string]float64),
+		tokenTiers:              make(map[string]string),
+		coinHistoricalPriceRepo: coinHistoricalPriceRepo,
+		rejectedPriceRepo:       rejectedPriceRepo,
+		redisClient:             redisClient,
+		logger:                  logger,
+	}
+	if s.mode != PriceGuardModeQuarantine {
+		s.mode = PriceGuardModeReject
+	}
+	if s.confirmations <= 0 {
+		s.confirmations = defaultPriceGuardConfirmations
+	}
+	if s.defaultBand <= 0 {
+		s.defaultBand = 50
+	}
+	for _, tier := range cfg.MapKeys("priceGuard.tiers") {
+		if band := cfg.Float64("priceGuard.tiers." + tier); band > 0 {
+			s.tierBands[tier] = band
+		}
+	}
+	for _, coinID := range cfg.MapKeys("priceGuard.tokens") {
+		s.tokenTiers[coinID] = cfg.String("priceGuard.tokens." + coinID)
+	}
+	return s
+}
+
+func (s *priceGuardService) Enabled() bool {
+	return s.enabled
+}
+
+func (s *priceGuardService) LastKnownPrices(coinIDs []string) map[string]float64 {
+	references := make(map[string]float64)
+	if !s.enabled || len(coinIDs) == 0 {
+		return references
+	}
+	// 不使用当前价格缓存，其中可能是被拒绝的报价
+	keys := make([]string, len(coinIDs))
+	for i, coinID := range coinIDs {
+		keys[i] = priceGuardAcceptedPrefix + coinID
+	}
+	accepted, _ := s.redisClient.Client.MGet(context.Background(), keys...).Result()
+	var missing []string
+	for i, coinID := range coinIDs {
+		var value string
+		if i < len(accepted) {
+			value, _ = accepted[i].(string)
+		}
+		if price, err := strconv.ParseFloat(value, 64); err == nil && price > 0 {
+			references[coinID] = price
+		} else {
+			missing = append(missing, coinID)
+		}
+	}
+	if len(missing) == 0 {
+		return references
+	}
+	latestPrices, err := s.coinHistoricalPriceRepo.GetLatestPrices(missing)
+	if err != nil {
+		s.logger.Err(err).Msg("PriceGuard 获取最新历史价格失败")
+		return references
+	}
+	for coinID, priceStr := range latestPrices {
+		if price, err := strconv.ParseFloat(priceStr, 64); err == nil && price > 0 {
+			references[coinID] = price
+		}
+	}
+	return references
+}
+
+func (s *priceGuardService) Check(coinID, label, source, price string, cached bool, reference float64) bool {
+	if !s.enabled {
+		return true
+	}
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil || value <= 0 {
+		return true
+	}
+	if reference <= 0 {
+		s.accept(coinID, price, value, reference)
+		return true
+	}
+	tier, band := s.band(coinID, label)
+	deviation := math.Abs(value-reference) / reference * 100
+	if deviation <= band {
+		s.accept(coinID, price, value, reference)
+		return true
+	}
+	// 缓存中的报价已经校验过，继续拒绝直到新的报价确认价格变化
+	if cached {
+		return false
+	}
+	if s.confirm(coinID, source, value, band) {
+		s.logger.Warn().Msgf("PriceGuard 确认 %s 的价格变化: %v -> %s", coinID, reference, price)
+		s.accept(coinID, price, value, reference)
+		return true
+	}
+
+	s.logger.Warn().Msgf("PriceGuard 拒绝 %s 的报价 %s: %s，最近价格 %v，偏差 %.2f%%", source, coinID, price, reference, deviation)
+	// 数据源请求时已将被拒绝的报价写入当前价格缓存，删除后下次请求重新获取
+	if err := s.redisClient.DeleteCurrentPriceCache(coinID); err != nil {
+		s.logger.Err(err).Msgf("PriceGuard 删除 %s 的当前价格缓存失败", coinID)
+	}
+	go s.rejectedPriceRepo.SaveRejectedPrice(schema.RejectedPrice{
+		CoinID:         coinID,
+		Source:         source,
+		Price:          price,
+		ReferencePrice: strconv.FormatFloat(reference, 'f', -1, 64),
+		Deviation:      deviation,
+		Tier:           tier,
+		Mode:           s.mode,
+		Date:           time.Now().Unix(),
+	})
+	return false
+}
+
+// accept 保存被接受的报价，作为之后校验的最近已知价格
+func (s *priceGuardService) accept(coinID, price string, value, reference float64) {
+	if value == reference {
+		return
+	}
+	if err := s.redisClient.Client.Set(context.Background(), priceGuardAcceptedPrefix+coinID, price, priceGuardAcceptedTTL).Err(); err != nil {
+		s.logger.Err(err).Msgf("PriceGuard 保存 %s 的已接受价格失败", coinID)
+	}
+}
+
+// confirm 记录超出范围的报价，返回新的价格水平是否已被确认。quarantine 模式下再次出现相近的报价即确认，
+// reject 模式下需要 confirmations 次相近的报价，或者两个不同的数据源报出相近的价格。
+// 待确认的价格通过 WATCH 事务更新，并发确认时事务失败后重新读取，避免丢失确认次数及数据源
+func (s *priceGuardService) confirm(coinID, source string, value, band float64) bool {
+	ctx := context.Background()
+	key := priceQuarantinePrefix + coinID
+	required := s.confirmations
+	if s.mode == PriceGuardModeQuarantine {
+		required = 2
+	}
+	var confirmed bool
+	update := func(tx *redis.Tx) error {
+		var candidate priceCandidate
+		if data, err := tx.Get(ctx, key).Bytes(); err == nil {
+			json.Unmarshal(data, &candidate)
+		}
+		if candidate.Price <= 0 || math.Abs(value-candidate.Price)/candidate.Price*100 > band {
+			// 与待确认的价格不一致，从该报价重新开始确认
+			candidate = priceCandidate{Price: value}
+		}
+		if candidate.Sources == nil {
+			candidate.Sources = make(map[string]bool)
+		}
+		candidate.Checks++
+		candidate.Sources[source] = true
+		confirmed = candidate.Checks >= required || len(candidate.Sources) >= 2
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if confirmed {
+				pipe.Del(ctx, key)
+				return nil
+			}
+			data, _ := json.Marshal(candidate)
+			pipe.Set(ctx, key, data, priceQuarantineTTL)
+			return nil
+		})
+		return err
+	}
+	for attempt := 0; attempt < priceGuardConfirmRetries; attempt++ {
+		err := s.redisClient.Client.Watch(ctx, update, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			s.logger.Err(err).Msgf("PriceGuard 更新 %s 的待确认价格失败", coinID)
+			return false
+		}
+		return confirmed
+	}
+	return false
+}
+
+// band 返回币种所属的 tier 及其允许的波动百分比
+func (s *priceGuardService) band(coinID, label string) (string, float64) {
+	tier := s.tokenTiers[coinID]
+	if tier == "" {
+		tier = label
+	}
+	if band, ok := s.tierBands[tier]; ok {
+		return tier, band
+	}
+	return defaultPriceGuardTier, s.defaultBand
+}
+
+func (s *priceGuardService) RejectedPrices(coinID string, limit int) ([]schema.RejectedPrice, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	return s.rejectedPriceRepo.GetRejectedPrices(coinID, limit)
+}
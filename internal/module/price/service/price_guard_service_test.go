@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPriceGuardService(t *testing.T, values map[string]interface{}) (*priceGuardService, *stubRejectedPriceRepo) {
+	redisClient, _ := newStubRedisClient()
+	rejected := &stubRejectedPriceRepo{}
+	historical := &stubHistoricalPriceRepo{latest: map[string]string{"1_0xhistory": "2"}}
+	return NewPriceGuardService(newTestConfig(t, values), historical, rejected, redisClient, zerolog.Nop()).(*priceGuardService), rejected
+}
+
+func TestPriceGuardService_Disabled(t *testing.T) {
+	guard, _ := setupPriceGuardService(t, map[string]interface{}{})
+	assert.False(t, guard.Enabled())
+	assert.True(t, guard.Check("1_0xabc", "", "coingecko", "1000", false, 1))
+	assert.Empty(t, guard.LastKnownPrices([]string{"1_0xabc"}))
+}
+
+func TestPriceGuardService_WithinBand(t *testing.T) {
+	guard, rejected := setupPriceGuardService(t, map[string]interface{}{
+		"priceGuard.enabled":        true,
+		"priceGuard.defaultBand":    50,
+		"priceGuard.tiers.stable":   2,
+		"priceGuard.tokens.1_0xabc": "stable",
+	})
+	assert.True(t, guard.Enabled())
+	// 没有最近价格时不做校验
+	assert.True(t, guard.Check("1_0xdef", "", "coingecko", "1000", false, 0))
+	// 默认 tier 允许 50% 的波动
+	assert.True(t, guard.Check("1_0xdef", "", "coingecko", "1.4", false, 1))
+	// stable tier 只允许 2% 的波动
+	assert.True(t, guard.Check("1_0xabc", "", "coingecko", "1.01", false, 1))
+	assert.True(t, guard.Check("1_0x123", "stable", "coingecko", "0.99", false, 1))
+	assert.Empty(t, rejected.prices)
+
+	// 被接受的报价作为最近已知价格，没有时使用最新的历史价格
+	assert.Equal(t, map[string]float64{"1_0xdef": 1.4, "1_0xabc": 1.01, "1_0xhistory": 2}, guard.LastKnownPrices([]string{"1_0xdef", "1_0xabc", "1_0xhistory", "1_0xnone"}))
+}
+
+func TestPriceGuardService_Reject(t *testing.T) {
+	guard, rejected := setupPriceGuardService(t, map[string]interface{}{
+		"priceGuard.enabled":     true,
+		"priceGuard.defaultBand": 50,
+	})
+	guard.accept("1_0xabc", "1", 1, 0)
+
+	// 超出范围的报价被拒绝并记录，同时删除数据源写入的当前价格缓存；缓存中的相同报价不重复记录也不计入确认次数
+	guard.redisClient.SetCurrentPriceCache("1_0xabc", "3")
+	assert.False(t, guard.Check("1_0xabc", "", SourceCoinGecko, "3", false, 1))
+	_, err := guard.redisClient.GetCurrentPriceCache("1_0xabc")
+	assert.ErrorIs(t, err, redis.Nil)
+	assert.False(t, guard.Check("1_0xabc", "", SourceCoinGecko, "3", true, 1))
+	assert.Eventually(t, func() bool {
+		prices, _ := guard.RejectedPrices("", 0)
+		return len(prices) == 1
+	}, time.Second, 10*time.Millisecond)
+	row := rejected.prices[0]
+	assert.Equal(t, PriceGuardModeReject, row.Mode)
+	assert.Equal(t, "1", row.ReferencePrice)
+	assert.InDelta(t, 200, row.Deviation, 1e-9)
+	assert.Equal(t, map[string]float64{"1_0xabc": 1}, guard.LastKnownPrices([]string{"1_0xabc"}))
+
+	// 同一数据源连续 confirmations 次报出相近的价格后确认价格变化
+	assert.False(t, guard.Check("1_0xabc", "", SourceCoinGecko, "3.1", false, 1))
+	assert.True(t, guard.Check("1_0xabc", "", SourceCoinGecko, "2.9", false, 1))
+	assert.Equal(t, map[string]float64{"1_0xabc": 2.9}, guard.LastKnownPrices([]string{"1_0xabc"}))
+
+	// 不一致的报价重新开始确认，两个数据源报出相近的价格时立即确认
+	assert.False(t, guard.Check("1_0xdef", "", SourceCoinGecko, "10", false, 1))
+	assert.False(t, guard.Check("1_0xdef", "", SourceCoinGecko, "100", false, 1))
+	assert.True(t, guard.Check("1_0xdef", "", SourceDefiLlama, "101", false, 1))
+}
+
+func TestPriceGuardService_Quarantine(t *testing.T) {
+	redisClient, stub := newStubRedisClient()
+	rejected := &stubRejectedPriceRepo{}
+	cfg := newTestConfig(t, map[string]interface{}{
+		"priceGuard.enabled": true,
+		"priceGuard.mode":    PriceGuardModeQuarantine,
+	})
+	guard := NewPriceGuardService(cfg, &stubHistoricalPriceRepo{}, rejected, redisClient, zerolog.Nop()).(*priceGuardService)
+	guard.accept("1_0xabc", "1", 1, 0)
+	slack := &stubSlackService{}
+	spike := &stubProvider{name: SourceCoinGecko, prices: map[string]string{"1_0xabc": "3"}}
+	steady := &stubProvider{name: SourceDefiLlama, prices: map[string]string{"1_0xabc": "1.02"}}
+	s := newTestBatchPriceService(cfg, redisClient, guard, slack, spike, steady)
+
+	// 被隔离的报价不返回，继续查询下一个数据源
+	results, err := s.FetchAndProcessBatchPrices(context.Background(), []string{"1"}, []string{"0xabc"}, nil, nil, true, false)
+	assert.NoError(t, err)
+	if assert.NotNil(t, results[0].Price) {
+		assert.Equal(t, "1.02", *results[0].Price)
+		assert.Equal(t, SourceDefiLlama, *results[0].Source)
+	}
+	assert.Eventually(t, func() bool {
+		prices, _ := guard.RejectedPrices("1_0xabc", 10)
+		return len(prices) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, PriceGuardModeQuarantine, rejected.prices[0].Mode)
+	assert.Equal(t, SourceCoinGecko, rejected.prices[0].Source)
+	_, quarantined := stub.get(priceQuarantinePrefix + "1_0xabc")
+	assert.True(t, quarantined)
+
+	// 没有其他数据源时不返回价格，测试中清除没有价格时设置的节流
+	unthrottle := func() { redisClient.Client.Del(context.Background(), shared.CoinsThrottlePrefix+"1_0xabc") }
+	s = newTestBatchPriceService(cfg, redisClient, guard, slack, &stubProvider{name: SourceCoinGecko, prices: map[string]string{"1_0xabc": "0.3"}})
+	results, _ = s.FetchAndProcessBatchPrices(context.Background(), []string{"1"}, []string{"0xabc"}, nil, nil, true, false)
+	assert.Nil(t, results[0].Price)
+	unthrottle()
+
+	// 隔离期内再次出现相近的报价时确认价格变化
+	s = newTestBatchPriceService(cfg, redisClient, guard, slack, &stubProvider{name: SourceCoinGecko, prices: map[string]string{"1_0xabc": "3.05"}})
+	results, _ = s.FetchAndProcessBatchPrices(context.Background(), []string{"1"}, []string{"0xabc"}, nil, nil, true, false)
+	assert.Nil(t, results[0].Price)
+	unthrottle()
+	s = newTestBatchPriceService(cfg, redisClient, guard, slack, &stubProvider{name: SourceCoinGecko, prices: map[string]string{"1_0xabc": "3.1"}})
+	results, _ = s.FetchAndProcessBatchPrices(context.Background(), []string{"1"}, []string{"0xabc"}, nil, nil, true, false)
+	if assert.NotNil(t, results[0].Price) {
+		assert.Equal(t, "3.1", *results[0].Price)
+	}
+	assert.Equal(t, map[string]float64{"1_0xabc": 3.1}, guard.LastKnownPrices([]string{"1_0xabc"}))
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+)
+
+// 数据源名称
+const (
+	SourceCoinGecko        = "coingecko"
+	SourceGeckoTerminal    = "geckoterminal"
+	SourceDefiLlama        = "defillama"
+	SourceCoinGeckoOnChain = "coinGeckoOnChain"
+	SourceDodoexRoute      = "dodoexRoute"
+	SourceCex              = "cex"
+	SourceChainlink        = "chainlink"
+	SourceAmmPool          = "ammPool"
+	SourceDodoPool         = "dodoPool"
+)
+
+// PriceProvider 价格数据源，新增数据源只需实现该接口并在 price_module 中注册
+type PriceProvider interface {
+	Name() string
+	SupportsCurrent() bool
+	SupportsHistorical() bool
+	// ListedCoinsOnly 为 true 时只查询 coins 表中已存在的币种
+	ListedCoinsOnly() bool
+	GetBatchCurrentPrices(addresses []string, chainIds []string, symbols []string, networks []string, isCache bool) ([]PriceResult, error)
+	GetBatchHistoricalPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64) ([]PriceResult, error)
+}
+
+// IntradayPriceProvider 支持按小时或 5 分钟粒度查询历史价格的数据源
+type IntradayPriceProvider interface {
+	PriceProvider
+	GetBatchIntradayPrices(addresses []string, chainIds []string, symbols []string, networks []string, unixTimeStamps []int64, granularity string) ([]PriceResult, error)
+}
+
+// RangePriceProvider 支持一次请求获取一段时间内价格序列的数据源，返回并保存按粒度归入时间段的收盘价
+type RangePriceProvider interface {
+	PriceProvider
+	GetPriceRange(chainId, address string, from, to int64, granularity string) ([]schema.CoinHistoricalPrice, error)
+}
+
+// CandleProvider 支持获取按天及按小时 OHLCV K 线的数据源，返回并保存获取到的 K 线
+type CandleProvider interface {
+	PriceProvider
+	GetCandles(chainId, address string, from, to int64, timeframe string) ([]schema.CoinCandle, error)
+}
+
+// TokenInfoProvider 支持查询代币 symbol、name、decimals 及总供应量的数据源，返回的 coin 只包含查到的字段
+type TokenInfoProvider interface {
+	PriceProvider
+	GetTokenInfo(chainId, address string) (*schema.Coins, error)
+}
+
+type PriceProviderRegistry interface {
+	Get(name string) (PriceProvider, bool)
+	Names() []string
+	// Current 按 order 顺序返回支持当前价格的数据源，未注册的名称会被忽略
+	Current(order []string) []PriceProvider
+	// Historical 按 order 顺序返回支持历史价格的数据源，未注册的名称会被忽略
+	Historical(order []string) []PriceProvider
+}
+
+type priceProviderRegistry struct {
+	providers map[string]PriceProvider
+}
+
+func NewPriceProviderRegistry(providers []PriceProvider) PriceProviderRegistry {
+	r := &priceProviderRegistry{
+		providers: make(map[string]PriceProvider, len(providers)),
+	}
+	for _, provider := range providers {
+		if provider == nil {
+			continue
+		}
+		r.providers[provider.Name()] = provider
+	}
+	return r
+}
+
+func (r *priceProviderRegistry) Get(name string) (PriceProvider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+func (r *priceProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *priceProviderRegistry) Current(order []string) []PriceProvider {
+	var providers []PriceProvider
+	for _, name := range order {
+		if provider, ok := r.providers[name]; ok && provider.SupportsCurrent() {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+func (r *priceProviderRegistry) Historical(order []string) []PriceProvider {
+	var providers []PriceProvider
+	for _, name := range order {
+		if provider, ok := r.providers[name]; ok && provider.SupportsHistorical() {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func providerNames(providers []PriceProvider) []string {
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = provider.Name()
+	}
+	return names
+}
+
+func TestPriceProviderRegistry_Get(t *testing.T) {
+	registry := NewPriceProviderRegistry([]PriceProvider{
+		&stubProvider{name: "a", currentOnly: true},
+		nil,
+	})
+
+	provider, ok := registry.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", provider.Name())
+
+	_, ok = registry.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"a"}, registry.Names())
+}
+
+func TestPriceProviderRegistry_Order(t *testing.T) {
+	registry := NewPriceProviderRegistry([]PriceProvider{
+		&stubProvider{name: "a"},
+		&stubProvider{name: "b", currentOnly: true},
+		&stubProvider{name: "c", historicalOnly: true},
+	})
+
+	assert.Equal(t, []string{"b", "a"}, providerNames(registry.Current([]string{"b", "missing", "a", "c"})))
+	assert.Equal(t, []string{"c", "a"}, providerNames(registry.Historical([]string{"c", "b", "a"})))
+	assert.Empty(t, registry.Current(nil))
+}
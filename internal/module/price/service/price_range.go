@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+)
+
+// 一次区间查询最多返回的时间段数量，与 OHLCV 接口单次返回的 K 线数量一致
+const maxRangePoints = 1000
+
+// PricePoint 价格序列中一个时间段的收盘价，timestamp 为时间段的起始时间
+type PricePoint struct {
+	TimeStamp int64  `json:"timestamp"`
+	Price     string `json:"price"`
+	Source    string `json:"source,omitempty"`
+}
+
+// PriceSeries 代币在一段时间内按粒度排列的价格，没有价格的时间段不返回
+type PriceSeries struct {
+	ChainID  string       `json:"chainId"`
+	Address  string       `json:"address"`
+	Interval string       `json:"interval"`
+	From     int64        `json:"from"`
+	To       int64        `json:"to"`
+	Currency string       `json:"currency,omitempty"` // 非 USD 计价时返回
+	Prices   []PricePoint `json:"prices"`
+}
+
+// rangePoint 上游返回的一个价格点
+type rangePoint struct {
+	timestamp int64
+	price     float64
+}
+
+// closesByBucket 将上游返回的价格点按粒度归入 [from, to] 内的时间段，每个时间段取最后一个价格作为收盘价
+func closesByBucket(coinID, source, granularity string, points []rangePoint, from, to int64) []schema.CoinHistoricalPrice {
+	sort.Slice(points, func(i, j int) bool { return points[i].timestamp < points[j].timestamp })
+	var prices []schema.CoinHistoricalPrice
+	for _, point := range points {
+		if point.timestamp < from || point.timestamp > to || point.price <= 0 {
+			continue
+		}
+		price := schema.CoinHistoricalPrice{
+			CoinID:      coinID,
+			Date:        shared.BucketStart(granularity, point.timestamp),
+			DayDate:     shared.BucketDate(granularity, point.timestamp),
+			Granularity: granularity,
+			Price:       strconv.FormatFloat(point.price, 'f', -1, 64),
+			Source:      source,
+		}
+		if n := len(prices); n > 0 && prices[n-1].DayDate == price.DayDate {
+			prices[n-1] = price
+			continue
+		}
+		prices = append(prices, price)
+	}
+	return prices
+}
+
+// rangeBuckets 返回 [from, to] 内各时间段的 day_date 及起始时间，按时间升序
+func rangeBuckets(granularity string, from, to int64) ([]string, map[string]int64) {
+	var dayDates []string
+	starts := make(map[string]int64)
+	step := int64(shared.GranularityDuration(granularity).Seconds())
+	for ts := shared.BucketStart(granularity, from); ts <= to; ts += step {
+		// 按天时夏令时切换会使时间段长度不等于 24 小时，以 day_date 去重
+		dayDate := shared.BucketDate(granularity, ts)
+		if _, ok := starts[dayDate]; ok {
+			continue
+		}
+		dayDates = append(dayDates, dayDate)
+		starts[dayDate] = shared.BucketStart(granularity, ts)
+	}
+	return dayDates, starts
+}
+
+// GetHistoricalPriceRange 先读取已保存的价格，缺少的时间段按数据源顺序各请求一次区间接口补全
+func (s *priceService) GetHistoricalPriceRange(chainId, address string, from, to int64, granularity string) (*PriceSeries, error) {
+	if granularity == "" {
+		granularity = shared.GranularityDay
+	}
+	if now := time.Now().Unix(); to <= 0 || to > now {
+		to = now
+	}
+	if from > to {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	dayDates, starts := rangeBuckets(granularity, from, to)
+	if len(dayDates) > maxRangePoints {
+		return nil, fmt.Errorf("range contains %d intervals, at most %d are allowed", len(dayDates), maxRangePoints)
+	}
+	from = starts[dayDates[0]]
+	// 按天保存的价格时间可能是当天任意时刻，查询到最后一个时间段结束
+	until := shared.BucketStart(granularity, to) + int64(shared.GranularityDuration(granularity).Seconds()) - 1
+
+	address = shared.NormalizeAddress(chainId, address)
+	coin, err := s.coinRepository.GetCoinsByOneID(chainId + "_" + address)
+	if err != nil {
+		return nil, err
+	}
+	queryChainId, queryAddress := chainId, address
+	if coin != nil && coin.ChainID != "" && coin.Address != "" {
+		queryChainId, queryAddress = coin.ChainID, coin.Address
+	}
+
+	points := make(map[string]PricePoint, len(dayDates))
+	// 已有价格的时间段不被后续数据源覆盖
+	merge := func(prices []schema.CoinHistoricalPrice, source string) {
+		for _, price := range prices {
+			start, ok := starts[price.DayDate]
+			if _, exists := points[price.DayDate]; !ok || exists || price.Price == "" {
+				continue
+			}
+			point := PricePoint{TimeStamp: start, Price: price.Price, Source: source}
+			if point.Source == "" {
+				point.Source = price.Source
+			}
+			points[price.DayDate] = point
+		}
+	}
+	stored, err := s.historicalRepo.GetPriceRange(queryChainId+"_"+queryAddress, granularity, from, until)
+	if err != nil {
+		s.logger.Err(err).Msgf("读取历史价格区间失败 %s_%s", queryChainId, queryAddress)
+	}
+	merge(stored, "")
+
+	if len(points) < len(dayDates) {
+		if coin != nil && s.isDerived(*coin) {
+			s.derivedPriceRange(coin, granularity, dayDates, starts, points)
+		} else {
+			for _, provider := range capableProviders[RangePriceProvider](s, queryChainId, coin) {
+				throttleKey := rangeThrottleKey(queryChainId, queryAddress, granularity, provider.Name())
+				if s.throttler.IsCoinsThrottled(throttleKey) {
+					continue
+				}
+				before := len(points)
+				status := "200"
+				prices, err := provider.GetPriceRange(queryChainId, queryAddress, from, until, granularity)
+				if err != nil {
+					if strings.Contains(err.Error(), "429") {
+						status = "429"
+					}
+					s.logger.Err(err).Msgf("GetHistoricalPriceRange 获取%s价格失败 %s_%s", provider.Name(), queryChainId, queryAddress)
+				}
+				merge(prices, provider.Name())
+				if len(points) == len(dayDates) {
+					break
+				}
+				if len(points) > before {
+					continue
+				}
+				if s.throttler.CoinsThrottle(throttleKey, status) {
+					s.slack.SaveLog(context.Background(), "priceService-GetHistoricalPriceRange", queryChainId, queryAddress, time.Unix(from, 0).Format("2006-01-02"), time.Now().Unix())
+				}
+			}
+		}
+	}
+
+	series := &PriceSeries{ChainID: chainId, Address: address, Interval: granularity, From: from, To: to, Prices: []PricePoint{}}
+	for _, dayDate := range dayDates {
+		if point, ok := points[dayDate]; ok {
+			series.Prices = append(series.Prices, point)
+		}
+	}
+	return series, nil
+}
+
+// rangeThrottleKey 区间价格请求按代币、粒度及数据源节流的 key
+func rangeThrottleKey(chainId, address, granularity, source string) string {
+	return fmt.Sprintf("%s_%s_range_%s_%s", chainId, address, granularity, source)
+}
+
+// RangeThrottled 代币被节流，或者代币不是衍生代币且所有可用的区间数据源都被节流时返回 true
+func (s *priceService) RangeThrottled(chainId, address, granularity string) bool {
+	address = shared.NormalizeAddress(chainId, address)
+	if s.throttler.IsCoinsThrottled(chainId + "_" + address) {
+		return true
+	}
+	coin, err := s.coinRepository.GetCoinsByOneID(chainId + "_" + address)
+	if err != nil || (coin != nil && s.isDerived(*coin)) {
+		return false
+	}
+	queryChainId, queryAddress := chainId, address
+	if coin != nil && coin.ChainID != "" && coin.Address != "" {
+		queryChainId, queryAddress = coin.ChainID, coin.Address
+	}
+	providers := capableProviders[RangePriceProvider](s, queryChainId, coin)
+	for _, provider := range providers {
+		if !s.throttler.IsCoinsThrottled(rangeThrottleKey(queryChainId, queryAddress, granularity, provider.Name())) {
+			return false
+		}
+	}
+	return len(providers) > 0
+}
+
+// derivedPriceRange LP 代币、包装代币及合成价格没有区间接口，缺少的时间段逐个按底层代币估值
+func (s *priceService) derivedPriceRange(coin *schema.Coins, granularity string, dayDates []string, starts map[string]int64, points map[string]PricePoint) {
+	var chainIds, addresses, datesStr []string
+	var unixTimeStamps []int64
+	for _, dayDate := range dayDates {
+		if _, ok := points[dayDate]; ok {
+			continue
+		}
+		chainIds = append(chainIds, coin.ChainID)
+		addresses = append(addresses, coin.Address)
+		unixTimeStamps = append(unixTimeStamps, starts[dayDate])
+		datesStr = append(datesStr, strconv.FormatInt(starts[dayDate], 10))
+	}
+	results, err := s.batchHistoricalPrice(0, granularity, chainIds, addresses, nil, nil, unixTimeStamps, datesStr)
+	if err != nil {
+		s.logger.Err(err).Msgf("GetHistoricalPriceRange 估值失败 %s", coin.ID)
+		return
+	}
+	for i, result := range results {
+		if result.Price == nil || *result.Price == "" {
+			continue
+		}
+		point := PricePoint{TimeStamp: unixTimeStamps[i], Price: *result.Price}
+		if result.Source != nil {
+			point.Source = *result.Source
+		}
+		points[shared.BucketDate(granularity, unixTimeStamps[i])] = point
+	}
+}
+
+// capableProviders 返回实现了 T 的历史价格数据源，币种指定的数据源优先，未收录的币种跳过只查询已收录币种的数据源
+func capableProviders[T PriceProvider](s *priceService, chainId string, coin *schema.Coins) []T {
+	var preferred string
+	if coin != nil {
+		preferred = preferredPriceSource(*coin)
+	}
+	var providers []T
+	for _, provider := range s.historicalProviders(chainId) {
+		capable, ok := provider.(T)
+		if !ok || (provider.ListedCoinsOnly() && coin == nil) {
+			continue
+		}
+		if provider.Name() == preferred {
+			providers = append([]T{capable}, providers...)
+			continue
+		}
+		providers = append(providers, capable)
+	}
+	return providers
+}
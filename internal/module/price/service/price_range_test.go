@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceService_HistoricalPriceRange(t *testing.T) {
+	// 区间内的每个小时取最后一个价格作为收盘价，区间外的价格被忽略
+	closes := closesByBucket("1_0xa", SourceGeckoTerminal, shared.GranularityHour, []rangePoint{
+		{timestamp: 3700, price: 2}, {timestamp: 3600, price: 1}, {timestamp: 7300, price: 3}, {timestamp: 11000, price: 4},
+	}, 3600, 10799)
+	if assert.Len(t, closes, 2) {
+		assert.Equal(t, "2", closes[0].Price)
+		assert.Equal(t, int64(3600), closes[0].Date)
+		assert.Equal(t, "3", closes[1].Price)
+		assert.Equal(t, int64(7200), closes[1].Date)
+	}
+	dayDates, starts := rangeBuckets(shared.GranularityHour, 3700, 10800)
+	assert.Len(t, dayDates, 3)
+	assert.Equal(t, int64(10800), starts[dayDates[2]])
+
+	historicalRepo := &stubHistoricalPriceRepo{saved: []schema.CoinHistoricalPrice{
+		{CoinID: "1_0xa", Date: 3600, DayDate: shared.BucketDate(shared.GranularityHour, 3600), Granularity: shared.GranularityHour, Price: "1.5", Source: SourceCoinGecko},
+	}}
+	listed := stubRangeProvider{&stubProvider{name: SourceCoinGecko, listedOnly: true, points: []rangePoint{{timestamp: 7200, price: 9}}}}
+	terminal := stubRangeProvider{&stubProvider{name: SourceGeckoTerminal, points: []rangePoint{{timestamp: 3600, price: 1}, {timestamp: 7300, price: 2}}}}
+	redisClient, stub := newStubRedisClient()
+	s := &priceService{
+		providers:             NewPriceProviderRegistry([]PriceProvider{listed, terminal, &stubProvider{name: SourceDefiLlama}}),
+		historicalSourceOrder: newSourceOrder(koanf.New("."), "sourceOrder.historical", []string{SourceCoinGecko, SourceDefiLlama, SourceGeckoTerminal}),
+		coinRepository:        stubCoinRepo{},
+		historicalRepo:        historicalRepo,
+		throttler:             shared.NewCoinsThrottler(redisClient, zerolog.Nop(), stubCoinRepo{}),
+		slack:                 &stubSlackService{},
+		logger:                zerolog.Nop(),
+	}
+
+	// 已保存的时间段不覆盖，未收录的币种跳过只查询已收录币种的数据源
+	series, err := s.GetHistoricalPriceRange("1", "0xA", 3600, 7300, shared.GranularityHour)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xa", series.Address)
+	assert.Equal(t, []PricePoint{
+		{TimeStamp: 3600, Price: "1.5", Source: SourceCoinGecko},
+		{TimeStamp: 7200, Price: "2", Source: SourceGeckoTerminal},
+	}, series.Prices)
+	assert.Equal(t, 0, listed.calls)
+	assert.Equal(t, 1, terminal.calls)
+
+	// 数据源返回 429 后该数据源的区间请求被节流，所有数据源都被节流时代币不能回填
+	assert.False(t, s.RangeThrottled("1", "0xa", shared.GranularityHour))
+	terminal.err = fmt.Errorf("429 Too Many Requests")
+	_, err = s.GetHistoricalPriceRange("1", "0xa", 3600, 11000, shared.GranularityHour)
+	assert.NoError(t, err)
+	_, throttled := stub.get(shared.CoinsThrottlePrefix + rangeThrottleKey("1", "0xa", shared.GranularityHour, SourceGeckoTerminal))
+	assert.True(t, throttled)
+	assert.True(t, s.RangeThrottled("1", "0xa", shared.GranularityHour))
+	calls := terminal.calls
+	_, err = s.GetHistoricalPriceRange("1", "0xa", 3600, 11000, shared.GranularityHour)
+	assert.NoError(t, err)
+	assert.Equal(t, calls, terminal.calls)
+
+	_, err = s.GetHistoricalPriceRange("1", "0xa", 7300, 3600, shared.GranularityHour)
+	assert.Error(t, err)
+	_, err = s.GetHistoricalPriceRange("1", "0xa", 0, 3600*2000, shared.GranularityHour)
+	assert.Error(t, err)
+}
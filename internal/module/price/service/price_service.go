@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,22 +21,31 @@ import (
 
 type PriceService interface {
 	GetPrice(chainId, address, symbol, network string, useCache bool, excludeRoute bool) (*string, error)
-	GetHistoricalPrice(chainId, address, symbol, network string, unixTimeStamp int64) (*string, error)
+	GetHistoricalPrice(chainId, address, symbol, network string, unixTimeStamp int64, granularity string) (*string, error)
 	GetBatchPrice(ctx context.Context, chainIds []string, addresses []string, symbols []string, networks []string, useCache bool, excludeRoute bool) ([]PriceResult, error)
-	GetBatchHistoricalPrice(chainIds []string, addresses []string, symbols []string, networks []string, unixTimeStamp []int64, datesStr []string) ([]PriceResult, error)
+	GetBatchHistoricalPrice(chainIds []string, addresses []string, symbols []string, networks []string, unixTimeStamp []int64, datesStr []string, granularity string) ([]PriceResult, error)
+	GetHistoricalPriceRange(chainId, address string, from, to int64, granularity string) (*PriceSeries, error)
+	// RangeThrottled 返回代币的区间价格请求当前是否被节流
+	RangeThrottled(chainId, address, granularity string) bool
+	GetOhlcv(chainId, address string, from, to int64, timeframe string) (*CandleSeries, error)
+	FillPriceChanges(results []PriceResult, windows []string)
+	FillMarketData(ctx context.Context, results []PriceResult, unixTimeStamps []int64)
 }
 
 type priceService struct {
-	coinGeckoService        CoinGeckoService
-	geckoTerminalService    GeckoTerminalService
-	coinGeckoOnChainService CoinGeckoOnChainService
-	defiLlamaService        DefiLlamaService
-	dodoexRouteService      DodoexRouteService
-	coinRepository          repository.CoinRepository
-	throttler               *shared.CoinsThrottler
-	slack                   SlackNotificationService
-	redisClient             *shared.RedisClient
-	logger                  zerolog.Logger
+	providers      PriceProviderRegistry
+	guard          PriceGuardService
+	pegs           PegService
+	lpTokens       LpTokenService
+	wrappers       WrapperService
+	coinRepository repository.CoinRepository
+	historicalRepo repository.CoinHistoricalPriceRepository
+	candleRepo     repository.CoinCandleRepository
+	marketDataRepo repository.CoinMarketDataRepository
+	throttler      *shared.CoinsThrottler
+	slack          SlackNotificationService
+	redisClient    *shared.RedisClient
+	logger         zerolog.Logger
 
 	keysRequestIDMap            sync.Map      // key: priceKey, value: requestIDs
 	requestIDChannelMap         sync.Map      // key: requestID, value: channel
@@ -44,11 +54,14 @@ type priceService struct {
 	processTimeOut              time.Duration //任务超时
 	prohibitedSourcesCurrent    map[string]bool
 	prohibitedSourcesHistorical map[string]bool
+	currentSourceOrder          sourceOrder // 当前价格数据源顺序
+	historicalSourceOrder       sourceOrder // 历史价格数据源顺序
+	consensus                   consensusConfig
 	fetchSize                   int64 //每次从redis 取多少
 	batchSize                   int64 //每个协程处理多少
 }
 
-func NewPriceService(cfg *koanf.Koanf, slack SlackNotificationService, coinGeckoService CoinGeckoService, geckoTerminalService GeckoTerminalService, defiLlamaService DefiLlamaService, dodoexRouteService DodoexRouteService, coinGeckoOnChainService CoinGeckoOnChainService, coinRepository repository.CoinRepository, logger zerolog.Logger, throttler *shared.CoinsThrottler, redisClient *shared.RedisClient) PriceService {
+func NewPriceService(cfg *koanf.Koanf, slack SlackNotificationService, providers PriceProviderRegistry, guard PriceGuardService, pegs PegService, lpTokens LpTokenService, wrappers WrapperService, coinRepository repository.CoinRepository, historicalRepo repository.CoinHistoricalPriceRepository, candleRepo repository.CoinCandleRepository, marketDataRepo repository.CoinMarketDataRepository, logger zerolog.Logger, throttler *shared.CoinsThrottler, redisClient *shared.RedisClient) PriceService {
 	// 读取当前价格禁止数据源配置
 	prohibitedCurrent := cfg.MapKeys("prohibitedSources.current")
 	prohibitedSourcesCurrent := make(map[string]bool, len(prohibitedCurrent))
@@ -64,6 +77,14 @@ func NewPriceService(cfg *koanf.Koanf, slack SlackNotificationService, coinGecko
 			prohibitedSourcesHistorical[v] = true
 		}
 	}
+	currentSourceOrder := newSourceOrder(cfg, "sourceOrder.current", defaultCurrentSourceOrder)
+	historicalSourceOrder := newSourceOrder(cfg, "sourceOrder.historical", defaultHistoricalSourceOrder)
+	consensus := newConsensusConfig(cfg)
+	for _, source := range append(append(currentSourceOrder.sources(), historicalSourceOrder.sources()...), consensus.sources...) {
+		if _, ok := providers.Get(source); !ok {
+			logger.Warn().Msgf("配置中的数据源 %s 未注册，将被忽略", source)
+		}
+	}
 	processTime := cfg.Duration("price.processTime")
 	if processTime == 0 {
 		processTime = 10 * time.Millisecond
@@ -86,19 +107,26 @@ func NewPriceService(cfg *koanf.Koanf, slack SlackNotificationService, coinGecko
 	// fetchSize = 200
 	// batchSize = 1
 	s := &priceService{
-		coinGeckoService:            coinGeckoService,
-		geckoTerminalService:        geckoTerminalService,
-		coinGeckoOnChainService:     coinGeckoOnChainService,
-		defiLlamaService:            defiLlamaService,
-		dodoexRouteService:          dodoexRouteService,
+		providers:                   providers,
+		guard:                       guard,
+		pegs:                        pegs,
+		lpTokens:                    lpTokens,
+		wrappers:                    wrappers,
 		coinRepository:              coinRepository,
+		historicalRepo:              historicalRepo,
+		candleRepo:                  candleRepo,
+		marketDataRepo:              marketDataRepo,
 		throttler:                   throttler,
 		redisClient:                 redisClient,
 		slack:                       slack,
+		logger:                      logger,
 		processTime:                 processTime,    // 设置任务拉取时间
 		processTimeOut:              processTimeOut, // 设置任务执行超时时间
 		prohibitedSourcesCurrent:    prohibitedSourcesCurrent,
 		prohibitedSourcesHistorical: prohibitedSourcesHistorical,
+		currentSourceOrder:          currentSourceOrder,
+		historicalSourceOrder:       historicalSourceOrder,
+		consensus:                   consensus,
 		fetchSize:                   fetchSize,
 		batchSize:                   batchSize,
 	}
@@ -126,10 +154,10 @@ func (s *priceService) GetPrice(chainId, address, symbol, network string, useCac
 		}
 		return nil, nil
 	}
-	address = strings.ToLower(address)
+	address = shared.NormalizeAddress(chainId, address)
 	// 使用缓存
-	requestKey := generateHashKey(chainId, strings.ToLower(address), safeDereferenceString(&symbol, ""), network)
-	if value, found := s.WaitForResult(chainId, strings.ToLower(address)); found && value != nil && *value != "" {
+	requestKey := generateHashKey(chainId, address, safeDereferenceString(&symbol, ""), network)
+	if value, found := s.WaitForResult(chainId, address); found && value != nil && *value != "" {
 		return value, nil
 	}
 	requestID := generateRequestID(chainId, address, safeDereferenceString(&symbol, ""), network)
@@ -167,7 +195,7 @@ func (s *priceService) GetPrice(chainId, address, symbol, network string, useCac
 	case flag := <-resultChannel:
 		if flag == "ok" {
 			// 等待一批结果
-			if value, found := s.WaitForResult(chainId, strings.ToLower(address)); found {
+			if value, found := s.WaitForResult(chainId, address); found {
 				if (value == nil || *value == "") && !excludeRoute {
 					results, err := s.FetchAndProcessBatchPrices(context.Background(), []string{chainId}, []string{address}, []string{safeDereferenceString(&symbol, "")}, []string{network}, useCache, excludeRoute)
 					if err != nil {
@@ -221,7 +249,7 @@ func (s *priceService) GetBatchPrice(ctx context.Context, chainIds []string, add
 	resultFutures := make([]*redis.StringCmd, len(chainIds)) // 保存管道的未来结果
 
 	for i := 0; i < len(chainIds); i++ {
-		resultKey := fmt.Sprintf("price_result:%s", strings.Join([]string{chainIds[i], strings.ToLower(addresses[i])}, "_"))
+		resultKey := fmt.Sprintf("price_result:%s", strings.Join([]string{chainIds[i], shared.NormalizeAddress(chainIds[i], addresses[i])}, "_"))
 		resultFutures[i] = pipe.Get(context.Background(), resultKey)
 	}
 	// 执行 Redis 管道
@@ -242,7 +270,7 @@ func (s *priceService) GetBatchPrice(ctx context.Context, chainIds []string, add
 			// 将需要发送到 Redis 的请求记录下来
 			symbol := GetOrDefault(symbols, i, "")
 			network := GetOrDefault(networks, i, "")
-			requestKey := generateHashKey(chainIds[i], strings.ToLower(addresses[i]), symbol, network)
+			requestKey := generateHashKey(chainIds[i], shared.NormalizeAddress(chainIds[i], addresses[i]), symbol, network)
 			requestKeys[i] = requestKey
 			requestKeyMap[requestKey] = true
 
@@ -257,7 +285,7 @@ func (s *priceService) GetBatchPrice(ctx context.Context, chainIds []string, add
 			} else {
 				s.keysRequestIDMap.Store(requestKey, []string{requestID})
 			}
-			requestInfo := fmt.Sprintf("%s|%s|%s|%s|%s", requestKey, chainIds[i], strings.ToLower(addresses[i]), symbol, network)
+			requestInfo := fmt.Sprintf("%s|%s|%s|%s|%s", requestKey, chainIds[i], shared.NormalizeAddress(chainIds[i], addresses[i]), symbol, network)
 			requestInfos[i] = requestInfo
 		}
 	}
@@ -326,11 +354,15 @@ func (s *priceService) WaitForBatchResults(chainIds []string, addresses []string
 	results := make([]PriceResult, len(chainIds))
 	pipe := s.redisClient.Client.Pipeline()                  // 创建 Redis 管道
 	resultFutures := make([]*redis.StringCmd, len(chainIds)) // 保存未来结果的引用
+	provenanceFutures := make([]*redis.StringCmd, len(chainIds))
 
 	// 构造请求并添加到管道
 	shouldExecutePipeline := false // 标记是否需要执行 Redis 管道
 
 	for idx, address := range addresses {
+		provenanceKey := fmt.Sprintf("%s%s_%s", priceResultProvenancePrefix, chainIds[idx], shared.NormalizeAddress(chainIds[idx], address))
+		provenanceFutures[idx] = pipe.Get(context.Background(), provenanceKey)
+		shouldExecutePipeline = true
 		if result, ok := resultMap[idx]; ok {
 			// 如果 resultMap 中已经有结果，直接使用
 			results[idx] = PriceResult{
@@ -344,7 +376,7 @@ func (s *priceService) WaitForBatchResults(chainIds []string, addresses []string
 			}
 		} else {
 			// 如果没有缓存结果，将请求添加到 Redis 管道中
-			resultKey := fmt.Sprintf("price_result:%s_%s", chainIds[idx], strings.ToLower(address))
+			resultKey := fmt.Sprintf("price_result:%s_%s", chainIds[idx], shared.NormalizeAddress(chainIds[idx], address))
 			resultFutures[idx] = pipe.Get(context.Background(), resultKey)
 			shouldExecutePipeline = true // 标记需要执行管道
 		}
@@ -367,7 +399,7 @@ func (s *priceService) WaitForBatchResults(chainIds []string, addresses []string
 		}
 		price, err := cmd.Result()
 		if err != nil {
-			s.logger.Debug().Err(err).Msgf("Failed to get price for key %s", fmt.Sprintf("price_result:%s_%s", chainIds[idx], strings.ToLower(addresses[idx])))
+			s.logger.Debug().Err(err).Msgf("Failed to get price for key %s", fmt.Sprintf("price_result:%s_%s", chainIds[idx], shared.NormalizeAddress(chainIds[idx], addresses[idx])))
 		}
 		if price != "-1" {
 			// 正常获取价格
@@ -393,6 +425,18 @@ func (s *priceService) WaitForBatchResults(chainIds []string, addresses []string
 		}
 	}
 
+	// 补充队列结果缓存中的来源信息
+	for idx, cmd := range provenanceFutures {
+		if results[idx].Price == nil {
+			continue
+		}
+		if data, err := cmd.Result(); err == nil {
+			if provenance, ok := unmarshalResultProvenance(data); ok {
+				results[idx].PriceProvenance = provenance
+			}
+		}
+	}
+
 	return results, nil
 }
 
@@ -494,6 +538,10 @@ func (s *priceService) ProcessPriceRequests() {
 						s.logger.Err(err).Msg("Failed to cache price result")
 						continue
 					}
+					if result.Price != nil {
+						provenanceKey := fmt.Sprintf("%s%s_%s", priceResultProvenancePrefix, result.ChainID, result.Address)
+						s.redisClient.Client.Set(ctx, provenanceKey, marshalResultProvenance(result.PriceProvenance), time.Minute*5)
+					}
 
 					// 通知生产者，传递哈希键
 					s.NotifyProducer("price_results_channel", resultKey, requestKeys[i])
@@ -579,16 +627,16 @@ func (s *priceService) processMessage(msg *redis.Message) {
 
 func (s *priceService) FetchAndProcessBatchPrices(ctx context.Context, chainIds []string, addresses []string, symbols []string, networks []string, isCache bool, excludeRoute bool) ([]PriceResult, error) {
 	// 在执行耗时操作前和期间检查 ctx 的状态
-	lowerAddresses := make([]string, len(addresses))
+	normalizedAddresses := make([]string, len(addresses))
 	resultsMap := make(map[string]PriceResult)
 	for i, addr := range addresses {
-		lowerAddresses[i] = strings.ToLower(addr)
+		normalizedAddresses[i] = shared.NormalizeAddress(chainIds[i], addr)
 	}
 
 	// 根据地址和链ID获取coin数据
 	ids := make([]string, len(addresses))
 	idToIndexMap := make(map[string]int)
-	for i, addr := range lowerAddresses {
+	for i, addr := range normalizedAddresses {
 		id := chainIds[i] + "_" + addr
 		ids[i] = id
 		idToIndexMap[id] = i
@@ -612,57 +660,61 @@ func (s *priceService) FetchAndProcessBatchPrices(ctx context.Context, chainIds
 			retrunCoinToMap[returnCoinId] = append(retrunCoinToMap[returnCoinId], coin.ID) // 追加到切片
 		}
 	}
-	geckoIDsSetSource := make(map[string]struct{})
-	terminalIDsSetSource := make(map[string]struct{})
-	llamaIDsSetSource := make(map[string]struct{})
-	geckoOnChainIDsSetSource := make(map[string]struct{})
-	// 初始化来源映射
-	geckoIDsSet := make(map[string]struct{})
-	terminalIDsSet := make(map[string]struct{})
-	llamaIDsSet := make(map[string]struct{})
-	dodoexIDsSet := make(map[string]struct{})
-	geckoOnChainIDsSet := make(map[string]struct{})
-	// 填充映射
+
+	// LP 代币和包装代币按底层代币价格估值，不查询数据源
+	derived := make(map[string]derivedRequest)
+	for _, coin := range coins {
+		if s.isDerived(coin) {
+			derived[coin.ID] = derivedRequest{coin: coin}
+		}
+	}
+
+	// 待查询的 ID 及其指定数据源
+	pending := make(map[string]struct{}, len(ids))
+	preferred := make(map[string]string)
 	for _, id := range ids {
-		parts := strings.Split(id, "_")
-		coinID := fmt.Sprintf("%s_%s", parts[0], parts[1])
-		if coin, exists := coinMap[coinID]; exists {
-			if coin.PriceSource != nil && (*coin.PriceSource == "coingecko") {
-				geckoIDsSetSource[id] = struct{}{}
-			} else if coin.PriceSource != nil && *coin.PriceSource == "geckoterminal" {
-				terminalIDsSetSource[id] = struct{}{}
-			} else if coin.PriceSource != nil && *coin.PriceSource == "coinGeckoOnChain" {
-				geckoOnChainIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "coingecko" {
-				geckoIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "geckoterminal" {
-				terminalIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "defillama" {
-				llamaIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "coinGeckoOnChain" {
-				geckoOnChainIDsSetSource[id] = struct{}{}
+		if _, ok := derived[id]; ok {
+			continue
+		}
+		pending[id] = struct{}{}
+		if coin, exists := coinMap[id]; exists {
+			if source := preferredPriceSource(coin); source != "" {
+				preferred[id] = source
 			}
-			geckoIDsSet[id] = struct{}{}
 		}
-		terminalIDsSet[id] = struct{}{}
-		llamaIDsSet[id] = struct{}{}
-		geckoOnChainIDsSet[id] = struct{}{}
-		if !excludeRoute {
-			dodoexIDsSet[id] = struct{}{}
+	}
+
+	// 价格校验使用的最近已知价格及币种 label，按实际查询的 ID 索引
+	queryLabels := make(map[string]string)
+	for _, id := range ids {
+		queryId := id
+		if retrunCoinId, exists := retrunCoinMap[id]; exists {
+			queryId = retrunCoinId
+		}
+		if queryLabels[queryId] == "" {
+			queryLabels[queryId] = coinMap[id].Label
 		}
 	}
-	// 批量查询指定数据源的历史价格
-	batchQuery := func(source string, idSet map[string]struct{}) {
-		if prohibited, ok := s.prohibitedSourcesCurrent[source]; ok && prohibited {
-			return
+	var references map[string]float64
+	if s.guard.Enabled() {
+		queryIds := make([]string, 0, len(queryLabels))
+		for queryId := range queryLabels {
+			queryIds = append(queryIds, queryId)
 		}
-		var bChainIds, bAddresses, bSymbols, bNetworks []string
+		references = s.guard.LastKnownPrices(queryIds)
+	}
 
+	// 组装批量查询参数，被节流的 ID 直接返回空价格
+	buildBatch := func(idSet map[string]struct{}) (bChainIds, bAddresses, bSymbols, bNetworks []string) {
 		for id := range idSet {
+			if _, ok := pending[id]; !ok {
+				continue
+			}
 			index := idToIndexMap[id]
 			if s.throttler.IsCoinsThrottled(id) {
-				resultsMap[id] = PriceResult{ChainID: chainIds[index], Address: lowerAddresses[index], Price: nil, Symbol: GetOrNil(symbols, index), Network: GetOrNil(networks, index), TimeStamp: "0"}
-				s.slack.SaveLog(context.Background(), "priceService-GetBatchPrice", chainIds[index], lowerAddresses[index], time.Now().Format("2006-01-02"), time.Now().Unix())
+				resultsMap[id] = PriceResult{ChainID: chainIds[index], Address: normalizedAddresses[index], Price: nil, Symbol: GetOrNil(symbols, index), Network: GetOrNil(networks, index), TimeStamp: "0"}
+				s.slack.SaveLog(context.Background(), "priceService-GetBatchPrice", chainIds[index], normalizedAddresses[index], time.Now().Format("2006-01-02"), time.Now().Unix())
+				delete(pending, id)
 				continue
 			}
 			if retrunCoinId, exists := retrunCoinMap[id]; exists {
@@ -670,84 +722,211 @@ func (s *priceService) FetchAndProcessBatchPrices(ctx context.Context, chainIds
 				bAddresses = append(bAddresses, strings.Split(retrunCoinId, "_")[1])
 			} else {
 				bChainIds = append(bChainIds, chainIds[index])
-				bAddresses = append(bAddresses, lowerAddresses[index])
+				bAddresses = append(bAddresses, normalizedAddresses[index])
 			}
 			bSymbols = append(bSymbols, GetOrDefault(symbols, index, ""))
 			bNetworks = append(bNetworks, GetOrDefault(networks, index, ""))
 		}
+		return
+	}
 
-		// 根据 source 调用不同的数据源方法
-		var results []PriceResult
-		var err error
-		switch source {
-		case "coingecko":
-			results, err = s.coinGeckoService.GetBatchPrice(bAddresses, bChainIds, bSymbols, bNetworks, isCache)
-		case "geckoterminal":
-			results, err = s.geckoTerminalService.GetBatchCurrentPrices(bAddresses, bChainIds, bSymbols, bNetworks, isCache)
-		case "defillama":
-			results, err = s.defiLlamaService.GetBatchCurrentPrices(bAddresses, bChainIds, bSymbols, bNetworks, isCache)
-		case "coinGeckoOnChain":
-			results, err = s.coinGeckoOnChainService.GetBatchCurrentPricesOnChain(bAddresses, bChainIds, bSymbols, bNetworks, isCache)
-		case "dodoexRoute":
-			results, err = s.dodoexRouteService.GetBatchCurrentPrices(bAddresses, bChainIds, bSymbols, bNetworks, isCache)
-		}
-
-		if err == nil {
-			for _, result := range results {
-				key := result.ChainID + "_" + result.Address
-				if result.Price != nil && *result.Price != "" {
-					resultsMap[key] = result
-					if coinIds, exists := retrunCoinToMap[key]; exists {
-						for _, coinId := range coinIds {
-							result.ChainID = strings.Split(coinId, "_")[0]
-							result.Address = strings.Split(coinId, "_")[1]
-							resultsMap[coinId] = result
-						}
+	// 查询数据源，返回查到价格的 ID（包含关联的 coins）及其结果
+	fetch := func(provider PriceProvider, bChainIds, bAddresses, bSymbols, bNetworks []string) map[string]PriceResult {
+		results, err := provider.GetBatchCurrentPrices(bAddresses, bChainIds, bSymbols, bNetworks, isCache)
+		if err != nil {
+			s.logger.Err(err).Msgf("GetBatchPrice 获取%s价格失败", provider.Name())
+			return nil
+		}
+		// 命中缓存但没有返回缓存时长的结果，根据当前价格缓存的剩余 TTL 计算
+		var cachedKeys []string
+		for _, result := range results {
+			if result.FromCache != nil && *result.FromCache && result.CacheAge == nil {
+				cachedKeys = append(cachedKeys, result.ChainID+"_"+result.Address)
+			}
+		}
+		cacheAges := s.redisClient.GetCurrentPriceCacheAges(cachedKeys)
+		now := time.Now().Unix()
+		found := make(map[string]PriceResult)
+		for _, result := range results {
+			key := result.ChainID + "_" + result.Address
+			if result.Price != nil && *result.Price != "" {
+				// 与最近已知价格偏差过大的报价被拒绝，继续查询下一个数据源
+				cached := result.FromCache != nil && *result.FromCache
+				if !s.guard.Check(key, queryLabels[key], provider.Name(), *result.Price, cached, references[key]) {
+					continue
+				}
+				s.pegs.Observe(key, provider.Name(), *result.Price, cached)
+				if age, ok := cacheAges[key]; ok && result.CacheAge == nil {
+					result.CacheAge = &age
+				}
+				result.PriceProvenance = result.PriceProvenance.complete(provider.Name(), now)
+				found[key] = result
+				if coinIds, exists := retrunCoinToMap[key]; exists {
+					for _, coinId := range coinIds {
+						result.ChainID = strings.Split(coinId, "_")[0]
+						result.Address = strings.Split(coinId, "_")[1]
+						found[coinId] = result
 					}
-					// 删除其他数据源集合中的 ID
-					delete(geckoIDsSet, key)
-					delete(terminalIDsSet, key)
-					delete(llamaIDsSet, key)
-					delete(dodoexIDsSet, key)
-					delete(geckoOnChainIDsSet, key)
 				}
 			}
-		} else {
-			s.logger.Err(err).Msgf("GetBatchPrice 获取%s价格失败", source)
 		}
+		return found
 	}
-	//查询指定数据源
-	if len(geckoIDsSetSource) > 0 {
-		batchQuery("coingecko", geckoIDsSetSource)
+
+	// 批量查询指定数据源的当前价格
+	batchQuery := func(provider PriceProvider, idSet map[string]struct{}) {
+		bChainIds, bAddresses, bSymbols, bNetworks := buildBatch(idSet)
+		if len(bAddresses) == 0 {
+			return
+		}
+		for id, result := range fetch(provider, bChainIds, bAddresses, bSymbols, bNetworks) {
+			resultsMap[id] = result
+			delete(pending, id)
+		}
 	}
-	if len(terminalIDsSetSource) > 0 {
-		batchQuery("geckoterminal", terminalIDsSetSource)
+
+	chainProviders := make(map[string][]PriceProvider)
+	providersOf := func(id string) []PriceProvider {
+		chainId := chainIds[idToIndexMap[id]]
+		if _, ok := chainProviders[chainId]; !ok {
+			chainProviders[chainId] = s.currentProviders(chainId, excludeRoute)
+		}
+		return chainProviders[chainId]
 	}
-	if len(llamaIDsSetSource) > 0 {
-		batchQuery("defillama", llamaIDsSetSource)
+	listedFor := func(provider PriceProvider, id string) bool {
+		_, listed := coinMap[id]
+		return listed || !provider.ListedCoinsOnly()
 	}
 
-	// 数据源顺序查询
-	// 查询剩余的默认数据源
-	if len(geckoIDsSet) > 0 {
-		batchQuery("coingecko", geckoIDsSet)
-	}
-	if len(llamaIDsSet) > 0 {
-		batchQuery("defillama", llamaIDsSet)
+	// 共识模式下先并行查询多个数据源，已经查询过的数据源不再参与后续的顺序查询
+	consensusTried := make(map[string]bool)
+	if s.consensus.enabled {
+		// 配置的共识数据源只保留该链数据源顺序中的数据源
+		chainConsensusProviders := make(map[string][]PriceProvider)
+		consensusProvidersOf := func(id string) []PriceProvider {
+			if len(s.consensus.sources) == 0 {
+				return providersOf(id)
+			}
+			chainId := chainIds[idToIndexMap[id]]
+			if providers, ok := chainConsensusProviders[chainId]; ok {
+				return providers
+			}
+			enabled := make(map[string]bool)
+			for _, provider := range providersOf(id) {
+				enabled[provider.Name()] = true
+			}
+			var providers []PriceProvider
+			for _, provider := range s.providers.Current(s.consensus.sources) {
+				if enabled[provider.Name()] {
+					providers = append(providers, provider)
+				}
+			}
+			chainConsensusProviders[chainId] = providers
+			return providers
+		}
+		var providers []PriceProvider
+		idSets := make(map[string]map[string]struct{})
+		for id := range pending {
+			for _, provider := range consensusProvidersOf(id) {
+				if !listedFor(provider, id) {
+					continue
+				}
+				if _, ok := idSets[provider.Name()]; !ok {
+					idSets[provider.Name()] = make(map[string]struct{})
+					providers = append(providers, provider)
+				}
+				idSets[provider.Name()][id] = struct{}{}
+				consensusTried[provider.Name()+"|"+id] = true
+			}
+		}
+
+		var wg sync.WaitGroup
+		found := make([]map[string]PriceResult, len(providers))
+		for i, provider := range providers {
+			bChainIds, bAddresses, bSymbols, bNetworks := buildBatch(idSets[provider.Name()])
+			if len(bAddresses) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, provider PriceProvider) {
+				defer wg.Done()
+				found[i] = fetch(provider, bChainIds, bAddresses, bSymbols, bNetworks)
+			}(i, provider)
+		}
+		wg.Wait()
+
+		foundBySource := make(map[string]map[string]PriceResult, len(providers))
+		for i, provider := range providers {
+			foundBySource[provider.Name()] = found[i]
+		}
+		var divergences []PriceDivergence
+		for id := range pending {
+			var quotes []sourceQuote
+			var first *PriceResult
+			for _, provider := range consensusProvidersOf(id) {
+				result, ok := foundBySource[provider.Name()][id]
+				if !ok {
+					continue
+				}
+				price, err := strconv.ParseFloat(*result.Price, 64)
+				if err != nil || price <= 0 {
+					continue
+				}
+				quotes = append(quotes, sourceQuote{source: provider.Name(), price: price})
+				if first == nil {
+					first = &result
+				}
+			}
+			if first == nil {
+				continue
+			}
+			result := *first
+			reached := len(quotes) >= s.consensus.minSources
+			result.Consensus = &reached
+			if reached {
+				price, deviation := s.consensus.aggregate(quotes)
+				priceStr := strconv.FormatFloat(price, 'f', -1, 64)
+				result.Price = &priceStr
+				source := SourceConsensus
+				result.Source = &source
+				if deviation > s.consensus.maxDeviation {
+					result.Divergent = true
+					prices := make(map[string]float64, len(quotes))
+					for _, quote := range quotes {
+						prices[quote.source] = quote.price
+					}
+					s.logger.Warn().Msgf("GetBatchPrice %s 数据源报价偏差 %.2f%%: %v", id, deviation, prices)
+					divergences = append(divergences, PriceDivergence{ChainID: result.ChainID, Address: result.Address, Prices: prices, Deviation: deviation})
+				}
+			} else {
+				// 报价不足时使用优先级最高的数据源的报价，并在来源信息中标记未达成共识
+				s.logger.Warn().Msgf("GetBatchPrice %s 只有 %d 个数据源报价，未达到共识所需的 %d 个", id, len(quotes), s.consensus.minSources)
+			}
+			resultsMap[id] = result
+			delete(pending, id)
+		}
+		// 同一批次的偏差告警合并为一次调用
+		if len(divergences) > 0 {
+			go s.slack.SaveDivergences(context.Background(), divergences)
+		}
 	}
-	if len(terminalIDsSet) > 0 {
-		batchQuery("geckoterminal", terminalIDsSet)
+
+	queryable := func(provider PriceProvider, id string) bool {
+		return listedFor(provider, id) && !consensusTried[provider.Name()+"|"+id]
 	}
-	if len(geckoOnChainIDsSet) > 0 {
-		batchQuery("coinGeckoOnChain", geckoOnChainIDsSet)
+	querySources(pending, preferred, providersOf, queryable, batchQuery)
+	for id, result := range s.derivedCurrentPrices(ctx, derived, isCache, excludeRoute) {
+		resultsMap[id] = result
 	}
-	if len(dodoexIDsSet) > 0 {
-		batchQuery("dodoexRoute", dodoexIDsSet)
+	// 锚定资产超出容忍范围的价格按配置截断或标记
+	for id, result := range resultsMap {
+		s.pegs.Apply(id, &result)
+		resultsMap[id] = result
 	}
 
 	results := make([]PriceResult, len(addresses))
 	for i, addr := range addresses {
-		key := chainIds[i] + "_" + strings.ToLower(addr)
+		key := shared.CoinID(chainIds[i], addr)
 		result, exists := resultsMap[key]
 		if !exists {
 			result = PriceResult{
@@ -776,16 +955,209 @@ func (s *priceService) FetchAndProcessBatchPrices(ctx context.Context, chainIds
 		}
 		results[i] = result
 	}
+	s.saveIntradaySnapshots(results)
+	s.saveMarketData(results, nil, coinMap)
 
 	return results, nil
 }
 
-func (s *priceService) GetHistoricalPrice(chainId, address, symbol, network string, unixTimeStamp int64) (*string, error) {
-	address = strings.ToLower(address)
+// saveIntradaySnapshots 将实时请求上游得到的价格按观测时间保存为小时及 5 分钟快照，缓存中的价格不保存
+func (s *priceService) saveIntradaySnapshots(results []PriceResult) {
+	var snapshots []schema.CoinHistoricalPrice
+	now := time.Now().Unix()
+	for _, result := range results {
+		if result.Price == nil || *result.Price == "" || result.FromCache == nil || *result.FromCache {
+			continue
+		}
+		observedAt := now
+		if result.ObservedAt != nil && *result.ObservedAt > 0 {
+			observedAt = *result.ObservedAt
+		}
+		snapshot := schema.CoinHistoricalPrice{
+			CoinID: shared.CoinID(result.ChainID, result.Address),
+			Date:   observedAt,
+			Price:  *result.Price,
+		}
+		if result.Source != nil {
+			snapshot.Source = *result.Source
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+	if err := s.historicalRepo.SaveIntradaySnapshots(snapshots); err != nil {
+		s.logger.Err(err).Msg("保存日内价格快照失败")
+	}
+}
+
+// preferredPriceSource 返回币种指定的数据源，没有指定时使用上一次成功的数据源
+func preferredPriceSource(coin schema.Coins) string {
+	if coin.PriceSource != nil && *coin.PriceSource != "" {
+		return *coin.PriceSource
+	}
+	if coin.LastPriceSource != nil && *coin.LastPriceSource != "" {
+		return *coin.LastPriceSource
+	}
+	return ""
+}
+
+// currentProviders 按指定链的顺序返回可用于查询当前价格的数据源
+func (s *priceService) currentProviders(chainId string, excludeRoute bool) []PriceProvider {
+	return s.filterCurrentProviders(s.providers.Current(s.currentSourceOrder.forChain(chainId)), excludeRoute)
+}
+
+// filterCurrentProviders 过滤掉被禁止的数据源，excludeRoute 时同时排除 dodoexRoute
+func (s *priceService) filterCurrentProviders(candidates []PriceProvider, excludeRoute bool) []PriceProvider {
+	var providers []PriceProvider
+	for _, provider := range candidates {
+		if s.prohibitedSourcesCurrent[provider.Name()] {
+			continue
+		}
+		if excludeRoute && provider.Name() == SourceDodoexRoute {
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// historicalProviders 按指定链的顺序返回可用于查询历史价格的数据源
+func (s *priceService) historicalProviders(chainId string) []PriceProvider {
+	var providers []PriceProvider
+	for _, provider := range s.providers.Historical(s.historicalSourceOrder.forChain(chainId)) {
+		if s.prohibitedSourcesHistorical[provider.Name()] {
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// granularityProviders 按粒度返回历史价格数据源，小时及 5 分钟粒度只使用支持的数据源
+func (s *priceService) granularityProviders(chainId, granularity string) []PriceProvider {
+	providers := s.historicalProviders(chainId)
+	if !shared.IsIntraday(granularity) {
+		return providers
+	}
+	var intraday []PriceProvider
+	for _, provider := range providers {
+		if _, ok := provider.(IntradayPriceProvider); ok {
+			intraday = append(intraday, provider)
+		}
+	}
+	return intraday
+}
+
+// intradaySnapshots 先从已保存的 OHLCV 及当前价格快照中读取小时或 5 分钟粒度的价格
+func (s *priceService) intradaySnapshots(granularity string, pending map[string]struct{}, resultsMap map[string]PriceResult, idToIndexMap map[string]int, chainIds, addresses []string, unixTimeStamps []int64) {
+	var ids, coinIds []string
+	var dates []int64
+	for id := range pending {
+		index := idToIndexMap[id]
+		ids = append(ids, id)
+		coinIds = append(coinIds, chainIds[index]+"_"+addresses[index])
+		dates = append(dates, unixTimeStamps[index])
+	}
+	if len(ids) == 0 {
+		return
+	}
+	prices, err := s.historicalRepo.GetHistoricalPricesByGranularity(coinIds, dates, granularity)
+	if err != nil {
+		s.logger.Err(err).Msg("读取历史价格快照失败")
+		return
+	}
+	for i, id := range ids {
+		price, ok := prices[coinIds[i]+"_"+shared.BucketDate(granularity, dates[i])]
+		if !ok || price == "" {
+			continue
+		}
+		index := idToIndexMap[id]
+		resultsMap[id] = PriceResult{
+			ChainID:         chainIds[index],
+			Address:         addresses[index],
+			Price:           &price,
+			TimeStamp:       strconv.FormatInt(unixTimeStamps[index], 10),
+			PriceProvenance: cachedProvenance(-1),
+		}
+		delete(pending, id)
+	}
+}
+
+// querySources 先查询币种指定的数据源，再按各链的数据源顺序逐轮查询 pending 中剩余的 ID
+// 同一轮中相同数据源的 ID 合并为一次批量查询，query 需要把查到价格的 ID 从 pending 中删除
+func querySources(pending map[string]struct{}, preferred map[string]string, providersOf func(id string) []PriceProvider, queryable func(provider PriceProvider, id string) bool, query func(provider PriceProvider, idSet map[string]struct{})) {
+	//查询指定数据源
+	providers, groups := groupBySource(pending, func(id string) PriceProvider {
+		for _, provider := range providersOf(id) {
+			if provider.Name() == preferred[id] && queryable(provider, id) {
+				return provider
+			}
+		}
+		return nil
+	})
+	for _, provider := range providers {
+		query(provider, groups[provider.Name()])
+	}
+
+	// 数据源顺序查询
+	for round := 0; len(pending) > 0; round++ {
+		remaining := false
+		providers, groups := groupBySource(pending, func(id string) PriceProvider {
+			chainProviders := providersOf(id)
+			if round >= len(chainProviders) {
+				return nil
+			}
+			remaining = true
+			if !queryable(chainProviders[round], id) {
+				return nil
+			}
+			return chainProviders[round]
+		})
+		if !remaining {
+			return
+		}
+		for _, provider := range providers {
+			query(provider, groups[provider.Name()])
+		}
+	}
+}
+
+// groupBySource 将 ID 按 pick 返回的数据源分组，pick 返回 nil 表示跳过该 ID
+func groupBySource(pending map[string]struct{}, pick func(id string) PriceProvider) ([]PriceProvider, map[string]map[string]struct{}) {
+	var providers []PriceProvider
+	groups := make(map[string]map[string]struct{})
+	for id := range pending {
+		provider := pick(id)
+		if provider == nil {
+			continue
+		}
+		if _, ok := groups[provider.Name()]; !ok {
+			groups[provider.Name()] = make(map[string]struct{})
+			providers = append(providers, provider)
+		}
+		groups[provider.Name()][id] = struct{}{}
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers, groups
+}
+
+func (s *priceService) GetHistoricalPrice(chainId, address, symbol, network string, unixTimeStamp int64, granularity string) (*string, error) {
+	address = shared.NormalizeAddress(chainId, address)
 	coin, err := s.coinRepository.GetCoinsByOneID(chainId + "_" + address)
 	if err != nil {
 		return nil, err
 	}
+	// 小时及 5 分钟粒度需要先查询快照，统一走批量查询
+	if (coin != nil && s.isDerived(*coin)) || shared.IsIntraday(granularity) {
+		results, err := s.GetBatchHistoricalPrice([]string{chainId}, []string{address}, []string{symbol}, []string{network}, []int64{unixTimeStamp}, []string{strconv.FormatInt(unixTimeStamp, 10)}, granularity)
+		if err != nil || len(results) == 0 {
+			return nil, err
+		}
+		return results[0].Price, nil
+	}
 	if coin != nil && coin.ChainID != "" && coin.Address != "" {
 		chainId = coin.ChainID
 		address = coin.Address
@@ -798,100 +1170,82 @@ func (s *priceService) GetHistoricalPrice(chainId, address, symbol, network stri
 		return nil, nil
 	}
 
-	var price *string
-
+	requestStatus := "200"
 	// 封装查询历史价格的逻辑
-	getHistoricalPriceFromSource := func(source string) (*string, error) {
-		if prohibited, ok := s.prohibitedSourcesHistorical[source]; ok && prohibited {
-			return nil, nil
-		}
-		switch source {
-		case "geckoterminal":
-			return s.geckoTerminalService.GetHistoricalPrice(chainId, address, unixTimeStamp)
-		case "coingecko":
-			return s.coinGeckoService.GetSingleHistoricalPrice(unixTimeStamp, chainId, address, symbol, network)
-		// case "coinGeckoOnChain":
-		// 	return s.coinGeckoOnChainService.GetHistoricalPriceOnChain(chainId, address, unixTimeStamp)
-		case "defillama":
-			return s.defiLlamaService.GetHistoricalPrice(chainId, address, unixTimeStamp)
-		default:
-			return s.geckoTerminalService.GetHistoricalPrice(chainId, address, unixTimeStamp)
-		}
-	}
-	if coin != nil && coin.PriceSource != nil && *coin.PriceSource != "" {
-		price, err = getHistoricalPriceFromSource(*coin.PriceSource)
-		if err == nil && price != nil {
-			return price, nil
-		} else {
-			s.logger.Err(err).Msg("GetHistoricalPrice 获取价格失败 " + coindId)
+	getHistoricalPriceFromProvider := func(provider PriceProvider) *string {
+		if provider.ListedCoinsOnly() && coin == nil {
+			return nil
 		}
-	}
-	if coin != nil && coin.LastPriceSource != nil && *coin.LastPriceSource != "" && price == nil {
-		price, err = getHistoricalPriceFromSource(*coin.LastPriceSource)
-		if err == nil && price != nil {
-			return price, nil
-		} else {
-			s.logger.Err(err).Msg("GetHistoricalPrice 获取价格失败 " + coindId)
+		results, err := provider.GetBatchHistoricalPrices([]string{address}, []string{chainId}, []string{symbol}, []string{network}, []int64{unixTimeStamp})
+		if err != nil {
+			if strings.Contains(err.Error(), "429") {
+				requestStatus = "429"
+			}
+			s.logger.Err(err).Msgf("GetHistoricalPrice-%s 获取价格失败 %s", provider.Name(), coindId)
+			return nil
 		}
-	}
-	// 默认优先使用 coingecko，其次是 geckoterminal
-	price, err = s.coinGeckoService.GetSingleHistoricalPrice(unixTimeStamp, chainId, address, symbol, network)
-	if err == nil && price != nil {
-		return price, nil
-	} else {
-		s.logger.Err(err).Msg("GetHistoricalPrice-coinGeckoService 获取价格失败 " + coindId)
+		if len(results) == 0 {
+			return nil
+		}
+		if results[0].RequestStatus != nil && *results[0].RequestStatus == "429" {
+			requestStatus = "429"
+		}
+		if results[0].Price == nil || *results[0].Price == "" {
+			return nil
+		}
+		return results[0].Price
 	}
 
-	price, err = s.defiLlamaService.GetHistoricalPrice(chainId, address, unixTimeStamp)
-	if err == nil && price != nil {
-		return price, nil
-	} else {
-		s.logger.Err(err).Msg("GetHistoricalPrice-defiLlamaService 获取价格失败 " + coindId)
+	providers := s.historicalProviders(chainId)
+	if coin != nil {
+		if source := preferredPriceSource(*coin); source != "" {
+			for _, provider := range providers {
+				if provider.Name() != source {
+					continue
+				}
+				if price := getHistoricalPriceFromProvider(provider); price != nil {
+					return price, nil
+				}
+			}
+		}
 	}
-
-	price, err = s.geckoTerminalService.GetHistoricalPrice(chainId, address, unixTimeStamp)
-	if err == nil && price != nil {
-		return price, nil
-	} else {
-		s.logger.Err(err).Msg("GetHistoricalPrice-geckoTerminalService 获取价格失败 " + coindId)
+	for _, provider := range providers {
+		if price := getHistoricalPriceFromProvider(provider); price != nil {
+			return price, nil
+		}
 	}
 
-	// price, err = s.coinGeckoOnChainService.GetHistoricalPriceOnChain(chainId, address, unixTimeStamp)
-	// if err == nil && price != nil {
-	// 	return price, nil
-	// } else {
-	// 	s.logger.Err(err).Msg("GetHistoricalPrice-coinGeckoOnChainService 获取价格失败 " + coindId)
-	// }
-
 	// 如果价格为空，则设置节流并发送警告
-	if price == nil {
-		requestStatus := "200"
-		if err != nil && strings.Contains(err.Error(), "429") {
-			requestStatus = "429"
-		}
-		if s.throttler.CoinsThrottle(coindId, requestStatus) {
-			s.slack.SaveLog(context.Background(), "priceService-GetHistoricalPrice", chainId, address, time.Unix(unixTimeStamp, 0).Format("2006-01-02"), time.Now().Unix())
-		}
+	if s.throttler.CoinsThrottle(coindId, requestStatus) {
+		s.slack.SaveLog(context.Background(), "priceService-GetHistoricalPrice", chainId, address, time.Unix(unixTimeStamp, 0).Format("2006-01-02"), time.Now().Unix())
 	}
 
 	return nil, nil
 }
 
-func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []string, symbols []string, networks []string, unixTimeStamp []int64, datesStr []string) ([]PriceResult, error) {
-	lowerAddresses := make([]string, len(addresses))
+func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []string, symbols []string, networks []string, unixTimeStamp []int64, datesStr []string, granularity string) ([]PriceResult, error) {
+	if granularity == "" {
+		granularity = shared.GranularityDay
+	}
+	return s.batchHistoricalPrice(0, granularity, chainIds, addresses, symbols, networks, unixTimeStamp, datesStr)
+}
+
+// batchHistoricalPrice depth 为按底层代币估值的递归层数
+func (s *priceService) batchHistoricalPrice(depth int, granularity string, chainIds []string, addresses []string, symbols []string, networks []string, unixTimeStamp []int64, datesStr []string) ([]PriceResult, error) {
+	normalizedAddresses := make([]string, len(addresses))
 	for i, addr := range addresses {
-		lowerAddresses[i] = strings.ToLower(addr)
+		normalizedAddresses[i] = shared.NormalizeAddress(chainIds[i], addr)
 	}
 
 	ids := make([]string, len(addresses))
 	idToIndexMap := make(map[string]int)
-	for i, addr := range lowerAddresses {
+	for i, addr := range normalizedAddresses {
 		id := fmt.Sprintf("%s_%s_%d", chainIds[i], addr, unixTimeStamp[i])
 		ids[i] = id
 		idToIndexMap[id] = i
 	}
 	coinIds := make([]string, len(addresses))
-	for i, addr := range lowerAddresses {
+	for i, addr := range normalizedAddresses {
 		coinIds[i] = fmt.Sprintf("%s_%s", chainIds[i], addr)
 	}
 
@@ -903,7 +1257,6 @@ func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []st
 	// 转换coins为map
 	coinMap := make(map[string]schema.Coins)
 	//关联coins
-	//关联coins
 	retrunCoinMap := make(map[string]string)
 	retrunCoinToMap := make(map[string][]string) // 修改为保存切片
 	for _, coin := range coins {
@@ -915,44 +1268,36 @@ func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []st
 		}
 	}
 
-	// 初始化来源映射
-	geckoIDsSetSource := make(map[string]struct{})    // 用于去重
-	terminalIDsSetSource := make(map[string]struct{}) // 用于去重
-	llamaIDsSetSource := make(map[string]struct{})    // 用于去重
-
-	geckoIDsSet := make(map[string]struct{})    // 用于去重
-	terminalIDsSet := make(map[string]struct{}) // 用于去重
-	llamaIDsSet := make(map[string]struct{})    // 用于去重
+	// LP 代币和包装代币按底层代币价格估值，不查询数据源
+	derived := make(map[string]derivedRequest)
+	for i, id := range ids {
+		if coin, exists := coinMap[coinIds[i]]; exists && s.isDerived(coin) {
+			derived[id] = derivedRequest{coin: coin, unixTimeStamp: unixTimeStamp[i]}
+		}
+	}
 
-	// 填充映射
-	for _, id := range ids {
-		parts := strings.Split(id, "_")
-		coinID := fmt.Sprintf("%s_%s", parts[0], parts[1])
-		if coin, exists := coinMap[coinID]; exists {
-			if coin.PriceSource != nil && (*coin.PriceSource == "coingecko") {
-				geckoIDsSetSource[id] = struct{}{}
-			} else if coin.PriceSource != nil && *coin.PriceSource == "geckoterminal" {
-				terminalIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "coingecko" {
-				geckoIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "geckoterminal" {
-				terminalIDsSetSource[id] = struct{}{}
-			} else if coin.LastPriceSource != nil && *coin.LastPriceSource == "defillama" {
-				llamaIDsSetSource[id] = struct{}{}
+	// 待查询的 ID 及其指定数据源
+	pending := make(map[string]struct{}, len(ids))
+	preferred := make(map[string]string)
+	for i, id := range ids {
+		if _, ok := derived[id]; ok {
+			continue
+		}
+		pending[id] = struct{}{}
+		if coin, exists := coinMap[coinIds[i]]; exists {
+			if source := preferredPriceSource(coin); source != "" {
+				preferred[id] = source
 			}
-			geckoIDsSet[id] = struct{}{}
 		}
-		terminalIDsSet[id] = struct{}{}
-		llamaIDsSet[id] = struct{}{}
 	}
 
 	resultsMap := make(map[string]PriceResult)
+	if shared.IsIntraday(granularity) {
+		s.intradaySnapshots(granularity, pending, resultsMap, idToIndexMap, chainIds, normalizedAddresses, unixTimeStamp)
+	}
 
 	// 批量查询指定数据源的历史价格
-	batchQueryHistorical := func(source string, idSet map[string]struct{}) {
-		if prohibited, ok := s.prohibitedSourcesHistorical[source]; ok && prohibited {
-			return
-		}
+	batchQueryHistorical := func(provider PriceProvider, idSet map[string]struct{}) {
 		var bChainIds, bAddresses, bSymbols, bNetworks []string
 		var bUnixTimeStamps []int64
 
@@ -961,92 +1306,86 @@ func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []st
 			if s.throttler.IsCoinsThrottled(id) {
 				resultsMap[id] = PriceResult{
 					ChainID:   chainIds[index],
-					Address:   lowerAddresses[index],
+					Address:   normalizedAddresses[index],
 					TimeStamp: datesStr[index],
 					Price:     nil,
 					Symbol:    GetOrNil(symbols, index),
 					Network:   GetOrNil(networks, index),
 				}
-				s.slack.SaveLog(context.Background(), "priceService-GetBatchHistoricalPrice", chainIds[index], lowerAddresses[index], time.Unix(unixTimeStamp[index], 0).Format("2006-01-02"), time.Now().Unix())
+				s.slack.SaveLog(context.Background(), "priceService-GetBatchHistoricalPrice", chainIds[index], normalizedAddresses[index], time.Unix(unixTimeStamp[index], 0).Format("2006-01-02"), time.Now().Unix())
+				delete(pending, id)
 				continue
 			}
 
-			coinId := chainIds[index] + "_" + lowerAddresses[index]
+			coinId := chainIds[index] + "_" + normalizedAddresses[index]
 			if retrunCoinId, exists := retrunCoinMap[coinId]; exists {
 				bChainIds = append(bChainIds, strings.Split(retrunCoinId, "_")[0])
 				bAddresses = append(bAddresses, strings.Split(retrunCoinId, "_")[1])
 			} else {
 				bChainIds = append(bChainIds, chainIds[index])
-				bAddresses = append(bAddresses, lowerAddresses[index])
+				bAddresses = append(bAddresses, normalizedAddresses[index])
 			}
 			bSymbols = append(bSymbols, GetOrDefault(symbols, index, ""))
 			bNetworks = append(bNetworks, GetOrDefault(networks, index, ""))
 			bUnixTimeStamps = append(bUnixTimeStamps, unixTimeStamp[index])
 		}
+		if len(bAddresses) == 0 {
+			return
+		}
 
-		// 根据 source 调用不同的数据源方法
 		var results []PriceResult
 		var err error
-		switch source {
-		case "coingecko":
-			results, err = s.coinGeckoService.GetBatchHistoricalPrices(bAddresses, bChainIds, bSymbols, bNetworks, bUnixTimeStamps)
-		case "geckoterminal":
-			results, err = s.geckoTerminalService.GetBatchHistoricalPrices(bAddresses, bChainIds, bSymbols, bNetworks, bUnixTimeStamps)
-		case "defillama":
-			results, err = s.defiLlamaService.GetBatchHistoricalPrices(bAddresses, bChainIds, bSymbols, bNetworks, bUnixTimeStamps)
+		if intraday, ok := provider.(IntradayPriceProvider); ok && shared.IsIntraday(granularity) {
+			results, err = intraday.GetBatchIntradayPrices(bAddresses, bChainIds, bSymbols, bNetworks, bUnixTimeStamps, granularity)
+		} else {
+			results, err = provider.GetBatchHistoricalPrices(bAddresses, bChainIds, bSymbols, bNetworks, bUnixTimeStamps)
 		}
-
-		if err == nil {
-			for _, result := range results {
-				key := fmt.Sprintf("%s_%s_%s", result.ChainID, result.Address, result.TimeStamp)
-				if result.Price != nil && *result.Price != "" {
-					resultsMap[key] = result
-					returnCoinId := fmt.Sprintf("%s_%s", result.ChainID, result.Address)
-					if coinIds, exists := retrunCoinToMap[returnCoinId]; exists {
-						for _, coinId := range coinIds {
-							result.ChainID = strings.Split(coinId, "_")[0]
-							result.Address = strings.Split(coinId, "_")[1]
-							resultsMap[fmt.Sprintf("%s_%s", coinId, result.TimeStamp)] = result
-						}
+		if err != nil {
+			s.logger.Err(err).Msgf("GetBatchHistoricalPrice 获取%s价格失败", provider.Name())
+			return
+		}
+		for _, result := range results {
+			key := fmt.Sprintf("%s_%s_%s", result.ChainID, result.Address, result.TimeStamp)
+			if result.Price != nil && *result.Price != "" {
+				observedAt, _ := strconv.ParseInt(result.TimeStamp, 10, 64)
+				result.PriceProvenance = result.PriceProvenance.complete(provider.Name(), observedAt)
+				resultsMap[key] = result
+				delete(pending, key)
+				returnCoinId := fmt.Sprintf("%s_%s", result.ChainID, result.Address)
+				if coinIds, exists := retrunCoinToMap[returnCoinId]; exists {
+					for _, coinId := range coinIds {
+						result.ChainID = strings.Split(coinId, "_")[0]
+						result.Address = strings.Split(coinId, "_")[1]
+						aliasKey := fmt.Sprintf("%s_%s", coinId, result.TimeStamp)
+						resultsMap[aliasKey] = result
+						delete(pending, aliasKey)
 					}
-					// 删除其他数据源集合中的 ID
-					delete(geckoIDsSet, key)
-					delete(terminalIDsSet, key)
-					delete(llamaIDsSet, key)
 				}
 			}
-		} else {
-			s.logger.Err(err).Msgf("GetBatchHistoricalPrice 获取%s价格失败", source)
 		}
 	}
 
-	//查询指定数据源
-	if len(geckoIDsSetSource) > 0 {
-		batchQueryHistorical("coingecko", geckoIDsSetSource)
-	}
-	if len(terminalIDsSetSource) > 0 {
-		batchQueryHistorical("geckoterminal", terminalIDsSetSource)
-	}
-	if len(llamaIDsSetSource) > 0 {
-		batchQueryHistorical("defillama", llamaIDsSetSource)
-	}
-
-	// 数据源顺序查询
-	// 查询剩余的默认数据源
-	if len(geckoIDsSet) > 0 {
-		batchQueryHistorical("coingecko", geckoIDsSet)
+	chainProviders := make(map[string][]PriceProvider)
+	providersOf := func(id string) []PriceProvider {
+		chainId := chainIds[idToIndexMap[id]]
+		if _, ok := chainProviders[chainId]; !ok {
+			chainProviders[chainId] = s.granularityProviders(chainId, granularity)
+		}
+		return chainProviders[chainId]
 	}
-	if len(llamaIDsSet) > 0 {
-		batchQueryHistorical("defillama", llamaIDsSet)
+	queryable := func(provider PriceProvider, id string) bool {
+		_, listed := coinMap[coinIds[idToIndexMap[id]]]
+		return listed || !provider.ListedCoinsOnly()
 	}
-	if len(terminalIDsSet) > 0 {
-		batchQueryHistorical("geckoterminal", terminalIDsSet)
+	querySources(pending, preferred, providersOf, queryable, batchQueryHistorical)
+	for id, result := range s.derivedHistoricalPrices(depth, granularity, derived) {
+		resultsMap[id] = result
 	}
 
 	// 构造最终结果
 	results := make([]PriceResult, len(addresses))
 	for i, addr := range addresses {
-		key := chainIds[i] + "_" + strings.ToLower(addr) + "_" + strconv.FormatInt(unixTimeStamp[i], 10)
+		key := shared.CoinID(chainIds[i], addr) + "_" + strconv.FormatInt(unixTimeStamp[i], 10)
 		result, exists := resultsMap[key]
 		if !exists {
 			result = PriceResult{
@@ -1062,6 +1401,8 @@ func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []st
 		result.Symbol = GetOrNil(symbols, i)
 		result.Network = GetOrNil(networks, i)
 		result.Address = addr
+		// 锚定资产超出容忍范围的历史价格只标记
+		s.pegs.Flag(shared.CoinID(chainIds[i], addr), &result)
 
 		if result.Price == nil || *result.Price == "" {
 			status := "200"
@@ -1074,6 +1415,9 @@ func (s *priceService) GetBatchHistoricalPrice(chainIds []string, addresses []st
 		}
 		results[i] = result
 	}
+	if granularity == shared.GranularityDay {
+		s.saveMarketData(results, unixTimeStamp, coinMap)
+	}
 
 	return results, nil
 }
@@ -58,17 +58,30 @@ func setupPriceService() service.PriceService {
 	coinRepo := repository.NewCoinRepository(db, zerolog.New(nil), redis)
 	slackRepo := repository.NewSlackNotificationRepository(lc, db, redis, zerolog.New(nil))
 	historicalPriceRepo := repository.NewCoinHistoricalPriceRepository(db, zerolog.New(nil), redis, coinRepo)
+	candleRepo := repository.NewCoinCandleRepository(db, zerolog.New(nil))
+	marketDataRepo := repository.NewCoinMarketDataRepository(db, zerolog.New(nil))
 	coinGeckoService := service.NewCoinGeckoService(cfg, coinRepo, historicalPriceRepo, redis, zerolog.New(nil))
-	geckoTerminalService := service.NewGeckoTerminalService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo)
+	geckoTerminalService := service.NewGeckoTerminalService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo)
 	defiLlamaService := service.NewDefiLlamaService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo)
 	dodoexRouteService := service.NewDodoexRouteService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo)
-	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, coinGeckoService)
+	coinGeckoOnChainService := service.NewCoinGeckoOnChainService(cfg, redis, zerolog.New(nil), coinRepo, historicalPriceRepo, candleRepo, coinGeckoService)
 	slackService := service.NewSlackNotificationService(slackRepo, redis, zerolog.New(nil))
 	throttler := shared.NewCoinsThrottler(redis, zerolog.New(nil), coinRepo)
+	providers := service.NewPriceProviderRegistry([]service.PriceProvider{
+		service.NewCoinGeckoProvider(coinGeckoService),
+		service.NewGeckoTerminalProvider(geckoTerminalService),
+		service.NewDefiLlamaProvider(defiLlamaService),
+		service.NewDodoexRouteProvider(dodoexRouteService),
+		service.NewCoinGeckoOnChainProvider(coinGeckoOnChainService),
+	})
+	guard := service.NewPriceGuardService(cfg, historicalPriceRepo, repository.NewRejectedPriceRepository(db, zerolog.New(nil)), redis, zerolog.New(nil))
+	pegs := service.NewPegService(cfg, slackService, redis, zerolog.New(nil))
+	rpcClient := shared.NewRpcClient(cfg, zerolog.New(nil))
+	lpTokens := service.NewLpTokenService(rpcClient, zerolog.New(nil))
+	wrappers := service.NewWrapperService(cfg, rpcClient, redis, zerolog.New(nil))
 	return service.NewPriceService(
-		slackService, coinGeckoService, geckoTerminalService, defiLlamaService,
-		dodoexRouteService, coinGeckoOnChainService, coinRepo,
-		zerolog.New(nil), throttler, redis,
+		cfg, slackService, providers, guard, pegs, lpTokens, wrappers, coinRepo,
+		historicalPriceRepo, candleRepo, marketDataRepo, zerolog.New(nil), throttler, redis,
 	)
 }
 
@@ -97,7 +110,7 @@ func TestGetPrice_Invalid(t *testing.T) {
 func TestGetHistoricalPrice_Valid(t *testing.T) {
 	setupOnce()
 	timestamp := time.Now().Add(-24 * time.Hour).Unix()
-	price, _ := priceService.GetHistoricalPrice("1", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", "ETH", "ethereum", timestamp)
+	price, _ := priceService.GetHistoricalPrice("1", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", "ETH", "ethereum", timestamp, shared.GranularityDay)
 	assert.NotNil(t, price)
 	t.Logf("Valid Historical Price: %v", *price)
 }
@@ -106,7 +119,7 @@ func TestGetHistoricalPrice_Invalid(t *testing.T) {
 	priceService := setupPriceService()
 
 	timestamp := time.Now().Add(-24 * time.Hour).Unix()
-	price, _ := priceService.GetHistoricalPrice("9999", "0xInvalidAddress", "ETH", "ethereum", timestamp)
+	price, _ := priceService.GetHistoricalPrice("9999", "0xInvalidAddress", "ETH", "ethereum", timestamp, shared.GranularityDay)
 	assert.Nil(t, price)
 }
 
@@ -143,7 +156,7 @@ func TestGetBatchHistoricalPrice_Valid(t *testing.T) {
 	timestamps := []int64{time.Now().Add(-24 * time.Hour).Unix()}
 	datesStr := []string{time.Now().Add(-24 * time.Hour).Format("02-01-2006")}
 
-	prices, _ := priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, timestamps, datesStr)
+	prices, _ := priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, timestamps, datesStr, shared.GranularityDay)
 	assert.NotNil(t, prices[0].Price)
 	t.Logf("Batch Valid Historical Prices: %v", prices)
 }
@@ -157,7 +170,7 @@ func TestGetBatchHistoricalPrice_Invalid(t *testing.T) {
 	timestamps := []int64{time.Now().Add(-24 * time.Hour).Unix()}
 	datesStr := []string{time.Now().Add(-24 * time.Hour).Format("02-01-2006")}
 
-	prices, _ := priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, timestamps, datesStr)
+	prices, _ := priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, timestamps, datesStr, shared.GranularityDay)
 	assert.Nil(t, prices[0].Price)
 	t.Logf("Batch Invalid Historical Prices: %v", prices)
 }
@@ -177,7 +190,7 @@ func TestEdgeCases(t *testing.T) {
 	timestamps := []int64{0} // 边界时间戳
 	datesStr := []string{"01-01-1970"}
 
-	prices, _ = priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, timestamps, datesStr)
+	prices, _ = priceService.GetBatchHistoricalPrice(chainIds, addresses, symbols, networks, timestamps, datesStr, shared.GranularityDay)
 	assert.Nil(t, prices[0].Price)
 	t.Log("Boundary timestamp test passed.")
 }
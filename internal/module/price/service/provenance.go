@@ -0,0 +1,86 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SourceConsensus 共识模式下由多个数据源报价聚合得到的价格
+const SourceConsensus = "consensus"
+
+const priceResultProvenancePrefix = "price_result_provenance:"
+
+// PriceProvenance 价格来源信息，仅在请求 provenance=true 时返回
+type PriceProvenance struct {
+	Source     *string `json:"source,omitempty"`     // 提供价格的数据源
+	ObservedAt *int64  `json:"observedAt,omitempty"` // 上游数据的观测时间（秒）
+	FromCache  *bool   `json:"fromCache,omitempty"`  // 是否来自缓存或已存储的价格
+	CacheAge   *int64  `json:"cacheAge,omitempty"`   // 在缓存中已存在的时长（秒）
+	Consensus  *bool   `json:"consensus,omitempty"`  // 共识模式下报价数是否达到 minSources，未达到时为单个数据源的报价
+}
+
+// cachedProvenance 数据源命中缓存时的来源信息，age 小于 0 表示未知
+func cachedProvenance(age int64) PriceProvenance {
+	fromCache := true
+	p := PriceProvenance{FromCache: &fromCache}
+	if age >= 0 {
+		p.CacheAge = &age
+	}
+	return p
+}
+
+// upstreamProvenance 数据源实时请求上游时的来源信息，observedAt 为 0 时由调用方补全
+func upstreamProvenance(observedAt int64) PriceProvenance {
+	fromCache := false
+	p := PriceProvenance{FromCache: &fromCache}
+	if observedAt > 0 {
+		p.ObservedAt = &observedAt
+	}
+	return p
+}
+
+// complete 补全数据源没有提供的来源信息，observedAt 为上游没有返回观测时间时的默认值
+func (p PriceProvenance) complete(source string, observedAt int64) PriceProvenance {
+	if p.Source == nil {
+		p.Source = &source
+	}
+	if p.FromCache == nil {
+		fromCache := false
+		p.FromCache = &fromCache
+	}
+	if p.ObservedAt == nil {
+		if p.CacheAge != nil {
+			observedAt -= *p.CacheAge
+		}
+		p.ObservedAt = &observedAt
+	}
+	return p
+}
+
+// resultProvenance 随 price_result 队列结果一起缓存的来源信息
+type resultProvenance struct {
+	PriceProvenance
+	CachedAt int64 `json:"cachedAt"`
+}
+
+func marshalResultProvenance(p PriceProvenance) string {
+	data, _ := json.Marshal(resultProvenance{PriceProvenance: p, CachedAt: time.Now().Unix()})
+	return string(data)
+}
+
+// unmarshalResultProvenance 解析队列结果的来源信息，缓存时长累加结果在 price_result 中的停留时间
+func unmarshalResultProvenance(data string) (PriceProvenance, bool) {
+	var r resultProvenance
+	if err := json.Unmarshal([]byte(data), &r); err != nil || r.CachedAt == 0 {
+		return PriceProvenance{}, false
+	}
+	age := time.Now().Unix() - r.CachedAt
+	if r.CacheAge != nil {
+		age += *r.CacheAge
+	}
+	p := cachedProvenance(age)
+	p.Source = r.Source
+	p.ObservedAt = r.ObservedAt
+	p.Consensus = r.Consensus
+	return p, true
+}
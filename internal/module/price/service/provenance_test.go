@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceProvenance_Complete(t *testing.T) {
+	now := time.Now().Unix()
+
+	fresh := upstreamProvenance(0).complete(SourceDefiLlama, now)
+	assert.Equal(t, SourceDefiLlama, *fresh.Source)
+	assert.False(t, *fresh.FromCache)
+	assert.Equal(t, now, *fresh.ObservedAt)
+	assert.Nil(t, fresh.CacheAge)
+
+	observed := upstreamProvenance(now-30).complete(SourceCoinGecko, now)
+	assert.Equal(t, now-30, *observed.ObservedAt)
+
+	cached := cachedProvenance(120).complete(SourceGeckoTerminal, now)
+	assert.True(t, *cached.FromCache)
+	assert.Equal(t, int64(120), *cached.CacheAge)
+	assert.Equal(t, now-120, *cached.ObservedAt)
+
+	empty := PriceProvenance{}.complete(SourceDodoexRoute, now)
+	assert.False(t, *empty.FromCache)
+	assert.Equal(t, SourceDodoexRoute, *empty.Source)
+}
+
+func TestResultProvenance_RoundTrip(t *testing.T) {
+	now := time.Now().Unix()
+	data := marshalResultProvenance(cachedProvenance(60).complete(SourceCoinGecko, now))
+
+	provenance, ok := unmarshalResultProvenance(data)
+	assert.True(t, ok)
+	assert.Equal(t, SourceCoinGecko, *provenance.Source)
+	assert.True(t, *provenance.FromCache)
+	assert.Equal(t, now-60, *provenance.ObservedAt)
+	assert.GreaterOrEqual(t, *provenance.CacheAge, int64(60))
+
+	_, ok = unmarshalResultProvenance("not json")
+	assert.False(t, ok)
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/DODOEX/token-price-proxy/internal/database/schema"
 	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
@@ -11,6 +13,16 @@ import (
 
 type SlackNotificationService interface {
 	SaveLog(ctx context.Context, source, chainID, address, dateDay string, timestamp int64) error
+	SaveDivergences(ctx context.Context, divergences []PriceDivergence) error
+	SaveDepeg(ctx context.Context, chainID, address string, target float64, prices map[string]float64) error
+}
+
+// PriceDivergence 单个币种的多数据源报价偏差
+type PriceDivergence struct {
+	ChainID   string
+	Address   string
+	Prices    map[string]float64
+	Deviation float64
 }
 
 type slackNotificationService struct {
@@ -42,3 +54,31 @@ func (s *slackNotificationService) SaveLog(ctx context.Context, source, chainID,
 	s.slackRepo.InsertNotification(ctx, notification)
 	return nil
 }
+
+// SaveDivergences 记录一批多数据源报价偏差，同一币种短时间内多次偏差时发送 Slack 告警
+func (s *slackNotificationService) SaveDivergences(ctx context.Context, divergences []PriceDivergence) error {
+	now := time.Now()
+	for _, divergence := range divergences {
+		if _, exists := shared.RefuseChainIdMap[divergence.ChainID]; exists {
+			continue
+		}
+		if err := s.SaveLog(ctx, "priceService-Divergence", divergence.ChainID, divergence.Address, now.Format("2006-01-02"), now.Unix()); err != nil {
+			return err
+		}
+		shared.HandleErrorWithThrottling(s.redisClient, s.logger, "PriceDivergence-"+divergence.ChainID+"_"+divergence.Address, fmt.Sprintf("数据源报价偏差 %.2f%%: %v", divergence.Deviation, divergence.Prices))
+	}
+	return nil
+}
+
+// SaveDepeg 记录锚定资产脱锚，多个数据源持续报出脱锚价格时发送 Slack 告警
+func (s *slackNotificationService) SaveDepeg(ctx context.Context, chainID, address string, target float64, prices map[string]float64) error {
+	if _, exists := shared.RefuseChainIdMap[chainID]; exists {
+		return nil
+	}
+	now := time.Now()
+	if err := s.SaveLog(ctx, "priceService-Depeg", chainID, address, now.Format("2006-01-02"), now.Unix()); err != nil {
+		return err
+	}
+	shared.HandleErrorWithThrottling(s.redisClient, s.logger, "PriceDepeg-"+chainID+"_"+address, fmt.Sprintf("锚定资产脱锚，目标价格 %v: %v", target, prices))
+	return nil
+}
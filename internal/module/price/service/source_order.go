@@ -0,0 +1,73 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// 默认数据源查询顺序
+var (
+	defaultCurrentSourceOrder    = []string{SourceCoinGecko, SourceDefiLlama, SourceGeckoTerminal, SourceCoinGeckoOnChain, SourceDodoexRoute, SourceAmmPool}
+	defaultHistoricalSourceOrder = []string{SourceCoinGecko, SourceDefiLlama, SourceGeckoTerminal}
+)
+
+// sourceOrder 数据源查询顺序，chains 中的配置会覆盖对应链的默认顺序
+type sourceOrder struct {
+	defaults []string
+	chains   map[string][]string
+}
+
+// newSourceOrder 读取 path.default 和 path.chains.<chainId> 配置，未配置时使用 fallback
+func newSourceOrder(cfg *koanf.Koanf, path string, fallback []string) sourceOrder {
+	order := sourceOrder{
+		defaults: configStrings(cfg, path+".default"),
+		chains:   make(map[string][]string),
+	}
+	if len(order.defaults) == 0 {
+		order.defaults = fallback
+	}
+	for _, chainId := range cfg.MapKeys(path + ".chains") {
+		if sources := configStrings(cfg, path+".chains."+chainId); len(sources) > 0 {
+			order.chains[chainId] = sources
+		}
+	}
+	return order
+}
+
+// forChain 返回指定链的数据源顺序
+func (o sourceOrder) forChain(chainId string) []string {
+	if sources, ok := o.chains[chainId]; ok {
+		return sources
+	}
+	return o.defaults
+}
+
+// configStrings 读取字符串列表，兼容环境变量传入的逗号分隔字符串
+func configStrings(cfg *koanf.Koanf, path string) []string {
+	if values := cfg.Strings(path); len(values) > 0 {
+		return values
+	}
+	return strings.FieldsFunc(cfg.String(path), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// sources 返回配置中出现过的所有数据源名称
+func (o sourceOrder) sources() []string {
+	seen := make(map[string]bool)
+	var sources []string
+	add := func(list []string) {
+		for _, source := range list {
+			if !seen[source] {
+				seen[source] = true
+				sources = append(sources, source)
+			}
+		}
+	}
+	add(o.defaults)
+	for _, list := range o.chains {
+		add(list)
+	}
+	return sources
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSourceOrder(t *testing.T) {
+	cfg := koanf.New(".")
+	assert.NoError(t, cfg.Load(confmap.Provider(map[string]interface{}{
+		"sourceOrder.current.default":      []interface{}{"defillama", "coingecko"},
+		"sourceOrder.current.chains.42161": "geckoterminal,coingecko",
+	}, "."), nil))
+
+	current := newSourceOrder(cfg, "sourceOrder.current", defaultCurrentSourceOrder)
+	assert.Equal(t, []string{"defillama", "coingecko"}, current.forChain("1"))
+	assert.Equal(t, []string{"geckoterminal", "coingecko"}, current.forChain("42161"))
+	assert.ElementsMatch(t, []string{"defillama", "coingecko", "geckoterminal"}, current.sources())
+
+	historical := newSourceOrder(cfg, "sourceOrder.historical", defaultHistoricalSourceOrder)
+	assert.Equal(t, defaultHistoricalSourceOrder, historical.forChain("42161"))
+}
+
+func TestQuerySources(t *testing.T) {
+	a := &stubProvider{name: "a"}
+	b := &stubProvider{name: "b"}
+	listed := &stubProvider{name: "listed", listedOnly: true}
+	chainOrders := map[string][]PriceProvider{
+		"1":     {listed, a, b},
+		"42161": {b, a},
+	}
+
+	pending := map[string]struct{}{"1_x": {}, "1_y": {}, "42161_z": {}}
+	preferred := map[string]string{"1_y": "b"}
+	answers := map[string]map[string]bool{
+		"a": {"1_x": true},
+		"b": {"42161_z": true},
+	}
+	var calls []string
+	querySources(pending, preferred,
+		func(id string) []PriceProvider { return chainOrders[id[:len(id)-2]] },
+		func(provider PriceProvider, id string) bool { return !provider.ListedCoinsOnly() },
+		func(provider PriceProvider, idSet map[string]struct{}) {
+			for id := range idSet {
+				calls = append(calls, provider.Name()+":"+id)
+				if answers[provider.Name()][id] {
+					delete(pending, id)
+				}
+			}
+		})
+
+	// 指定数据源优先；未上架币种跳过 listed；每轮按链各自的顺序查询
+	assert.Equal(t, "b:1_y", calls[0])
+	assert.ElementsMatch(t, []string{"b:1_y", "a:1_x", "a:1_y", "b:42161_z", "b:1_y"}, calls)
+	assert.Equal(t, map[string]struct{}{"1_y": {}}, pending)
+}
+
+func TestPriceService_IntradaySources(t *testing.T) {
+	s := &priceService{
+		providers: NewPriceProviderRegistry([]PriceProvider{
+			&stubProvider{name: SourceCoinGecko},
+			stubIntradayProvider{&stubProvider{name: SourceGeckoTerminal}},
+		}),
+		historicalSourceOrder: newSourceOrder(koanf.New("."), "sourceOrder.historical", []string{SourceCoinGecko, SourceGeckoTerminal}),
+		historicalRepo:        &stubHistoricalPriceRepo{latest: map[string]string{"1_0xsnapshot": "1.5"}},
+		logger:                zerolog.Nop(),
+	}
+	names := func(providers []PriceProvider) []string {
+		var names []string
+		for _, provider := range providers {
+			names = append(names, provider.Name())
+		}
+		return names
+	}
+	assert.Equal(t, []string{SourceCoinGecko, SourceGeckoTerminal}, names(s.granularityProviders("1", shared.GranularityDay)))
+	assert.Equal(t, []string{SourceGeckoTerminal}, names(s.granularityProviders("1", shared.GranularityHour)))
+
+	// 已有快照的 ID 直接返回，其余 ID 留给数据源查询
+	pending := map[string]struct{}{"1_0xsnapshot_7300": {}, "1_0xmissing_7300": {}}
+	idToIndexMap := map[string]int{"1_0xsnapshot_7300": 0, "1_0xmissing_7300": 1}
+	resultsMap := make(map[string]PriceResult)
+	s.intradaySnapshots(shared.GranularityHour, pending, resultsMap, idToIndexMap, []string{"1", "1"}, []string{"0xsnapshot", "0xmissing"}, []int64{7300, 7300})
+	assert.Equal(t, map[string]struct{}{"1_0xmissing_7300": {}}, pending)
+	if assert.NotNil(t, resultsMap["1_0xsnapshot_7300"].Price) {
+		assert.Equal(t, "1.5", *resultsMap["1_0xsnapshot_7300"].Price)
+		assert.Equal(t, "7300", resultsMap["1_0xsnapshot_7300"].TimeStamp)
+		assert.True(t, *resultsMap["1_0xsnapshot_7300"].FromCache)
+	}
+
+	// 只有实时请求上游的价格按观测时间保存为快照
+	fresh, cached, observedAt, sourceName, fromCache := "2", "3", int64(7300), SourceGeckoTerminal, false
+	s.saveIntradaySnapshots([]PriceResult{
+		{ChainID: "1", Address: "0xfresh", Price: &fresh, PriceProvenance: PriceProvenance{Source: &sourceName, ObservedAt: &observedAt, FromCache: &fromCache}},
+		{ChainID: "1", Address: "0xcached", Price: &cached, PriceProvenance: cachedProvenance(0)},
+		{ChainID: "1", Address: "0xnil"},
+	})
+	assert.Equal(t, []schema.CoinHistoricalPrice{{CoinID: "1_0xfresh", Date: 7300, Price: "2", Source: SourceGeckoTerminal}}, s.historicalRepo.(*stubHistoricalPriceRepo).snapshots)
+
+	assert.Equal(t, int64(7200), shared.BucketStart(shared.GranularityHour, 7300))
+	assert.Equal(t, int64(7200), shared.BucketStart(shared.GranularityFiveMinute, 7300))
+	assert.NotEqual(t, shared.BucketDate(shared.GranularityHour, 7200), shared.BucketDate(shared.GranularityFiveMinute, 7200))
+	assert.Equal(t, shared.GranularityFiveMinute, shared.BucketGranularity(shared.BucketDate(shared.GranularityFiveMinute, 7300)))
+	_, err := shared.ParseGranularity("1w")
+	assert.Error(t, err)
+}
+
+func TestBucketStart_LocalTimeZone(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	// 与 UTC 相差半小时的时区，按 UTC 对齐的小时会跨越本地的两天
+	time.Local = time.FixedZone("IST", 5*3600+1800)
+
+	ts := time.Date(2024, 1, 1, 18, 45, 0, 0, time.UTC).Unix() // 本地 2024-01-02 00:15
+	hourStart := shared.BucketStart(shared.GranularityHour, ts)
+	assert.Equal(t, time.Date(2024, 1, 1, 18, 30, 0, 0, time.UTC).Unix(), hourStart)
+	assert.Equal(t, shared.BucketStart(shared.GranularityDay, ts), hourStart)
+	assert.Equal(t, "02-01-2024 00", shared.BucketDate(shared.GranularityHour, ts))
+	assert.Equal(t, "02-01-2024 00:15", shared.BucketDate(shared.GranularityFiveMinute, ts))
+	for _, granularity := range []string{shared.GranularityHour, shared.GranularityFiveMinute} {
+		assert.True(t, strings.HasPrefix(shared.BucketDate(granularity, ts), shared.BucketDate(shared.GranularityDay, ts)))
+	}
+}
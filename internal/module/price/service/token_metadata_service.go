@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/rs/zerolog"
+)
+
+// 补全代币信息时依次查询的数据源
+var tokenInfoSources = []string{SourceGeckoTerminal, SourceCoinGeckoOnChain}
+
+const (
+	// 同一代币补全失败后，再次请求数据源及节点的最短间隔
+	tokenInfoRetryInterval = time.Hour
+	// 同时补全的代币数量
+	tokenInfoConcurrency = 5
+)
+
+// TokenMetadata 代币的基础信息，total_supply 为最小单位的数量，没有查到的字段为 null
+type TokenMetadata struct {
+	ChainID     string  `json:"chainId"`
+	Address     string  `json:"address"`
+	AssetID     string  `json:"assetId,omitempty"` // CAIP-19 资产 ID
+	Symbol      *string `json:"symbol"`
+	Name        *string `json:"name"`
+	Decimals    *int    `json:"decimals"`
+	TotalSupply *string `json:"totalSupply"`
+	Serial      int     `json:"serial"`
+	Error       string  `json:"error,omitempty"` // 请求中的地址无效
+}
+
+type TokenMetadataService interface {
+	// GetTokens 返回代币信息，coins 表中缺少 symbol、name 或 decimals 的代币从节点及数据源补全并写回 coins 表
+	GetTokens(chainIds []string, addresses []string) ([]TokenMetadata, error)
+}
+
+type tokenMetadataService struct {
+	providers      PriceProviderRegistry
+	coinRepository repository.CoinRepository
+	rpcClient      *shared.RpcClient
+	redisClient    *shared.RedisClient
+	logger         zerolog.Logger
+}
+
+func NewTokenMetadataService(providers PriceProviderRegistry, coinRepository repository.CoinRepository, rpcClient *shared.RpcClient, redisClient *shared.RedisClient, logger zerolog.Logger) TokenMetadataService {
+	return &tokenMetadataService{
+		providers:      providers,
+		coinRepository: coinRepository,
+		rpcClient:      rpcClient,
+		redisClient:    redisClient,
+		logger:         logger,
+	}
+}
+
+func (s *tokenMetadataService) GetTokens(chainIds []string, addresses []string) ([]TokenMetadata, error) {
+	ids := make([]string, len(addresses))
+	for i, address := range addresses {
+		ids[i] = shared.CoinID(chainIds[i], address)
+	}
+	coins, err := s.coinRepository.GetCoinsByID(ids)
+	if err != nil {
+		return nil, err
+	}
+	coinMap := make(map[string]schema.Coins, len(coins))
+	for _, coin := range coins {
+		coinMap[coin.ID] = coin
+	}
+
+	// 同一代币在请求中出现多次时只补全一次
+	var incomplete []string
+	seen := make(map[string]bool)
+	for i, id := range ids {
+		coin, exists := coinMap[id]
+		if !exists {
+			coinMap[id] = schema.Coins{ID: id, ChainID: chainIds[i], Address: shared.NormalizeAddress(chainIds[i], addresses[i])}
+		} else if tokenInfoComplete(coin) {
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			incomplete = append(incomplete, id)
+		}
+	}
+	for id, coin := range s.enrich(incomplete, coinMap) {
+		coinMap[id] = coin
+	}
+
+	results := make([]TokenMetadata, len(addresses))
+	for i, id := range ids {
+		coin := coinMap[id]
+		results[i] = TokenMetadata{
+			ChainID:     chainIds[i],
+			Address:     addresses[i],
+			Symbol:      nonEmpty(coin.Symbol),
+			Name:        nonEmpty(coin.Name),
+			Decimals:    coin.Decimals,
+			TotalSupply: nonEmpty(coin.TotalSupply),
+			Serial:      i,
+		}
+	}
+	return results, nil
+}
+
+// enrich 并发补全代币信息，返回补全了字段的代币，其中 symbol 和 name 都有值的写回 coins 表
+func (s *tokenMetadataService) enrich(ids []string, coinMap map[string]schema.Coins) map[string]schema.Coins {
+	enriched := make(map[string]schema.Coins)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, tokenInfoConcurrency)
+	for _, id := range ids {
+		if !s.enrichAllowed(id) {
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(coin schema.Coins) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if !s.fillTokenInfo(&coin) {
+				return
+			}
+			if coin.Symbol != nil && coin.Name != nil {
+				if err := s.coinRepository.UpsertCoins([]schema.Coins{coin}); err != nil {
+					s.logger.Err(err).Msgf("保存代币信息失败 %s", coin.ID)
+				}
+			}
+			mu.Lock()
+			enriched[coin.ID] = coin
+			mu.Unlock()
+		}(coinMap[id])
+	}
+	wg.Wait()
+	return enriched
+}
+
+// fillTokenInfo 先通过节点读取 ERC-20 合约，仍有缺少的字段时依次查询数据源，返回是否补全了字段
+func (s *tokenMetadataService) fillTokenInfo(coin *schema.Coins) bool {
+	filled := false
+	if s.rpcClient != nil && s.rpcClient.HasChain(coin.ChainID) {
+		metadata, err := s.rpcClient.Erc20Metadata(coin.ChainID, coin.Address)
+		if err != nil {
+			s.logger.Debug().Err(err).Msgf("读取 ERC-20 代币信息失败 %s", coin.ID)
+		} else {
+			filled = mergeTokenInfo(coin, schema.Coins{Symbol: metadata.Symbol, Name: metadata.Name, Decimals: metadata.Decimals, TotalSupply: metadata.TotalSupply})
+		}
+	}
+	for _, name := range tokenInfoSources {
+		if tokenInfoComplete(*coin) {
+			break
+		}
+		provider, ok := s.providers.Get(name)
+		if !ok {
+			continue
+		}
+		tokenInfoProvider, ok := provider.(TokenInfoProvider)
+		if !ok {
+			continue
+		}
+		info, err := tokenInfoProvider.GetTokenInfo(coin.ChainID, coin.Address)
+		if err != nil {
+			s.logger.Err(err).Msgf("获取%s代币信息失败 %s", name, coin.ID)
+			continue
+		}
+		if info != nil && mergeTokenInfo(coin, *info) {
+			filled = true
+			if coin.GeckoterminalNetwork == nil {
+				coin.GeckoterminalNetwork = info.GeckoterminalNetwork
+			}
+		}
+	}
+	return filled
+}
+
+// enrichAllowed 同一代币在 tokenInfoRetryInterval 内只补全一次，避免没有数据的代币每次请求都查询上游
+func (s *tokenMetadataService) enrichAllowed(id string) bool {
+	allowed, err := s.redisClient.Client.SetNX(context.Background(), "coins:tokenInfo:attempt:"+id, 1, tokenInfoRetryInterval).Result()
+	return err == nil && allowed
+}
+
+// tokenInfoComplete symbol、name 和 decimals 都有值时不需要补全
+func tokenInfoComplete(coin schema.Coins) bool {
+	return nonEmpty(coin.Symbol) != nil && nonEmpty(coin.Name) != nil && coin.Decimals != nil
+}
+
+// mergeTokenInfo 只补充 coin 中为空的字段，返回是否有字段被补充
+func mergeTokenInfo(coin *schema.Coins, info schema.Coins) bool {
+	merged := false
+	fill := func(target **string, value *string) {
+		if nonEmpty(*target) == nil && nonEmpty(value) != nil {
+			*target = value
+			merged = true
+		}
+	}
+	fill(&coin.Symbol, info.Symbol)
+	fill(&coin.Name, info.Name)
+	fill(&coin.TotalSupply, info.TotalSupply)
+	if coin.Decimals == nil && info.Decimals != nil {
+		coin.Decimals = info.Decimals
+		merged = true
+	}
+	return merged
+}
+
+// nonEmpty 空字符串按 nil 处理
+func nonEmpty(value *string) *string {
+	if value == nil || *value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// abiStringResult 按 ABI 动态 string 编码返回值
+func abiStringResult(value string) string {
+	padded := make([]byte, (len(value)+31)/32*32)
+	copy(padded, value)
+	return abiResult(big.NewInt(32), big.NewInt(int64(len(value)))) + hex.EncodeToString(padded)
+}
+
+func TestTokenMetadataService_GetTokens(t *testing.T) {
+	const (
+		erc20    = "0x00000000000000000000000000000000000000d1"
+		unknown  = "0x00000000000000000000000000000000000000d2"
+		complete = "0x00000000000000000000000000000000000000d3"
+	)
+	// name 按旧合约的 bytes32 返回
+	name := make([]byte, 32)
+	copy(name, "Maker")
+	server := newStubContractServer(map[string]string{
+		erc20 + ":0x95d89b41": abiStringResult("MKR"),
+		erc20 + ":0x06fdde03": "0x" + hex.EncodeToString(name),
+		erc20 + ":0x313ce567": abiResult(big.NewInt(18)),
+		erc20 + ":0x18160ddd": abiResult(big.NewInt(1000)),
+	}, 1)
+	defer server.Close()
+
+	symbol, tokenName, decimals := "GT", "Gecko Token", 6
+	provider := stubTokenInfoProvider{&stubProvider{name: SourceGeckoTerminal, infos: map[string]schema.Coins{
+		"1_" + unknown: {Symbol: &symbol, Name: &tokenName, Decimals: &decimals},
+	}}}
+	existingSymbol, empty := "OLD", ""
+	coins := stubCoinRepo{
+		"1_" + unknown:  {ID: "1_" + unknown, ChainID: "1", Address: unknown, Symbol: &existingSymbol, Name: &empty},
+		"1_" + complete: {ID: "1_" + complete, ChainID: "1", Address: complete, Symbol: &symbol, Name: &tokenName, Decimals: &decimals},
+	}
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	s := &tokenMetadataService{
+		providers:      NewPriceProviderRegistry([]PriceProvider{provider}),
+		coinRepository: coins,
+		rpcClient:      newTestRpcClient(server.URL),
+		redisClient:    redisClient,
+		logger:         zerolog.Nop(),
+	}
+
+	// 节点读取到所有字段时不再查询数据源
+	coin := schema.Coins{ID: "1_" + erc20, ChainID: "1", Address: erc20}
+	assert.True(t, s.fillTokenInfo(&coin))
+	assert.Equal(t, "MKR", *coin.Symbol)
+	assert.Equal(t, "Maker", *coin.Name)
+	assert.Equal(t, 18, *coin.Decimals)
+	assert.Equal(t, "1000", *coin.TotalSupply)
+	assert.Equal(t, 0, provider.calls)
+
+	// 节点调用失败时由数据源补全，已有的字段不被覆盖
+	coin = coins["1_"+unknown]
+	assert.True(t, s.fillTokenInfo(&coin))
+	assert.Equal(t, "OLD", *coin.Symbol)
+	assert.Equal(t, "Gecko Token", *coin.Name)
+	assert.Equal(t, 6, *coin.Decimals)
+	assert.Equal(t, 1, provider.calls)
+
+	// 无法限制重试频率时不补全，直接返回已保存的信息
+	results, err := s.GetTokens([]string{"1", "1", "1"}, []string{complete, unknown, "0x00000000000000000000000000000000000000D4"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, "Gecko Token", *results[0].Name)
+		assert.Equal(t, 6, *results[0].Decimals)
+		assert.Equal(t, "OLD", *results[1].Symbol)
+		assert.Nil(t, results[1].Name)
+		assert.Nil(t, results[2].Symbol)
+		assert.Equal(t, "0x00000000000000000000000000000000000000D4", results[2].Address)
+		assert.Equal(t, 2, results[2].Serial)
+	}
+	assert.Equal(t, 1, provider.calls)
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// SourceWrapper 按底层代币价格和汇率计算的包装代币价格
+const SourceWrapper = "wrapper"
+
+// 包装代币汇率类型
+const (
+	WrapperErc4626  = "erc4626"  // convertToAssets(1 份额)
+	WrapperCompound = "compound" // exchangeRateStored()，按 cToken 与底层代币的精度换算
+	WrapperWstEth   = "wstETH"   // stEthPerToken()
+	WrapperCall     = "call"     // 自定义 calldata，返回值按 rateDecimals 换算
+)
+
+// 包装代币合约方法选择器
+const (
+	wrapperConvertToAssets    = "0x07a2d13a"
+	wrapperExchangeRateStored = "0x182df0f5"
+	wrapperStEthPerToken      = "0x035faf82"
+	wrapperAsset              = "0x38d52e0f"
+	wrapperUnderlying         = "0x6f307dc3"
+)
+
+const (
+	wrapperRateKeyPrefix     = "wrapper:rate:"
+	defaultWrapperRateTTL    = 10 * time.Minute
+	wrapperHistoricalRateTTL = 7 * 24 * time.Hour
+)
+
+// WrapperRule coins.wrapper_rule 中的包装规则
+type WrapperRule struct {
+	Type         string `json:"type"`
+	Underlying   string `json:"underlying"`   // 底层代币的 coins ID，erc4626 和 compound 为空时读取 asset() / underlying()
+	Contract     string `json:"contract"`     // 提供汇率的合约，默认为代币本身
+	Data         string `json:"data"`         // call 类型的 calldata
+	RateDecimals *int   `json:"rateDecimals"` // call 类型返回值的精度，默认 18
+}
+
+// WrapperService 读取包装代币与底层代币之间的汇率，由 PriceService 结合底层代币价格计算价格
+type WrapperService interface {
+	IsWrapped(coin schema.Coins) bool
+	// Underlying 返回底层代币的链 ID 和地址
+	Underlying(coin schema.Coins) (string, string, error)
+	// Rate 返回 1 个包装代币可兑换的底层代币数量，unixTimeStamp 为 0 时为当前汇率
+	Rate(coin schema.Coins, unixTimeStamp int64) (float64, error)
+}
+
+type wrapperService struct {
+	rateTTL     time.Duration
+	rpcClient   *shared.RpcClient
+	redisClient *shared.RedisClient
+	logger      zerolog.Logger
+	underlying  sync.Map // coins ID -> 底层代币地址
+}
+
+func NewWrapperService(cfg *koanf.Koanf, rpcClient *shared.RpcClient, redisClient *shared.RedisClient, logger zerolog.Logger) WrapperService {
+	rateTTL := cfg.Duration("wrapper.rateTTL")
+	if rateTTL == 0 {
+		rateTTL = defaultWrapperRateTTL
+	}
+	return &wrapperService{
+		rateTTL:     rateTTL,
+		rpcClient:   rpcClient,
+		redisClient: redisClient,
+		logger:      logger,
+	}
+}
+
+// wrapperRuleOf 解析币种的包装规则，没有配置或类型不支持时返回 false
+func wrapperRuleOf(coin schema.Coins) (WrapperRule, bool) {
+	if coin.WrapperRule == nil || *coin.WrapperRule == "" {
+		return WrapperRule{}, false
+	}
+	var rule WrapperRule
+	if err := json.Unmarshal([]byte(*coin.WrapperRule), &rule); err != nil {
+		return WrapperRule{}, false
+	}
+	switch rule.Type {
+	case WrapperErc4626, WrapperCompound:
+	case WrapperWstEth:
+		if rule.Underlying == "" {
+			return WrapperRule{}, false
+		}
+	case WrapperCall:
+		if rule.Underlying == "" || rule.Data == "" {
+			return WrapperRule{}, false
+		}
+	default:
+		return WrapperRule{}, false
+	}
+	return rule, true
+}
+
+func (s *wrapperService) IsWrapped(coin schema.Coins) bool {
+	_, ok := wrapperRuleOf(coin)
+	return ok
+}
+
+func (s *wrapperService) Underlying(coin schema.Coins) (string, string, error) {
+	rule, ok := wrapperRuleOf(coin)
+	if !ok {
+		return "", "", fmt.Errorf("%s has no wrapper rule", coin.ID)
+	}
+	if rule.Underlying != "" {
+		chainId, address, found := strings.Cut(rule.Underlying, "_")
+		if !found {
+			return "", "", fmt.Errorf("invalid underlying coin id: %s", rule.Underlying)
+		}
+		return chainId, shared.NormalizeAddress(chainId, address), nil
+	}
+	if address, ok := s.underlying.Load(coin.ID); ok {
+		return coin.ChainID, address.(string), nil
+	}
+	selector := wrapperAsset
+	if rule.Type == WrapperCompound {
+		selector = wrapperUnderlying
+	}
+	words, err := s.call(coin.ChainID, s.contractOf(coin, rule), selector, 0)
+	if err != nil {
+		return "", "", err
+	}
+	address := shared.AbiAddress(words[0])
+	s.underlying.Store(coin.ID, address)
+	return coin.ChainID, address, nil
+}
+
+func (s *wrapperService) Rate(coin schema.Coins, unixTimeStamp int64) (float64, error) {
+	rule, ok := wrapperRuleOf(coin)
+	if !ok {
+		return 0, fmt.Errorf("%s has no wrapper rule", coin.ID)
+	}
+	cacheKey := wrapperRateKeyPrefix + coin.ID
+	ttl := s.rateTTL
+	if unixTimeStamp > 0 {
+		cacheKey += "_" + strconv.FormatInt(unixTimeStamp, 10)
+		ttl = wrapperHistoricalRateTTL
+	}
+	if cached, err := s.redisClient.Client.Get(context.Background(), cacheKey).Result(); err == nil {
+		if rate, err := strconv.ParseFloat(cached, 64); err == nil {
+			return rate, nil
+		}
+	}
+
+	if !s.rpcClient.HasChain(coin.ChainID) {
+		return 0, fmt.Errorf("no rpc endpoint configured for chain %s", coin.ChainID)
+	}
+	var blockNumber uint64
+	if unixTimeStamp > 0 {
+		var err error
+		if blockNumber, err = s.rpcClient.BlockNumberAt(coin.ChainID, unixTimeStamp); err != nil {
+			return 0, err
+		}
+	}
+	rate, err := s.readRate(coin, rule, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("invalid exchange rate %f for %s", rate, coin.ID)
+	}
+	s.redisClient.Client.Set(context.Background(), cacheKey, strconv.FormatFloat(rate, 'f', -1, 64), ttl)
+	return rate, nil
+}
+
+// readRate 在指定区块调用汇率方法，blockNumber 为 0 时使用最新区块
+func (s *wrapperService) readRate(coin schema.Coins, rule WrapperRule, blockNumber uint64) (float64, error) {
+	contract := s.contractOf(coin, rule)
+	var data string
+	var scale int // 汇率整数值的精度
+	switch rule.Type {
+	case WrapperErc4626:
+		_, underlying, err := s.Underlying(coin)
+		if err != nil {
+			return 0, err
+		}
+		shareDecimals, err := s.rpcClient.Decimals(coin.ChainID, strings.ToLower(coin.Address))
+		if err != nil {
+			return 0, err
+		}
+		assetDecimals, err := s.rpcClient.Decimals(coin.ChainID, underlying)
+		if err != nil {
+			return 0, err
+		}
+		data = wrapperConvertToAssets + shared.AbiEncodeUint(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(shareDecimals)), nil))
+		scale = assetDecimals
+	case WrapperCompound:
+		// exchangeRateStored 的精度为 18 + 底层代币精度 - cToken 精度
+		_, underlying, err := s.Underlying(coin)
+		if err != nil {
+			return 0, err
+		}
+		cTokenDecimals, err := s.rpcClient.Decimals(coin.ChainID, strings.ToLower(coin.Address))
+		if err != nil {
+			return 0, err
+		}
+		underlyingDecimals, err := s.rpcClient.Decimals(coin.ChainID, underlying)
+		if err != nil {
+			return 0, err
+		}
+		data = wrapperExchangeRateStored
+		scale = 18 + underlyingDecimals - cTokenDecimals
+	case WrapperWstEth:
+		data = wrapperStEthPerToken
+		scale = 18
+	case WrapperCall:
+		data = rule.Data
+		scale = 18
+		if rule.RateDecimals != nil {
+			scale = *rule.RateDecimals
+		}
+	}
+
+	words, err := s.call(coin.ChainID, contract, data, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	rate, _ := new(big.Float).Quo(new(big.Float).SetInt(words[0]), pow10(scale)).Float64()
+	return rate, nil
+}
+
+func (s *wrapperService) contractOf(coin schema.Coins, rule WrapperRule) string {
+	if rule.Contract != "" {
+		return strings.ToLower(rule.Contract)
+	}
+	return strings.ToLower(coin.Address)
+}
+
+func (s *wrapperService) call(chainId, to, data string, blockNumber uint64) ([]*big.Int, error) {
+	result, err := s.rpcClient.EthCall(chainId, to, data, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	words, err := shared.AbiWords(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty response from %s", to)
+	}
+	return words, nil
+}
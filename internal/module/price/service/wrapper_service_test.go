@@ -0,0 +1,97 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DODOEX/token-price-proxy/internal/database/schema"
+	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUsdc     = "0x00000000000000000000000000000000000000a0"
+	testStEth    = "0x00000000000000000000000000000000000000a2"
+	testVault    = "0x00000000000000000000000000000000000000e1"
+	testCToken   = "0x00000000000000000000000000000000000000e2"
+	testWstEth   = "0x00000000000000000000000000000000000000e3"
+	testRateFeed = "0x00000000000000000000000000000000000000e4"
+)
+
+// newStubWrapperServer 模拟 ERC-4626 金库、cToken、wstETH 及自定义汇率合约
+func newStubWrapperServer(t *testing.T) *shared.RpcClient {
+	e := func(n int64) *big.Int { return new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil) }
+	mul := func(a int64, b *big.Int) *big.Int { return new(big.Int).Mul(big.NewInt(a), b) }
+	server := newStubContractServer(map[string]string{
+		testUsdc + ":0x313ce567":   abiResult(big.NewInt(6)),
+		testVault + ":0x313ce567":  abiResult(big.NewInt(18)),
+		testCToken + ":0x313ce567": abiResult(big.NewInt(8)),
+
+		testVault + ":" + wrapperAsset:                                                 abiAddressResult(testUsdc),
+		testVault + ":" + wrapperConvertToAssets + shared.AbiEncodeUint(e(18)):         abiResult(big.NewInt(1050000)),
+		testVault + ":" + wrapperConvertToAssets + shared.AbiEncodeUint(e(18)) + "@50": abiResult(big.NewInt(1010000)),
+
+		// exchangeRateStored 的精度为 18 + 6 - 8
+		testCToken + ":" + wrapperUnderlying:         abiAddressResult(testUsdc),
+		testCToken + ":" + wrapperExchangeRateStored: abiResult(mul(2, e(14))),
+
+		testWstEth + ":" + wrapperStEthPerToken: abiResult(mul(115, e(16))),
+		testRateFeed + ":0x12345678":            abiResult(big.NewInt(1100000)),
+	}, 100)
+	t.Cleanup(server.Close)
+	return newTestRpcClient(server.URL)
+}
+
+func wrappedCoin(address, rule string) schema.Coins {
+	return schema.Coins{ID: "1_" + address, ChainID: "1", Address: address, WrapperRule: &rule}
+}
+
+func TestWrapperService_Rate(t *testing.T) {
+	redisClient := &shared.RedisClient{Client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	s := NewWrapperService(koanf.New("."), newStubWrapperServer(t), redisClient, zerolog.Nop())
+
+	assert.False(t, s.IsWrapped(schema.Coins{ID: "1_" + testVault}))
+	assert.False(t, s.IsWrapped(wrappedCoin(testVault, `{"type":"unknown"}`)))
+	assert.False(t, s.IsWrapped(wrappedCoin(testWstEth, `{"type":"wstETH"}`)))
+
+	vault := wrappedCoin(testVault, `{"type":"erc4626"}`)
+	assert.True(t, s.IsWrapped(vault))
+	chainId, underlying, err := s.Underlying(vault)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", chainId)
+	assert.Equal(t, testUsdc, underlying)
+	rate, err := s.Rate(vault, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.05, rate)
+	// 时间 505 对应区块 50
+	rate, err = s.Rate(vault, 505)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.01, rate)
+
+	cToken := wrappedCoin(testCToken, `{"type":"compound"}`)
+	_, underlying, err = s.Underlying(cToken)
+	assert.NoError(t, err)
+	assert.Equal(t, testUsdc, underlying)
+	rate, err = s.Rate(cToken, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.02, rate)
+
+	wstEth := wrappedCoin(testWstEth, `{"type":"wstETH","underlying":"1_`+testStEth+`"}`)
+	_, underlying, err = s.Underlying(wstEth)
+	assert.NoError(t, err)
+	assert.Equal(t, testStEth, underlying)
+	rate, err = s.Rate(wstEth, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.15, rate)
+
+	custom := wrappedCoin(testWstEth, `{"type":"call","underlying":"1_`+testStEth+`","contract":"`+testRateFeed+`","data":"0x12345678","rateDecimals":6}`)
+	rate, err = s.Rate(custom, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.1, rate)
+
+	_, err = s.Rate(wrappedCoin(testCToken, `{"type":"call","underlying":"1_`+testStEth+`","data":"0xdeadbeef"}`), 0)
+	assert.Error(t, err)
+}
@@ -7,9 +7,16 @@ import (
 	"github.com/DODOEX/token-price-proxy/internal/module/price/repository"
 	"github.com/DODOEX/token-price-proxy/internal/module/price/service"
 	"github.com/DODOEX/token-price-proxy/internal/module/shared"
+	"github.com/knadh/koanf/v2"
 	"github.com/rs/zerolog"
 )
 
+// 日内价格默认的保留时间
+var defaultIntradayRetention = map[string]time.Duration{
+	shared.GranularityHour:       90 * 24 * time.Hour,
+	shared.GranularityFiveMinute: 7 * 24 * time.Hour,
+}
+
 // Scheduler struct to hold repositories and logger
 type Scheduler struct {
 	CoinHistoricalPriceRepo     repository.CoinHistoricalPriceRepository
@@ -17,23 +24,39 @@ type Scheduler struct {
 	CoinGeckoService            service.CoinGeckoService
 	SlackNotificationRepository repository.SlackNotificationRepository
 	RequestLogRepository        repository.RequestLogRepository
+	BackfillService             service.BackfillService
+	IntradayRetention           map[string]time.Duration // 日内粒度 => 保留时间
 	redisClient                 *shared.RedisClient
 	Logger                      zerolog.Logger
 }
 
 // NewScheduler creates a new Scheduler
-func NewScheduler(coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, coinRepo repository.CoinRepository, slackNotificationRepository repository.SlackNotificationRepository, requestLogsRepository repository.RequestLogRepository, redisClient *shared.RedisClient, logger zerolog.Logger, coinGeckoService service.CoinGeckoService) *Scheduler {
+func NewScheduler(cfg *koanf.Koanf, coinHistoricalPriceRepo repository.CoinHistoricalPriceRepository, coinRepo repository.CoinRepository, slackNotificationRepository repository.SlackNotificationRepository, requestLogsRepository repository.RequestLogRepository, redisClient *shared.RedisClient, logger zerolog.Logger, coinGeckoService service.CoinGeckoService, backfillService service.BackfillService) *Scheduler {
 	return &Scheduler{
 		CoinHistoricalPriceRepo:     coinHistoricalPriceRepo,
 		CoinRepo:                    coinRepo,
 		CoinGeckoService:            coinGeckoService,
 		SlackNotificationRepository: slackNotificationRepository,
 		RequestLogRepository:        requestLogsRepository,
+		BackfillService:             backfillService,
+		IntradayRetention:           intradayRetention(cfg),
 		redisClient:                 redisClient,
 		Logger:                      logger,
 	}
 }
 
+// intradayRetention 读取 historical.retention 中各日内粒度的保留时间，未配置时使用默认值
+func intradayRetention(cfg *koanf.Koanf) map[string]time.Duration {
+	retention := make(map[string]time.Duration, len(defaultIntradayRetention))
+	for granularity, duration := range defaultIntradayRetention {
+		if configured := cfg.Duration("historical.retention." + granularity); configured > 0 {
+			duration = configured
+		}
+		retention[granularity] = duration
+	}
+	return retention
+}
+
 // StartProcessQueue 定时处理队列数据
 func (s *Scheduler) StartCoinsProcessQueue() {
 	ticker := time.NewTicker(5 * time.Minute)
@@ -168,3 +191,38 @@ func (s *Scheduler) StartProcessDeleteOldData() {
 
 	}
 }
+
+// StartBackfillJobs 每分钟继续执行未结束的历史价格回填任务，多个实例之间只有一个在执行
+func (s *Scheduler) StartBackfillJobs() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		redisLockKey := "sync_backfill_jobs_lock"
+		if s.redisClient.AcquireLock(redisLockKey, 2*time.Minute) {
+			if err := s.BackfillService.RunPending(50 * time.Second); err != nil {
+				s.Logger.Error().Err(err).Msg("处理 BackfillJobs 失败")
+			}
+			s.redisClient.ReleaseLock(redisLockKey)
+		}
+	}
+}
+
+// StartDeleteIntradayPrices 每小时删除超过保留时间的小时及 5 分钟价格，按天价格不删除
+func (s *Scheduler) StartDeleteIntradayPrices() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		redisLockKey := "sync_delete_intraday_prices_lock"
+		if s.redisClient.AcquireLock(redisLockKey, 30*time.Minute) {
+			for granularity, retention := range s.IntradayRetention {
+				deleted, err := s.CoinHistoricalPriceRepo.DeleteIntradayPrices(granularity, time.Now().Add(-retention).Unix())
+				if err != nil {
+					s.Logger.Error().Err(err).Msg("处理 DeleteIntradayPrices 失败")
+					continue
+				}
+				s.Logger.Info().Msgf("处理 DeleteIntradayPrices 成功，删除 %s 价格 %d 条", granularity, deleted)
+			}
+			s.redisClient.ReleaseLock(redisLockKey)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package shared
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// 链的地址格式
+const (
+	ChainFamilyEVM    = "evm"    // 0x 开头的十六进制地址，不区分大小写
+	ChainFamilySolana = "solana" // base58，区分大小写
+	ChainFamilyTron   = "tron"   // base58check，区分大小写
+	ChainFamilyTon    = "ton"    // base64url，区分大小写
+	ChainFamilySui    = "sui"    // 0x 开头的十六进制地址，不区分大小写
+	ChainFamilyAptos  = "aptos"  // 0x 开头的十六进制地址，不区分大小写
+)
+
+// caseInsensitiveFamilies 地址不区分大小写的链，统一转为小写
+var caseInsensitiveFamilies = map[string]bool{
+	ChainFamilyEVM:   true,
+	ChainFamilySui:   true,
+	ChainFamilyAptos: true,
+}
+
+var chainFamilies = make(map[string]string) // 全局变量，存储非 EVM 链 ID 到地址格式的映射
+
+// LoadChainFamilies 根据 CHAIN_MAPPING 中的链名称识别非 EVM 链，再用环境变量 CHAIN_FAMILIES 覆盖
+func LoadChainFamilies() {
+	newChainFamilies := make(map[string]string)
+	mu.RLock()
+	for name, id := range nameToIDMapping {
+		if isChainFamily(name) && name != ChainFamilyEVM {
+			newChainFamilies[id] = name
+		}
+	}
+	mu.RUnlock()
+
+	if chainFamiliesStr := os.Getenv("CHAIN_FAMILIES"); chainFamiliesStr != "" {
+		var configured map[string]string
+		if err := json.Unmarshal([]byte(chainFamiliesStr), &configured); err != nil {
+			fmt.Println("解析 CHAIN_FAMILIES 时出错:", err)
+		}
+		for chainNameOrID, family := range configured {
+			family = strings.ToLower(family)
+			if !isChainFamily(family) {
+				fmt.Printf("CHAIN_FAMILIES 中 %s 的地址格式 %s 无效\n", chainNameOrID, family)
+				continue
+			}
+			chainID, err := GetChainID(chainNameOrID)
+			if err != nil {
+				chainID = chainNameOrID
+			}
+			newChainFamilies[chainID] = family
+		}
+	}
+
+	mu.Lock()
+	chainFamilies = newChainFamilies
+	mu.Unlock()
+	fmt.Printf("非 EVM 链设置成功，长度为 %d \n", len(chainFamilies))
+}
+
+func isChainFamily(family string) bool {
+	switch family {
+	case ChainFamilyEVM, ChainFamilySolana, ChainFamilyTron, ChainFamilyTon, ChainFamilySui, ChainFamilyAptos:
+		return true
+	}
+	return false
+}
+
+// ChainFamily 返回链的地址格式，没有配置的链按 EVM 处理
+func ChainFamily(chainID string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if family, ok := chainFamilies[chainID]; ok {
+		return family
+	}
+	return ChainFamilyEVM
+}
+
+// NormalizeAddress 按链的地址格式规范化地址，只有不区分大小写的链才转为小写
+func NormalizeAddress(chainID, address string) string {
+	address = strings.TrimSpace(address)
+	if caseInsensitiveFamilies[ChainFamily(chainID)] {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+// CoinID 返回 coins 表的 ID，格式为 链ID_规范化后的地址
+func CoinID(chainID, address string) string {
+	return chainID + "_" + NormalizeAddress(chainID, address)
+}
+
+// NormalizeCoinID 规范化 链ID_地址 格式的 ID 中的地址部分
+func NormalizeCoinID(id string) string {
+	chainID, address, ok := strings.Cut(strings.TrimSpace(id), "_")
+	if !ok {
+		return id
+	}
+	return CoinID(chainID, address)
+}
+
+var (
+	evmAddressPattern         = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	moveAddressPattern        = regexp.MustCompile(`^0x[0-9a-fA-F]{1,64}$`)
+	base58AddressPattern      = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{32,44}$`)
+	tronAddressPattern        = regexp.MustCompile(`^T[1-9A-HJ-NP-Za-km-z]{33}$`)
+	tonRawAddressPattern      = regexp.MustCompile(`^-?[0-9]+:[0-9a-fA-F]{64}$`)
+	tonFriendlyAddressPattern = regexp.MustCompile(`^[A-Za-z0-9_+/-]{48}$`)
+)
+
+// eip3770ShortNames 常用链的 EIP-3770 短名称，CHAIN_MAPPING 中的名称同样可以作为地址前缀
+var eip3770ShortNames = map[string]string{
+	"eth":   "1",
+	"oeth":  "10",
+	"bnb":   "56",
+	"matic": "137",
+	"mnt":   "5000",
+	"base":  "8453",
+	"arb1":  "42161",
+	"avax":  "43114",
+	"linea": "59144",
+	"scr":   "534352",
+}
+
+// AddressError 请求中的地址无效
+type AddressError struct {
+	Address string
+	Message string
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("invalid address %s: %s", e.Address, e.Message)
+}
+
+// splitAddressPrefix 拆分 EIP-3770 格式的 shortName:0x... 地址，没有前缀时 chainID 为空
+func splitAddressPrefix(address string) (chainID, rest string, err error) {
+	shortName, rest, found := strings.Cut(address, ":")
+	// TON 的原始地址同样包含冒号，只有冒号后是 0x 地址时才视为 EIP-3770 前缀
+	if !found || !strings.HasPrefix(rest, "0x") {
+		return "", address, nil
+	}
+	if chainID, ok := eip3770ShortNames[strings.ToLower(shortName)]; ok {
+		return chainID, rest, nil
+	}
+	if chainID, err := GetChainID(shortName); err == nil {
+		return chainID, rest, nil
+	}
+	return "", "", &AddressError{Address: address, Message: "unknown chain short name " + shortName}
+}
+
+// CanonicalAddress 校验请求中的地址并返回规范化后的地址，支持 EIP-3770 的 shortName:0x... 格式。
+// chainID 为空时使用前缀对应的链，返回实际使用的链 ID
+func CanonicalAddress(chainID, address string) (string, string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return chainID, "", &AddressError{Address: address, Message: "address is required"}
+	}
+	prefixChainID, rest, err := splitAddressPrefix(address)
+	if err != nil {
+		return chainID, "", err
+	}
+	if prefixChainID != "" {
+		if chainID != "" && chainID != prefixChainID {
+			return chainID, "", &AddressError{Address: address, Message: fmt.Sprintf("prefix is chain %s but chain %s was requested", prefixChainID, chainID)}
+		}
+		chainID = prefixChainID
+	}
+	if chainID == "" {
+		return chainID, "", &AddressError{Address: address, Message: "chain is required"}
+	}
+
+	family := ChainFamily(chainID)
+	if prefixChainID != "" && family != ChainFamilyEVM {
+		return chainID, "", &AddressError{Address: address, Message: "EIP-3770 prefix is only supported on EVM chains"}
+	}
+	var valid bool
+	switch family {
+	case ChainFamilyEVM:
+		valid = evmAddressPattern.MatchString(rest)
+		// 默认按小写规范化，开启 STRICT_ADDRESS_CHECKSUM 后才拒绝校验和错误的地址
+		if valid && StrictAddressChecksum && !validChecksum(rest) {
+			return chainID, "", &AddressError{Address: address, Message: "checksum mismatch"}
+		}
+	case ChainFamilySui, ChainFamilyAptos:
+		valid = moveAddressPattern.MatchString(rest)
+	case ChainFamilySolana:
+		valid = base58AddressPattern.MatchString(rest)
+	case ChainFamilyTron:
+		valid = tronAddressPattern.MatchString(rest)
+	case ChainFamilyTon:
+		valid = tonRawAddressPattern.MatchString(rest) || tonFriendlyAddressPattern.MatchString(rest)
+	}
+	if !valid {
+		return chainID, "", &AddressError{Address: address, Message: "malformed " + family + " address"}
+	}
+	return chainID, NormalizeAddress(chainID, rest), nil
+}
+
+// validChecksum 校验 EIP-55 校验和，全小写或全大写的地址不带校验和
+func validChecksum(address string) bool {
+	hexPart := address[2:]
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return true
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(strings.ToLower(hexPart)))
+	digest := hex.EncodeToString(hash.Sum(nil))
+	for i, c := range hexPart {
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		upper := digest[i] >= '8'
+		if upper != (c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
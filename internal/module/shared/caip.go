@@ -0,0 +1,120 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// caipNamespaceEIP155 EVM 链的 CAIP-2 命名空间，reference 即链 ID
+const caipNamespaceEIP155 = "eip155"
+
+var (
+	caip2Pattern      = regexp.MustCompile(`^[-a-z0-9]{3,8}:[-_a-zA-Z0-9]{1,32}$`)
+	caipAssetPattern  = regexp.MustCompile(`^[-a-z0-9]{3,8}$`)
+	caip2ToChainID    = make(map[string]string) // 全局变量，存储非 EVM 链的 CAIP-2 ID 到链 ID 的映射
+	chainIDToCAIP2    = make(map[string]string)
+	caipAssetByFamily = map[string]string{ // 各地址格式对应的 CAIP-19 资产命名空间
+		ChainFamilyEVM:    "erc20",
+		ChainFamilySolana: "token",
+		ChainFamilyTron:   "trc20",
+		ChainFamilyTon:    "jetton",
+		ChainFamilySui:    "coin",
+		ChainFamilyAptos:  "coin",
+	}
+)
+
+// LoadCAIP2Mapping 解析环境变量 CAIP2_MAPPING，配置非 EVM 链的 CAIP-2 ID，值为链名称或链 ID
+func LoadCAIP2Mapping() {
+	caip2MappingStr := os.Getenv("CAIP2_MAPPING")
+	if caip2MappingStr == "" {
+		fmt.Println("环境变量 CAIP2_MAPPING 未设置")
+		return
+	}
+	var configured map[string]string
+	if err := json.Unmarshal([]byte(caip2MappingStr), &configured); err != nil {
+		fmt.Println("解析 CAIP2_MAPPING 时出错:", err)
+		return
+	}
+
+	newCaip2ToChainID := make(map[string]string)
+	newChainIDToCAIP2 := make(map[string]string)
+	for caip2, chainNameOrID := range configured {
+		chainID, err := GetChainID(chainNameOrID)
+		if err != nil || !caip2Pattern.MatchString(caip2) {
+			fmt.Printf("CAIP2_MAPPING 中的 %s: %s 无效\n", caip2, chainNameOrID)
+			continue
+		}
+		newCaip2ToChainID[caip2] = chainID
+		newChainIDToCAIP2[chainID] = caip2
+	}
+
+	mu.Lock()
+	caip2ToChainID = newCaip2ToChainID
+	chainIDToCAIP2 = newChainIDToCAIP2
+	mu.Unlock()
+	fmt.Printf("环境变量 CAIP2_MAPPING 设置成功，长度为 %d \n", len(caip2ToChainID))
+}
+
+// ChainIDFromCAIP2 根据 CAIP-2 ID 返回链 ID，eip155:<链ID> 直接使用 CHAIN_MAPPING 中的链
+func ChainIDFromCAIP2(caip2 string) (string, error) {
+	namespace, reference, _ := strings.Cut(caip2, ":")
+	if namespace == caipNamespaceEIP155 {
+		if chainID, err := GetChainID(reference); err == nil {
+			return chainID, nil
+		}
+	} else {
+		mu.RLock()
+		chainID, ok := caip2ToChainID[caip2]
+		mu.RUnlock()
+		if ok {
+			return chainID, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported CAIP-2 chain: %s", caip2)
+}
+
+// CAIP2 返回链的 CAIP-2 ID，非 EVM 链需要在 CAIP2_MAPPING 中配置
+func CAIP2(chainID string) (string, error) {
+	mu.RLock()
+	caip2, ok := chainIDToCAIP2[chainID]
+	mu.RUnlock()
+	if ok {
+		return caip2, nil
+	}
+	if ChainFamily(chainID) == ChainFamilyEVM {
+		return caipNamespaceEIP155 + ":" + chainID, nil
+	}
+	return "", fmt.Errorf("no CAIP-2 chain configured for %s", chainID)
+}
+
+// ParseAssetID 解析 eip155:1/erc20:0x... 格式的 CAIP-19 资产 ID，返回链 ID 及未规范化的地址
+func ParseAssetID(assetID string) (string, string, error) {
+	caip2, asset, found := strings.Cut(strings.TrimSpace(assetID), "/")
+	if !found || !caip2Pattern.MatchString(caip2) {
+		return "", "", &AddressError{Address: assetID, Message: "malformed CAIP-19 asset id"}
+	}
+	namespace, reference, found := strings.Cut(asset, ":")
+	if !found || !caipAssetPattern.MatchString(namespace) || reference == "" {
+		return "", "", &AddressError{Address: assetID, Message: "malformed CAIP-19 asset id"}
+	}
+	chainID, err := ChainIDFromCAIP2(caip2)
+	if err != nil {
+		return "", "", &AddressError{Address: assetID, Message: err.Error()}
+	}
+	if expected := caipAssetByFamily[ChainFamily(chainID)]; namespace != expected {
+		return "", "", &AddressError{Address: assetID, Message: fmt.Sprintf("asset namespace %s is not supported on %s, expected %s", namespace, caip2, expected)}
+	}
+	return chainID, reference, nil
+}
+
+// AssetID 返回代币的 CAIP-19 资产 ID
+func AssetID(chainID, address string) (string, error) {
+	caip2, err := CAIP2(chainID)
+	if err != nil {
+		return "", err
+	}
+	return caip2 + "/" + caipAssetByFamily[ChainFamily(chainID)] + ":" + NormalizeAddress(chainID, address), nil
+}
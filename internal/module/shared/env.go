@@ -18,6 +18,8 @@ var (
 	AllowApiKeyNil            = true
 	AllowApiKeyNilRateLimiter = 1000
 	AllowedTokens             = []string{"*USD*", "DAI", "*DODO", "JOJO", "*BTC*", "*ETH*", "*MATIC*", "*BNB*", "*AVAX", "*NEAR", "*XRP", "TON*", "*ARB", "ENS"} // 设置默认值
+	// 是否拒绝 EIP-55 校验和错误的混合大小写 EVM 地址
+	StrictAddressChecksum = false
 	//拒绝的链ID
 	RefuseChainIdMap = map[string]int{
 		"128": 1,
@@ -34,6 +36,9 @@ type USDTAddress struct {
 // LoadEnv 加载 .env 文件中的环境变量，并更新链映射
 func LoadEnv() (struct{}, error) {
 	UpdateChainMapping()
+	LoadChainFamilies()
+	LoadStrictAddressChecksum()
+	LoadCAIP2Mapping()
 	LoadAllowApiKey()
 	LoadUSDTAddresses()
 	LoadDodoexRouteUrl()
@@ -51,6 +56,12 @@ func LoadAllowApiKey() {
 	fmt.Printf("AllowApiKeyNilRateLimiter is %d\n", AllowApiKeyNilRateLimiter)
 }
 
+// LoadStrictAddressChecksum 解析环境变量 STRICT_ADDRESS_CHECKSUM，默认不校验混合大小写地址的校验和
+func LoadStrictAddressChecksum() {
+	StrictAddressChecksum = os.Getenv("STRICT_ADDRESS_CHECKSUM") == "true"
+	fmt.Printf("StrictAddressChecksum is %t\n", StrictAddressChecksum)
+}
+
 // UpdateChainMapping 解析环境变量 CHAIN_MAPPING 并更新全局映射
 func UpdateChainMapping() {
 	chainMappingStr := os.Getenv("CHAIN_MAPPING")
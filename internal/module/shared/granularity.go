@@ -0,0 +1,99 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 历史价格粒度
+const (
+	GranularityDay        = "1d"
+	GranularityHour       = "1h"
+	GranularityFiveMinute = "5m"
+)
+
+// 各粒度的时间段在 day_date 及缓存 key 中的格式，小时和 5 分钟的格式长度不同，互不冲突
+const (
+	dayBucketLayout        = "02-01-2006"
+	hourBucketLayout       = "02-01-2006 15"
+	fiveMinuteBucketLayout = "02-01-2006 15:04"
+)
+
+// ParseGranularity 解析请求中的粒度，为空时按天
+func ParseGranularity(granularity string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(granularity)) {
+	case "", GranularityDay, "day":
+		return GranularityDay, nil
+	case GranularityHour, "hour":
+		return GranularityHour, nil
+	case GranularityFiveMinute, "5min", "minute5":
+		return GranularityFiveMinute, nil
+	}
+	return "", fmt.Errorf("unsupported granularity: %s", granularity)
+}
+
+// ParseCandleTimeframe 解析 K 线周期，只支持按天和按小时，为空时按天
+func ParseCandleTimeframe(timeframe string) (string, error) {
+	granularity, err := ParseGranularity(timeframe)
+	if err != nil || granularity == GranularityFiveMinute {
+		return "", fmt.Errorf("unsupported timeframe: %s", timeframe)
+	}
+	return granularity, nil
+}
+
+// GranularityDuration 返回粒度对应的时间段长度
+func GranularityDuration(granularity string) time.Duration {
+	switch granularity {
+	case GranularityHour:
+		return time.Hour
+	case GranularityFiveMinute:
+		return 5 * time.Minute
+	}
+	return 24 * time.Hour
+}
+
+// IsIntraday 粒度是否小于一天
+func IsIntraday(granularity string) bool {
+	return granularity == GranularityHour || granularity == GranularityFiveMinute
+}
+
+// BucketStart 返回时间戳所在时间段的起始时间戳。各粒度都与 day_date 一致按本地时区对齐，
+// 本地时区与 UTC 相差半小时时，小时时间段也不会跨越两天
+func BucketStart(granularity string, unixTimeStamp int64) int64 {
+	t := time.Unix(unixTimeStamp, 0)
+	if !IsIntraday(granularity) {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Unix()
+	}
+	_, offset := t.Zone()
+	seconds := int64(GranularityDuration(granularity).Seconds())
+	local := unixTimeStamp + int64(offset)
+	return local - local%seconds - int64(offset)
+}
+
+// BucketDate 返回时间戳所在时间段的 day_date，按天时为 dd-mm-yyyy
+func BucketDate(granularity string, unixTimeStamp int64) string {
+	switch granularity {
+	case GranularityHour:
+		return time.Unix(BucketStart(granularity, unixTimeStamp), 0).Format(hourBucketLayout)
+	case GranularityFiveMinute:
+		return time.Unix(BucketStart(granularity, unixTimeStamp), 0).Format(fiveMinuteBucketLayout)
+	}
+	return time.Unix(unixTimeStamp, 0).Format(dayBucketLayout)
+}
+
+// BucketGranularity 根据 day_date 的格式返回其粒度
+func BucketGranularity(bucketDate string) string {
+	switch len(bucketDate) {
+	case len(hourBucketLayout):
+		return GranularityHour
+	case len(fiveMinuteBucketLayout):
+		return GranularityFiveMinute
+	}
+	return GranularityDay
+}
+
+// IsCurrentBucket day_date 是否为当前尚未结束的时间段
+func IsCurrentBucket(bucketDate string) bool {
+	return bucketDate == BucketDate(BucketGranularity(bucketDate), time.Now().Unix())
+}
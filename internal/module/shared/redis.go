@@ -22,6 +22,9 @@ const (
 	redisCurrentPricePrefix             = "price:current:"
 	redisHistoricalPricePrefix          = "price:historical:"
 	redisHistoricalPriceExistencePrefix = "price:historical:exists:"
+	redisCurrencyPricePrefix            = "price:currency:"
+	redisFxRatePrefix                   = "fx:rate:"
+	currentPriceCacheTTL                = 10 * time.Minute
 	batchSize                           = 1000
 	maxRetries                          = 3
 )
@@ -188,7 +191,12 @@ func (r *RedisClient) ReleaseLock(lockKey string) {
 
 func (r *RedisClient) SetCurrentPriceCache(coinID string, price string) error {
 	cacheKey := redisCurrentPricePrefix + coinID
-	return r.Client.Set(context.Background(), cacheKey, price, 10*time.Minute).Err()
+	return r.Client.Set(context.Background(), cacheKey, price, currentPriceCacheTTL).Err()
+}
+
+// DeleteCurrentPriceCache 删除币种的当前价格缓存
+func (r *RedisClient) DeleteCurrentPriceCache(coinID string) error {
+	return r.Client.Del(context.Background(), redisCurrentPricePrefix+coinID).Err()
 }
 
 func (r *RedisClient) GetCurrentPricesCache(coinIDs []string) (map[string]string, error) {
@@ -207,11 +215,39 @@ func (r *RedisClient) GetCurrentPriceCache(coinID string) (string, error) {
 	return r.Client.Get(context.Background(), cacheKey).Result()
 }
 
+// GetCurrentPriceCacheAges 根据剩余 TTL 计算当前价格缓存已存在的秒数，缓存不存在的币种不返回
+func (r *RedisClient) GetCurrentPriceCacheAges(coinIDs []string) map[string]int64 {
+	ages := make(map[string]int64)
+	if len(coinIDs) == 0 {
+		return ages
+	}
+	ctx := context.Background()
+	pipe := r.Client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(coinIDs))
+	for i, coinID := range coinIDs {
+		ttls[i] = pipe.TTL(ctx, redisCurrentPricePrefix+coinID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		r.logger.Debug().Err(err).Msg("获取当前价格缓存 TTL 失败")
+		return ages
+	}
+	for i, coinID := range coinIDs {
+		if ttl, err := ttls[i].Result(); err == nil && ttl > 0 {
+			ages[coinID] = int64((currentPriceCacheTTL - ttl).Seconds())
+		}
+	}
+	return ages
+}
+
 func (r *RedisClient) SetHistoricalPriceCache(coinID string, dayDate string, price string) error {
 	cacheKey := redisHistoricalPricePrefix + coinID + "_" + dayDate
 	cacheDuration := 72 * time.Hour
-	if dayDate == time.Now().Format("02-01-2006") {
+	if IsCurrentBucket(dayDate) {
+		// 当前时间段的价格还会变化，小时及 5 分钟粒度只缓存到时间段结束
 		cacheDuration = 24 * time.Hour
+		if granularity := BucketGranularity(dayDate); IsIntraday(granularity) {
+			cacheDuration = GranularityDuration(granularity)
+		}
 	}
 	//是否存在历史的缓存标记
 	r.Client.Set(context.Background(), redisHistoricalPriceExistencePrefix+coinID, "1", 24*7*time.Hour)
@@ -230,3 +266,43 @@ func (r *RedisClient) HasHistoricalPriceCache(coinID string) (bool, error) {
 	}
 	return have == "1", nil
 }
+
+// SetCurrencyPriceCache 缓存数据源原生的非 USD 报价，dayDate 为空时表示当前价格
+func (r *RedisClient) SetCurrencyPriceCache(currency, coinID, dayDate, price string) error {
+	cacheKey := redisCurrencyPricePrefix + currency + ":" + coinID
+	cacheDuration := currentPriceCacheTTL
+	if dayDate != "" {
+		cacheKey += "_" + dayDate
+		cacheDuration = 72 * time.Hour
+	}
+	return r.Client.Set(context.Background(), cacheKey, price, cacheDuration).Err()
+}
+
+// GetCurrencyPriceCache 读取数据源原生的非 USD 报价，dayDate 为空时表示当前价格
+func (r *RedisClient) GetCurrencyPriceCache(currency, coinID, dayDate string) (string, error) {
+	cacheKey := redisCurrencyPricePrefix + currency + ":" + coinID
+	if dayDate != "" {
+		cacheKey += "_" + dayDate
+	}
+	return r.Client.Get(context.Background(), cacheKey).Result()
+}
+
+// SetFxRateCache 缓存汇率，dayDate 为空时表示当前汇率
+func (r *RedisClient) SetFxRateCache(currency, dayDate, rate string) error {
+	cacheKey := redisFxRatePrefix + currency
+	cacheDuration := currentPriceCacheTTL
+	if dayDate != "" {
+		cacheKey += "_" + dayDate
+		cacheDuration = 72 * time.Hour
+	}
+	return r.Client.Set(context.Background(), cacheKey, rate, cacheDuration).Err()
+}
+
+// GetFxRateCache 读取汇率缓存，dayDate 为空时表示当前汇率
+func (r *RedisClient) GetFxRateCache(currency, dayDate string) (string, error) {
+	cacheKey := redisFxRatePrefix + currency
+	if dayDate != "" {
+		cacheKey += "_" + dayDate
+	}
+	return r.Client.Get(context.Background(), cacheKey).Result()
+}
@@ -0,0 +1,404 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DODOEX/token-price-proxy/utils/config"
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// RpcError 节点返回的 JSON-RPC 错误，eth_call 执行 revert 时也会返回该错误
+type RpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// RpcClient 使用 loadbalances 中配置的节点发起 JSON-RPC 请求，节点按 weight 从高到低依次重试
+type RpcClient struct {
+	endpoints        map[string][]*config.EndpointInfo
+	archiveEndpoints map[string][]*config.EndpointInfo
+	client           *http.Client
+	requestID        atomic.Int64
+	decimals         sync.Map
+	logger           zerolog.Logger
+}
+
+func NewRpcClient(cfg *koanf.Koanf, logger zerolog.Logger) *RpcClient {
+	var chains []config.Chain
+	if err := cfg.Unmarshal("loadbalances", &chains); err != nil {
+		logger.Error().Err(err).Msg("解析 loadbalances 配置失败")
+	}
+
+	c := &RpcClient{
+		endpoints:        make(map[string][]*config.EndpointInfo),
+		archiveEndpoints: make(map[string][]*config.EndpointInfo),
+		client:           &http.Client{Timeout: 10 * time.Second},
+		logger:           logger,
+	}
+	for _, chain := range chains {
+		chainId := strconv.Itoa(chain.ChainID)
+		endpoints := chain.Endpoints
+		var archive []*config.EndpointInfo
+		if chain.Services != nil {
+			if len(chain.Services.Activenode.Endpoints) > 0 {
+				endpoints = chain.Services.Activenode.Endpoints
+			}
+			archive = chain.Services.Fullnode.Endpoints
+			if len(endpoints) == 0 {
+				endpoints = archive
+			}
+		}
+		if len(archive) == 0 {
+			archive = endpoints
+		}
+		if len(endpoints) == 0 {
+			continue
+		}
+		c.endpoints[chainId] = sortEndpoints(endpoints)
+		c.archiveEndpoints[chainId] = sortEndpoints(archive)
+	}
+	return c
+}
+
+func sortEndpoints(endpoints []*config.EndpointInfo) []*config.EndpointInfo {
+	sorted := make([]*config.EndpointInfo, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint != nil && endpoint.Url != "" {
+			sorted = append(sorted, endpoint)
+		}
+	}
+	weight := func(e *config.EndpointInfo) int {
+		if e.Weight == nil {
+			return 1
+		}
+		return *e.Weight
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return weight(sorted[i]) > weight(sorted[j])
+	})
+	return sorted
+}
+
+// HasChain 是否配置了该链的节点
+func (c *RpcClient) HasChain(chainId string) bool {
+	return len(c.endpoints[chainId]) > 0
+}
+
+// Call 发起 JSON-RPC 请求，archive 为 true 时优先使用 fullnode 节点
+func (c *RpcClient) Call(chainId string, archive bool, method string, params []any, result any) error {
+	endpoints := c.endpoints[chainId]
+	if archive {
+		endpoints = c.archiveEndpoints[chainId]
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no rpc endpoint configured for chain %s", chainId)
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      c.requestID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range endpoints {
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  *RpcError       `json:"error"`
+		}
+		body, err := c.post(endpoint, payload)
+		if err == nil {
+			err = ParseJSONResponse(body, &resp)
+		}
+		if err != nil {
+			c.logger.Debug().Err(err).Msgf("rpc 请求失败, chainId: %s, method: %s", chainId, method)
+			lastErr = err
+			continue
+		}
+		// 节点返回的执行错误与节点无关，不再重试其他节点
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+	return lastErr
+}
+
+func (c *RpcClient) post(endpoint *config.EndpointInfo, payload []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.Url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if endpoint.Headers != nil {
+		for key, value := range *endpoint.Headers {
+			req.Header.Set(key, value)
+		}
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rpc request failed, status code: %d, response: %s", res.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// EthCall 调用合约只读方法，blockNumber 为 0 时使用最新区块，返回 ABI 编码的结果
+func (c *RpcClient) EthCall(chainId, to, data string, blockNumber uint64) (string, error) {
+	block := "latest"
+	if blockNumber > 0 {
+		block = "0x" + strconv.FormatUint(blockNumber, 16)
+	}
+	var result string
+	err := c.Call(chainId, blockNumber > 0, "eth_call", []any{map[string]string{"to": to, "data": data}, block}, &result)
+	return result, err
+}
+
+// blockHeader 读取区块号和区块时间，blockNumber 为 0 时读取最新区块
+func (c *RpcClient) blockHeader(chainId string, blockNumber uint64) (uint64, int64, error) {
+	block := "latest"
+	if blockNumber > 0 {
+		block = "0x" + strconv.FormatUint(blockNumber, 16)
+	}
+	var header *struct {
+		Number    string `json:"number"`
+		Timestamp string `json:"timestamp"`
+	}
+	if err := c.Call(chainId, false, "eth_getBlockByNumber", []any{block, false}, &header); err != nil {
+		return 0, 0, err
+	}
+	if header == nil {
+		return 0, 0, fmt.Errorf("block %s not found on chain %s", block, chainId)
+	}
+	number, err := strconv.ParseUint(strings.TrimPrefix(header.Number, "0x"), 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	timestamp, err := strconv.ParseInt(strings.TrimPrefix(header.Timestamp, "0x"), 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return number, timestamp, nil
+}
+
+// BlockTimestamp 返回区块时间，blockNumber 为 0 时返回最新区块的时间
+func (c *RpcClient) BlockTimestamp(chainId string, blockNumber uint64) (int64, error) {
+	_, timestamp, err := c.blockHeader(chainId, blockNumber)
+	return timestamp, err
+}
+
+// BlockNumberAt 二分查找区块时间不晚于 unixTimeStamp 的最后一个区块
+func (c *RpcClient) BlockNumberAt(chainId string, unixTimeStamp int64) (uint64, error) {
+	latest, latestTime, err := c.blockHeader(chainId, 0)
+	if err != nil {
+		return 0, err
+	}
+	if latestTime <= unixTimeStamp {
+		return latest, nil
+	}
+	lo, hi := uint64(1), latest
+	if _, firstTime, err := c.blockHeader(chainId, lo); err != nil {
+		return 0, err
+	} else if firstTime > unixTimeStamp {
+		return 0, fmt.Errorf("timestamp %d is before the first block of chain %s", unixTimeStamp, chainId)
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		_, midTime, err := c.blockHeader(chainId, mid)
+		if err != nil {
+			return 0, err
+		}
+		if midTime <= unixTimeStamp {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// Decimals 读取合约的 decimals()，结果不会变化，缓存在内存中
+func (c *RpcClient) Decimals(chainId, address string) (int, error) {
+	key := chainId + "_" + strings.ToLower(address)
+	if decimals, ok := c.decimals.Load(key); ok {
+		return decimals.(int), nil
+	}
+	data, err := c.EthCall(chainId, address, "0x313ce567", 0)
+	if err != nil {
+		return 0, err
+	}
+	words, err := AbiWords(data)
+	if err != nil || len(words) == 0 {
+		return 0, fmt.Errorf("invalid decimals response from %s: %s", address, data)
+	}
+	decimals := int(words[0].Int64())
+	c.decimals.Store(key, decimals)
+	return decimals, nil
+}
+
+// Erc20Metadata ERC-20 合约的基础信息，读取失败的字段为空
+type Erc20Metadata struct {
+	Symbol      *string
+	Name        *string
+	Decimals    *int
+	TotalSupply *string // 最小单位的数量
+}
+
+// Erc20Metadata 读取合约的 symbol()、name()、decimals() 和 totalSupply()，全部读取失败时返回错误
+func (c *RpcClient) Erc20Metadata(chainId, address string) (*Erc20Metadata, error) {
+	metadata := &Erc20Metadata{}
+	var lastErr error
+	readString := func(selector string) *string {
+		data, err := c.EthCall(chainId, address, selector, 0)
+		if err == nil {
+			var value string
+			if value, err = AbiString(data); err == nil && value != "" {
+				return &value
+			}
+		}
+		lastErr = err
+		return nil
+	}
+	metadata.Symbol = readString("0x95d89b41")
+	metadata.Name = readString("0x06fdde03")
+	if decimals, err := c.Decimals(chainId, address); err == nil {
+		metadata.Decimals = &decimals
+	} else {
+		lastErr = err
+	}
+	if data, err := c.EthCall(chainId, address, "0x18160ddd", 0); err == nil {
+		if words, err := AbiWords(data); err == nil && len(words) > 0 {
+			totalSupply := words[0].String()
+			metadata.TotalSupply = &totalSupply
+		}
+	} else {
+		lastErr = err
+	}
+	if metadata.Symbol == nil && metadata.Name == nil && metadata.Decimals == nil && metadata.TotalSupply == nil {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no erc20 metadata returned by %s", address)
+		}
+		return nil, lastErr
+	}
+	return metadata, nil
+}
+
+// AbiString 解析返回值中的 string，兼容返回 bytes32 的旧合约
+func AbiString(data string) (string, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return "", err
+	}
+	if len(raw) == 32 {
+		return strings.ToValidUTF8(strings.TrimRight(string(raw), "\x00"), ""), nil
+	}
+	if len(raw) < 64 {
+		return "", fmt.Errorf("invalid abi string length: %d", len(raw))
+	}
+	offset := new(big.Int).SetBytes(raw[:32])
+	if !offset.IsInt64() || offset.Int64()+32 > int64(len(raw)) {
+		return "", fmt.Errorf("invalid abi string offset: %s", offset)
+	}
+	start := offset.Int64() + 32
+	length := new(big.Int).SetBytes(raw[start-32 : start])
+	if !length.IsInt64() || start+length.Int64() > int64(len(raw)) {
+		return "", fmt.Errorf("invalid abi string length: %s", length)
+	}
+	return strings.ToValidUTF8(string(raw[start:start+length.Int64()]), ""), nil
+}
+
+// AbiWords 将 ABI 编码的返回值拆分为 32 字节的无符号整数
+func AbiWords(data string) ([]*big.Int, error) {
+	data = strings.TrimPrefix(data, "0x")
+	if len(data)%64 != 0 {
+		return nil, fmt.Errorf("invalid abi data length: %d", len(data))
+	}
+	words := make([]*big.Int, 0, len(data)/64)
+	for i := 0; i < len(data); i += 64 {
+		word, ok := new(big.Int).SetString(data[i:i+64], 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid abi data: %s", data[i:i+64])
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+// AbiInt 将 32 字节的字按 int256 解析为有符号整数
+func AbiInt(word *big.Int) *big.Int {
+	if word.Bit(255) == 0 {
+		return new(big.Int).Set(word)
+	}
+	return new(big.Int).Sub(word, new(big.Int).Lsh(big.NewInt(1), 256))
+}
+
+// AbiAddress 将 32 字节的字解析为小写地址
+func AbiAddress(word *big.Int) string {
+	return fmt.Sprintf("0x%040x", word)
+}
+
+// AbiAddressArray 解析返回值中第 index 个字指向的 address[] 动态数组
+func AbiAddressArray(words []*big.Int, index int) ([]string, error) {
+	if index >= len(words) || !words[index].IsInt64() || words[index].Int64()%32 != 0 {
+		return nil, fmt.Errorf("invalid abi array offset at %d", index)
+	}
+	start := int(words[index].Int64() / 32)
+	if start >= len(words) || !words[start].IsInt64() || start+1+int(words[start].Int64()) > len(words) {
+		return nil, fmt.Errorf("invalid abi array at %d", start)
+	}
+	addresses := make([]string, 0, words[start].Int64())
+	for _, word := range words[start+1 : start+1+int(words[start].Int64())] {
+		addresses = append(addresses, AbiAddress(word))
+	}
+	return addresses, nil
+}
+
+// AbiEncodeUint 将无符号整数编码为 32 字节的十六进制参数
+func AbiEncodeUint(value *big.Int) string {
+	return fmt.Sprintf("%064x", value)
+}
+
+// AbiEncodeAddress 将地址编码为 32 字节的十六进制参数
+func AbiEncodeAddress(address string) string {
+	return fmt.Sprintf("%064s", strings.ToLower(strings.TrimPrefix(address, "0x")))
+}
+
+// FormatUnits 按精度将整数转换为十进制字符串，去掉末尾的 0
+func FormatUnits(value *big.Int, decimals int) string {
+	if decimals <= 0 {
+		return new(big.Int).Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-decimals)), nil)).String()
+	}
+	str := new(big.Rat).SetFrac(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)).FloatString(decimals)
+	if strings.Contains(str, ".") {
+		str = strings.TrimRight(strings.TrimRight(str, "0"), ".")
+	}
+	return str
+}
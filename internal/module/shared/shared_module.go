@@ -11,5 +11,6 @@ var NewSharedModule = fx.Options(
 	fx.Provide(NewRedisClient),
 	fx.Invoke(LoadEnv),
 	fx.Provide(NewCoinsThrottler),
+	fx.Provide(NewRpcClient),
 	// fx.Provide(NewRabbitMQ),
 )
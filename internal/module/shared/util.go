@@ -84,3 +84,17 @@ func ParseJSONResponse(body []byte, result interface{}) error {
 
 	return nil
 }
+
+// Pick 按下标取出 values 中的元素，values 为空时返回 nil，越界的下标取零值
+func Pick[T any](values []T, indexes []int) []T {
+	if len(values) == 0 {
+		return nil
+	}
+	picked := make([]T, len(indexes))
+	for i, index := range indexes {
+		if index < len(values) {
+			picked[i] = values[index]
+		}
+	}
+	return picked
+}
@@ -23,5 +23,6 @@ func (r *Router) Register() {
 	r.PriceRouter.RegisterPriceRoutes()
 	r.PriceRouter.RegisterCoinsRoutes()
 	r.PriceRouter.RegisterAppTokenRoutes()
+	r.PriceRouter.RegisterBackfillRoutes()
 
 }
@@ -18,6 +18,7 @@ CREATE TABLE coin_historical_prices (
     coin_id    VARCHAR(255) NOT NULL,
     date       BIGINT NOT NULL,
     day_date   VARCHAR(255) NOT NULL,
+    granularity VARCHAR(16) DEFAULT '1d'::character varying NOT NULL,
     price      VARCHAR(255) NOT NULL,
     source     VARCHAR(255) DEFAULT ''::character varying NOT NULL,
     query_info JSON,
@@ -31,6 +32,8 @@ CREATE TABLE coin_historical_prices (
 -- 添加索引
 CREATE INDEX idx_coin_historical_prices_coin_id_day_date ON coin_historical_prices (coin_id, day_date);
 CREATE INDEX idx_coin_historical_prices_day_date ON coin_historical_prices (day_date);
+CREATE INDEX idx_coin_historical_prices_coin_id_granularity_date ON coin_historical_prices (coin_id, granularity, date);
+CREATE INDEX idx_coin_historical_prices_granularity_date ON coin_historical_prices (granularity, date);
 
 -- coins 表
 CREATE TABLE coins (
@@ -54,6 +57,8 @@ CREATE TABLE coins (
     last_price_source     VARCHAR(255),
     price_source          VARCHAR(255),
     return_coins_id       VARCHAR(255),
+    wrapper_rule          JSON,
+    formula               TEXT,
     created_at            TIMESTAMPTZ,
     updated_at            TIMESTAMPTZ,
     deleted_at            TIMESTAMPTZ
@@ -203,6 +208,127 @@ CREATE TABLE slack_notifications (
                                      CONSTRAINT unique_notification UNIQUE (coin_id, day_date)
 );
 
+-- rejected_prices 表，价格校验拒绝的报价
+CREATE TABLE rejected_prices (
+    coin_id         VARCHAR(255) NOT NULL,
+    source          VARCHAR(255) NOT NULL,
+    price           VARCHAR(255) NOT NULL,
+    reference_price VARCHAR(255) NOT NULL,
+    deviation       DOUBLE PRECISION NOT NULL,
+    tier            VARCHAR(255) DEFAULT ''::character varying NOT NULL,
+    mode            VARCHAR(255) DEFAULT ''::character varying NOT NULL,
+    date            BIGINT NOT NULL,
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ
+);
+
+CREATE INDEX idx_rejected_prices_coin_id ON rejected_prices (coin_id);
+
+-- fx_rates 表，1 USD 兑换各计价货币的汇率
+CREATE TABLE fx_rates (
+    currency   VARCHAR(32) NOT NULL,
+    rate       VARCHAR(255) NOT NULL,
+    date       BIGINT NOT NULL,
+    day_date   VARCHAR(255) NOT NULL,
+    source     VARCHAR(255) DEFAULT ''::character varying NOT NULL,
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    CONSTRAINT unique_fx_currency_day_date UNIQUE (currency, day_date)
+);
+
+-- cex_symbols 表，coins 与交易所交易对的映射
+CREATE TABLE cex_symbols (
+    coin_id    VARCHAR(255) NOT NULL,
+    symbol     VARCHAR(255) NOT NULL,
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    CONSTRAINT idx_cex_symbols_coin_id UNIQUE (coin_id)
+);
+
+-- coin_candles 表，代币按天及按小时的 OHLCV K 线
+CREATE TABLE coin_candles (
+    coin_id    VARCHAR(255) NOT NULL,
+    timeframe  VARCHAR(16) NOT NULL,
+    timestamp  BIGINT NOT NULL,
+    open       VARCHAR(255) NOT NULL,
+    high       VARCHAR(255) NOT NULL,
+    low        VARCHAR(255) NOT NULL,
+    close      VARCHAR(255) NOT NULL,
+    volume     VARCHAR(255) DEFAULT '0'::character varying NOT NULL,
+    source     VARCHAR(255) DEFAULT ''::character varying NOT NULL,
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    CONSTRAINT unique_coin_candle UNIQUE (coin_id, timeframe, timestamp)
+);
+
+-- coin_market_data 表，代币按天保存的市值、完全稀释估值、24 小时成交额及流动性
+CREATE TABLE coin_market_data (
+    coin_id                 VARCHAR(255) NOT NULL,
+    date                    BIGINT NOT NULL,
+    day_date                VARCHAR(255) NOT NULL,
+    market_cap              VARCHAR(255),
+    fully_diluted_valuation VARCHAR(255),
+    volume_24h              VARCHAR(255),
+    liquidity               VARCHAR(255),
+    source                  VARCHAR(255) DEFAULT ''::character varying NOT NULL,
+    id                      BIGSERIAL PRIMARY KEY,
+    created_at              TIMESTAMPTZ,
+    updated_at              TIMESTAMPTZ,
+    deleted_at              TIMESTAMPTZ,
+    CONSTRAINT unique_coin_market_data UNIQUE (coin_id, day_date)
+);
+
+-- coin_request_counts 表，由请求日志按代币和日期汇总的请求次数，用于代币搜索的排序
+CREATE TABLE coin_request_counts (
+    coin_id    VARCHAR(255) NOT NULL,
+    date       BIGINT NOT NULL,
+    count      BIGINT DEFAULT 0 NOT NULL,
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    CONSTRAINT unique_coin_request_count UNIQUE (coin_id, date)
+);
+
+CREATE INDEX idx_coin_request_counts_date ON coin_request_counts (date);
+
+-- 代币搜索按 LOWER(symbol)、LOWER(name) 做 LIKE 匹配，三元组索引用于前缀匹配及包含关键字的查询
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_coins_symbol_trgm ON coins USING gin (LOWER(symbol) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_coins_name_trgm ON coins USING gin (LOWER(name) gin_trgm_ops);
+
+-- backfill_jobs 表，历史价格回填任务及其检查点
+CREATE TABLE backfill_jobs (
+    coin_ids    JSON NOT NULL,
+    from_time   BIGINT NOT NULL,
+    to_time     BIGINT NOT NULL,
+    granularity VARCHAR(16) DEFAULT '1d'::character varying NOT NULL,
+    status      VARCHAR(32) NOT NULL,
+    coin_index  INT DEFAULT 0 NOT NULL,
+    cursor      BIGINT DEFAULT 0 NOT NULL,
+    attempts    INT DEFAULT 0 NOT NULL,
+    filled      BIGINT DEFAULT 0 NOT NULL,
+    missing     BIGINT DEFAULT 0 NOT NULL,
+    skipped     BIGINT DEFAULT 0 NOT NULL,
+    last_error  TEXT DEFAULT ''::text NOT NULL,
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX idx_backfill_jobs_status ON backfill_jobs (status);
+
 UPDATE coins
 SET price_source = 'coingecko'
 WHERE coingecko_coin_id IS NOT NULL;